@@ -0,0 +1,31 @@
+package blockdev
+
+import "errors"
+
+// ErrChunkNotFound is returned when reading a chunk that has never been written.
+var ErrChunkNotFound = errors.New("chunk not found")
+
+// Device is the storage backing a single simulated disk.
+// It stores fixed-size chunks addressed by their index on the disk.
+type Device interface {
+	// ReadChunk returns a copy of the chunk at index.
+	ReadChunk(index int) ([]byte, error)
+	// WriteChunk stores chunk at index, growing the device if needed. Chunks skipped over are
+	// holes that read back as zeros without taking up space.
+	WriteChunk(index int, chunk []byte) error
+	// Discard releases the storage of the chunk at index, which reads back as zeros afterwards.
+	// Discarding a chunk past the end of the device does nothing.
+	Discard(index int) error
+	// ChunkCount returns the number of chunks up to the last one written, holes included.
+	ChunkCount() int
+	// AllocatedChunks returns the number of chunks taking up space, i.e. written and not discarded since.
+	AllocatedChunks() int
+	// Allocated reports whether the chunk at index takes up space. Holes read back as zeros.
+	Allocated(index int) bool
+	// ChunkSize returns the size in bytes of every chunk on the device.
+	ChunkSize() int
+	// Wipe discards every chunk, leaving the device blank.
+	Wipe() error
+	// Close releases any resources held by the device.
+	Close() error
+}
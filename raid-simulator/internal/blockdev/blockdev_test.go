@@ -0,0 +1,160 @@
+package blockdev_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/stretchr/testify/assert"
+)
+
+func testDevice(t *testing.T, dev blockdev.Device) {
+	assert.Equal(t, 0, dev.ChunkCount())
+	assert.Equal(t, 4, dev.ChunkSize())
+
+	_, err := dev.ReadChunk(0)
+	assert.ErrorIs(t, err, blockdev.ErrChunkNotFound)
+
+	// Writing past the end grows the device, leaving holes that read back as zeros
+	assert.NoError(t, dev.WriteChunk(2, []byte("WXYZ")))
+	assert.Equal(t, 3, dev.ChunkCount())
+	assert.Equal(t, 1, dev.AllocatedChunks())
+	assert.True(t, dev.Allocated(2))
+	assert.False(t, dev.Allocated(0), "a hole")
+	assert.False(t, dev.Allocated(-1))
+
+	chunk, err := dev.ReadChunk(0)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, 4), chunk)
+
+	chunk, err = dev.ReadChunk(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("WXYZ"), chunk)
+
+	// Returned chunks are copies
+	chunk[0] = 'A'
+	chunk, err = dev.ReadChunk(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("WXYZ"), chunk)
+
+	assert.Error(t, dev.WriteChunk(0, []byte("TOO_LONG")))
+	assert.Error(t, dev.WriteChunk(-1, []byte("ABCD")))
+
+	// Discarded chunks read back as zeros and stop taking up space
+	assert.NoError(t, dev.WriteChunk(0, []byte("ABCD")))
+	assert.Equal(t, 2, dev.AllocatedChunks())
+	assert.NoError(t, dev.Discard(2))
+	assert.NoError(t, dev.Discard(7), "past the end")
+	assert.Equal(t, 3, dev.ChunkCount())
+	assert.Equal(t, 1, dev.AllocatedChunks())
+	assert.False(t, dev.Allocated(2))
+	chunk, err = dev.ReadChunk(2)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, 4), chunk)
+	assert.Error(t, dev.Discard(-1))
+
+	assert.NoError(t, dev.Wipe())
+	assert.Equal(t, 0, dev.ChunkCount())
+	assert.Zero(t, dev.AllocatedChunks())
+}
+
+func TestMemory(t *testing.T) {
+	dev := blockdev.NewMemory(4)
+	testDevice(t, dev)
+	assert.NoError(t, dev.Close())
+}
+
+func TestFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	dev, err := blockdev.OpenFile(path, 4)
+	assert.NoError(t, err)
+	testDevice(t, dev)
+	assert.Equal(t, path, dev.Path())
+	assert.NoError(t, dev.Close())
+}
+
+func TestFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	dev, err := blockdev.OpenFile(path, 4)
+	assert.NoError(t, err)
+	assert.NoError(t, dev.WriteChunk(1, []byte("ABCD")))
+	assert.NoError(t, dev.Close())
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(8), info.Size())
+
+	dev, err = blockdev.OpenFile(path, 4)
+	assert.NoError(t, err)
+	defer dev.Close()
+	assert.Equal(t, 2, dev.ChunkCount())
+	chunk, err := dev.ReadChunk(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ABCD"), chunk)
+}
+
+func TestFile_Header(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	dev, err := blockdev.OpenFileWithHeader(path, 4)
+	assert.NoError(t, err)
+	testDevice(t, dev)
+
+	header, err := dev.ReadHeader()
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, blockdev.HeaderSize), header, "never written")
+	assert.NoError(t, dev.WriteHeader([]byte("metadata")))
+	assert.Equal(t, 0, dev.ChunkCount(), "the header holds no chunks")
+	assert.NoError(t, dev.WriteChunk(0, []byte("ABCD")))
+	assert.Error(t, dev.WriteHeader(make([]byte, blockdev.HeaderSize+1)))
+	assert.NoError(t, dev.Close())
+
+	// Chunks start after the header
+	raw, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Len(t, raw, blockdev.HeaderSize+4)
+	assert.Equal(t, []byte("ABCD"), raw[blockdev.HeaderSize:])
+
+	header, err = blockdev.ReadImageHeader(path)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("metadata"), header[:8])
+
+	// Images opened without a header have none to read
+	dev, err = blockdev.OpenFile(filepath.Join(t.TempDir(), "plain.img"), 4)
+	assert.NoError(t, err)
+	defer dev.Close()
+	_, err = dev.ReadHeader()
+	assert.Error(t, err)
+}
+
+func TestFile_AllocationMapPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "disk.img")
+	dev, err := blockdev.OpenFile(path, 4)
+	assert.NoError(t, err)
+	assert.NoError(t, dev.WriteChunk(0, []byte("ABCD")))
+	assert.NoError(t, dev.WriteChunk(1, []byte("EFGH")))
+	assert.NoError(t, dev.WriteChunk(9, []byte("IJKL")))
+	assert.NoError(t, dev.Discard(1))
+	assert.NoError(t, dev.Close())
+
+	dev, err = blockdev.OpenFile(path, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, dev.ChunkCount())
+	assert.Equal(t, 2, dev.AllocatedChunks())
+	chunk, err := dev.ReadChunk(1)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, 4), chunk)
+	assert.NoError(t, dev.Close())
+
+	// Images written before allocation was tracked count every chunk as allocated
+	assert.NoError(t, os.Remove(path+blockdev.AllocationMapSuffix))
+	dev, err = blockdev.OpenFile(path, 4)
+	assert.NoError(t, err)
+	defer dev.Close()
+	assert.Equal(t, 10, dev.AllocatedChunks())
+}
+
+func TestFile_InvalidChunkSize(t *testing.T) {
+	_, err := blockdev.OpenFile(filepath.Join(t.TempDir(), "disk.img"), 0)
+	assert.Error(t, err)
+}
@@ -0,0 +1,231 @@
+package blockdev
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// AllocationMapSuffix is appended to the path of a disk image to get the file recording which of its chunks are allocated.
+const AllocationMapSuffix = ".alloc"
+
+// HeaderSize is the space reserved at the start of images opened with OpenFileWithHeader, ahead of their first chunk.
+const HeaderSize = 4096
+
+// HeaderDevice is implemented by devices that reserve a header ahead of their chunks, where the
+// array they belong to keeps metadata identifying the disk.
+type HeaderDevice interface {
+	// ReadHeader returns the HeaderSize bytes of the header, zeros if it was never written.
+	ReadHeader() ([]byte, error)
+	// WriteHeader replaces the header with data, padded with zeros to HeaderSize.
+	WriteHeader(data []byte) error
+}
+
+// File stores chunks in a disk image file, chunk i living at byte offset i*chunkSz after the header, if any.
+// Chunks are written with WriteAt, so skipped regions stay as holes on file systems that support sparse files.
+// Which chunks hold data is tracked in an allocation map saved next to the image when the device is closed.
+type File struct {
+	path    string
+	chunkSz int
+	header  int64 // bytes reserved ahead of the first chunk
+	file    *os.File
+
+	alloc      []byte // bitmap of the allocated chunks
+	allocDirty bool   // alloc changed since it was loaded
+}
+
+var _ HeaderDevice = (*File)(nil)
+
+// OpenFile opens the image at path, creating an empty one if it does not exist.
+// Every chunk of an image without an allocation map is considered allocated.
+func OpenFile(path string, chunkSz int) (*File, error) {
+	return openFile(path, chunkSz, 0)
+}
+
+// OpenFileWithHeader opens the image at path like OpenFile, with HeaderSize bytes reserved for
+// a header ahead of the first chunk.
+func OpenFileWithHeader(path string, chunkSz int) (*File, error) {
+	return openFile(path, chunkSz, HeaderSize)
+}
+
+// ReadImageHeader reads the header of the image at path without opening it as a device.
+func ReadImageHeader(path string) ([]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk image %s: %w", path, err)
+	}
+	defer f.Close()
+	return readHeader(f)
+}
+
+func openFile(path string, chunkSz int, header int64) (*File, error) {
+	if chunkSz <= 0 {
+		return nil, fmt.Errorf("chunk size must be greater than 0. Provided: %d", chunkSz)
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open disk image %s: %w", path, err)
+	}
+	dev := &File{path: path, chunkSz: chunkSz, header: header, file: f}
+	dev.alloc, err = os.ReadFile(path + AllocationMapSuffix)
+	if errors.Is(err, os.ErrNotExist) {
+		dev.alloc, err = nil, nil
+		for i := 0; i < dev.ChunkCount(); i++ {
+			dev.setAllocated(i, true)
+		}
+	}
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read allocation map of %s: %w", path, err)
+	}
+	return dev, nil
+}
+
+func (f *File) ReadChunk(index int) ([]byte, error) {
+	count := f.ChunkCount()
+	if index < 0 || index >= count {
+		return nil, fmt.Errorf("%w: index %d of %d", ErrChunkNotFound, index, count)
+	}
+	chunk := make([]byte, f.chunkSz)
+	if !f.Allocated(index) {
+		return chunk, nil
+	}
+	if _, err := f.file.ReadAt(chunk, f.offset(index)); err != nil {
+		return nil, fmt.Errorf("failed to read chunk %d from %s: %w", index, f.path, err)
+	}
+	return chunk, nil
+}
+
+func (f *File) WriteChunk(index int, chunk []byte) error {
+	if index < 0 {
+		return fmt.Errorf("chunk index must be non-negative, got %d", index)
+	}
+	if len(chunk) != f.chunkSz {
+		return fmt.Errorf("chunk size mismatch: expected %d bytes, got %d", f.chunkSz, len(chunk))
+	}
+	if _, err := f.file.WriteAt(chunk, f.offset(index)); err != nil {
+		return fmt.Errorf("failed to write chunk %d to %s: %w", index, f.path, err)
+	}
+	f.setAllocated(index, true)
+	return nil
+}
+
+// Discard punches a hole in the image where the chunk lives, or overwrites it with zeros on
+// file systems that cannot.
+func (f *File) Discard(index int) error {
+	if index < 0 {
+		return fmt.Errorf("chunk index must be non-negative, got %d", index)
+	}
+	if index >= f.ChunkCount() {
+		return nil
+	}
+	offset := f.offset(index)
+	if err := punchHole(f.file, offset, int64(f.chunkSz)); err != nil {
+		if _, err := f.file.WriteAt(make([]byte, f.chunkSz), offset); err != nil {
+			return fmt.Errorf("failed to discard chunk %d of %s: %w", index, f.path, err)
+		}
+	}
+	f.setAllocated(index, false)
+	return nil
+}
+
+func (f *File) ChunkCount() int {
+	info, err := f.file.Stat()
+	if err != nil {
+		return 0
+	}
+	return int(max(info.Size()-f.header, 0) / int64(f.chunkSz))
+}
+
+func (f *File) AllocatedChunks() int {
+	count := 0
+	for _, b := range f.alloc {
+		for ; b != 0; b &= b - 1 {
+			count++
+		}
+	}
+	return count
+}
+
+func (f *File) ChunkSize() int {
+	return f.chunkSz
+}
+
+func (f *File) Wipe() error {
+	if err := f.file.Truncate(0); err != nil {
+		return fmt.Errorf("failed to wipe disk image %s: %w", f.path, err)
+	}
+	f.alloc, f.allocDirty = nil, true
+	return nil
+}
+
+// Close saves the allocation map and closes the image.
+func (f *File) Close() error {
+	var err error
+	if f.allocDirty {
+		if err = os.WriteFile(f.path+AllocationMapSuffix, f.alloc, 0644); err != nil {
+			err = fmt.Errorf("failed to save allocation map of %s: %w", f.path, err)
+		}
+		f.allocDirty = false
+	}
+	return errors.Join(err, f.file.Close())
+}
+
+// ReadHeader returns the header of an image opened with OpenFileWithHeader.
+func (f *File) ReadHeader() ([]byte, error) {
+	if f.header == 0 {
+		return nil, fmt.Errorf("disk image %s has no header", f.path)
+	}
+	return readHeader(f.file)
+}
+
+// WriteHeader replaces the header of an image opened with OpenFileWithHeader.
+func (f *File) WriteHeader(data []byte) error {
+	if f.header == 0 {
+		return fmt.Errorf("disk image %s has no header", f.path)
+	}
+	if len(data) > HeaderSize {
+		return fmt.Errorf("header of %d bytes exceeds the %d bytes reserved", len(data), HeaderSize)
+	}
+	header := make([]byte, HeaderSize)
+	copy(header, data)
+	if _, err := f.file.WriteAt(header, 0); err != nil {
+		return fmt.Errorf("failed to write header of %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Path returns the location of the image file.
+func (f *File) Path() string {
+	return f.path
+}
+
+// offset returns where the chunk at index starts in the image.
+func (f *File) offset(index int) int64 {
+	return f.header + int64(index)*int64(f.chunkSz)
+}
+
+// readHeader reads the first HeaderSize bytes of an image, zeros past its end.
+func readHeader(file *os.File) ([]byte, error) {
+	header := make([]byte, HeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to read header of %s: %w", file.Name(), err)
+	}
+	return header, nil
+}
+
+func (f *File) Allocated(index int) bool {
+	return index >= 0 && index/8 < len(f.alloc) && f.alloc[index/8]&(1<<(index%8)) != 0
+}
+
+func (f *File) setAllocated(index int, allocated bool) {
+	if f.Allocated(index) == allocated {
+		return
+	}
+	for len(f.alloc) <= index/8 {
+		f.alloc = append(f.alloc, 0)
+	}
+	f.alloc[index/8] ^= 1 << (index % 8)
+	f.allocDirty = true
+}
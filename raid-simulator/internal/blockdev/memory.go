@@ -0,0 +1,71 @@
+package blockdev
+
+import "fmt"
+
+// Memory keeps chunks in process memory. Its contents are lost when the process exits.
+// Only the chunks written are stored, so the holes between them cost nothing.
+type Memory struct {
+	chunkSz int
+	count   int            // chunks up to the last one written
+	chunks  map[int][]byte // allocated chunks by index
+}
+
+func NewMemory(chunkSz int) *Memory {
+	return &Memory{chunkSz: chunkSz, chunks: map[int][]byte{}}
+}
+
+func (m *Memory) ReadChunk(index int) ([]byte, error) {
+	if index < 0 || index >= m.count {
+		return nil, fmt.Errorf("%w: index %d of %d", ErrChunkNotFound, index, m.count)
+	}
+	chunk := make([]byte, m.chunkSz)
+	copy(chunk, m.chunks[index])
+	return chunk, nil
+}
+
+func (m *Memory) WriteChunk(index int, chunk []byte) error {
+	if index < 0 {
+		return fmt.Errorf("chunk index must be non-negative, got %d", index)
+	}
+	if len(chunk) != m.chunkSz {
+		return fmt.Errorf("chunk size mismatch: expected %d bytes, got %d", m.chunkSz, len(chunk))
+	}
+	m.chunks[index] = append([]byte(nil), chunk...)
+	m.count = max(m.count, index+1)
+	return nil
+}
+
+func (m *Memory) Discard(index int) error {
+	if index < 0 {
+		return fmt.Errorf("chunk index must be non-negative, got %d", index)
+	}
+	delete(m.chunks, index)
+	return nil
+}
+
+func (m *Memory) ChunkCount() int {
+	return m.count
+}
+
+func (m *Memory) AllocatedChunks() int {
+	return len(m.chunks)
+}
+
+func (m *Memory) Allocated(index int) bool {
+	_, ok := m.chunks[index]
+	return ok
+}
+
+func (m *Memory) ChunkSize() int {
+	return m.chunkSz
+}
+
+func (m *Memory) Wipe() error {
+	m.count = 0
+	m.chunks = map[int][]byte{}
+	return nil
+}
+
+func (m *Memory) Close() error {
+	return nil
+}
@@ -0,0 +1,12 @@
+package blockdev
+
+import (
+	"os"
+	"syscall"
+)
+
+// punchHole deallocates length bytes of f at offset, keeping the file size.
+func punchHole(f *os.File, offset, length int64) error {
+	const mode = 0x01 | 0x02 // FALLOC_FL_KEEP_SIZE | FALLOC_FL_PUNCH_HOLE
+	return syscall.Fallocate(int(f.Fd()), mode, offset, length)
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package blockdev
+
+import (
+	"errors"
+	"os"
+)
+
+// punchHole is not supported outside Linux; discarded chunks are overwritten with zeros instead.
+func punchHole(f *os.File, offset, length int64) error {
+	return errors.ErrUnsupported
+}
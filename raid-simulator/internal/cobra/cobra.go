@@ -1,8 +1,22 @@
 package cobra
 
 import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+
 	"github.com/Anthya1104/raid-simulator/internal/config"
+	"github.com/Anthya1104/raid-simulator/internal/nbd"
 	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/Anthya1104/raid-simulator/internal/service"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
@@ -10,6 +24,93 @@ import (
 var raidType string
 var inputData string
 
+// flags shared by the raid subcommands operating on a persisted array
+var arrayDir string
+var createType string
+var diskCount int
+var stripeSz int
+var diskSize int
+var createLayout string
+var createGroups int
+var createCopies int
+var createMirrorLayout string
+var createReadPolicy string
+var createTopology string
+var createSpares int
+var writeData string
+var writeOffset int
+var crashAfter int
+var readStart int
+var readLength int
+var discardOffset int
+var discardLength int
+var diskIndex int
+
+// flags of the raid reshape subcommand
+var reshapeType string
+var reshapeDisks int
+var reshapeStripeSz int
+var reshapeLayout string
+var reshapeGroups int
+var reshapeCopies int
+var reshapeMirrorLayout string
+var reshapeReadPolicy string
+var reshapeTopology string
+var reshapeSteps int
+
+// flags of the raid status subcommand
+var statusJSON bool
+var statusStripes int
+
+// flags of the raid layout subcommand
+var layoutFirst int
+var layoutStripes int
+var layoutPreview int
+var layoutJSON bool
+
+// flags of the raid bench subcommand
+var benchPattern string
+var benchReadRatio float64
+var benchIOSize int
+var benchQueueDepth int
+var benchOps int
+var benchSpan int
+var benchSeed int64
+var benchFailed []int
+var benchLatency time.Duration
+var benchThroughput float64
+var benchJSON bool
+
+// flags of the raid reliability subcommand
+var reliabilityAFR float64
+var reliabilityMTBF float64
+var reliabilityDiskTB float64
+var reliabilityRebuildRate float64
+var reliabilityMission float64
+var reliabilityTrials int
+var reliabilitySeed int64
+var reliabilityJSON bool
+
+// flags of the raid serve subcommand
+var serveListen string
+var serveSocket string
+var serveName string
+var serveSize int64
+var serveReadOnly bool
+
+// flags of the raid assemble subcommand
+var assembleForce bool
+var assembleJSON bool
+
+// flags of the raid inject subcommands
+var corruptChunk int
+var corruptOffset int
+var corruptLength int
+var badChunks []int
+var faultLatency time.Duration
+var faultErrorRate float64
+var faultSeed int64
+
 var rootCmd = &cobra.Command{
 	Use:   "app",
 	Short: "A base CLI app with Cobra and logrus",
@@ -28,20 +129,710 @@ var versionCmd = &cobra.Command{
 
 var raidCmd = &cobra.Command{
 	Use:   "raid",
-	Short: "Run RAID simulation (raid0, raid1, ...)",
+	Short: "Run RAID simulation (raid0, raid1, ...) or operate on a saved array",
 	Run: func(cmd *cobra.Command, args []string) {
 		if raidType == "" || inputData == "" {
-			logrus.Error("Please provide --type and --data flags")
+			logrus.Error("Please provide --type and --data flags, or use a subcommand")
 			return
 		}
 		raid.RunRAIDSimulation(raid.RaidType(raidType), inputData)
 	},
 }
 
+var raidCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a new persisted RAID array",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		raidType, disks, opts, err := arrayGeometry(cmd)
+		if err != nil {
+			return err
+		}
+		return service.CreateArray(arrayDir, raidType, disks, stripeSz, diskSize, opts, createSpares)
+	},
+}
+
+// arrayGeometry returns the RAID type, disk count and level settings given by the flags of raid create and raid bench.
+func arrayGeometry(cmd *cobra.Command) (raid.RaidType, int, raid.ControllerOptions, error) {
+	raidType, err := typeOrTopology(cmd, createType, createTopology)
+	if err != nil {
+		return "", 0, raid.ControllerOptions{}, err
+	}
+	disks := diskCount
+	if fixed, _ := raid.FixedDiskCount(raidType); fixed > 0 && !cmd.Flags().Changed("disks") {
+		disks = 0 // let the code or topology pick its disks
+	}
+	opts := raid.ControllerOptions{
+		Layout:       raid.ParityLayout(createLayout),
+		Groups:       createGroups,
+		Copies:       createCopies,
+		MirrorLayout: raid.MirrorLayout(createMirrorLayout),
+		ReadPolicy:   raid.ReadPolicy(createReadPolicy),
+	}
+	return raidType, disks, opts, nil
+}
+
+var raidWriteCmd = &cobra.Command{
+	Use:   "write",
+	Short: "Write data into the array at a logical offset",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if writeData == "" {
+			return fmt.Errorf("please provide --data")
+		}
+		if crashAfter >= 0 {
+			return service.CrashWriteArray(arrayDir, []byte(writeData), writeOffset, crashAfter)
+		}
+		return service.WriteArray(arrayDir, []byte(writeData), writeOffset)
+	},
+}
+
+var raidReadCmd = &cobra.Command{
+	Use:   "read",
+	Short: "Read data from the array",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := service.ReadArray(arrayDir, readStart, readLength)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Read %d bytes from offset %d", len(data), readStart)
+		fmt.Fprintln(cmd.OutOrStdout(), string(data))
+		return nil
+	},
+}
+
+var raidDiscardCmd = &cobra.Command{
+	Use:     "discard",
+	Aliases: []string{"trim"},
+	Short:   "Discard (TRIM) a logical byte range, releasing its chunks on the disks so it reads back as zeros",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.DiscardArray(arrayDir, discardOffset, discardLength)
+	},
+}
+
+var raidFailDiskCmd = &cobra.Command{
+	Use:   "fail-disk",
+	Short: "Simulate a failure of one disk",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.FailDisk(arrayDir, diskIndex)
+	},
+}
+
+var raidRemoveDiskCmd = &cobra.Command{
+	Use:   "remove-disk",
+	Short: "Pull a failed disk out of its slot, deleting its image",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.RemoveDisk(arrayDir, diskIndex)
+	},
+}
+
+var raidAddSpareCmd = &cobra.Command{
+	Use:   "add-spare",
+	Short: "Add a hot spare, rebuilt in place of the next failed disk (or of a failed disk right away)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.AddSpare(arrayDir)
+	},
+}
+
+var raidReplaceDiskCmd = &cobra.Command{
+	Use:   "replace-disk",
+	Short: "Replace a disk with a blank one, ready to be rebuilt",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.ReplaceDisk(arrayDir, diskIndex)
+	},
+}
+
+var raidRebuildCmd = &cobra.Command{
+	Use:   "rebuild",
+	Short: "Rebuild a replaced disk from the remaining members",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.RebuildDisk(arrayDir, diskIndex)
+	},
+}
+
+var raidScrubCmd = &cobra.Command{
+	Use:   "scrub",
+	Short: "Verify parity and repair silently corrupted chunks (raid5, raid6)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := service.ScrubArray(arrayDir)
+		if err != nil {
+			return err
+		}
+		logrus.Infof("Scrubbed %d stripes: %d chunks repaired, %d stripes unrecoverable", report.Stripes, len(report.Repaired), len(report.Unrecoverable))
+		for _, repair := range report.Repaired {
+			logrus.Infof("  repaired stripe %d on disk %d", repair.Stripe, repair.Disk)
+		}
+		if len(report.Unrecoverable) > 0 {
+			return fmt.Errorf("unrecoverable stripes: %v", report.Unrecoverable)
+		}
+		return nil
+	},
+}
+
+var raidReshapeCmd = &cobra.Command{
+	Use:   "reshape",
+	Short: "Migrate the array to another RAID level, disk count, stripe size or level setting, or resume a paused reshape",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		raidType, err := typeOrTopology(cmd, reshapeType, reshapeTopology)
+		if err != nil {
+			return err
+		}
+		changes := raid.ReshapeTarget{
+			Type:         raidType,
+			DiskCount:    reshapeDisks,
+			StripeSz:     reshapeStripeSz,
+			Layout:       raid.ParityLayout(reshapeLayout),
+			Groups:       reshapeGroups,
+			Copies:       reshapeCopies,
+			MirrorLayout: raid.MirrorLayout(reshapeMirrorLayout),
+			ReadPolicy:   raid.ReadPolicy(reshapeReadPolicy),
+		}
+		return service.ReshapeArray(arrayDir, changes, reshapeSteps)
+	},
+}
+
+var raidAssembleCmd = &cobra.Command{
+	Use:   "assemble [IMAGE...]",
+	Short: "Put the array back together from its disk images, wherever they moved, placing each by its member superblock",
+	Long: `Put the array back together in --dir from the member superblocks in the headers of its disk
+images, like mdadm --assemble. Every image goes back to its slot whatever its name or position,
+members that missed updates are failed as stale, and missing members are failed, to be replaced
+and rebuilt. Without images, every *.img file in --dir is scanned.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := service.AssembleArray(arrayDir, args, assembleForce)
+		if err != nil {
+			return err
+		}
+		if assembleJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		}
+		return printAssembleReport(cmd.OutOrStdout(), report)
+	},
+}
+
+// printAssembleReport renders report as human-readable tables: the slot of every member and the images left out.
+func printAssembleReport(out io.Writer, report raid.AssembleReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Array:\t%s %s (events %d)\n", report.Type, report.UUID, report.Events)
+	fmt.Fprintln(w, "\nSLOT\tIMAGE\tEVENTS\tSTATE\tSTATUS")
+	for _, member := range report.Members {
+		status := string(member.Status)
+		if member.Reordered {
+			status += ", reordered"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\n", member.Slot, member.Image, member.Events, member.State, status)
+	}
+	if len(report.Skipped) > 0 {
+		fmt.Fprintln(w, "\nSKIPPED IMAGE\tREASON")
+		for _, skipped := range report.Skipped {
+			fmt.Fprintf(w, "%s\t%s\n", skipped.Image, skipped.Reason)
+		}
+	}
+	return w.Flush()
+}
+
+// typeOrTopology returns the RAID type given by --type, or the one built by the YAML topology file given by --topology.
+func typeOrTopology(cmd *cobra.Command, raidType, topologyFile string) (raid.RaidType, error) {
+	if topologyFile == "" {
+		return raid.RaidType(raidType), nil
+	}
+	if cmd.Flags().Changed("type") {
+		return "", fmt.Errorf("--type and --topology are mutually exclusive")
+	}
+	return service.LoadTopology(topologyFile)
+}
+
+var raidInjectCmd = &cobra.Command{
+	Use:   "inject",
+	Short: "Inject faults into a disk of the array",
+}
+
+var injectCorruptCmd = &cobra.Command{
+	Use:   "corrupt",
+	Short: "Silently flip bytes of a chunk (bit rot)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.CorruptChunk(arrayDir, diskIndex, corruptChunk, corruptOffset, corruptLength)
+	},
+}
+
+var injectBadChunksCmd = &cobra.Command{
+	Use:   "bad-chunks",
+	Short: "Fail reads of individual stripe indexes (latent sector errors)",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.UpdateFaults(arrayDir, diskIndex, func(faults *raid.Faults) {
+			faults.BadChunks = append(faults.BadChunks, badChunks...)
+		})
+	},
+}
+
+var injectReadErrorsCmd = &cobra.Command{
+	Use:   "read-errors",
+	Short: "Make every read of the disk fail while writes keep succeeding",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.UpdateFaults(arrayDir, diskIndex, func(faults *raid.Faults) {
+			faults.ReadErrors = true
+		})
+	},
+}
+
+var injectSlowCmd = &cobra.Command{
+	Use:   "slow",
+	Short: "Add latency to every read and write of the disk",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.UpdateFaults(arrayDir, diskIndex, func(faults *raid.Faults) {
+			faults.Latency = faultLatency
+		})
+	},
+}
+
+var injectFlakyCmd = &cobra.Command{
+	Use:   "flaky",
+	Short: "Fail reads and writes of the disk at random with a seeded probability",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.UpdateFaults(arrayDir, diskIndex, func(faults *raid.Faults) {
+			faults.ErrorRate = faultErrorRate
+			faults.Seed = faultSeed
+		})
+	},
+}
+
+var injectClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove every fault injected into the disk",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return service.UpdateFaults(arrayDir, diskIndex, func(faults *raid.Faults) {
+			*faults = raid.Faults{}
+		})
+	},
+}
+
+var raidStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the array health: array and disk states, fault tolerance, capacity usage and parity placement",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		report, err := service.GetHealthReport(arrayDir, statusStripes)
+		if err != nil {
+			return err
+		}
+		if statusJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		}
+		return printHealthReport(cmd.OutOrStdout(), report)
+	},
+}
+
+// printHealthReport renders report as human-readable tables: the array, its disks and the parity placement.
+func printHealthReport(out io.Writer, report raid.HealthReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Type:\t%s\n", report.Type)
+	if report.UUID != "" {
+		fmt.Fprintf(w, "UUID:\t%s (events %d)\n", report.UUID, report.Events)
+	}
+	fmt.Fprintf(w, "State:\t%s\n", report.State)
+	fmt.Fprintf(w, "Fault tolerance:\t%d more disk failure(s)\n", report.FaultTolerance)
+	fmt.Fprintf(w, "Stripe size:\t%d bytes\n", report.StripeSz)
+	if report.Layout != "" {
+		fmt.Fprintf(w, "Parity layout:\t%s\n", report.Layout)
+	}
+	if report.Groups > 0 {
+		fmt.Fprintf(w, "Parity groups:\t%d of %d disks\n", report.Groups, len(report.Disks)/report.Groups)
+	}
+	if report.Copies > 0 {
+		fmt.Fprintf(w, "Mirror:\t%d copies of every chunk, %s layout\n", report.Copies, report.MirrorLayout)
+	}
+	if report.ReadPolicy != "" {
+		fmt.Fprintf(w, "Read policy:\t%s\n", report.ReadPolicy)
+	}
+	fmt.Fprintf(w, "Capacity:\t%d bytes, %d used (%.1f%%)\n", report.Capacity, report.HighWaterMark, report.Usage*100)
+	fmt.Fprintf(w, "Allocated:\t%d bytes on the disks\n", report.Allocated)
+	if len(report.Spares) > 0 {
+		fmt.Fprintf(w, "Hot spares:\t%d (%s)\n", len(report.Spares), strings.Join(report.Spares, ", "))
+	}
+	if reshape := report.Reshape; reshape != nil {
+		fmt.Fprintf(w, "Reshape:\tinto %s with %d disks and stripe size %d, %d/%d bytes copied\n",
+			reshape.Target.Type, reshape.Target.DiskCount, reshape.Target.StripeSz, reshape.Checkpoint, reshape.Total)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "DISK\tSTATE\tCHUNKS\tALLOCATED\tSIZE\tUSAGE\tFAULTS")
+	for _, disk := range report.Disks {
+		size, usage := "grows", "-"
+		if disk.Size > 0 {
+			size = fmt.Sprintf("%d", disk.Size)
+			usage = fmt.Sprintf("%.1f%%", float64(disk.Allocated*report.StripeSz)*100/float64(disk.Size))
+		}
+		faults := "-"
+		if disk.Faults != nil {
+			faults = fmt.Sprintf("%+v", *disk.Faults)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\n", disk.ID, disk.State, disk.Chunks, disk.Allocated, size, usage, faults)
+	}
+
+	if len(report.Parity) > 0 {
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "STRIPE\tPARITY")
+		for _, stripe := range report.Parity {
+			roles := make([]string, len(stripe.Disks))
+			for i, disk := range stripe.Disks {
+				roles[i] = fmt.Sprintf("%s=disk %d", raid.ParityRole(i, len(stripe.Disks)), disk)
+			}
+			fmt.Fprintf(w, "%d\t%s\n", stripe.Stripe, strings.Join(roles, ", "))
+		}
+	}
+	return w.Flush()
+}
+
+var raidLayoutCmd = &cobra.Command{
+	Use:   "layout",
+	Short: "Show the stripe map: which disk holds each data block and parity chunk, with a preview of its bytes",
+	RunE: func(cmd *cobra.Command, args []string) error {
+		stripes, err := service.GetStripeMap(arrayDir, layoutFirst, layoutStripes)
+		if err != nil {
+			return err
+		}
+		if layoutJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(stripes)
+		}
+		status, err := service.GetArrayStatus(arrayDir)
+		if err != nil {
+			return err
+		}
+		return printStripeMap(cmd.OutOrStdout(), stripes, len(status.Disks), layoutPreview)
+	},
+}
+
+// printStripeMap renders stripes as a grid of stripes by disks. Every cell names the chunk, Dn for
+// logical block n or its parity role, followed by the first preview bytes in hex and as ASCII.
+func printStripeMap(out io.Writer, stripes []raid.MapStripe, diskCount, preview int) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := []string{"STRIPE"}
+	for d := 0; d < diskCount; d++ {
+		header = append(header, fmt.Sprintf("DISK %d", d))
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, stripe := range stripes {
+		cells := make([]string, diskCount)
+		for d := range cells {
+			cells[d] = "." // disk outside the stripe's group
+		}
+		for _, chunk := range stripe.Chunks {
+			cells[chunk.Disk] = mapCell(chunk, preview)
+		}
+		fmt.Fprintf(w, "%d\t%s\n", stripe.Stripe, strings.Join(cells, "\t"))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(out, "\nDn: logical block n, P/Q: parity, -: never written")
+	return err
+}
+
+func mapCell(chunk raid.MapChunk, preview int) string {
+	label := chunk.Role
+	if chunk.Role == raid.RoleData {
+		label = fmt.Sprintf("D%d", chunk.Block)
+	}
+	switch {
+	case chunk.State == raid.DiskStateFailed, chunk.State == raid.DiskStateRemoved:
+		return fmt.Sprintf("%s (%s)", label, chunk.State)
+	case chunk.Error != "":
+		return label + " (unreadable)"
+	case chunk.Data == nil:
+		return label + " -"
+	}
+	data := chunk.Data[:min(preview, len(chunk.Data))]
+	ascii := make([]byte, len(data))
+	for i, b := range data {
+		ascii[i] = '.'
+		if b >= 0x20 && b < 0x7f {
+			ascii[i] = b
+		}
+	}
+	return fmt.Sprintf("%s %x |%s|", label, data, ascii)
+}
+
+var raidBenchCmd = &cobra.Command{
+	Use:   "bench",
+	Short: "Replay a workload on a fresh in-memory array and count the chunk I/Os it causes on the disks",
+	Long: `Replay a workload on a fresh in-memory array and count the chunk I/Os every read and write
+causes on the disks, showing e.g. the read-modify-write cost of small parity writes. With --latency
+or --throughput, the disks are also modelled to estimate the IOPS and bandwidth of the array.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		raidType, disks, opts, err := arrayGeometry(cmd)
+		if err != nil {
+			return err
+		}
+		workload := raid.Workload{
+			Pattern:    raid.WorkloadPattern(benchPattern),
+			ReadRatio:  benchReadRatio,
+			IOSize:     benchIOSize,
+			QueueDepth: benchQueueDepth,
+			Ops:        benchOps,
+			Span:       benchSpan,
+			Seed:       benchSeed,
+		}
+		if workload.IOSize == 0 {
+			workload.IOSize = stripeSz
+		}
+		model := raid.DiskModel{Latency: benchLatency, Throughput: benchThroughput * 1e6}
+		report, err := service.BenchmarkArray(raidType, disks, stripeSz, diskSize, opts, benchFailed, workload, model)
+		if err != nil {
+			return err
+		}
+		if benchJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		}
+		return printWorkloadReport(cmd.OutOrStdout(), raidType, report)
+	},
+}
+
+var raidServeCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "Export the array as a Network Block Device, to put a real file system on it",
+	Long: `Export the array as a Network Block Device on a TCP address or a Unix socket until interrupted.
+NBD reads, writes, flushes and trims become reads, writes, saves and discards of the array, e.g.:
+
+  sudo nbd-client localhost 10809 /dev/nbd0 -N raid
+  sudo mkfs.ext4 /dev/nbd0 && sudo mount /dev/nbd0 /mnt`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		network, address := "tcp", serveListen
+		if serveSocket != "" {
+			network, address = "unix", serveSocket
+		}
+		listener, err := net.Listen(network, address)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", address, err)
+		}
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return service.ServeArray(ctx, arrayDir, listener, serveName, serveSize, serveReadOnly)
+	},
+}
+
+var raidReliabilityCmd = &cobra.Command{
+	Use:   "reliability",
+	Short: "Estimate the mean time to data loss of an array and its chance of losing data within a mission time",
+	Long: `Estimate the mean time to data loss (MTTDL) of an array, and its probability of losing data
+within the mission time, when its disks fail at random and every failed disk is replaced at once and
+rebuilt at the rebuild rate. The disk failures the level survives are found by failing the disks of
+its controller. The estimate is computed analytically from a Markov model, and with --trials by a
+Monte Carlo simulation failing and rebuilding the disks of the controller.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		raidType, disks, opts, err := arrayGeometry(cmd)
+		if err != nil {
+			return err
+		}
+		model := raid.ReliabilityModel{
+			AFR:         reliabilityAFR,
+			MTBF:        reliabilityMTBF,
+			DiskSize:    reliabilityDiskTB * 1e12,
+			RebuildRate: reliabilityRebuildRate * 1e6,
+			Mission:     reliabilityMission * 24 * 365,
+			Trials:      reliabilityTrials,
+			Seed:        reliabilitySeed,
+		}
+		if cmd.Flags().Changed("mtbf") && !cmd.Flags().Changed("afr") {
+			model.AFR = 0
+		}
+		report, err := service.EstimateReliability(raidType, disks, opts, model)
+		if err != nil {
+			return err
+		}
+		if reliabilityJSON {
+			encoder := json.NewEncoder(cmd.OutOrStdout())
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(report)
+		}
+		return printReliabilityReport(cmd.OutOrStdout(), report)
+	},
+}
+
+// printReliabilityReport renders report as a human-readable table of the disk failures survived
+// and the analytic and simulated estimates.
+func printReliabilityReport(out io.Writer, report raid.ReliabilityReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	model := report.Model
+	fmt.Fprintf(w, "Type:\t%s (%d disks)\n", report.Type, report.Disks)
+	fmt.Fprintf(w, "Fault tolerance:\t%d disks\n", report.FaultTolerance)
+	fmt.Fprintf(w, "Disk MTBF:\t%.0f hours (AFR %.2f%%)\n", report.DiskMTBF, (1-math.Exp(-24*365/report.DiskMTBF))*100)
+	fmt.Fprintf(w, "Rebuild:\t%.1f hours (%.2f TB at %.0f MB/s)\n", report.RebuildHours, model.DiskSize/1e12, model.RebuildRate/1e6)
+	fmt.Fprintf(w, "Mission:\t%.1f years\n", model.Mission/(24*365))
+
+	fmt.Fprintln(w, "\nFAILED DISKS\tSURVIVED")
+	for k, fraction := range report.Survival[1:] {
+		fmt.Fprintf(w, "%d\t%.1f%%\n", k+1, fraction*100)
+		if fraction == 0 {
+			break
+		}
+	}
+
+	fmt.Fprintln(w, "\nESTIMATE\tMTTDL\tP(LOSS IN MISSION)")
+	fmt.Fprintf(w, "analytic\t%s\t%.3g\n", formatHours(report.Analytic.MTTDL), report.Analytic.LossProbability)
+	if mc := report.MonteCarlo; mc != nil {
+		mttdl := formatHours(mc.MTTDL)
+		if mc.Losses == 0 {
+			mttdl = "no loss in " + formatHours(model.Mission*float64(mc.Trials))
+		}
+		fmt.Fprintf(w, "monte carlo\t%s\t%.3g ± %.2g (%d losses in %d trials)\n", mttdl, mc.LossProbability, mc.StdErr, mc.Losses, mc.Trials)
+	}
+	return w.Flush()
+}
+
+// formatHours renders a duration in hours along with the years it spans.
+func formatHours(hours float64) string {
+	return fmt.Sprintf("%.4g hours (%.4g years)", hours, hours/(24*365))
+}
+
+// printWorkloadReport renders report as human-readable tables: the chunk I/Os per kind of I/O,
+// the load of every disk and the modelled performance.
+func printWorkloadReport(out io.Writer, raidType raid.RaidType, report raid.WorkloadReport) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	workload := report.Workload
+	fmt.Fprintf(w, "Type:\t%s\n", raidType)
+	fmt.Fprintf(w, "Workload:\t%d %s I/Os of %d bytes, %.0f%% reads, over %d bytes\n",
+		workload.Ops, workload.Pattern, workload.IOSize, workload.ReadRatio*100, workload.Span)
+
+	fmt.Fprintln(w, "\nOP\tI/OS\tBYTES\tCHUNK READS\tCHUNK WRITES\tREADS/IO\tWRITES/IO")
+	for _, op := range append(report.Ops, report.Total()) {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%.2f\t%.2f\n", op.Op, op.Count, op.Bytes, op.ChunkReads, op.ChunkWrites, op.ReadsPerOp(), op.WritesPerOp())
+	}
+
+	if report.Estimate == nil {
+		fmt.Fprintln(w, "\nDISK\tREADS\tWRITES")
+		for _, disk := range report.Disks {
+			fmt.Fprintf(w, "%d\t%d\t%d\n", disk.Disk, disk.Reads, disk.Writes)
+		}
+		return w.Flush()
+	}
+	fmt.Fprintln(w, "\nDISK\tREADS\tWRITES\tBUSY\tUTILIZATION")
+	for _, disk := range report.Disks {
+		fmt.Fprintf(w, "%d\t%d\t%d\t%s\t%.1f%%\n", disk.Disk, disk.Reads, disk.Writes, disk.Busy, disk.Utilization*100)
+	}
+	estimate := report.Estimate
+	fmt.Fprintf(w, "\nQueue depth:\t%d\n", workload.QueueDepth)
+	fmt.Fprintf(w, "Elapsed:\t%s\n", estimate.Elapsed)
+	fmt.Fprintf(w, "IOPS:\t%.0f\n", estimate.IOPS)
+	fmt.Fprintf(w, "Bandwidth:\t%.3f MB/s\n", estimate.Bandwidth/1e6)
+	fmt.Fprintf(w, "Mean latency:\t%s\n", estimate.MeanLatency)
+	return w.Flush()
+}
+
 func InitCLI() *cobra.Command {
-	raidCmd.Flags().StringVar(&raidType, "type", "", "RAID type (e.g. raid0)")
+	raidCmd.Flags().StringVar(&raidType, "type", "", "RAID type (e.g. raid0, or a composite topology such as \"raid0(2 x raid1(2))\")")
 	raidCmd.Flags().StringVar(&inputData, "data", "", "Input data to write into RAID")
 
+	raidCmd.PersistentFlags().StringVar(&arrayDir, "dir", config.DefaultArrayDir, "Directory holding the persisted array")
+
+	for _, cmd := range []*cobra.Command{raidCreateCmd, raidBenchCmd} {
+		cmd.Flags().IntVar(&stripeSz, "stripe-size", config.DefaultStripeSz, "Stripe (chunk) size in bytes")
+		cmd.Flags().IntVar(&diskSize, "disk-size", config.DefaultDiskSize, "Size of every member disk in bytes (0 lets disks grow on demand)")
+	}
+	for _, cmd := range []*cobra.Command{raidCreateCmd, raidBenchCmd, raidReliabilityCmd} {
+		cmd.Flags().StringVar(&createType, "type", string(raid.RaidTypeRaid5), "RAID type (e.g. raid5, ec:k+m for a k data + m parity erasure code such as ec:8+3, or a composite topology such as \"raid0(2 x raid1(2))\")")
+		cmd.Flags().IntVar(&diskCount, "disks", config.DefaultDiskCount, "Number of member disks")
+		cmd.Flags().StringVar(&createLayout, "layout", "", fmt.Sprintf("Parity layout of raid5 and raid50 arrays, one of %v (default %s)", raid.ParityLayouts(), raid.DefaultParityLayout))
+		cmd.Flags().StringVar(&createTopology, "topology", "", "YAML file describing a composite topology, instead of --type")
+		cmd.Flags().IntVar(&createGroups, "groups", 0, fmt.Sprintf("Number of parity groups of raid50 and raid60 arrays (default %d)", raid.DefaultParityGroups))
+		cmd.Flags().IntVar(&createCopies, "copies", 0, fmt.Sprintf("Copies of every chunk of raid10 arrays (default %d)", raid.DefaultMirrorCopies))
+		cmd.Flags().StringVar(&createMirrorLayout, "mirror-layout", "", fmt.Sprintf("Copy placement of raid10 arrays, one of %v (default %s)", raid.MirrorLayouts(), raid.DefaultMirrorLayout))
+		cmd.Flags().StringVar(&createReadPolicy, "read-policy", "", fmt.Sprintf("Mirror serving each read of raid1 and raid10 arrays, one of %v (default %s)", raid.ReadPolicies(), raid.DefaultReadPolicy))
+	}
+
+	raidCreateCmd.Flags().IntVar(&createSpares, "spares", 0, "Number of hot spares, rebuilt in place of failed disks")
+
+	raidBenchCmd.Flags().StringVar(&benchPattern, "pattern", string(raid.WorkloadRandom), fmt.Sprintf("Where the I/Os land, one of %v", raid.WorkloadPatterns()))
+	raidBenchCmd.Flags().Float64Var(&benchReadRatio, "read-ratio", 0.5, "Fraction of the I/Os that are reads, from 0 to 1")
+	raidBenchCmd.Flags().IntVar(&benchIOSize, "io-size", 0, "Bytes of every I/O (default: one stripe chunk)")
+	raidBenchCmd.Flags().IntVar(&benchQueueDepth, "queue-depth", 1, "I/Os kept in flight by the performance model")
+	raidBenchCmd.Flags().IntVar(&benchOps, "ops", 1000, "Number of I/Os")
+	raidBenchCmd.Flags().IntVar(&benchSpan, "span", 0, "Bytes at the start of the array the I/Os fall in (default: the usable capacity)")
+	raidBenchCmd.Flags().Int64Var(&benchSeed, "seed", 1, "Seed of the random offsets, operations and data")
+	raidBenchCmd.Flags().IntSliceVar(&benchFailed, "failed", nil, "Disks to fail before the run, to measure the array degraded, e.g. 0,3")
+	raidBenchCmd.Flags().DurationVar(&benchLatency, "latency", 0, "Modelled positioning time of every chunk I/O, e.g. 4ms")
+	raidBenchCmd.Flags().Float64Var(&benchThroughput, "throughput", 0, "Modelled transfer rate of every disk in MB/s (0 for instant transfers)")
+	raidBenchCmd.Flags().BoolVar(&benchJSON, "json", false, "Print the report as JSON instead of tables")
+
+	raidReliabilityCmd.Flags().Float64Var(&reliabilityAFR, "afr", 0.02, "Annualized failure rate of every disk, from 0 to 1")
+	raidReliabilityCmd.Flags().Float64Var(&reliabilityMTBF, "mtbf", 0, "Mean time between failures of every disk in hours, instead of --afr")
+	raidReliabilityCmd.Flags().Float64Var(&reliabilityDiskTB, "disk-tb", 8, "Size of every member disk in TB, rebuilt onto every replacement")
+	raidReliabilityCmd.Flags().Float64Var(&reliabilityRebuildRate, "rebuild-rate", 100, "Rate a replacement disk is rebuilt at in MB/s")
+	raidReliabilityCmd.Flags().Float64Var(&reliabilityMission, "mission", 5, "Mission time in years the array is meant to keep its data")
+	raidReliabilityCmd.Flags().IntVar(&reliabilityTrials, "trials", 10000, "Monte Carlo trials (0 for the analytic estimate alone)")
+	raidReliabilityCmd.Flags().Int64Var(&reliabilitySeed, "seed", 1, "Seed of the simulated failures")
+	raidReliabilityCmd.Flags().BoolVar(&reliabilityJSON, "json", false, "Print the report as JSON instead of a table")
+
+	raidServeCmd.Flags().StringVar(&serveListen, "listen", fmt.Sprintf("127.0.0.1:%d", nbd.DefaultPort), "TCP address to listen on")
+	raidServeCmd.Flags().StringVar(&serveSocket, "socket", "", "Unix socket to listen on instead of --listen")
+	raidServeCmd.Flags().StringVar(&serveName, "name", "raid", "Export name; clients asking for the default export get it too")
+	raidServeCmd.Flags().Int64Var(&serveSize, "size", 0, "Export size in bytes (default: the array capacity; required when disks grow on demand)")
+	raidServeCmd.Flags().BoolVar(&serveReadOnly, "read-only", false, "Reject writes and trims")
+
+	raidWriteCmd.Flags().StringVar(&writeData, "data", "", "Data to write into the array")
+	raidWriteCmd.Flags().IntVar(&writeOffset, "offset", 0, "Logical byte offset to write at")
+	raidWriteCmd.Flags().IntVar(&crashAfter, "crash-after", -1, "Simulate a crash once this many shards of a stripe are written (raid5, raid6)")
+
+	raidReadCmd.Flags().IntVar(&readStart, "start", 0, "Logical byte offset to read from")
+	raidReadCmd.Flags().IntVar(&readLength, "length", 0, "Number of bytes to read")
+	_ = raidReadCmd.MarkFlagRequired("length")
+
+	raidDiscardCmd.Flags().IntVar(&discardOffset, "offset", 0, "Logical byte offset to discard from")
+	raidDiscardCmd.Flags().IntVar(&discardLength, "length", 0, "Number of bytes to discard")
+	_ = raidDiscardCmd.MarkFlagRequired("length")
+
+	for _, cmd := range []*cobra.Command{raidFailDiskCmd, raidRemoveDiskCmd, raidReplaceDiskCmd, raidRebuildCmd} {
+		cmd.Flags().IntVar(&diskIndex, "disk", -1, "Index of the target disk")
+		_ = cmd.MarkFlagRequired("disk")
+	}
+
+	raidReshapeCmd.Flags().StringVar(&reshapeType, "type", "", "Target RAID type, e.g. raid6, ec:4+2 or \"raid1(2 x raid5(3))\" (default: keep the current one)")
+	raidReshapeCmd.Flags().StringVar(&reshapeTopology, "topology", "", "YAML file describing the target composite topology, instead of --type")
+	raidReshapeCmd.Flags().IntVar(&reshapeDisks, "disks", 0, "Target number of disks (default: keep the current one)")
+	raidReshapeCmd.Flags().IntVar(&reshapeStripeSz, "stripe-size", 0, "Target stripe size (default: keep the current one)")
+	raidReshapeCmd.Flags().StringVar(&reshapeLayout, "layout", "", "Target raid5 or raid50 parity layout (default: keep the current one)")
+	raidReshapeCmd.Flags().IntVar(&reshapeGroups, "groups", 0, "Target number of raid50 or raid60 parity groups (default: keep the current one)")
+	raidReshapeCmd.Flags().IntVar(&reshapeCopies, "copies", 0, "Target copies of every raid10 chunk (default: keep the current one)")
+	raidReshapeCmd.Flags().StringVar(&reshapeMirrorLayout, "mirror-layout", "", "Target raid10 copy placement (default: keep the current one)")
+	raidReshapeCmd.Flags().StringVar(&reshapeReadPolicy, "read-policy", "", "Target raid1 or raid10 read policy (default: keep the current one)")
+	raidReshapeCmd.Flags().IntVar(&reshapeSteps, "steps", 0, "Stop after copying this many blocks, to resume later (default: copy everything)")
+
+	raidAssembleCmd.Flags().BoolVar(&assembleForce, "force", false, "Use stale members as they are instead of failing them")
+	raidAssembleCmd.Flags().BoolVar(&assembleJSON, "json", false, "Print the report as JSON instead of tables")
+
+	raidStatusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print the report as JSON instead of tables")
+	raidStatusCmd.Flags().IntVar(&statusStripes, "stripes", 0, "Number of stripes whose parity placement is listed (default: one per disk, a full rotation)")
+
+	raidLayoutCmd.Flags().IntVar(&layoutFirst, "first", 0, "First stripe to show")
+	raidLayoutCmd.Flags().IntVar(&layoutStripes, "stripes", 0, "Number of stripes to show (default: one per disk, a full rotation)")
+	raidLayoutCmd.Flags().IntVar(&layoutPreview, "preview", 4, "Bytes of every chunk shown in hex and ASCII")
+	raidLayoutCmd.Flags().BoolVar(&layoutJSON, "json", false, "Print the stripe map as JSON, with every chunk's bytes in base64")
+
+	raidInjectCmd.PersistentFlags().IntVar(&diskIndex, "disk", -1, "Index of the target disk")
+	_ = raidInjectCmd.MarkPersistentFlagRequired("disk")
+	injectCorruptCmd.Flags().IntVar(&corruptChunk, "chunk", 0, "Index of the chunk (stripe) to corrupt")
+	injectCorruptCmd.Flags().IntVar(&corruptOffset, "offset", 0, "Byte offset inside the chunk")
+	injectCorruptCmd.Flags().IntVar(&corruptLength, "length", 1, "Number of bytes to flip")
+	injectBadChunksCmd.Flags().IntSliceVar(&badChunks, "chunks", nil, "Chunk (stripe) indexes whose reads fail, e.g. 0,3")
+	_ = injectBadChunksCmd.MarkFlagRequired("chunks")
+	injectSlowCmd.Flags().DurationVar(&faultLatency, "latency", 10*time.Millisecond, "Delay added to every chunk I/O")
+	injectFlakyCmd.Flags().Float64Var(&faultErrorRate, "rate", 0.1, "Probability that a chunk I/O fails")
+	injectFlakyCmd.Flags().Int64Var(&faultSeed, "seed", 1, "Seed of the random failures")
+	for _, cmd := range []*cobra.Command{injectCorruptCmd, injectBadChunksCmd, injectReadErrorsCmd, injectSlowCmd, injectFlakyCmd, injectClearCmd} {
+		cmd.SilenceUsage = true
+		raidInjectCmd.AddCommand(cmd)
+	}
+
+	for _, cmd := range []*cobra.Command{raidCreateCmd, raidWriteCmd, raidReadCmd, raidDiscardCmd, raidFailDiskCmd, raidRemoveDiskCmd, raidReplaceDiskCmd, raidAddSpareCmd, raidRebuildCmd, raidScrubCmd, raidReshapeCmd, raidAssembleCmd, raidInjectCmd, raidStatusCmd, raidLayoutCmd, raidBenchCmd, raidReliabilityCmd, raidServeCmd} {
+		cmd.SilenceUsage = true
+		raidCmd.AddCommand(cmd)
+	}
+
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(raidCmd)
 
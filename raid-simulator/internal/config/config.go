@@ -9,4 +9,9 @@ const (
 	LogLevelError   string = "error"
 
 	LogFilePath string = "log/log_output.txt"
+
+	DefaultArrayDir  string = "raid-array" // directory holding the persisted array used by the raid subcommands
+	DefaultDiskCount int    = 3
+	DefaultStripeSz  int    = 4
+	DefaultDiskSize  int    = 64 * 1024 // declared size of every member disk in bytes
 )
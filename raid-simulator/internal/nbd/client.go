@@ -0,0 +1,313 @@
+package nbd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+)
+
+// ErrClientClosed is returned by requests on a client that was closed.
+var ErrClientClosed = errors.New("nbd: client closed")
+
+// Client is a pure-Go NBD client, enough to exercise a server without the kernel's nbd driver.
+// It implements io.ReaderAt and io.WriterAt; requests from concurrent goroutines are pipelined
+// over the connection and matched with their replies by handle.
+type Client struct {
+	conn  net.Conn
+	size  int64
+	flags uint16
+
+	writeMu sync.Mutex // serializes requests on the wire
+
+	mu      sync.Mutex // guards the fields below
+	pending map[uint64]*call
+	handle  uint64
+	err     error // why the connection is gone, nil while it is up
+	closed  bool
+
+	done chan struct{} // closed once the reply reader exits
+}
+
+// call is a request waiting for its reply.
+type call struct {
+	buf   []byte // where the data of a read goes
+	errno Errno
+	err   error // set if the connection was lost before the reply
+	done  chan struct{}
+}
+
+var (
+	_ io.ReaderAt = (*Client)(nil)
+	_ io.WriterAt = (*Client)(nil)
+)
+
+// Dial connects to the server at address on network ("tcp" or "unix") and opens the export name.
+func Dial(network, address, name string) (*Client, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, fmt.Errorf("nbd: failed to connect to %s: %w", address, err)
+	}
+	client, err := NewClient(conn, name)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+// NewClient negotiates the export name over conn, which it owns from then on.
+func NewClient(conn net.Conn, name string) (*Client, error) {
+	c := &Client{conn: conn, pending: make(map[uint64]*call), done: make(chan struct{})}
+	if err := c.handshake(name); err != nil {
+		return nil, err
+	}
+	go c.readReplies()
+	return c, nil
+}
+
+// Size returns the size of the export in bytes.
+func (c *Client) Size() int64 {
+	return c.size
+}
+
+// ReadOnly reports whether the server rejects writes to the export.
+func (c *Client) ReadOnly() bool {
+	return c.flags&transReadOnly != 0
+}
+
+// ReadAt reads len(p) bytes at off, in requests of at most MaxRequestLength bytes.
+func (c *Client) ReadAt(p []byte, off int64) (int, error) {
+	for n := 0; n < len(p); {
+		length := min(len(p)-n, MaxRequestLength)
+		if err := c.do(cmdRead, 0, off+int64(n), length, nil, p[n:n+length]); err != nil {
+			return n, err
+		}
+		n += length
+	}
+	return len(p), nil
+}
+
+// WriteAt writes p at off, in requests of at most MaxRequestLength bytes.
+func (c *Client) WriteAt(p []byte, off int64) (int, error) {
+	for n := 0; n < len(p); {
+		length := min(len(p)-n, MaxRequestLength)
+		if err := c.do(cmdWrite, 0, off+int64(n), length, p[n:n+length], nil); err != nil {
+			return n, err
+		}
+		n += length
+	}
+	return len(p), nil
+}
+
+// WriteZeroes zeroes length bytes at off, in requests of at most MaxRequestLength bytes. Unless
+// noHole is set the server may release them instead.
+func (c *Client) WriteZeroes(off int64, length int, noHole bool) error {
+	var flags uint16
+	if noHole {
+		flags |= cmdFlagNoHole
+	}
+	return c.doRange(cmdWriteZeroes, flags, off, length)
+}
+
+// Trim tells the server that length bytes at off are no longer needed, in requests of at most
+// MaxRequestLength bytes.
+func (c *Client) Trim(off int64, length int) error {
+	return c.doRange(cmdTrim, 0, off, length)
+}
+
+// Flush asks the server to persist every write completed so far.
+func (c *Client) Flush() error {
+	return c.do(cmdFlush, 0, 0, 0, nil, nil)
+}
+
+// Close disconnects from the server. Requests still waiting for a reply fail with ErrClientClosed.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClientClosed
+	}
+	c.closed = true
+	connected := c.err == nil
+	c.mu.Unlock()
+
+	if connected {
+		c.writeMu.Lock()
+		_ = writeFields(c.conn, request{Magic: requestMagic, Type: cmdDisc})
+		c.writeMu.Unlock()
+	}
+	c.fail(ErrClientClosed)
+	err := c.conn.Close()
+	<-c.done
+	return err
+}
+
+// handshake negotiates the export with NBD_OPT_GO.
+func (c *Client) handshake(name string) error {
+	var greeting struct {
+		Magic    uint64
+		OptMagic uint64
+		Flags    uint16
+	}
+	if err := binary.Read(c.conn, binary.BigEndian, &greeting); err != nil {
+		return fmt.Errorf("nbd: failed to read server greeting: %w", err)
+	}
+	if greeting.Magic != initMagic || greeting.OptMagic != optMagic {
+		return fmt.Errorf("nbd: server does not speak the newstyle protocol")
+	}
+	if greeting.Flags&flagFixedNewstyle == 0 {
+		return fmt.Errorf("nbd: server does not support the fixed newstyle handshake")
+	}
+	clientFlags := clientFlagFixedNewstyle
+	if greeting.Flags&flagNoZeroes != 0 {
+		clientFlags |= clientFlagNoZeroes
+	}
+	data, err := encodeFields(uint32(len(name)), []byte(name), uint16(0))
+	if err != nil {
+		return err
+	}
+	if err := writeFields(c.conn, clientFlags, optMagic, optGo, uint32(len(data)), data); err != nil {
+		return fmt.Errorf("nbd: failed to send export name: %w", err)
+	}
+
+	for {
+		var reply struct {
+			Magic  uint64
+			Option uint32
+			Type   uint32
+			Length uint32
+		}
+		if err := binary.Read(c.conn, binary.BigEndian, &reply); err != nil {
+			return fmt.Errorf("nbd: failed to read option reply: %w", err)
+		}
+		if reply.Magic != optReplyMagic || reply.Option != optGo || reply.Length > maxOptionLength {
+			return fmt.Errorf("nbd: malformed option reply")
+		}
+		data := make([]byte, reply.Length)
+		if _, err := io.ReadFull(c.conn, data); err != nil {
+			return fmt.Errorf("nbd: failed to read option reply: %w", err)
+		}
+		switch reply.Type {
+		case repAck:
+			if c.size == 0 {
+				return fmt.Errorf("nbd: server did not describe export %q", name)
+			}
+			return nil
+		case repInfo:
+			if len(data) == 12 && binary.BigEndian.Uint16(data) == infoExport {
+				c.size = int64(binary.BigEndian.Uint64(data[2:]))
+				c.flags = binary.BigEndian.Uint16(data[10:])
+			}
+		case repErrUnknown:
+			return fmt.Errorf("nbd: server has no export %q", name)
+		default:
+			if reply.Type&(1<<31) != 0 {
+				return fmt.Errorf("nbd: server refused export %q (error %#x): %s", name, reply.Type, data)
+			}
+		}
+	}
+}
+
+// doRange sends a request without payload for length bytes at off, split like ReadAt and WriteAt.
+func (c *Client) doRange(cmd, flags uint16, off int64, length int) error {
+	if off < 0 || length < 0 {
+		return fmt.Errorf("nbd: negative offset %d or length %d", off, length)
+	}
+	for n := 0; n < length; {
+		chunk := min(length-n, MaxRequestLength)
+		if err := c.do(cmd, flags, off+int64(n), chunk, nil, nil); err != nil {
+			return err
+		}
+		n += chunk
+	}
+	return nil
+}
+
+// do sends a request and waits for its reply. A read's data lands in buf.
+func (c *Client) do(cmd, flags uint16, off int64, length int, payload, buf []byte) error {
+	if off < 0 || length < 0 {
+		return fmt.Errorf("nbd: negative offset %d or length %d", off, length)
+	}
+	pending := &call{buf: buf, done: make(chan struct{})}
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	handle := c.handle
+	c.handle++
+	c.pending[handle] = pending
+	c.mu.Unlock()
+
+	req := request{Magic: requestMagic, Flags: flags, Type: cmd, Handle: handle, Offset: uint64(off), Length: uint32(length)}
+	c.writeMu.Lock()
+	err := writeFields(c.conn, req, payload)
+	c.writeMu.Unlock()
+	if err != nil {
+		c.fail(fmt.Errorf("nbd: failed to send request: %w", err))
+	}
+
+	<-pending.done
+	if pending.err != nil {
+		return pending.err
+	}
+	if pending.errno != 0 {
+		return fmt.Errorf("nbd: request of %d bytes at offset %d failed: %w", length, off, pending.errno)
+	}
+	return nil
+}
+
+// readReplies hands every reply to the request waiting for it until the connection fails.
+func (c *Client) readReplies() {
+	defer close(c.done)
+	for {
+		var reply struct {
+			Magic  uint32
+			Errno  uint32
+			Handle uint64
+		}
+		if err := binary.Read(c.conn, binary.BigEndian, &reply); err != nil {
+			c.fail(fmt.Errorf("nbd: connection lost: %w", err))
+			return
+		}
+		if reply.Magic != simpleReplyMagic {
+			c.fail(fmt.Errorf("nbd: bad reply magic %#x", reply.Magic))
+			return
+		}
+		c.mu.Lock()
+		pending := c.pending[reply.Handle]
+		delete(c.pending, reply.Handle)
+		c.mu.Unlock()
+		if pending == nil {
+			c.fail(fmt.Errorf("nbd: reply to unknown request %d", reply.Handle))
+			return
+		}
+		if reply.Errno == 0 && pending.buf != nil {
+			if _, err := io.ReadFull(c.conn, pending.buf); err != nil {
+				pending.err = fmt.Errorf("nbd: connection lost: %w", err)
+				close(pending.done)
+				c.fail(pending.err)
+				return
+			}
+		}
+		pending.errno = Errno(reply.Errno)
+		close(pending.done)
+	}
+}
+
+// fail records why the connection is gone, unless it already was, and fails every pending request.
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err == nil {
+		c.err = err
+	}
+	for handle, pending := range c.pending {
+		pending.err = c.err
+		close(pending.done)
+		delete(c.pending, handle)
+	}
+}
@@ -0,0 +1,140 @@
+// Package nbd serves block devices over the Network Block Device protocol, so the Linux nbd-client
+// (or the pure-Go Client of this package) can put a real file system on a simulated array.
+//
+// Only the fixed newstyle handshake and simple replies are implemented; structured replies,
+// block status queries and TLS are not.
+package nbd
+
+import (
+	"fmt"
+	"io"
+)
+
+// DefaultPort is the TCP port registered for NBD.
+const DefaultPort = 10809
+
+// MaxRequestLength is the longest read or write a request may carry. Clients split longer I/O.
+const MaxRequestLength = 32 << 20
+
+// MaxInFlight is how many requests of one connection the server runs at a time. Further requests
+// are not read off the connection until one of them has been replied to.
+const MaxInFlight = 16
+
+// Backend is the block device behind an export: a fixed-size byte range that can be read and written.
+type Backend interface {
+	io.ReaderAt
+	io.WriterAt
+	// Size returns the size of the device in bytes.
+	Size() int64
+}
+
+// Flusher is implemented by backends that buffer writes and can persist them on request.
+type Flusher interface {
+	Flush() error
+}
+
+// Discarder is implemented by backends that can release a byte range, which reads back as zeros afterwards.
+type Discarder interface {
+	Discard(off, length int64) error
+}
+
+// Magic numbers of the handshake and of the transmission phase.
+const (
+	initMagic        uint64 = 0x4e42444d41474943 // "NBDMAGIC"
+	optMagic         uint64 = 0x49484156454f5054 // "IHAVEOPT"
+	optReplyMagic    uint64 = 0x0003e889045565a9
+	requestMagic     uint32 = 0x25609513
+	simpleReplyMagic uint32 = 0x67446698
+	maxOptionLength         = 4096
+	exportNameZeroes        = 124 // zero bytes closing an NBD_OPT_EXPORT_NAME reply without NBD_FLAG_NO_ZEROES
+)
+
+// Handshake flags sent by the server and by the client.
+const (
+	flagFixedNewstyle uint16 = 1 << 0
+	flagNoZeroes      uint16 = 1 << 1
+
+	clientFlagFixedNewstyle uint32 = 1 << 0
+	clientFlagNoZeroes      uint32 = 1 << 1
+)
+
+// Options a client may send during the handshake.
+const (
+	optExportName uint32 = 1
+	optAbort      uint32 = 2
+	optList       uint32 = 3
+	optInfo       uint32 = 6
+	optGo         uint32 = 7
+)
+
+// Option reply types.
+const (
+	repAck        uint32 = 1
+	repServer     uint32 = 2
+	repInfo       uint32 = 3
+	repErrUnsup   uint32 = 1<<31 + 1
+	repErrInvalid uint32 = 1<<31 + 3
+	repErrUnknown uint32 = 1<<31 + 6
+)
+
+// Information types of an NBD_REP_INFO reply.
+const (
+	infoExport    uint16 = 0
+	infoBlockSize uint16 = 3
+)
+
+// Transmission flags describing an export.
+const (
+	transHasFlags        uint16 = 1 << 0
+	transReadOnly        uint16 = 1 << 1
+	transSendFlush       uint16 = 1 << 2
+	transSendFUA         uint16 = 1 << 3
+	transSendTrim        uint16 = 1 << 5
+	transSendWriteZeroes uint16 = 1 << 6
+	transCanMultiConn    uint16 = 1 << 8
+)
+
+// Commands of the transmission phase and their flags.
+const (
+	cmdRead        uint16 = 0
+	cmdWrite       uint16 = 1
+	cmdDisc        uint16 = 2
+	cmdFlush       uint16 = 3
+	cmdTrim        uint16 = 4
+	cmdWriteZeroes uint16 = 6
+
+	cmdFlagFUA    uint16 = 1 << 0
+	cmdFlagNoHole uint16 = 1 << 1
+)
+
+// Errno is an error code of the NBD protocol, which uses the values of the Linux errno codes.
+type Errno uint32
+
+const (
+	EPERM     Errno = 1
+	EIO       Errno = 5
+	ENOMEM    Errno = 12
+	EINVAL    Errno = 22
+	ENOSPC    Errno = 28
+	EOVERFLOW Errno = 75
+	ENOTSUP   Errno = 95
+	ESHUTDOWN Errno = 108
+)
+
+var errnoNames = map[Errno]string{
+	EPERM:     "operation not permitted",
+	EIO:       "input/output error",
+	ENOMEM:    "cannot allocate memory",
+	EINVAL:    "invalid argument",
+	ENOSPC:    "no space left on device",
+	EOVERFLOW: "value too large",
+	ENOTSUP:   "operation not supported",
+	ESHUTDOWN: "server is shutting down",
+}
+
+func (e Errno) Error() string {
+	if name, ok := errnoNames[e]; ok {
+		return name
+	}
+	return fmt.Sprintf("nbd error %d", uint32(e))
+}
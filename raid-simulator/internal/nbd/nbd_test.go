@@ -0,0 +1,254 @@
+package nbd_test
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/nbd"
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+// serve exports a fresh RAID5 volume of size bytes on a local listener of network and returns
+// the volume and the listener's address. The server is closed when the test ends.
+func serve(t *testing.T, network string, size int64, readOnly bool) (*raid.Volume, string) {
+	t.Helper()
+	controller, err := raid.NewController(raid.RaidTypeRaid5, 4, 4)
+	assert.NoError(t, err)
+	volume, err := raid.NewVolume(controller, size)
+	assert.NoError(t, err)
+	return volume, serveBackend(t, network, volume, readOnly)
+}
+
+// serveBackend exports backend on a local listener of network and returns the listener's address.
+// The server is closed when the test ends.
+func serveBackend(t *testing.T, network string, backend nbd.Backend, readOnly bool) string {
+	t.Helper()
+	server, err := nbd.NewServer("raid", backend, readOnly)
+	assert.NoError(t, err)
+
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "nbd.sock")
+	}
+	listener, err := net.Listen(network, address)
+	assert.NoError(t, err)
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+	t.Cleanup(func() {
+		assert.NoError(t, server.Close())
+		assert.ErrorIs(t, <-served, nbd.ErrServerClosed)
+	})
+	return listener.Addr().String()
+}
+
+// gatedBackend holds every write until its gate is closed, counting the writes waiting at it.
+type gatedBackend struct {
+	gate    chan struct{}
+	entered chan struct{} // receives once per write reaching the backend
+
+	mu           sync.Mutex
+	active, peak int
+}
+
+func (b *gatedBackend) ReadAt(p []byte, off int64) (int, error) { return len(p), nil }
+
+func (b *gatedBackend) WriteAt(p []byte, off int64) (int, error) {
+	b.mu.Lock()
+	b.active++
+	b.peak = max(b.peak, b.active)
+	b.mu.Unlock()
+	b.entered <- struct{}{}
+	<-b.gate
+	b.mu.Lock()
+	b.active--
+	b.mu.Unlock()
+	return len(p), nil
+}
+
+func (b *gatedBackend) Size() int64 { return 1 << 20 }
+
+// discardBackend is a large export that only records the ranges discarded from it.
+type discardBackend struct {
+	mu        sync.Mutex
+	discarded [][2]int64
+}
+
+func (b *discardBackend) ReadAt(p []byte, off int64) (int, error)  { return len(p), nil }
+func (b *discardBackend) WriteAt(p []byte, off int64) (int, error) { return len(p), nil }
+func (b *discardBackend) Size() int64                              { return 8 << 30 }
+
+func (b *discardBackend) Discard(off, length int64) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.discarded = append(b.discarded, [2]int64{off, length})
+	return nil
+}
+
+func TestServer_ReadWriteTrimFlush(t *testing.T) {
+	volume, address := serve(t, "tcp", 1024, false)
+	client, err := nbd.Dial("tcp", address, "raid")
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.Equal(t, int64(1024), client.Size())
+	assert.False(t, client.ReadOnly())
+
+	data := bytes.Repeat([]byte("NBD over RAID5! "), 8)
+	n, err := client.WriteAt(data, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.NoError(t, client.Flush())
+
+	buf := make([]byte, 256)
+	_, err = client.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, 100), buf[:100], "never written")
+	assert.Equal(t, data, buf[100:228])
+
+	// The writes went through the controller, and degraded reads still serve them
+	assert.NoError(t, volume.Controller().ClearDisk(2))
+	_, err = client.ReadAt(buf[:len(data)], 100)
+	assert.NoError(t, err)
+	assert.Equal(t, data, buf[:len(data)])
+
+	assert.NoError(t, client.Trim(100, 16))
+	assert.NoError(t, client.WriteZeroes(132, 8, true))
+	_, err = client.ReadAt(buf[:48], 100)
+	assert.NoError(t, err)
+	expected := bytes.Clone(data[:48])
+	clear(expected[:16])
+	clear(expected[32:40])
+	assert.Equal(t, expected, buf[:48])
+}
+
+func TestServer_Errors(t *testing.T) {
+	_, address := serve(t, "tcp", 64, false)
+	client, err := nbd.Dial("tcp", address, "")
+	assert.NoError(t, err, "the default export name selects the export")
+	defer client.Close()
+
+	_, err = client.ReadAt(make([]byte, 8), 60)
+	assert.ErrorIs(t, err, nbd.EINVAL)
+	_, err = client.WriteAt(make([]byte, 8), 60)
+	assert.ErrorIs(t, err, nbd.ENOSPC)
+	assert.ErrorIs(t, client.Trim(64, 1), nbd.EINVAL)
+
+	// A failed request leaves the connection usable
+	_, err = client.WriteAt([]byte("ok"), 0)
+	assert.NoError(t, err)
+
+	_, err = nbd.Dial("tcp", address, "other")
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no export")
+	}
+}
+
+func TestServer_ReadOnly(t *testing.T) {
+	_, address := serve(t, "tcp", 64, true)
+	client, err := nbd.Dial("tcp", address, "raid")
+	assert.NoError(t, err)
+	defer client.Close()
+	assert.True(t, client.ReadOnly())
+
+	_, err = client.WriteAt([]byte("nope"), 0)
+	assert.ErrorIs(t, err, nbd.EPERM)
+	assert.ErrorIs(t, client.Trim(0, 4), nbd.EPERM)
+	_, err = client.ReadAt(make([]byte, 4), 0)
+	assert.NoError(t, err)
+}
+
+func TestServer_ConcurrentClientsOverUnixSocket(t *testing.T) {
+	_, address := serve(t, "unix", 4096, false)
+
+	// Every client pipelines writes of its own region from several goroutines
+	const clients, writers, blockSz = 4, 4, 64
+	var wg sync.WaitGroup
+	for c := range clients {
+		client, err := nbd.Dial("unix", address, "raid")
+		assert.NoError(t, err)
+		defer client.Close()
+		for w := range writers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				block := (c*writers + w) * blockSz
+				data := bytes.Repeat([]byte(fmt.Sprintf("%02d", c*writers+w)), blockSz/2)
+				_, err := client.WriteAt(data, int64(block))
+				assert.NoError(t, err)
+			}()
+		}
+	}
+	wg.Wait()
+
+	client, err := nbd.Dial("unix", address, "raid")
+	assert.NoError(t, err)
+	defer client.Close()
+	buf := make([]byte, clients*writers*blockSz)
+	_, err = client.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	for i := range clients * writers {
+		assert.Equal(t, bytes.Repeat([]byte(fmt.Sprintf("%02d", i)), blockSz/2), buf[i*blockSz:(i+1)*blockSz])
+	}
+}
+
+func TestServer_LimitsRequestsInFlight(t *testing.T) {
+	const requests = nbd.MaxInFlight + 8
+	backend := &gatedBackend{gate: make(chan struct{}), entered: make(chan struct{}, requests)}
+	address := serveBackend(t, "tcp", backend, false)
+	client, err := nbd.Dial("tcp", address, "raid")
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// Pipeline more writes than the server runs at a time
+	var wg sync.WaitGroup
+	for i := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := client.WriteAt(bytes.Repeat([]byte{byte(i)}, 4096), int64(i)*4096)
+			assert.NoError(t, err)
+		}()
+	}
+	// Every slot is taken before the first write completes
+	for range nbd.MaxInFlight {
+		<-backend.entered
+	}
+	close(backend.gate)
+	wg.Wait()
+	assert.Len(t, backend.entered, requests-nbd.MaxInFlight, "the rest ran once slots freed")
+	assert.Equal(t, nbd.MaxInFlight, backend.peak, "no more writes than slots ran at a time")
+}
+
+func TestClient_SplitsLongRanges(t *testing.T) {
+	backend := &discardBackend{}
+	client, err := nbd.Dial("tcp", serveBackend(t, "tcp", backend, false), "raid")
+	assert.NoError(t, err)
+	defer client.Close()
+
+	// Neither range fits the 32-bit length of a single request
+	const length = 5 << 30
+	assert.NoError(t, client.Trim(100, length))
+	assert.NoError(t, client.WriteZeroes(200, length, false))
+	var expected [][2]int64
+	for _, start := range []int64{100, 200} {
+		for off := int64(0); off < length; off += nbd.MaxRequestLength {
+			expected = append(expected, [2]int64{start + off, min(length-off, nbd.MaxRequestLength)})
+		}
+	}
+	assert.Equal(t, expected, backend.discarded)
+}
+
+func TestClient_ClosedConnection(t *testing.T) {
+	_, address := serve(t, "tcp", 64, false)
+	client, err := nbd.Dial("tcp", address, "raid")
+	assert.NoError(t, err)
+	assert.NoError(t, client.Close())
+
+	_, err = client.ReadAt(make([]byte, 4), 0)
+	assert.ErrorIs(t, err, nbd.ErrClientClosed)
+	assert.ErrorIs(t, client.Close(), nbd.ErrClientClosed)
+}
@@ -0,0 +1,471 @@
+package nbd
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrServerClosed is returned by Serve and ServeConn once the server has been closed.
+var ErrServerClosed = errors.New("nbd: server closed")
+
+// Server exports one backend under a name. Requests of every connection are served concurrently,
+// so the backend must be safe for concurrent use; replies go out as requests complete.
+type Server struct {
+	name     string
+	backend  Backend
+	readOnly bool
+
+	// ioMu is held shared by every request and exclusively by flushes, so a flush covers every
+	// request that completed before it and never runs alongside a write
+	ioMu sync.RWMutex
+
+	mu        sync.Mutex // guards the fields below
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+	wg        sync.WaitGroup // connections being served
+}
+
+// NewServer creates a server exporting backend as name. Clients asking for the default
+// (empty) export name get it too. A read-only server rejects writes and trims with EPERM.
+func NewServer(name string, backend Backend, readOnly bool) (*Server, error) {
+	if backend == nil {
+		return nil, fmt.Errorf("nbd server requires a backend")
+	}
+	if backend.Size() <= 0 {
+		return nil, fmt.Errorf("nbd export size must be greater than 0. Provided: %d", backend.Size())
+	}
+	return &Server{
+		name:      name,
+		backend:   backend,
+		readOnly:  readOnly,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}, nil
+}
+
+// Serve accepts connections on l and serves each of them in its own goroutine until the server is
+// closed, when it returns ErrServerClosed. It closes l on return.
+func (s *Server) Serve(l net.Listener) error {
+	defer l.Close()
+	if !s.track(func() { s.listeners[l] = struct{}{} }) {
+		return ErrServerClosed
+	}
+	defer s.untrack(func() { delete(s.listeners, l) })
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if s.isClosed() {
+				return ErrServerClosed
+			}
+			return fmt.Errorf("nbd: failed to accept connection: %w", err)
+		}
+		go func() {
+			if err := s.ServeConn(conn); err != nil && !errors.Is(err, ErrServerClosed) {
+				logrus.Warnf("NBD connection from %s ended: %v", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// ServeConn negotiates an export with the client on conn and serves its requests until the client
+// disconnects. It closes conn on return.
+func (s *Server) ServeConn(conn net.Conn) error {
+	defer conn.Close()
+	if !s.track(func() {
+		s.conns[conn] = struct{}{}
+		s.wg.Add(1)
+	}) {
+		return ErrServerClosed
+	}
+	defer s.untrack(func() {
+		delete(s.conns, conn)
+		s.wg.Done()
+	})
+
+	ok, err := s.handshake(conn)
+	if err != nil || !ok {
+		return err
+	}
+	logrus.Infof("NBD client %s connected to export %q", conn.RemoteAddr(), s.name)
+	err = s.transmit(conn)
+	if s.isClosed() {
+		return ErrServerClosed
+	}
+	logrus.Infof("NBD client %s disconnected", conn.RemoteAddr())
+	return err
+}
+
+// Close stops accepting connections, drops the connected clients and waits for the requests in
+// flight to complete. Writes that were not flushed stay with the backend.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	s.closed = true
+	var err error
+	for l := range s.listeners {
+		err = errors.Join(err, l.Close())
+	}
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// track runs add under the server lock unless the server is closed, and reports whether it ran.
+func (s *Server) track(add func()) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false
+	}
+	add()
+	return true
+}
+
+func (s *Server) untrack(remove func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remove()
+}
+
+func (s *Server) isClosed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.closed
+}
+
+// exports reports whether name selects the server's export.
+func (s *Server) exports(name string) bool {
+	return name == s.name || name == ""
+}
+
+// transmissionFlags describes the export and the commands it accepts.
+func (s *Server) transmissionFlags() uint16 {
+	flags := transHasFlags | transSendFlush | transSendFUA | transSendWriteZeroes | transCanMultiConn
+	if s.readOnly {
+		flags |= transReadOnly
+	}
+	if _, ok := s.backend.(Discarder); ok {
+		flags |= transSendTrim
+	}
+	return flags
+}
+
+// handshake runs the fixed newstyle negotiation. It reports whether the client picked the export
+// and moves on to the transmission phase; false without an error means the client aborted.
+func (s *Server) handshake(conn net.Conn) (bool, error) {
+	if err := writeFields(conn, initMagic, optMagic, flagFixedNewstyle|flagNoZeroes); err != nil {
+		return false, fmt.Errorf("nbd: failed to greet client: %w", err)
+	}
+	var clientFlags uint32
+	if err := binary.Read(conn, binary.BigEndian, &clientFlags); err != nil {
+		return false, fmt.Errorf("nbd: failed to read client flags: %w", err)
+	}
+	if clientFlags&^(clientFlagFixedNewstyle|clientFlagNoZeroes) != 0 {
+		return false, fmt.Errorf("nbd: unknown client flags %#x", clientFlags)
+	}
+
+	for {
+		var header struct {
+			Magic  uint64
+			Option uint32
+			Length uint32
+		}
+		if err := binary.Read(conn, binary.BigEndian, &header); err != nil {
+			return false, fmt.Errorf("nbd: failed to read option: %w", err)
+		}
+		if header.Magic != optMagic {
+			return false, fmt.Errorf("nbd: bad option magic %#x", header.Magic)
+		}
+		if header.Length > maxOptionLength {
+			return false, fmt.Errorf("nbd: option %d of %d bytes is too long", header.Option, header.Length)
+		}
+		data := make([]byte, header.Length)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return false, fmt.Errorf("nbd: failed to read option %d: %w", header.Option, err)
+		}
+
+		var err error
+		switch header.Option {
+		case optExportName:
+			// The old way to pick an export has no error reply: an unknown name ends the connection
+			if !s.exports(string(data)) {
+				return false, fmt.Errorf("nbd: client asked for unknown export %q", data)
+			}
+			fields := []any{uint64(s.backend.Size()), s.transmissionFlags()}
+			if clientFlags&clientFlagNoZeroes == 0 {
+				fields = append(fields, make([]byte, exportNameZeroes))
+			}
+			if err := writeFields(conn, fields...); err != nil {
+				return false, fmt.Errorf("nbd: failed to send export details: %w", err)
+			}
+			return true, nil
+		case optAbort:
+			return false, writeOptionReply(conn, header.Option, repAck)
+		case optList:
+			if len(data) != 0 {
+				err = writeOptionReply(conn, header.Option, repErrInvalid)
+				break
+			}
+			err = writeOptionReply(conn, header.Option, repServer, uint32(len(s.name)), []byte(s.name))
+			if err == nil {
+				err = writeOptionReply(conn, header.Option, repAck)
+			}
+		case optInfo, optGo:
+			var done bool
+			done, err = s.negotiateExport(conn, header.Option, data)
+			if err == nil && done {
+				return true, nil
+			}
+		default:
+			err = writeOptionReply(conn, header.Option, repErrUnsup)
+		}
+		if err != nil {
+			return false, fmt.Errorf("nbd: failed to reply to option %d: %w", header.Option, err)
+		}
+	}
+}
+
+// negotiateExport answers NBD_OPT_INFO and NBD_OPT_GO, whose data names the export and the
+// information the client wants. It reports whether the client picked the export with NBD_OPT_GO.
+func (s *Server) negotiateExport(conn net.Conn, option uint32, data []byte) (bool, error) {
+	if len(data) < 4 {
+		return false, writeOptionReply(conn, option, repErrInvalid)
+	}
+	nameLen := int(binary.BigEndian.Uint32(data))
+	if len(data) < 4+nameLen+2 {
+		return false, writeOptionReply(conn, option, repErrInvalid)
+	}
+	name := string(data[4 : 4+nameLen])
+	requests := data[4+nameLen+2:]
+	if len(requests) != 2*int(binary.BigEndian.Uint16(data[4+nameLen:])) {
+		return false, writeOptionReply(conn, option, repErrInvalid)
+	}
+	if !s.exports(name) {
+		return false, writeOptionReply(conn, option, repErrUnknown)
+	}
+
+	if err := writeOptionReply(conn, option, repInfo, infoExport, uint64(s.backend.Size()), s.transmissionFlags()); err != nil {
+		return false, err
+	}
+	for i := 0; i < len(requests); i += 2 {
+		if binary.BigEndian.Uint16(requests[i:]) == infoBlockSize {
+			// Any byte is addressable; 4 KiB requests suit every level
+			err := writeOptionReply(conn, option, repInfo, infoBlockSize, uint32(1), uint32(4096), uint32(MaxRequestLength))
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	if err := writeOptionReply(conn, option, repAck); err != nil {
+		return false, err
+	}
+	return option == optGo, nil
+}
+
+// request is the header of a transmission request.
+type request struct {
+	Magic  uint32
+	Flags  uint16
+	Type   uint16
+	Handle uint64
+	Offset uint64
+	Length uint32
+}
+
+// transmit serves the requests of a client until it disconnects. Every request runs in its own
+// goroutine, at most MaxInFlight at a time; replies are written whole, one at a time, in the order
+// requests complete.
+func (s *Server) transmit(conn net.Conn) error {
+	var (
+		replyMu  sync.Mutex
+		inflight sync.WaitGroup
+	)
+	defer inflight.Wait()
+	// A slot is taken before a write payload is read, which bounds the memory a connection holds
+	slots := make(chan struct{}, MaxInFlight)
+
+	for {
+		var req request
+		if err := binary.Read(conn, binary.BigEndian, &req); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return fmt.Errorf("nbd: failed to read request: %w", err)
+		}
+		if req.Magic != requestMagic {
+			return fmt.Errorf("nbd: bad request magic %#x", req.Magic)
+		}
+		if req.Type == cmdDisc {
+			return nil
+		}
+		slots <- struct{}{}
+		var payload []byte
+		if req.Type == cmdWrite {
+			// The payload has to be consumed to stay in sync, so an oversized one ends the connection
+			if req.Length > MaxRequestLength {
+				return fmt.Errorf("nbd: write of %d bytes exceeds the %d bytes allowed", req.Length, MaxRequestLength)
+			}
+			payload = make([]byte, req.Length)
+			if _, err := io.ReadFull(conn, payload); err != nil {
+				return fmt.Errorf("nbd: failed to read write payload: %w", err)
+			}
+		}
+
+		inflight.Add(1)
+		go func() {
+			defer func() {
+				<-slots
+				inflight.Done()
+			}()
+			data, errno := s.handle(req, payload)
+			if errno != 0 {
+				logrus.Debugf("NBD request %d (%d bytes at %d) failed: %v", req.Type, req.Length, req.Offset, errno)
+				data = nil
+			}
+			replyMu.Lock()
+			defer replyMu.Unlock()
+			if err := writeFields(conn, simpleReplyMagic, uint32(errno), req.Handle, data); err != nil {
+				logrus.Debugf("NBD failed to reply to request %d: %v", req.Handle, err)
+			}
+		}()
+	}
+}
+
+// handle runs one request against the backend, returning the data read or the error to report.
+func (s *Server) handle(req request, payload []byte) ([]byte, Errno) {
+	if req.Type == cmdFlush {
+		return nil, s.flush()
+	}
+	if req.Type == cmdRead && req.Length > MaxRequestLength {
+		return nil, EOVERFLOW
+	}
+
+	errno := func() Errno {
+		s.ioMu.RLock()
+		defer s.ioMu.RUnlock()
+
+		inBounds := s.inBounds(req.Offset, req.Length)
+		switch req.Type {
+		case cmdRead:
+			if !inBounds {
+				return EINVAL
+			}
+			payload = make([]byte, req.Length)
+			if _, err := s.backend.ReadAt(payload, int64(req.Offset)); err != nil && !errors.Is(err, io.EOF) {
+				logrus.Warnf("NBD read of %d bytes at offset %d failed: %v", req.Length, req.Offset, err)
+				return EIO
+			}
+			return 0
+		case cmdWrite, cmdWriteZeroes, cmdTrim:
+			if s.readOnly {
+				return EPERM
+			}
+			if !inBounds {
+				// Writing past the end runs out of space; trimming there makes no sense
+				if req.Type == cmdTrim {
+					return EINVAL
+				}
+				return ENOSPC
+			}
+			return s.modify(req, payload)
+		default:
+			return EINVAL
+		}
+	}()
+	if errno != 0 || req.Type == cmdRead {
+		return payload, errno
+	}
+	if req.Flags&cmdFlagFUA != 0 {
+		return nil, s.flush()
+	}
+	return nil, 0
+}
+
+// inBounds reports whether length bytes at off lie within the export.
+func (s *Server) inBounds(off uint64, length uint32) bool {
+	size := uint64(s.backend.Size())
+	return off <= size && uint64(length) <= size-off
+}
+
+// modify runs a write, write-zeroes or trim request.
+func (s *Server) modify(req request, payload []byte) Errno {
+	off, length := int64(req.Offset), int64(req.Length)
+	discarder, canDiscard := s.backend.(Discarder)
+	var err error
+	switch {
+	case req.Type == cmdTrim && !canDiscard:
+		// A trim is only a hint, which a backend that cannot discard may ignore
+		return 0
+	case req.Type == cmdTrim, req.Type == cmdWriteZeroes && req.Flags&cmdFlagNoHole == 0 && canDiscard:
+		err = discarder.Discard(off, length)
+	case req.Type == cmdWriteZeroes:
+		_, err = s.backend.WriteAt(make([]byte, length), off)
+	default:
+		_, err = s.backend.WriteAt(payload, off)
+	}
+	if err != nil {
+		logrus.Warnf("NBD request %d of %d bytes at offset %d failed: %v", req.Type, length, off, err)
+		return EIO
+	}
+	return 0
+}
+
+// flush persists the writes that completed so far, waiting for those in flight.
+func (s *Server) flush() Errno {
+	flusher, ok := s.backend.(Flusher)
+	if !ok {
+		return 0
+	}
+	s.ioMu.Lock()
+	defer s.ioMu.Unlock()
+	if err := flusher.Flush(); err != nil {
+		logrus.Warnf("NBD flush failed: %v", err)
+		return EIO
+	}
+	return 0
+}
+
+// writeOptionReply sends a reply to a handshake option, its data made of fields.
+func writeOptionReply(w io.Writer, option, replyType uint32, fields ...any) error {
+	data, err := encodeFields(fields...)
+	if err != nil {
+		return err
+	}
+	return writeFields(w, optReplyMagic, option, replyType, uint32(len(data)), data)
+}
+
+// writeFields sends fields big-endian in a single write.
+func writeFields(w io.Writer, fields ...any) error {
+	data, err := encodeFields(fields...)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+func encodeFields(fields ...any) ([]byte, error) {
+	var data []byte
+	for _, field := range fields {
+		var err error
+		if data, err = binary.Append(data, binary.BigEndian, field); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
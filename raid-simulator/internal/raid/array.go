@@ -0,0 +1,610 @@
+package raid
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/sirupsen/logrus"
+)
+
+const superblockFileName = "array.json"
+
+// journalFileName holds the write-ahead journal of arrays with parity.
+const journalFileName = "journal.log"
+
+// checksumFileSuffix is appended to a disk image's name to get the file holding its chunk checksums.
+const checksumFileSuffix = ".sum"
+
+// superblock describes a persisted array so later invocations can reopen it.
+type superblock struct {
+	UUID          string             `json:"uuid,omitempty"`   // arrays created before member superblocks have none, nor image headers
+	Events        uint64             `json:"events,omitempty"` // bumped by every save, see MemberSuperblock
+	Type          RaidType           `json:"type"`
+	StripeSz      int                `json:"stripe_size"`
+	Layout        ParityLayout       `json:"layout,omitempty"`
+	Groups        int                `json:"groups,omitempty"`
+	Copies        int                `json:"copies,omitempty"`
+	MirrorLayout  MirrorLayout       `json:"mirror_layout,omitempty"`
+	ReadPolicy    ReadPolicy         `json:"read_policy,omitempty"`
+	DiskSize      int                `json:"disk_size,omitempty"`       // declared size of every disk in bytes, 0 when disks grow on demand
+	HighWaterMark int                `json:"high_water_mark,omitempty"` // logical end of the data written so far
+	Disks         []superblockDisk   `json:"disks"`
+	Spares        []superblockDisk   `json:"spares,omitempty"`     // hot spares standing by, blank images outside the disk set
+	Generation    int                `json:"generation,omitempty"` // bumped by every completed reshape, names the files of the disk set
+	Reshape       *superblockReshape `json:"reshape,omitempty"`    // reshape in progress, if any
+}
+
+type superblockDisk struct {
+	ID     int       `json:"id"`
+	State  DiskState `json:"state"`
+	Image  string    `json:"image"`            // image file name, relative to the array directory unless absolute; deleted once removed
+	Faults *Faults   `json:"faults,omitempty"` // faults injected into the disk, kept across invocations
+}
+
+// superblockReshape records the disk set an array is being reshaped into and how far the copy got.
+type superblockReshape struct {
+	Type         RaidType         `json:"type"`
+	StripeSz     int              `json:"stripe_size"`
+	Layout       ParityLayout     `json:"layout,omitempty"`
+	Groups       int              `json:"groups,omitempty"`
+	Copies       int              `json:"copies,omitempty"`
+	MirrorLayout MirrorLayout     `json:"mirror_layout,omitempty"`
+	ReadPolicy   ReadPolicy       `json:"read_policy,omitempty"`
+	Disks        []superblockDisk `json:"disks"`
+	Checkpoint   int              `json:"checkpoint"`
+}
+
+func (sb *superblock) options() ControllerOptions {
+	return ControllerOptions{Layout: sb.Layout, Groups: sb.Groups, Copies: sb.Copies, MirrorLayout: sb.MirrorLayout, ReadPolicy: sb.ReadPolicy}
+}
+
+func (r *superblockReshape) options() ControllerOptions {
+	return ControllerOptions{Layout: r.Layout, Groups: r.Groups, Copies: r.Copies, MirrorLayout: r.MirrorLayout, ReadPolicy: r.ReadPolicy}
+}
+
+// memberSet is one generation of an array: its disk images, its journal and the controller striping across them.
+type memberSet struct {
+	controller RAIDController
+	disks      []*Disk
+	journal    Journal // nil for levels without parity
+}
+
+// Array is a RAID controller whose member disks are image files in a directory,
+// alongside a superblock recording the level, geometry and disk states.
+type Array struct {
+	RAIDController
+	dir     string
+	sb      superblock
+	members *memberSet
+	reshape *Reshape   // reshape in progress, nil otherwise
+	target  *memberSet // disk set being reshaped into, nil otherwise
+
+	lifecycle lifecycle // event subscribers and rebuilds onto hot spares
+}
+
+// CreateArray creates a new file-backed array in dir, which must not already hold one.
+// Every disk holds diskSize bytes, or grows on demand when diskSize is 0.
+func CreateArray(dir string, raidType RaidType, diskCount, stripeSz, diskSize int, opts ControllerOptions) (*Array, error) {
+	if _, err := lookupFactory(raidType); err != nil {
+		return nil, err
+	}
+	if diskCount <= 0 {
+		return nil, fmt.Errorf("disk count must be greater than 0. Provided: %d", diskCount)
+	}
+	if _, err := diskChunks(diskSize, stripeSz); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, superblockFileName)); err == nil {
+		return nil, fmt.Errorf("an array already exists in %s", dir)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create array directory %s: %w", dir, err)
+	}
+	if err := os.Remove(filepath.Join(dir, journalName(0))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove leftover journal: %w", err)
+	}
+
+	uuid, err := newArrayUUID()
+	if err != nil {
+		return nil, err
+	}
+	sb := superblock{
+		UUID:         uuid,
+		Type:         raidType,
+		StripeSz:     stripeSz,
+		Layout:       opts.Layout,
+		Groups:       opts.Groups,
+		Copies:       opts.Copies,
+		MirrorLayout: opts.MirrorLayout,
+		ReadPolicy:   opts.ReadPolicy,
+		DiskSize:     diskSize,
+		Disks:        newSuperblockDisks(diskCount, 0),
+	}
+	array, err := openArray(dir, sb)
+	if err != nil {
+		return nil, err
+	}
+	// Leftover images from an earlier array in the same directory must not leak into the new one
+	for _, disk := range array.members.disks {
+		if err := disk.reset(DiskStateOnline); err != nil {
+			array.closeDisks()
+			return nil, err
+		}
+	}
+	if restorer, ok := array.members.controller.(highWaterMarkRestorer); ok {
+		restorer.restoreHighWaterMark(0)
+	}
+	if err := array.Save(); err != nil {
+		array.closeDisks()
+		return nil, err
+	}
+	return array, nil
+}
+
+// OpenArray reopens the array previously created in dir.
+func OpenArray(dir string) (*Array, error) {
+	raw, err := os.ReadFile(filepath.Join(dir, superblockFileName))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no array found in %s", dir)
+		}
+		return nil, fmt.Errorf("failed to read superblock: %w", err)
+	}
+	var sb superblock
+	if err := json.Unmarshal(raw, &sb); err != nil {
+		return nil, fmt.Errorf("failed to parse superblock in %s: %w", dir, err)
+	}
+	array, err := openArray(dir, sb)
+	if err != nil {
+		return nil, err
+	}
+	if sb.UUID != "" {
+		if err := array.checkMembers(); err != nil {
+			array.closeDisks()
+			return nil, err
+		}
+	}
+	return array, nil
+}
+
+func openArray(dir string, sb superblock) (*Array, error) {
+	members, err := openMembers(dir, sb.Type, sb.StripeSz, sb.DiskSize, sb.options(), sb.Disks, journalName(sb.Generation), sb.UUID != "")
+	if err != nil {
+		return nil, err
+	}
+	// Superblocks written before the mark was recorded fall back to the extent allocated on the disks
+	if restorer, ok := members.controller.(highWaterMarkRestorer); ok && sb.HighWaterMark > 0 {
+		restorer.restoreHighWaterMark(sb.HighWaterMark)
+	}
+	array := &Array{RAIDController: members.controller, dir: dir, sb: sb, members: members}
+	if sb.Reshape == nil {
+		return array, nil
+	}
+
+	target, err := openMembers(dir, sb.Reshape.Type, sb.Reshape.StripeSz, sb.DiskSize, sb.Reshape.options(), sb.Reshape.Disks, journalName(sb.Generation+1), sb.UUID != "")
+	if err != nil {
+		array.closeDisks()
+		return nil, err
+	}
+	array.target = target
+	if err := array.startReshape(sb.Reshape.Checkpoint); err != nil {
+		array.closeDisks()
+		return nil, err
+	}
+	logrus.Debugf("[%s] Resuming reshape into %s at %d bytes.", sb.Type, sb.Reshape.Type, sb.Reshape.Checkpoint)
+	return array, nil
+}
+
+// openMembers opens the disk images of one disk set and builds its controller. With headers, the
+// images reserve a header for their member superblock ahead of the chunks.
+// Writes interrupted by a crash are replayed from the journal before the controller serves anything.
+func openMembers(dir string, raidType RaidType, stripeSz, diskSize int, opts ControllerOptions, sbDisks []superblockDisk, journalFile string, headers bool) (*memberSet, error) {
+	chunkLimit, err := diskChunks(diskSize, stripeSz)
+	if err != nil {
+		return nil, err
+	}
+	open := blockdev.OpenFile
+	if headers {
+		open = blockdev.OpenFileWithHeader
+	}
+	members := &memberSet{}
+	for _, member := range sbDisks {
+		var dev blockdev.Device = blockdev.NewMemory(stripeSz) // the slot of a removed disk stays empty
+		if member.State != DiskStateRemoved {
+			if dev, err = open(imagePath(dir, member.Image), stripeSz); err != nil {
+				members.close()
+				return nil, err
+			}
+		}
+		sums, err := loadChecksums(imagePath(dir, member.Image+checksumFileSuffix))
+		if err != nil {
+			dev.Close()
+			members.close()
+			return nil, err
+		}
+		disk := newDiskWithChecksums(member.ID, member.State, dev, chunkLimit, sums)
+		if member.Faults != nil {
+			if err := disk.InjectFaults(*member.Faults); err != nil {
+				dev.Close()
+				members.close()
+				return nil, fmt.Errorf("invalid faults for disk %d: %w", member.ID, err)
+			}
+		}
+		members.disks = append(members.disks, disk)
+	}
+
+	controller, err := NewControllerWithOptions(raidType, members.disks, stripeSz, opts)
+	if err != nil {
+		members.close()
+		return nil, err
+	}
+	members.controller = controller
+
+	if journaled, ok := controller.(Journaled); ok {
+		journal, err := OpenFileJournal(filepath.Join(dir, journalFile))
+		if err != nil {
+			members.close()
+			return nil, err
+		}
+		members.journal = journal
+		replayed, err := journaled.AttachJournal(journal)
+		if err != nil {
+			members.close()
+			return nil, err
+		}
+		if replayed > 0 {
+			logrus.Infof("[%s] Recovered %d interrupted stripe writes from the journal in %s.", raidType, replayed, dir)
+		}
+	}
+	return members, nil
+}
+
+// save records the disk states and faults of the set in sbDisks and writes the chunk checksums next to each image.
+func (m *memberSet) save(dir string, sbDisks []superblockDisk) error {
+	// Disk states are read under the controller's lock, as rebuilds in the background change them
+	statuses := m.controller.Status().Disks
+	for i, disk := range m.disks {
+		sbDisks[i].State = statuses[i].State
+		sbDisks[i].Faults = nil
+		if faults := disk.Faults(); !faults.IsZero() {
+			sbDisks[i].Faults = &faults
+		}
+		if sbDisks[i].State == DiskStateRemoved {
+			continue
+		}
+		if err := saveChecksums(imagePath(dir, sbDisks[i].Image+checksumFileSuffix), disk.Checksums()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *memberSet) close() error {
+	var firstErr error
+	if m.journal != nil {
+		firstErr = m.journal.Close()
+	}
+	for _, disk := range m.disks {
+		if err := disk.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// newSuperblockDisks describes count online disks whose files belong to the given generation.
+func newSuperblockDisks(count, generation int) []superblockDisk {
+	disks := make([]superblockDisk, count)
+	for i := range disks {
+		image := fmt.Sprintf("disk-%d.img", i)
+		if generation > 0 {
+			image = fmt.Sprintf("disk-%d.g%d.img", i, generation)
+		}
+		disks[i] = superblockDisk{ID: i, State: DiskStateOnline, Image: image}
+	}
+	return disks
+}
+
+// imagePath resolves the file of a disk image recorded in the superblock.
+func imagePath(dir, image string) string {
+	if filepath.IsAbs(image) {
+		return image
+	}
+	return filepath.Join(dir, image)
+}
+
+// journalName returns the journal file of the disk set of the given generation.
+func journalName(generation int) string {
+	if generation > 0 {
+		return fmt.Sprintf("journal.g%d.log", generation)
+	}
+	return journalFileName
+}
+
+// Dir returns the directory holding the array's superblock and disk images.
+func (a *Array) Dir() string {
+	return a.dir
+}
+
+// DiskSize returns the declared size of every member disk in bytes, 0 when they grow on demand.
+func (a *Array) DiskSize() int {
+	return a.sb.DiskSize
+}
+
+// Disk returns the member disk at index, for instance to inject faults into it.
+func (a *Array) Disk(index int) (*Disk, error) {
+	if index < 0 || index >= len(a.members.disks) {
+		return nil, fmt.Errorf("disk index %d out of bounds for %d disks", index, len(a.members.disks))
+	}
+	return a.members.disks[index], nil
+}
+
+// HealthReport reports the health of the array, see NewHealthReport. While the array is being
+// reshaped no parity placement is listed, as stripes live in either layout.
+func (a *Array) HealthReport(stripes int) HealthReport {
+	report := NewHealthReport(a.RAIDController, stripes)
+	report.UUID, report.Events, report.Spares = a.sb.UUID, a.sb.Events, a.Spares()
+	return report
+}
+
+// StripeMap maps count stripes starting at first if the array's level places its chunks by a parity layout.
+func (a *Array) StripeMap(first, count int) ([]MapStripe, error) {
+	if a.reshape != nil {
+		return nil, fmt.Errorf("cannot map stripes while the array is being reshaped")
+	}
+	mapper, ok := a.RAIDController.(StripeMapper)
+	if !ok {
+		return nil, fmt.Errorf("%s arrays have no parity layout to map", a.sb.Type)
+	}
+	return mapper.StripeMap(first, count)
+}
+
+// Discard discards a logical byte range if the array's level can, releasing the chunks it covers on the disks.
+func (a *Array) Discard(offset, length int) error {
+	if a.reshape != nil {
+		return fmt.Errorf("cannot discard while the array is being reshaped")
+	}
+	discarder, ok := a.RAIDController.(Discarder)
+	if !ok {
+		return fmt.Errorf("%s arrays cannot discard", a.sb.Type)
+	}
+	return discarder.Discard(offset, length)
+}
+
+// Scrub verifies and repairs the array if its level keeps parity to check the data against.
+func (a *Array) Scrub(progress ProgressFunc) (ScrubReport, error) {
+	if a.reshape != nil {
+		return ScrubReport{}, fmt.Errorf("cannot scrub while the array is being reshaped")
+	}
+	scrubber, ok := a.RAIDController.(Scrubber)
+	if !ok {
+		return ScrubReport{}, fmt.Errorf("%s arrays have no parity to scrub", a.sb.Type)
+	}
+	return scrubber.Scrub(progress)
+}
+
+// CrashAfter arms a simulated crash after n shards of the next stripe write reach their disks.
+func (a *Array) CrashAfter(n int) error {
+	journaled, ok := a.members.controller.(Journaled)
+	if !ok {
+		return fmt.Errorf("%s arrays have no journaled stripe writes to interrupt", a.sb.Type)
+	}
+	journaled.CrashAfter(n)
+	return nil
+}
+
+// StartReshape begins migrating the array's contents into a new set of disks laid out as target.
+// The array keeps serving reads and writes; call ContinueReshape to copy the contents.
+func (a *Array) StartReshape(target ReshapeTarget) error {
+	if a.reshape != nil {
+		return fmt.Errorf("a reshape into %s is already in progress", a.sb.Reshape.Type)
+	}
+	if _, err := lookupFactory(target.Type); err != nil {
+		return err
+	}
+	if target.DiskCount <= 0 {
+		return fmt.Errorf("disk count must be greater than 0. Provided: %d", target.DiskCount)
+	}
+	if a.Status().State != ArrayStateOptimal {
+		return fmt.Errorf("cannot reshape a %s array, rebuild it first", a.Status().State)
+	}
+
+	generation := a.sb.Generation + 1
+	sbReshape := &superblockReshape{
+		Type:         target.Type,
+		StripeSz:     target.StripeSz,
+		Layout:       target.Layout,
+		Groups:       target.Groups,
+		Copies:       target.Copies,
+		MirrorLayout: target.MirrorLayout,
+		ReadPolicy:   target.ReadPolicy,
+		Disks:        newSuperblockDisks(target.DiskCount, generation),
+	}
+	if err := os.Remove(filepath.Join(a.dir, journalName(generation))); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove leftover journal: %w", err)
+	}
+	members, err := openMembers(a.dir, target.Type, target.StripeSz, a.sb.DiskSize, sbReshape.options(), sbReshape.Disks, journalName(generation), a.sb.UUID != "")
+	if err != nil {
+		return err
+	}
+	if a.sb.DiskSize > 0 && members.controller.Capacity() < a.HighWaterMark() {
+		capacity := members.controller.Capacity()
+		members.close()
+		return fmt.Errorf("%s with %d disks holds %d bytes, less than the %d bytes written: %w", target.Type, target.DiskCount, capacity, a.HighWaterMark(), ErrOutOfSpace)
+	}
+	for _, disk := range members.disks {
+		if err := disk.reset(DiskStateOnline); err != nil {
+			members.close()
+			return err
+		}
+	}
+
+	a.target = members
+	a.sb.Reshape = sbReshape
+	if err := a.startReshape(0); err != nil {
+		a.target, a.sb.Reshape = nil, nil
+		members.close()
+		return err
+	}
+	logrus.Infof("[%s] Reshaping into %s with %d disks and stripe size %d.", a.sb.Type, target.Type, target.DiskCount, target.StripeSz)
+	return a.Save()
+}
+
+func (a *Array) startReshape(checkpoint int) error {
+	reshape, err := NewReshape(a.members.controller, a.target.controller, checkpoint)
+	if err != nil {
+		return err
+	}
+	a.reshape = reshape
+	a.RAIDController = reshape
+	return nil
+}
+
+// ContinueReshape copies up to steps more blocks into the new disk set (all remaining ones if
+// steps <= 0), saving the checkpoint after each so an interrupted reshape resumes where it stopped.
+// Once everything is copied the new disk set replaces the old one. It reports whether the reshape finished.
+func (a *Array) ContinueReshape(steps int, progress ProgressFunc) (bool, error) {
+	if a.reshape == nil {
+		return false, fmt.Errorf("no reshape in progress")
+	}
+	for step := 0; steps <= 0 || step < steps; step++ {
+		done, err := a.reshape.Step()
+		if err != nil {
+			return false, err
+		}
+		a.sb.Reshape.Checkpoint = a.reshape.Checkpoint()
+		if err := a.Save(); err != nil {
+			return false, err
+		}
+		if progress != nil {
+			status := a.reshape.ReshapeStatus()
+			progress(status.Checkpoint, status.Total)
+		}
+		if done {
+			return true, a.finishReshape()
+		}
+	}
+	return false, nil
+}
+
+// finishReshape makes the new disk set current and deletes the files of the old one.
+func (a *Array) finishReshape() error {
+	old, oldDisks, oldJournal := a.members, a.sb.Disks, journalName(a.sb.Generation)
+	// The copy went block by block, so the target's own mark may lie past the data actually written
+	if restorer, ok := a.target.controller.(highWaterMarkRestorer); ok {
+		restorer.restoreHighWaterMark(old.controller.HighWaterMark())
+	}
+
+	reshaped := a.sb.Reshape
+	a.sb.Type, a.sb.StripeSz, a.sb.Disks = reshaped.Type, reshaped.StripeSz, reshaped.Disks
+	a.sb.Layout, a.sb.Groups, a.sb.Copies, a.sb.MirrorLayout, a.sb.ReadPolicy = reshaped.Layout, reshaped.Groups, reshaped.Copies, reshaped.MirrorLayout, reshaped.ReadPolicy
+	a.sb.Generation++
+	a.sb.Reshape = nil
+	a.members, a.target, a.reshape = a.target, nil, nil
+	a.RAIDController = a.members.controller
+	if err := a.Save(); err != nil {
+		return err
+	}
+	logrus.Infof("[%s] Reshape done, array now has %d disks with stripe size %d.", a.sb.Type, len(a.sb.Disks), a.sb.StripeSz)
+
+	if err := old.close(); err != nil {
+		return err
+	}
+	files := []string{oldJournal}
+	for _, disk := range oldDisks {
+		files = append(files, disk.Image, disk.Image+checksumFileSuffix, disk.Image+blockdev.AllocationMapSuffix)
+	}
+	for _, file := range files {
+		if err := os.Remove(imagePath(a.dir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s of the old disk set: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// Save records the current disk states in the superblock and the chunk checksums next to each
+// image, and bumps the event counter in the member superblock of every disk that has not failed.
+func (a *Array) Save() error {
+	a.sb.HighWaterMark = a.members.controller.HighWaterMark()
+	if err := a.members.save(a.dir, a.sb.Disks); err != nil {
+		return err
+	}
+	if a.target != nil {
+		if err := a.target.save(a.dir, a.sb.Reshape.Disks); err != nil {
+			return err
+		}
+	}
+	if a.sb.UUID != "" {
+		if err := a.writeMemberSuperblocks(); err != nil {
+			return err
+		}
+	}
+	raw, err := json.MarshalIndent(a.sb, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode superblock: %w", err)
+	}
+
+	// Write to a temporary file first so a crash never leaves a half-written superblock behind
+	path := filepath.Join(a.dir, superblockFileName)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write superblock: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace superblock: %w", err)
+	}
+	return nil
+}
+
+// Close waits for the rebuilds onto hot spares, saves the superblock and releases every disk image.
+func (a *Array) Close() error {
+	a.Wait()
+	saveErr := a.Save()
+	closeErr := a.closeDisks()
+	if saveErr != nil {
+		return saveErr
+	}
+	return closeErr
+}
+
+func (a *Array) closeDisks() error {
+	err := a.members.close()
+	if a.target != nil {
+		if targetErr := a.target.close(); err == nil {
+			err = targetErr
+		}
+	}
+	return err
+}
+
+// loadChecksums reads the little-endian CRC-32 list stored at path. A missing file yields no checksums.
+func loadChecksums(path string) ([]uint32, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checksums %s: %w", path, err)
+	}
+	sums := make([]uint32, len(raw)/4)
+	for i := range sums {
+		sums[i] = binary.LittleEndian.Uint32(raw[i*4:])
+	}
+	return sums, nil
+}
+
+func saveChecksums(path string, sums []uint32) error {
+	raw := make([]byte, 0, len(sums)*4)
+	for _, sum := range sums {
+		raw = binary.LittleEndian.AppendUint32(raw, sum)
+	}
+	if err := os.WriteFile(path, raw, 0644); err != nil {
+		return fmt.Errorf("failed to write checksums %s: %w", path, err)
+	}
+	return nil
+}
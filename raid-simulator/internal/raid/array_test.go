@@ -0,0 +1,86 @@
+package raid_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArray_PersistsAcrossReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "array")
+	data := []byte("PersistentRAID5Data!")
+
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid5, 3, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	read, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	assert.NoError(t, array.ClearDisk(1))
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+
+	status := array.Status()
+	assert.Equal(t, raid.ArrayStateDegraded, status.State)
+	assert.Equal(t, raid.DiskStateFailed, status.Disks[1].State)
+	assert.Equal(t, 0, status.Disks[1].Chunks)
+
+	read, err = array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+}
+
+func TestArray_AllLevels(t *testing.T) {
+	for _, raidType := range raid.SupportedRaidTypes() {
+		t.Run(string(raidType), func(t *testing.T) {
+			dir := t.TempDir()
+			data := []byte("EveryLevelPersists")
+
+			array, err := raid.CreateArray(dir, raidType, 8, 2, 0, raid.ControllerOptions{}) // enough disks for two RAID6 groups
+			assert.NoError(t, err)
+			assert.NoError(t, array.Write(data, 3))
+			assert.NoError(t, array.Close())
+
+			array, err = raid.OpenArray(dir)
+			assert.NoError(t, err)
+			defer array.Close()
+
+			read, err := array.Read(3, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, read)
+		})
+	}
+}
+
+func TestArray_CreateTwiceFails(t *testing.T) {
+	dir := t.TempDir()
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid1, 2, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Close())
+
+	_, err = raid.CreateArray(dir, raid.RaidTypeRaid1, 2, 4, 0, raid.ControllerOptions{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "already exists")
+}
+
+func TestArray_OpenMissing(t *testing.T) {
+	_, err := raid.OpenArray(t.TempDir())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no array found")
+}
+
+func TestArray_InvalidGeometry(t *testing.T) {
+	_, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid6, 3, 4, 0, raid.ControllerOptions{})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "RAID6 requires at least 4 disks")
+}
@@ -0,0 +1,232 @@
+package raid
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/sirupsen/logrus"
+)
+
+// MemberStatus tells how AssembleArray used the image it found for a slot, if any.
+type MemberStatus string
+
+const (
+	MemberCurrent MemberStatus = "current" // up to date, used as is
+	MemberStale   MemberStatus = "stale"   // missed updates of the array, failed to be replaced and rebuilt
+	MemberForced  MemberStatus = "forced"  // missed updates of the array, used anyway as asked
+	MemberFailed  MemberStatus = "failed"  // recorded as failed by the array
+	MemberMissing MemberStatus = "missing" // no image found, failed to be replaced and rebuilt
+)
+
+// AssembledMember describes one slot of an assembled array.
+type AssembledMember struct {
+	Slot      int          `json:"slot"`
+	Image     string       `json:"image"`
+	Events    uint64       `json:"events,omitempty"` // event counter of the image's member superblock
+	State     DiskState    `json:"state"`            // state the disk is assembled in
+	Status    MemberStatus `json:"status"`
+	Reordered bool         `json:"reordered,omitempty"` // the image came out of slot order among the images used
+}
+
+// SkippedImage is an image AssembleArray did not use, and why.
+type SkippedImage struct {
+	Image  string `json:"image"`
+	Reason string `json:"reason"`
+}
+
+// AssembleReport describes how AssembleArray put an array back together from its member images.
+type AssembleReport struct {
+	UUID    string            `json:"uuid"`
+	Type    RaidType          `json:"type"`
+	Events  uint64            `json:"events"` // event counter of the most recent members
+	Members []AssembledMember `json:"members"`
+	Skipped []SkippedImage    `json:"skipped,omitempty"`
+}
+
+// scannedImage is a candidate member found by AssembleArray.
+type scannedImage struct {
+	path     string
+	position int
+	msb      MemberSuperblock
+}
+
+// AssembleArray puts an array back together in dir from the member superblocks of disk images,
+// like mdadm --assemble: it places every image in the slot its superblock names, whatever order
+// or file names the images come in, and rewrites the array's superblock in dir. Without images it
+// scans dir for *.img files.
+//
+// The members with the highest event counter describe the array. Members that missed updates are
+// stale and assembled failed, to be replaced and rebuilt, unless force asks to use them anyway
+// (their contents may then be out of date). Slots without an image are missing and failed as well.
+// Images without a member superblock, or of an older generation of the array, are skipped; images
+// of several arrays are an error. Faults injected into the disks are not recorded in member
+// superblocks and are lost.
+func AssembleArray(dir string, images []string, force bool) (*Array, AssembleReport, error) {
+	var report AssembleReport
+	if len(images) == 0 {
+		var err error
+		if images, err = filepath.Glob(filepath.Join(dir, "*.img")); err != nil {
+			return nil, report, fmt.Errorf("failed to scan %s for disk images: %w", dir, err)
+		}
+		// Number slots naturally, so disk-10.img comes after disk-9.img
+		slices.SortFunc(images, func(a, b string) int {
+			return cmp.Or(cmp.Compare(len(a), len(b)), cmp.Compare(a, b))
+		})
+	}
+
+	var scanned []scannedImage
+	for position, image := range images {
+		header, err := blockdev.ReadImageHeader(image)
+		if err != nil {
+			return nil, report, err
+		}
+		msb, ok, err := decodeMemberSuperblock(header)
+		switch {
+		case err != nil:
+			report.Skipped = append(report.Skipped, SkippedImage{Image: image, Reason: err.Error()})
+		case !ok:
+			report.Skipped = append(report.Skipped, SkippedImage{Image: image, Reason: "no member superblock"})
+		default:
+			scanned = append(scanned, scannedImage{path: image, position: position, msb: msb})
+		}
+	}
+	if len(scanned) == 0 {
+		return nil, report, fmt.Errorf("no member superblock found in %d disk images", len(images))
+	}
+	for _, image := range scanned[1:] {
+		if image.msb.ArrayUUID != scanned[0].msb.ArrayUUID {
+			return nil, report, fmt.Errorf("the disk images belong to several arrays: %s holds a member of %s, %s of %s",
+				scanned[0].path, scanned[0].msb.ArrayUUID, image.path, image.msb.ArrayUUID)
+		}
+	}
+
+	// The most recent members describe the array; the others may be stale
+	slices.SortStableFunc(scanned, func(a, b scannedImage) int { return cmp.Compare(b.msb.Events, a.msb.Events) })
+	fresh := scanned[0].msb
+	if fresh.Reshaping {
+		return nil, report, fmt.Errorf("array %s was being reshaped; its disk sets cannot be assembled", fresh.ArrayUUID)
+	}
+	report.UUID, report.Type, report.Events = fresh.ArrayUUID, fresh.Type, fresh.Events
+
+	slots := make([]*scannedImage, len(fresh.Disks))
+	for i := range scanned {
+		image := &scanned[i]
+		switch {
+		case image.msb.Generation != fresh.Generation:
+			report.Skipped = append(report.Skipped, SkippedImage{Image: image.path, Reason: fmt.Sprintf("from generation %d of the array, not %d", image.msb.Generation, fresh.Generation)})
+		case image.msb.Slot < 0 || image.msb.Slot >= len(slots):
+			report.Skipped = append(report.Skipped, SkippedImage{Image: image.path, Reason: fmt.Sprintf("slot %d out of range", image.msb.Slot)})
+		case slots[image.msb.Slot] != nil:
+			report.Skipped = append(report.Skipped, SkippedImage{Image: image.path, Reason: fmt.Sprintf("duplicate of slot %d, older than %s", image.msb.Slot, slots[image.msb.Slot].path)})
+		default:
+			slots[image.msb.Slot] = image
+		}
+	}
+
+	sb := superblock{
+		UUID:          fresh.ArrayUUID,
+		Events:        fresh.Events,
+		Type:          fresh.Type,
+		StripeSz:      fresh.StripeSz,
+		Layout:        fresh.Layout,
+		Groups:        fresh.Groups,
+		Copies:        fresh.Copies,
+		MirrorLayout:  fresh.MirrorLayout,
+		ReadPolicy:    fresh.ReadPolicy,
+		DiskSize:      fresh.DiskSize,
+		HighWaterMark: fresh.HighWaterMark,
+		Generation:    fresh.Generation,
+	}
+	// Images out of order come at another rank among the images used than their slot does
+	var placed []*scannedImage
+	for _, image := range slots {
+		if image != nil {
+			placed = append(placed, image)
+		}
+	}
+	byPosition := slices.Clone(placed)
+	slices.SortFunc(byPosition, func(a, b *scannedImage) int { return cmp.Compare(a.position, b.position) })
+	reordered := make(map[*scannedImage]bool)
+	for rank, image := range placed {
+		reordered[image] = byPosition[rank] != image
+	}
+
+	canonical := newSuperblockDisks(len(slots), fresh.Generation)
+	for slot, image := range slots {
+		member := AssembledMember{Slot: slot, State: fresh.Disks[slot], Status: MemberCurrent}
+		if image != nil {
+			member.Image, member.Events, member.Reordered = image.path, image.msb.Events, reordered[image]
+		} else {
+			member.Image = missingImage(dir, canonical[slot].Image, slots)
+		}
+		switch {
+		case member.State.isFailed():
+			member.Status, member.Reordered = MemberFailed, false
+		case image == nil:
+			member.State, member.Status = DiskStateFailed, MemberMissing
+		case image.msb.Events < fresh.Events && force:
+			member.Status = MemberForced
+		case image.msb.Events < fresh.Events:
+			member.State, member.Status = DiskStateFailed, MemberStale
+		}
+		sb.Disks = append(sb.Disks, superblockDisk{ID: slot, State: member.State, Image: relativeImage(dir, member.Image)})
+		report.Members = append(report.Members, member)
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, report, fmt.Errorf("failed to create array directory %s: %w", dir, err)
+	}
+	array, err := openArray(dir, sb)
+	if err != nil {
+		return nil, report, err
+	}
+	if array.Status().State == ArrayStateFailed {
+		array.closeDisks()
+		return nil, report, fmt.Errorf("cannot assemble %s array %s: too many members are missing or stale (force uses stale members anyway)", sb.Type, sb.UUID)
+	}
+	if err := array.Save(); err != nil {
+		array.closeDisks()
+		return nil, report, err
+	}
+	for _, member := range report.Members {
+		if member.Status != MemberCurrent || member.Reordered {
+			logrus.Infof("[%s] Slot %d is %s: %s (events %d, reordered %t).", sb.Type, member.Slot, member.Status, member.Image, member.Events, member.Reordered)
+		}
+	}
+	return array, report, nil
+}
+
+// missingImage names a blank image standing in for a missing member: the slot's usual image in
+// dir, unless another member's image already goes by that name.
+func missingImage(dir, name string, slots []*scannedImage) string {
+	path := filepath.Join(dir, name)
+	for _, image := range slots {
+		if image != nil && sameFile(image.path, path) {
+			return filepath.Join(dir, "missing-"+name)
+		}
+	}
+	return path
+}
+
+// relativeImage records an image path relative to dir when it lies inside, absolute otherwise.
+func relativeImage(dir, image string) string {
+	absDir, errDir := filepath.Abs(dir)
+	absImage, errImage := filepath.Abs(image)
+	if errDir != nil || errImage != nil {
+		return image
+	}
+	if rel, err := filepath.Rel(absDir, absImage); err == nil && filepath.IsLocal(rel) {
+		return rel
+	}
+	return absImage
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
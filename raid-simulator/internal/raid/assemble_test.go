@@ -0,0 +1,239 @@
+package raid
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/stretchr/testify/assert"
+)
+
+// readMemberSuperblock decodes the member superblock in the header of an image.
+func readMemberSuperblock(t *testing.T, image string) (MemberSuperblock, bool) {
+	t.Helper()
+	header, err := blockdev.ReadImageHeader(image)
+	assert.NoError(t, err)
+	msb, ok, err := decodeMemberSuperblock(header)
+	assert.NoError(t, err)
+	return msb, ok
+}
+
+// createTestArray creates an array in a new directory holding data, and closes it.
+func createTestArray(t *testing.T, raidType RaidType, diskCount int, data []byte) string {
+	t.Helper()
+	dir := t.TempDir()
+	array, err := CreateArray(dir, raidType, diskCount, 4, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+	return dir
+}
+
+// moveImage renames a disk image together with its checksum and allocation files.
+func moveImage(t *testing.T, from, to string) {
+	t.Helper()
+	for _, suffix := range []string{"", checksumFileSuffix, blockdev.AllocationMapSuffix} {
+		assert.NoError(t, os.Rename(from+suffix, to+suffix))
+	}
+}
+
+// copyImage copies a disk image together with its checksum and allocation files.
+func copyImage(t *testing.T, from, to string) {
+	t.Helper()
+	for _, suffix := range []string{"", checksumFileSuffix, blockdev.AllocationMapSuffix} {
+		raw, err := os.ReadFile(from + suffix)
+		assert.NoError(t, err)
+		assert.NoError(t, os.WriteFile(to+suffix, raw, 0644))
+	}
+}
+
+func TestArray_WritesMemberSuperblocks(t *testing.T) {
+	dir := createTestArray(t, RaidTypeRaid5, 4, []byte("MemberSuperblocks"))
+	array, err := OpenArray(dir)
+	assert.NoError(t, err)
+	report := array.HealthReport(0)
+	assert.NotEmpty(t, report.UUID)
+
+	for slot := range 4 {
+		msb, ok := readMemberSuperblock(t, filepath.Join(dir, fmt.Sprintf("disk-%d.img", slot)))
+		if assert.True(t, ok) {
+			assert.Equal(t, report.UUID, msb.ArrayUUID)
+			assert.Equal(t, slot, msb.Slot)
+			assert.Equal(t, RaidTypeRaid5, msb.Type)
+			assert.Equal(t, 4, msb.StripeSz)
+			assert.Equal(t, report.Events, msb.Events)
+			assert.Len(t, msb.Disks, 4)
+		}
+	}
+
+	// A failed disk stops receiving superblocks, the others keep counting events
+	assert.NoError(t, array.ClearDisk(2))
+	assert.NoError(t, array.Close())
+	_, ok := readMemberSuperblock(t, filepath.Join(dir, "disk-2.img"))
+	assert.False(t, ok, "wiped with the disk")
+	msb, _ := readMemberSuperblock(t, filepath.Join(dir, "disk-0.img"))
+	assert.Equal(t, report.Events+1, msb.Events)
+	assert.Equal(t, []DiskState{DiskStateOnline, DiskStateOnline, DiskStateFailed, DiskStateOnline}, msb.Disks)
+}
+
+func TestAssembleArray_SwappedImages(t *testing.T) {
+	data := []byte("SwappedImagesStayInTheirSlots")
+	dir := createTestArray(t, RaidTypeRaid5, 4, data)
+	disk0, disk1 := filepath.Join(dir, "disk-0.img"), filepath.Join(dir, "disk-1.img")
+	moveImage(t, disk0, disk0+".tmp")
+	moveImage(t, disk1, disk0)
+	moveImage(t, disk0+".tmp", disk1)
+
+	_, err := OpenArray(dir)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "out of order")
+	}
+
+	array, report, err := AssembleArray(dir, nil, false)
+	assert.NoError(t, err)
+	assert.Len(t, report.Members, 4)
+	assert.Equal(t, disk1, report.Members[0].Image)
+	assert.Equal(t, disk0, report.Members[1].Image)
+	for i, member := range report.Members {
+		assert.Equal(t, MemberCurrent, member.Status)
+		assert.Equal(t, i < 2, member.Reordered, "slot %d", i)
+	}
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, ArrayStateOptimal, array.Status().State)
+	assert.NoError(t, array.Close())
+}
+
+// staleArray returns an array whose disk 1 missed the last write: "OldData!" was overwritten
+// with "NewData!" while it was away.
+func staleArray(t *testing.T, raidType RaidType, diskCount int) string {
+	t.Helper()
+	dir := createTestArray(t, raidType, diskCount, []byte("OldData!"))
+	disk1 := filepath.Join(dir, "disk-1.img")
+	backup := filepath.Join(t.TempDir(), "disk-1.img")
+	copyImage(t, disk1, backup)
+
+	array, err := OpenArray(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write([]byte("NewData!"), 0))
+	assert.NoError(t, array.Close())
+	copyImage(t, backup, disk1)
+	return dir
+}
+
+func TestAssembleArray_StaleMember(t *testing.T) {
+	array, report, err := AssembleArray(staleArray(t, RaidTypeRaid5, 3), nil, false)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, MemberStale, report.Members[1].Status)
+	assert.Equal(t, DiskStateFailed, report.Members[1].State)
+	assert.Less(t, report.Members[1].Events, report.Events)
+	assert.Equal(t, ArrayStateDegraded, array.Status().State)
+	output, err := array.Read(0, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("NewData!"), output)
+}
+
+func TestAssembleArray_ForcedStaleMember(t *testing.T) {
+	array, report, err := AssembleArray(staleArray(t, RaidTypeRaid1, 2), nil, true)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, MemberForced, report.Members[1].Status)
+	assert.Equal(t, DiskStateOnline, report.Members[1].State)
+	assert.Equal(t, ArrayStateOptimal, array.Status().State)
+
+	// The forced member keeps what it held
+	assert.NoError(t, array.ClearDisk(0))
+	output, err := array.Read(0, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("OldData!"), output)
+}
+
+func TestOpenArray_FailsStaleMember(t *testing.T) {
+	array, err := OpenArray(staleArray(t, RaidTypeRaid1, 2))
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, DiskStateFailed, array.Status().Disks[1].State)
+	output, err := array.Read(0, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("NewData!"), output)
+}
+
+func TestAssembleArray_ForcedAndMissingMembers(t *testing.T) {
+	data := []byte("RAID6SurvivesTwoMissingDisks")
+	dir := createTestArray(t, RaidTypeRaid6, 5, data)
+	backup := filepath.Join(t.TempDir(), "disk-4.img")
+	copyImage(t, filepath.Join(dir, "disk-4.img"), backup)
+	array, err := OpenArray(dir)
+	assert.NoError(t, err)
+	assert.NoError(t, array.Close())
+	copyImage(t, backup, filepath.Join(dir, "disk-4.img"))
+
+	// The images moved to another directory and were listed out of order, with one of them missing
+	moved := t.TempDir()
+	var images []string
+	for _, slot := range []string{"3", "0", "4", "1"} {
+		image := filepath.Join(moved, "sd"+slot+".img")
+		moveImage(t, filepath.Join(dir, "disk-"+slot+".img"), image)
+		images = append(images, image)
+	}
+	assembled := filepath.Join(t.TempDir(), "array")
+	array, report, err := AssembleArray(assembled, images, true)
+	assert.NoError(t, err)
+	assert.Equal(t, MemberMissing, report.Members[2].Status)
+	assert.Equal(t, MemberForced, report.Members[4].Status, "only saved once more, but forced in")
+	assert.Equal(t, DiskStateOnline, report.Members[4].State)
+	assert.True(t, report.Members[3].Reordered)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+	assert.Equal(t, ArrayStateDegraded, array.Status().State)
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(assembled)
+	assert.NoError(t, err, "images outside the array directory are recorded by absolute path")
+	assert.NoError(t, array.Close())
+
+	// Two missing members are tolerated, a third is one too many
+	array, _, err = AssembleArray(filepath.Join(t.TempDir(), "array"), images[:3], false)
+	assert.NoError(t, err)
+	assert.NoError(t, array.Close())
+	_, _, err = AssembleArray(filepath.Join(t.TempDir(), "array"), images[:2], false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "too many members")
+	}
+}
+
+func TestAssembleArray_RejectsForeignImages(t *testing.T) {
+	first := createTestArray(t, RaidTypeRaid1, 2, []byte("first"))
+	second := createTestArray(t, RaidTypeRaid1, 2, []byte("second"))
+	_, _, err := AssembleArray(t.TempDir(), []string{filepath.Join(first, "disk-0.img"), filepath.Join(second, "disk-1.img")}, false)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "several arrays")
+	}
+
+	blank := filepath.Join(t.TempDir(), "blank.img")
+	assert.NoError(t, os.WriteFile(blank, nil, 0644))
+	_, _, err = AssembleArray(t.TempDir(), []string{blank}, false)
+	assert.Error(t, err)
+}
+
+func TestOpenArray_FailsMissingMember(t *testing.T) {
+	dir := createTestArray(t, RaidTypeRaid5, 3, []byte("Survives"))
+	moveImage(t, filepath.Join(dir, "disk-2.img"), filepath.Join(t.TempDir(), "disk-2.img"))
+
+	array, err := OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, DiskStateFailed, array.Status().Disks[2].State, "the blank image standing in holds no superblock")
+	output, err := array.Read(0, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("Survives"), output)
+}
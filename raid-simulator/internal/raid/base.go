@@ -1,6 +1,11 @@
 package raid
 
-import "github.com/sirupsen/logrus"
+import (
+	"fmt"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+)
 
 const (
 	initialOffset = 0
@@ -12,21 +17,397 @@ var (
 	RaidTypeRaid0  RaidType = "raid0"
 	RaidTypeRaid1  RaidType = "raid1"
 	RaidTypeRaid10 RaidType = "raid10"
+	RaidTypeRaid4  RaidType = "raid4"
 	RaidTypeRaid5  RaidType = "raid5"
 	RaidTypeRaid6  RaidType = "raid6"
+	RaidTypeRaid50 RaidType = "raid50"
+	RaidTypeRaid60 RaidType = "raid60"
 )
 
-// Simulate single Disk
-type Disk struct {
-	ID   int
-	Data [][]byte // keep the data structure as [][]byte to simulate unit stripe/block
-}
-
-// Base RAIDController
+// RAIDController is the common surface of every RAID level, so callers can drive any level generically.
 type RAIDController interface {
-	Write(data []byte) error
+	// Write writes data starting at the given logical byte offset.
+	Write(data []byte, offset int) error
+	// Read reads length bytes starting at the given logical byte offset.
 	Read(start, length int) ([]byte, error)
+	// ClearDisk simulates a failure of the disk at index.
 	ClearDisk(index int) error
+	// ReplaceDisk swaps the disk at index for a blank replacement.
+	ReplaceDisk(index int) error
+	// Status reports the array and per-disk state.
+	Status() ArrayStatus
+	// Capacity returns the usable logical bytes of the array. Over disks of a declared size it is
+	// fixed by the level (e.g. (n-1)·size for RAID5); over disks that grow on demand it is the
+	// logical bytes covered by the stripes allocated so far.
+	Capacity() int
+	// HighWaterMark returns the logical byte offset just past the furthest byte ever written.
+	HighWaterMark() int
+}
+
+// ProgressFunc receives rebuild progress as the number of units done out of total.
+type ProgressFunc func(done, total int)
+
+// Rebuilder is implemented by levels with redundancy, which can regenerate the
+// contents of a replaced disk from the remaining members.
+type Rebuilder interface {
+	// Rebuild regenerates the replaced disk at index. Reads and writes keep being
+	// served between rebuild steps, and progress (if not nil) is reported after each step.
+	Rebuild(index int, progress ProgressFunc) error
+}
+
+// Scrubber is implemented by levels that can verify their redundancy against the data
+// and repair chunks that were silently corrupted.
+type Scrubber interface {
+	// Scrub walks every stripe, repairs the corrupt chunks it can locate and reports the outcome.
+	// Progress (if not nil) is reported after each stripe.
+	Scrub(progress ProgressFunc) (ScrubReport, error)
+}
+
+// Journaled is implemented by levels whose stripe writes span several disks and can be
+// protected against the write hole by a write-ahead journal.
+type Journaled interface {
+	// AttachJournal journals every later stripe write, first replaying the writes the journal
+	// holds that never completed. It returns the number of replayed stripes.
+	AttachJournal(journal Journal) (int, error)
+	// CrashAfter arms a simulated crash after n shards of the next stripe write reach their disks.
+	CrashAfter(n int)
+}
+
+// ParityMapper is implemented by levels with parity, reporting which disks each stripe keeps it on.
+type ParityMapper interface {
+	// ParityDisks returns the disks holding the parity shards of stripe: P first, then Q and any further shard.
+	ParityDisks(stripe int) []int
+}
+
+var (
+	_ Discarder = (*RAID0Controller)(nil)
+	_ Discarder = (*RAID1Controller)(nil)
+	_ Discarder = (*RAID10Controller)(nil)
+	_ Discarder = (*RAID4Controller)(nil)
+	_ Discarder = (*RAID5Controller)(nil)
+	_ Discarder = (*RAID6Controller)(nil)
+	_ Discarder = (*ErasureCodedController)(nil)
+	_ Discarder = (*RAID50Controller)(nil)
+	_ Discarder = (*RAID60Controller)(nil)
+	_ Discarder = (*CompositeController)(nil)
+)
+
+var (
+	_ diskRemover = (*RAID0Controller)(nil)
+	_ diskRemover = (*RAID1Controller)(nil)
+	_ diskRemover = (*RAID10Controller)(nil)
+	_ diskRemover = (*RAID4Controller)(nil)
+	_ diskRemover = (*RAID5Controller)(nil)
+	_ diskRemover = (*RAID6Controller)(nil)
+	_ diskRemover = (*ErasureCodedController)(nil)
+	_ diskRemover = (*RAID50Controller)(nil)
+	_ diskRemover = (*RAID60Controller)(nil)
+	_ diskRemover = (*CompositeController)(nil)
+)
+
+var (
+	_ ParityMapper = (*RAID4Controller)(nil)
+	_ ParityMapper = (*RAID5Controller)(nil)
+	_ ParityMapper = (*RAID6Controller)(nil)
+	_ ParityMapper = (*ErasureCodedController)(nil)
+	_ ParityMapper = (*RAID50Controller)(nil)
+	_ ParityMapper = (*RAID60Controller)(nil)
+)
+
+var (
+	_ StripeMapper = (*RAID4Controller)(nil)
+	_ StripeMapper = (*RAID5Controller)(nil)
+	_ StripeMapper = (*RAID6Controller)(nil)
+	_ StripeMapper = (*ErasureCodedController)(nil)
+	_ StripeMapper = (*RAID50Controller)(nil)
+	_ StripeMapper = (*RAID60Controller)(nil)
+)
+
+var (
+	_ Scrubber = (*RAID4Controller)(nil)
+	_ Scrubber = (*RAID5Controller)(nil)
+	_ Scrubber = (*RAID6Controller)(nil)
+	_ Scrubber = (*ErasureCodedController)(nil)
+	_ Scrubber = (*RAID50Controller)(nil)
+	_ Scrubber = (*RAID60Controller)(nil)
+)
+
+var (
+	_ Journaled = (*RAID4Controller)(nil)
+	_ Journaled = (*RAID5Controller)(nil)
+	_ Journaled = (*RAID6Controller)(nil)
+	_ Journaled = (*ErasureCodedController)(nil)
+)
+
+var (
+	_ Rebuilder = (*RAID1Controller)(nil)
+	_ Rebuilder = (*RAID10Controller)(nil)
+	_ Rebuilder = (*RAID4Controller)(nil)
+	_ Rebuilder = (*RAID5Controller)(nil)
+	_ Rebuilder = (*RAID6Controller)(nil)
+	_ Rebuilder = (*ErasureCodedController)(nil)
+	_ Rebuilder = (*RAID50Controller)(nil)
+	_ Rebuilder = (*RAID60Controller)(nil)
+	_ Rebuilder = (*CompositeController)(nil)
+)
+
+var (
+	_ RAIDController = (*RAID0Controller)(nil)
+	_ RAIDController = (*RAID1Controller)(nil)
+	_ RAIDController = (*RAID10Controller)(nil)
+	_ RAIDController = (*RAID4Controller)(nil)
+	_ RAIDController = (*RAID5Controller)(nil)
+	_ RAIDController = (*RAID6Controller)(nil)
+	_ RAIDController = (*ErasureCodedController)(nil)
+	_ RAIDController = (*RAID50Controller)(nil)
+	_ RAIDController = (*RAID60Controller)(nil)
+	_ RAIDController = (*CompositeController)(nil)
+)
+
+// ControllerOptions holds the level-specific settings of a controller. The zero value selects every default.
+type ControllerOptions struct {
+	Layout       ParityLayout       // parity layout of RAID5 and RAID50 arrays
+	Groups       int                // parity sub-arrays of RAID50 and RAID60 arrays, DefaultParityGroups when 0
+	Copies       int                // copies of every chunk of RAID10 arrays, DefaultMirrorCopies when 0
+	MirrorLayout MirrorLayout       // placement of the copies of RAID10 arrays, DefaultMirrorLayout when empty
+	ReadPolicy   ReadPolicy         // mirror serving each read of RAID1 and RAID10 arrays, DefaultReadPolicy when empty
+	Logger       logrus.FieldLogger // receives the log of the controller, the standard logger when nil
+}
+
+// logSetter is implemented by the controllers that log through ControllerOptions.Logger.
+type logSetter interface {
+	setLogger(logger logrus.FieldLogger)
+}
+
+// controllerLog is embedded by the controllers to log through the logger they were built with.
+type controllerLog struct {
+	logger logrus.FieldLogger
+}
+
+// log returns the logger of the controller, the standard logger unless another one was set.
+func (l *controllerLog) log() logrus.FieldLogger {
+	if l.logger == nil {
+		return logrus.StandardLogger()
+	}
+	return l.logger
+}
+
+func (l *controllerLog) setLogger(logger logrus.FieldLogger) {
+	l.logger = logger
+}
+
+// rejectOptions fails when opts carries settings that the level cannot honour. Levels clear the
+// settings they accept before calling it, so a level with no choice to make passes opts unchanged.
+func rejectOptions(opts ControllerOptions) error {
+	switch {
+	case opts.Layout != "":
+		return fmt.Errorf("parity layouts only apply to %s and %s arrays", RaidTypeRaid5, RaidTypeRaid50)
+	case opts.Groups != 0:
+		return fmt.Errorf("parity groups only apply to %s and %s arrays", RaidTypeRaid50, RaidTypeRaid60)
+	case opts.Copies != 0:
+		return fmt.Errorf("mirror copies only apply to %s arrays, %s arrays keep one copy per disk", RaidTypeRaid10, RaidTypeRaid1)
+	case opts.MirrorLayout != "":
+		return fmt.Errorf("mirror layouts only apply to %s arrays", RaidTypeRaid10)
+	case opts.ReadPolicy != "":
+		return fmt.Errorf("read policies only apply to %s and %s arrays", RaidTypeRaid1, RaidTypeRaid10)
+	}
+	return nil
+}
+
+// ControllerFactory builds a controller of a single RAID level over the given member disks.
+type ControllerFactory func(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error)
+
+var controllerFactories = map[RaidType]ControllerFactory{
+	RaidTypeRaid0:  newRAID0Factory,
+	RaidTypeRaid1:  newRAID1Factory,
+	RaidTypeRaid10: newRAID10Factory,
+	RaidTypeRaid4:  adaptFactory(newRAID4Controller),
+	RaidTypeRaid5:  newRAID5Factory,
+	RaidTypeRaid6:  adaptFactory(newRAID6Controller),
+	RaidTypeRaid50: newRAID50Factory,
+	RaidTypeRaid60: newRAID60Factory,
+}
+
+// adaptFactory wraps a typed constructor so a failed construction yields a nil interface rather than a typed nil.
+// Levels built this way have no settings, so any option is refused.
+func adaptFactory[T RAIDController](ctor func(disks []*Disk, stripeSz int) (T, error)) ControllerFactory {
+	return func(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+		if err := rejectOptions(opts); err != nil {
+			return nil, err
+		}
+		controller, err := ctor(disks, stripeSz)
+		if err != nil {
+			return nil, err
+		}
+		return controller, nil
+	}
+}
+
+func newRAID1Factory(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	policy := opts.ReadPolicy
+	opts.ReadPolicy = ""
+	if err := rejectOptions(opts); err != nil {
+		return nil, err
+	}
+	controller, err := newRAID1Controller(disks, stripeSz, policy)
+	if err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
+func newRAID10Factory(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	copies, layout, policy := opts.Copies, opts.MirrorLayout, opts.ReadPolicy
+	opts.Copies, opts.MirrorLayout, opts.ReadPolicy = 0, "", ""
+	if err := rejectOptions(opts); err != nil {
+		return nil, err
+	}
+	controller, err := newRAID10Controller(disks, stripeSz, copies, layout, policy)
+	if err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
+func newRAID5Factory(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	layout := opts.Layout
+	opts.Layout = ""
+	if err := rejectOptions(opts); err != nil {
+		return nil, err
+	}
+	controller, err := newRAID5Controller(disks, stripeSz, layout)
+	if err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
+func newRAID50Factory(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	groups, layout := opts.Groups, opts.Layout
+	opts.Groups, opts.Layout = 0, ""
+	if err := rejectOptions(opts); err != nil {
+		return nil, err
+	}
+	controller, err := newRAID50Controller(disks, stripeSz, groups, layout)
+	if err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
+func newRAID60Factory(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	groups := opts.Groups
+	opts.Groups = 0
+	if err := rejectOptions(opts); err != nil {
+		return nil, err
+	}
+	controller, err := newRAID60Controller(disks, stripeSz, groups)
+	if err != nil {
+		return nil, err
+	}
+	return controller, nil
+}
+
+func newRAID0Factory(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	if err := rejectOptions(opts); err != nil {
+		return nil, err
+	}
+	if len(disks) < 1 {
+		return nil, fmt.Errorf("RAID0 requires at least 1 disk. Provided: %d", len(disks))
+	}
+	if stripeSz <= 0 {
+		return nil, fmt.Errorf("stripe size must be greater than 0. Provided: %d", stripeSz)
+	}
+	return newRAID0Controller(disks, stripeSz), nil
+}
+
+// lookupFactory returns the factory of raidType: a registered one, or one built from a composite
+// topology spec or from the parameters of a generic "ec:k+m" erasure code.
+func lookupFactory(raidType RaidType) (ControllerFactory, error) {
+	if factory, ok := controllerFactories[raidType]; ok {
+		return factory, nil
+	}
+	if IsComposite(raidType) {
+		return newCompositeFactory(raidType)
+	}
+	if IsErasureCoded(raidType) {
+		return newErasureCodedFactory(raidType)
+	}
+	return nil, fmt.Errorf("unsupported RAID type: %s", raidType)
+}
+
+// FixedDiskCount returns the number of disks raidType is defined over: the k+m disks of an "ec:k+m"
+// code, or the plain disks of a composite topology. It returns 0 for levels taking any disk count.
+func FixedDiskCount(raidType RaidType) (int, error) {
+	switch {
+	case IsComposite(raidType):
+		topology, err := ParseTopology(string(raidType))
+		if err != nil {
+			return 0, err
+		}
+		return topology.DiskCount(), nil
+	case IsErasureCoded(raidType):
+		dataShards, parityShards, err := ParseErasureCode(raidType)
+		if err != nil {
+			return 0, err
+		}
+		return dataShards + parityShards, nil
+	default:
+		return 0, nil
+	}
+}
+
+// RegisterController adds or replaces the factory used to build controllers of raidType.
+func RegisterController(raidType RaidType, factory ControllerFactory) {
+	controllerFactories[raidType] = factory
+}
+
+// NewController builds an in-memory controller for raidType using the registered factory.
+// Its disks grow on demand.
+func NewController(raidType RaidType, diskCount, stripeSz int) (RAIDController, error) {
+	return NewControllerWithDisks(raidType, newDisks(diskCount, stripeSz), stripeSz)
+}
+
+// NewSizedController builds an in-memory controller for raidType over disks of diskSize bytes each.
+// Writes past the usable capacity of the level fail with ErrOutOfSpace.
+func NewSizedController(raidType RaidType, diskCount, stripeSz, diskSize int) (RAIDController, error) {
+	chunkLimit, err := diskChunks(diskSize, stripeSz)
+	if err != nil {
+		return nil, err
+	}
+	return NewControllerWithDisks(raidType, newSizedDisks(diskCount, stripeSz, chunkLimit), stripeSz)
+}
+
+// NewControllerWithDisks builds a controller for raidType over existing member disks.
+func NewControllerWithDisks(raidType RaidType, disks []*Disk, stripeSz int) (RAIDController, error) {
+	return NewControllerWithOptions(raidType, disks, stripeSz, ControllerOptions{})
+}
+
+// NewControllerWithOptions builds a controller for raidType over existing member disks with level-specific settings.
+func NewControllerWithOptions(raidType RaidType, disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+	factory, err := lookupFactory(raidType)
+	if err != nil {
+		return nil, err
+	}
+	controller, err := factory(disks, stripeSz, opts)
+	if err != nil {
+		return nil, err
+	}
+	if setter, ok := controller.(logSetter); ok && opts.Logger != nil {
+		setter.setLogger(opts.Logger)
+	}
+	return controller, nil
+}
+
+// SupportedRaidTypes lists every registered RAID type in sorted order. Erasure-coded types
+// ("ec:k+m") and composite topologies are built on demand and are not listed.
+func SupportedRaidTypes() []RaidType {
+	types := make([]RaidType, 0, len(controllerFactories))
+	for raidType := range controllerFactories {
+		types = append(types, raidType)
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i] < types[j] })
+	return types
 }
 
 func RunRAIDSimulation(raidType RaidType, input string) {
@@ -37,9 +418,9 @@ func RunRAIDSimulation(raidType RaidType, input string) {
 		clearTarget := 1
 		Raid0SimulationFlow(input, diskCount, stripeSz, clearTarget)
 	case RaidTypeRaid1:
-		diskCount := 2
+		diskCount := 3
 		stripeSz := 1
-		clearTarget := 0
+		clearTarget := []int{0, 1} // a triple mirror survives losing two disks
 		Raid1SimulationFlow(input, diskCount, stripeSz, clearTarget)
 	case RaidTypeRaid10:
 		totalDisks := 4
@@ -56,7 +437,23 @@ func RunRAIDSimulation(raidType RaidType, input string) {
 		stripeSz := 1
 		clearTarget := []int{0, 1}
 		Raid6SimulationFlow(input, totalDisks, stripeSz, clearTarget)
+	case RaidTypeRaid50:
+		totalDisks := 6
+		stripeSz := 1
+		clearTarget := []int{0, 3} // one disk in each RAID5 group
+		Raid50SimulationFlow(input, totalDisks, stripeSz, clearTarget)
+	case RaidTypeRaid60:
+		totalDisks := 8
+		stripeSz := 1
+		clearTarget := []int{0, 1, 4, 5} // two disks in each RAID6 group
+		Raid60SimulationFlow(input, totalDisks, stripeSz, clearTarget)
 	default:
+		if IsComposite(raidType) {
+			stripeSz := 1
+			clearTarget := []int{0}
+			CompositeSimulationFlow(input, raidType, stripeSz, clearTarget)
+			return
+		}
 		logrus.Warnf("Unsupported RAID type: %s", raidType)
 	}
 }
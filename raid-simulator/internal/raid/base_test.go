@@ -0,0 +1,109 @@
+package raid_test
+
+import (
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewController_AllRaidTypes(t *testing.T) {
+	cases := []struct {
+		raidType  raid.RaidType
+		diskCount int
+		stripeSz  int
+		failDisk  int
+	}{
+		{raid.RaidTypeRaid1, 2, 2, 0},
+		{raid.RaidTypeRaid10, 4, 2, 1},
+		{raid.RaidTypeRaid5, 3, 2, 2},
+		{raid.RaidTypeRaid6, 5, 2, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(tc.raidType, tc.diskCount, tc.stripeSz)
+			assert.NoError(t, err)
+
+			data := []byte("GenericControllerData")
+			assert.NoError(t, controller.Write(data, 0))
+			assert.GreaterOrEqual(t, controller.Capacity(), len(data))
+
+			status := controller.Status()
+			assert.Equal(t, tc.raidType, status.Type)
+			assert.Equal(t, raid.ArrayStateOptimal, status.State)
+			assert.Len(t, status.Disks, tc.diskCount)
+
+			assert.NoError(t, controller.ClearDisk(tc.failDisk))
+			assert.Equal(t, raid.ArrayStateDegraded, controller.Status().State)
+
+			read, err := controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, read)
+
+			assert.NoError(t, controller.ReplaceDisk(tc.failDisk))
+			assert.Equal(t, raid.DiskStateRebuilding, controller.Status().Disks[tc.failDisk].State)
+
+			read, err = controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, read)
+		})
+	}
+}
+
+func TestNewController_RAID0(t *testing.T) {
+	controller, err := raid.NewController(raid.RaidTypeRaid0, 3, 4)
+	assert.NoError(t, err)
+
+	data := []byte("ABCDEFGHIJKL")
+	assert.NoError(t, controller.Write(data, 0))
+	assert.Equal(t, 12, controller.Capacity())
+
+	assert.NoError(t, controller.ClearDisk(1))
+	status := controller.Status()
+	assert.Equal(t, raid.ArrayStateFailed, status.State)
+	assert.Equal(t, 0, status.FaultTolerance)
+	assert.Error(t, controller.Write(data, 0))
+}
+
+func TestNewController_Unsupported(t *testing.T) {
+	controller, err := raid.NewController(raid.RaidType("raid7"), 3, 4)
+	assert.Error(t, err)
+	assert.Nil(t, controller)
+	assert.Contains(t, err.Error(), "unsupported RAID type")
+}
+
+func TestNewController_InvalidGeometry(t *testing.T) {
+	controller, err := raid.NewController(raid.RaidTypeRaid5, 2, 4)
+	assert.Error(t, err)
+	assert.Nil(t, controller)
+}
+
+func TestSupportedRaidTypes(t *testing.T) {
+	assert.Equal(t, []raid.RaidType{
+		raid.RaidTypeRaid0,
+		raid.RaidTypeRaid1,
+		raid.RaidTypeRaid10,
+		raid.RaidTypeRaid4,
+		raid.RaidTypeRaid5,
+		raid.RaidTypeRaid50,
+		raid.RaidTypeRaid6,
+		raid.RaidTypeRaid60,
+	}, raid.SupportedRaidTypes())
+}
+
+func TestController_UnalignedOffsetWrite(t *testing.T) {
+	for _, raidType := range raid.SupportedRaidTypes() {
+		t.Run(string(raidType), func(t *testing.T) {
+			controller, err := raid.NewController(raidType, 8, 2) // enough disks for two RAID6 groups
+			assert.NoError(t, err)
+
+			assert.NoError(t, controller.Write([]byte("0000000000000000"), 0))
+			assert.NoError(t, controller.Write([]byte("ABCDEFGHI"), 3))
+
+			read, err := controller.Read(0, 16)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte("000ABCDEFGHI0000"), read)
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+)
+
+// ErrOutOfSpace is returned by writes that extend past the end of the addressable space.
+var ErrOutOfSpace = errors.New("out of space")
+
+// highWaterMark tracks the logical end of the data written to an array, so reads past it
+// are reported precisely rather than inferred from the chunks allocated on the disks.
+// Controllers built over disks that already hold data start from the allocated extent,
+// until the precise mark recorded by an earlier run is restored.
+type highWaterMark struct {
+	end atomic.Int64
+}
+
+// HighWaterMark returns the logical byte offset just past the furthest byte written.
+func (h *highWaterMark) HighWaterMark() int {
+	return int(h.end.Load())
+}
+
+// advance moves the mark to end if that lies past it.
+func (h *highWaterMark) advance(end int) {
+	for {
+		current := h.end.Load()
+		if int64(end) <= current || h.end.CompareAndSwap(current, int64(end)) {
+			return
+		}
+	}
+}
+
+// restoreHighWaterMark sets the mark recorded by an earlier run of the array.
+func (h *highWaterMark) restoreHighWaterMark(end int) {
+	h.end.Store(int64(end))
+}
+
+// highWaterMarkRestorer is implemented by controllers whose high-water mark can be restored when reopened.
+type highWaterMarkRestorer interface {
+	restoreHighWaterMark(end int)
+}
+
+// diskChunkLimit returns how many chunks every member disk can hold, or 0 when any of them grows on demand.
+func diskChunkLimit(disks []*Disk) int {
+	limit := 0
+	for i, disk := range disks {
+		if disk.chunkLimit == 0 {
+			return 0
+		}
+		if i == 0 || disk.chunkLimit < limit {
+			limit = disk.chunkLimit
+		}
+	}
+	return limit
+}
+
+// checkSpace fails with ErrOutOfSpace when a write of length bytes at offset does not fit in the
+// usable capacity of an array over disks of a declared size. Arrays over growing disks never run out.
+func checkSpace(name string, disks []*Disk, capacity, offset, length int) error {
+	if diskChunkLimit(disks) == 0 || offset+length <= capacity {
+		return nil
+	}
+	return fmt.Errorf("%s: write of %d bytes at offset %d: %w (usable capacity %d bytes)", name, length, offset, ErrOutOfSpace, capacity)
+}
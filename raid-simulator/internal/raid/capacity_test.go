@@ -0,0 +1,135 @@
+package raid_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCapacity_PerLevel(t *testing.T) {
+	const diskSize, stripeSz = 16, 4
+	cases := []struct {
+		raidType  raid.RaidType
+		diskCount int
+		capacity  int
+	}{
+		{raid.RaidTypeRaid0, 3, 3 * diskSize},
+		{raid.RaidTypeRaid1, 3, diskSize},
+		{raid.RaidTypeRaid10, 4, 2 * diskSize},
+		{raid.RaidTypeRaid5, 4, 3 * diskSize},
+		{raid.RaidTypeRaid6, 5, 3 * diskSize},
+		{raid.RaidTypeRaid50, 6, 4 * diskSize},
+		{raid.RaidTypeRaid60, 8, 4 * diskSize},
+		{"raid1(2 x raid0(2))", 4, 2 * diskSize},
+		{"raid0(2 x raid5(3))", 6, 4 * diskSize},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := raid.NewSizedController(tc.raidType, tc.diskCount, stripeSz, diskSize)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.capacity, controller.Capacity())
+			assert.Equal(t, tc.capacity, controller.Status().Capacity)
+			for _, disk := range controller.Status().Disks {
+				assert.Equal(t, diskSize, disk.Size)
+			}
+
+			// The whole capacity can be filled, but not a byte more
+			data := bytes.Repeat([]byte("x"), tc.capacity)
+			assert.NoError(t, controller.Write(data, 0))
+			assert.ErrorIs(t, controller.Write([]byte("y"), tc.capacity), raid.ErrOutOfSpace)
+			assert.ErrorIs(t, controller.Write([]byte("yy"), tc.capacity-1), raid.ErrOutOfSpace)
+			assert.Equal(t, tc.capacity, controller.HighWaterMark())
+
+			output, err := controller.Read(0, tc.capacity)
+			assert.NoError(t, err)
+			assert.Equal(t, data, output)
+		})
+	}
+}
+
+func TestCapacity_HighWaterMarkBoundsReads(t *testing.T) {
+	for _, level := range concurrencyLevels {
+		t.Run(string(level.raidType), func(t *testing.T) {
+			controller, err := raid.NewSizedController(level.raidType, level.diskCount, 4, 64)
+			assert.NoError(t, err)
+			assert.NoError(t, controller.Write([]byte("hello"), 2))
+			assert.Equal(t, 7, controller.HighWaterMark())
+			assert.Equal(t, 7, controller.Status().HighWaterMark)
+
+			// Reads stop at the last byte written rather than at the end of the allocated stripe
+			output, err := controller.Read(0, 20)
+			assert.NoError(t, err)
+			assert.Equal(t, append([]byte{0, 0}, "hello"...), output)
+
+			_, err = controller.Read(8, 1)
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), "beyond total data stored 7")
+			}
+
+			// Writing below the mark does not move it back
+			assert.NoError(t, controller.Write([]byte("J"), 0))
+			assert.Equal(t, 7, controller.HighWaterMark())
+		})
+	}
+}
+
+func TestCapacity_SparseWriteReadsHolesAsZeros(t *testing.T) {
+	for _, level := range concurrencyLevels {
+		t.Run(string(level.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(level.raidType, level.diskCount, 2)
+			assert.NoError(t, err)
+			assert.NoError(t, controller.Write([]byte("end"), 40))
+
+			output, err := controller.Read(0, 43)
+			assert.NoError(t, err)
+			assert.Equal(t, append(make([]byte, 40), "end"...), output)
+		})
+	}
+}
+
+func TestNewSizedController_InvalidDiskSize(t *testing.T) {
+	_, err := raid.NewSizedController(raid.RaidTypeRaid5, 3, 4, 3)
+	assert.Error(t, err)
+	_, err = raid.NewSizedController(raid.RaidTypeRaid5, 3, 4, -1)
+	assert.Error(t, err)
+}
+
+func TestArray_PersistsDiskSizeAndHighWaterMark(t *testing.T) {
+	dir := t.TempDir()
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid5, 3, 4, 32, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, 64, array.Capacity())
+	assert.NoError(t, array.Write([]byte("abc"), 10))
+	assert.NoError(t, array.Close())
+
+	reopened, err := raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	assert.Equal(t, 64, reopened.Capacity())
+	assert.Equal(t, 13, reopened.HighWaterMark())
+	assert.ErrorIs(t, reopened.Write([]byte("x"), 64), raid.ErrOutOfSpace)
+
+	output, err := reopened.Read(8, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0, 0, 'a', 'b', 'c'}, output)
+}
+
+func TestArray_ReshapeRefusesTooSmallTarget(t *testing.T) {
+	array, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid5, 4, 4, 16, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.Write(bytes.Repeat([]byte("z"), 40), 0))
+
+	err = array.StartReshape(raid.ReshapeTarget{Type: raid.RaidTypeRaid1, DiskCount: 2, StripeSz: 4})
+	assert.ErrorIs(t, err, raid.ErrOutOfSpace)
+
+	assert.NoError(t, array.StartReshape(raid.ReshapeTarget{Type: raid.RaidTypeRaid6, DiskCount: 6, StripeSz: 4}))
+	done, err := array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 64, array.Capacity())
+	assert.Equal(t, 40, array.HighWaterMark())
+}
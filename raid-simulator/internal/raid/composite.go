@@ -0,0 +1,527 @@
+package raid
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/sirupsen/logrus"
+)
+
+// CompositeController implements the RAIDController interface for a Topology. Every nested array is
+// an ordinary controller of its level whose members are plain disks or, through an arrayDevice, whole
+// arrays acting as a single disk of their parent. Disk indexes address the plain disks, numbered
+// depth-first in member order.
+//
+// A nested array that can no longer serve its data fails as a member of its parent. Once its failed
+// disks are replaced, rebuilding any of them restarts it blank and rebuilds it as a whole from the
+// redundancy of its parent.
+type CompositeController struct {
+	mu       sync.RWMutex // held shared by status and rebuilds, exclusively by disk state changes
+	raidType RaidType
+	stripeSz int
+	root     *compositeNode
+	disks    []*Disk         // the plain disks, by index
+	leaves   []compositeLeaf // where each plain disk sits, by index
+	controllerLog
+}
+
+// compositeNode is one nested array of a composite array.
+type compositeNode struct {
+	topology Topology
+	array    RAIDController
+	members  []*Disk          // member disks of array, in member order
+	children []*compositeNode // nested array behind each member, nil for plain disks
+	parent   *compositeNode
+	slot     int // member index in the parent
+}
+
+// compositeLeaf locates a plain disk: the nested array it belongs to and its member index there.
+type compositeLeaf struct {
+	node *compositeNode
+	slot int
+}
+
+// NewCompositeController creates an in-memory composite array laid out as spec, e.g. "raid0(2 x raid1(2))".
+// Its disks grow on demand.
+func NewCompositeController(spec string, stripeSz int) (*CompositeController, error) {
+	topology, err := ParseTopology(spec)
+	if err != nil {
+		return nil, err
+	}
+	return newCompositeController(newDisks(topology.DiskCount(), stripeSz), stripeSz, topology)
+}
+
+func newCompositeController(disks []*Disk, stripeSz int, topology Topology) (*CompositeController, error) {
+	if stripeSz <= 0 {
+		return nil, fmt.Errorf("stripe size must be greater than 0. Provided: %d", stripeSz)
+	}
+	if len(disks) != topology.DiskCount() {
+		return nil, fmt.Errorf("%s requires exactly %d disks. Provided: %d", topology, topology.DiskCount(), len(disks))
+	}
+	c := &CompositeController{raidType: topology.RaidType(), stripeSz: stripeSz, disks: disks}
+	root, err := c.build(topology, nil, 0)
+	if err != nil {
+		return nil, err
+	}
+	c.root = root
+	return c, nil
+}
+
+// newCompositeFactory returns the factory building controllers of a topology spec raidType.
+func newCompositeFactory(raidType RaidType) (ControllerFactory, error) {
+	topology, err := ParseTopology(string(raidType))
+	if err != nil {
+		return nil, err
+	}
+	return func(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+		if err := rejectOptions(opts); err != nil {
+			return nil, err
+		}
+		controller, err := newCompositeController(disks, stripeSz, topology)
+		if err != nil {
+			return nil, err
+		}
+		return controller, nil
+	}, nil
+}
+
+// build creates the nested array described by topology, taking its plain disks from c.disks in order.
+func (c *CompositeController) build(topology Topology, parent *compositeNode, slot int) (*compositeNode, error) {
+	node := &compositeNode{topology: topology, parent: parent, slot: slot}
+	for i, member := range topology.Members {
+		if member.Type == topologyDisk {
+			node.members = append(node.members, c.disks[len(c.leaves)])
+			node.children = append(node.children, nil)
+			c.leaves = append(c.leaves, compositeLeaf{node: node, slot: i})
+			continue
+		}
+		child, err := c.build(member, node, i)
+		if err != nil {
+			return nil, err
+		}
+		node.members = append(node.members, child.memberDisk(c.stripeSz))
+		node.children = append(node.children, child)
+	}
+
+	array, err := NewControllerWithOptions(topology.Type, node.members, c.stripeSz, topology.options())
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", topology, err)
+	}
+	node.array = array
+	return node, nil
+}
+
+// memberDisk wraps the nested array as the member disk at its slot of the parent. An array that
+// cannot serve its data, for instance because it had failed before the composite was reopened,
+// starts as a failed member. Its size follows from its capacity when all its disks have one.
+func (n *compositeNode) memberDisk(chunkSz int) *Disk {
+	state := DiskStateOnline
+	if n.array.Status().State == ArrayStateFailed {
+		state = DiskStateFailed
+	}
+	chunkLimit := 0
+	if diskChunkLimit(n.members) > 0 {
+		chunkLimit = n.array.Capacity() / chunkSz
+	}
+	return NewSizedDisk(n.slot, state, &arrayDevice{node: n, chunkSz: chunkSz}, chunkLimit)
+}
+
+// memberState returns the state of the member at slot, read under the array's own lock.
+func (n *compositeNode) memberState(slot int) DiskState {
+	return n.array.Status().Disks[slot].State
+}
+
+// lost reports whether the parent gave up on the nested array as a failed member.
+func (n *compositeNode) lost() bool {
+	return n.parent != nil && n.parent.memberState(n.slot) == DiskStateFailed
+}
+
+// wipe discards the contents of the nested array, leaving it consistent and blank: its failed (or
+// removed) plain disks stay so, every other member comes back online, and nested members fail again only if
+// they still cannot serve data. It runs when the parent wipes the member disk backed by the array.
+func (n *compositeNode) wipe() error {
+	for i, member := range n.members {
+		state := DiskStateOnline
+		if n.children[i] == nil && member.State.isFailed() {
+			state = member.State
+		}
+		if err := member.reset(state); err != nil {
+			return err
+		}
+		if n.children[i] != nil && n.children[i].array.Status().State == ArrayStateFailed {
+			if err := member.reset(DiskStateFailed); err != nil {
+				return err
+			}
+		}
+	}
+	if restorer, ok := n.array.(highWaterMarkRestorer); ok {
+		restorer.restoreHighWaterMark(0)
+	}
+	return nil
+}
+
+// failuresToFail returns the fewest further disk failures that fail the nested array, assuming they
+// hit its weakest available members: the array fails once its fault tolerance is exceeded.
+func (n *compositeNode) failuresToFail() int {
+	status := n.array.Status()
+	if status.State == ArrayStateFailed {
+		return 0
+	}
+	var costs []int
+	for i, disk := range status.Disks {
+		switch {
+		case disk.State != DiskStateOnline:
+		case n.children[i] == nil:
+			costs = append(costs, 1)
+		default:
+			costs = append(costs, n.children[i].failuresToFail())
+		}
+	}
+	slices.Sort(costs)
+	total := 0
+	for _, cost := range costs[:min(status.FaultTolerance+1, len(costs))] {
+		total += cost
+	}
+	return total
+}
+
+// degraded reports whether the nested array, or any array nested in it, runs without full redundancy.
+func (n *compositeNode) degraded() bool {
+	if n.array.Status().State != ArrayStateOptimal {
+		return true
+	}
+	for _, child := range n.children {
+		if child != nil && child.degraded() {
+			return true
+		}
+	}
+	return false
+}
+
+// rebuildMember regenerates the member at slot from the other members of the nested array.
+func (n *compositeNode) rebuildMember(slot int, progress ProgressFunc) error {
+	rebuilder, ok := n.array.(Rebuilder)
+	if !ok {
+		return fmt.Errorf("%s arrays have no redundancy to rebuild from", n.topology.Type)
+	}
+	return rebuilder.Rebuild(slot, progress)
+}
+
+func (c *CompositeController) leaf(index int) (compositeLeaf, error) {
+	if index < 0 || index >= len(c.leaves) {
+		return compositeLeaf{}, fmt.Errorf("disk index %d out of bounds for %d disks", index, len(c.leaves))
+	}
+	return c.leaves[index], nil
+}
+
+// Write writes data starting at the logical byte offset through the root array.
+func (c *CompositeController) Write(data []byte, offset int) error {
+	return c.root.array.Write(data, offset)
+}
+
+// Discard discards the range through the root array, down to every nested array it spans.
+func (c *CompositeController) Discard(offset, length int) error {
+	discarder, ok := c.root.array.(Discarder)
+	if !ok {
+		return fmt.Errorf("%s arrays cannot discard", c.root.topology.Type)
+	}
+	return discarder.Discard(offset, length)
+}
+
+// Read reads data through the root array. Every nested array reconstructs what it lost on its own.
+func (c *CompositeController) Read(start, length int) ([]byte, error) {
+	return c.root.array.Read(start, length)
+}
+
+// ClearDisk simulates a failure of the plain disk at index. Nested arrays that can no longer serve
+// their data fail as members of their parents, up the tree.
+func (c *CompositeController) ClearDisk(index int) error {
+	leaf, err := c.leaf(index)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := leaf.node.array.ClearDisk(leaf.slot); err != nil {
+		return err
+	}
+	for n := leaf.node; n.parent != nil && !n.lost() && n.array.Status().State == ArrayStateFailed; n = n.parent {
+		c.log().Infof("[%s] Nested array %s failed, failing it as member %d of %s.", c.raidType, n.topology, n.slot, n.parent.topology)
+		if err := n.parent.array.ClearDisk(n.slot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setLogger has every nested array log through logger too.
+func (c *CompositeController) setLogger(logger logrus.FieldLogger) {
+	c.controllerLog.setLogger(logger)
+	c.root.setLogger(logger)
+}
+
+func (n *compositeNode) setLogger(logger logrus.FieldLogger) {
+	if setter, ok := n.array.(logSetter); ok {
+		setter.setLogger(logger)
+	}
+	for _, child := range n.children {
+		if child != nil {
+			child.setLogger(logger)
+		}
+	}
+}
+
+// removeDisk marks the failed plain disk at index removed through the nested array holding it.
+func (c *CompositeController) removeDisk(index int) error {
+	leaf, err := c.leaf(index)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	remover, ok := leaf.node.array.(diskRemover)
+	if !ok {
+		return fmt.Errorf("%s arrays cannot remove disks", leaf.node.topology)
+	}
+	return remover.removeDisk(leaf.slot)
+}
+
+// ReplaceDisk swaps the plain disk at index for a blank replacement, to be rebuilt. A replacement
+// inside a nested array that failed stays rebuilding until the array is restarted by Rebuild, even
+// where its level brings blank disks straight online, so the array keeps counting as failed.
+func (c *CompositeController) ReplaceDisk(index int) error {
+	leaf, err := c.leaf(index)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := leaf.node.array.ReplaceDisk(leaf.slot); err != nil {
+		return err
+	}
+	if disk := c.disks[index]; outermostLost(leaf.node) != nil && disk.State == DiskStateOnline {
+		return disk.reset(DiskStateRebuilding)
+	}
+	return nil
+}
+
+// Rebuild regenerates the replaced plain disk at index. When the nested array holding it had failed,
+// the outermost such array is restarted blank and rebuilt as a whole from its parent instead; this
+// requires every failed disk in it to have been replaced. Members left waiting for a rebuild further
+// up the tree are rebuilt next.
+func (c *CompositeController) Rebuild(index int, progress ProgressFunc) error {
+	leaf, err := c.leaf(index)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	restarted, err := c.restartLost(leaf.node)
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	node := restarted
+	if node == nil {
+		node = leaf.node
+		if err := node.rebuildMember(leaf.slot, progress); err != nil {
+			return err
+		}
+	}
+	for ; node.parent != nil; node = node.parent {
+		if node.parent.memberState(node.slot) != DiskStateRebuilding {
+			continue
+		}
+		if err := node.parent.rebuildMember(node.slot, progress); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// outermostLost returns the outermost nested array above node, node included, that its parent gave
+// up on, or nil when there is none.
+func outermostLost(node *compositeNode) *compositeNode {
+	var lost *compositeNode
+	for n := node; n.parent != nil; n = n.parent {
+		if n.lost() {
+			lost = n
+		}
+	}
+	return lost
+}
+
+// restartLost wipes the outermost nested array above node that its parent gave up on and, if it
+// can serve data again, hands it back to its parent as a blank replacement. It returns nil when no
+// array above node was lost.
+func (c *CompositeController) restartLost(node *compositeNode) (*compositeNode, error) {
+	lost := outermostLost(node)
+	if lost == nil {
+		return nil, nil
+	}
+	if err := lost.parent.array.ClearDisk(lost.slot); err != nil {
+		return nil, err
+	}
+	if lost.array.Status().State == ArrayStateFailed {
+		return nil, fmt.Errorf("nested array %s (member %d of %s) still has failed disks, replace them before rebuilding", lost.topology, lost.slot, lost.parent.topology)
+	}
+	if err := lost.parent.array.ReplaceDisk(lost.slot); err != nil {
+		return nil, err
+	}
+	c.log().Infof("[%s] Nested array %s restarted as member %d of %s.", c.raidType, lost.topology, lost.slot, lost.parent.topology)
+	return lost, nil
+}
+
+// Status reports the state of the whole composite. It is degraded as soon as any nested array is,
+// and its fault tolerance counts plain disk failures in the worst case.
+func (c *CompositeController) Status() ArrayStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	root := c.root.array.Status()
+	state := root.State
+	if state == ArrayStateOptimal && c.root.degraded() {
+		state = ArrayStateDegraded
+	}
+	disks := make([]DiskStatus, len(c.leaves))
+	for i, leaf := range c.leaves {
+		disks[i] = leaf.node.array.Status().Disks[leaf.slot]
+	}
+	return ArrayStatus{
+		Type:           c.raidType,
+		State:          state,
+		StripeSz:       c.stripeSz,
+		FaultTolerance: max(c.root.failuresToFail()-1, 0),
+		Capacity:       root.Capacity,
+		HighWaterMark:  root.HighWaterMark,
+		Disks:          disks,
+	}
+}
+
+// Capacity returns the usable logical bytes of the root array.
+func (c *CompositeController) Capacity() int {
+	return c.root.array.Capacity()
+}
+
+// HighWaterMark returns the logical end of the data written to the root array.
+func (c *CompositeController) HighWaterMark() int {
+	return c.root.array.HighWaterMark()
+}
+
+func (c *CompositeController) restoreHighWaterMark(end int) {
+	if restorer, ok := c.root.array.(highWaterMarkRestorer); ok {
+		restorer.restoreHighWaterMark(end)
+	}
+}
+
+// arrayDevice presents a nested array as the block device of one member disk of its parent:
+// chunk i of the device holds the logical bytes [i*chunkSz, (i+1)*chunkSz) of the array.
+// The member disk serializes writes and wipes, so the array is never wiped under an I/O.
+type arrayDevice struct {
+	node    *compositeNode
+	chunkSz int
+}
+
+func (d *arrayDevice) ReadChunk(index int) ([]byte, error) {
+	if index < 0 || index >= d.ChunkCount() {
+		return nil, fmt.Errorf("%w: index %d of %d", blockdev.ErrChunkNotFound, index, d.ChunkCount())
+	}
+	data, err := d.node.array.Read(index*d.chunkSz, d.chunkSz)
+	if err != nil {
+		return nil, err
+	}
+	chunk := make([]byte, d.chunkSz)
+	copy(chunk, data)
+	return chunk, nil
+}
+
+func (d *arrayDevice) WriteChunk(index int, chunk []byte) error {
+	if index < 0 {
+		return fmt.Errorf("chunk index must be non-negative, got %d", index)
+	}
+	if len(chunk) != d.chunkSz {
+		return fmt.Errorf("chunk size mismatch: expected %d bytes, got %d", d.chunkSz, len(chunk))
+	}
+	return d.node.array.Write(chunk, index*d.chunkSz)
+}
+
+// Discard discards the chunk's range of the array, or overwrites it with zeros if the array cannot discard.
+func (d *arrayDevice) Discard(index int) error {
+	if index < 0 {
+		return fmt.Errorf("chunk index must be non-negative, got %d", index)
+	}
+	if discarder, ok := d.node.array.(Discarder); ok {
+		return discarder.Discard(index*d.chunkSz, d.chunkSz)
+	}
+	if index >= d.ChunkCount() {
+		return nil
+	}
+	return d.node.array.Write(make([]byte, d.chunkSz), index*d.chunkSz)
+}
+
+// ChunkCount returns the chunks covered by the data written to the array.
+func (d *arrayDevice) ChunkCount() int {
+	return (d.node.array.HighWaterMark() + d.chunkSz - 1) / d.chunkSz
+}
+
+// AllocatedChunks counts every chunk below the array's high-water mark: the array tracks the
+// space it takes up on its own disks, not per chunk of its parent.
+func (d *arrayDevice) AllocatedChunks() int {
+	return d.ChunkCount()
+}
+
+// Allocated reports every chunk below the array's high-water mark as allocated, like AllocatedChunks.
+func (d *arrayDevice) Allocated(index int) bool {
+	return index >= 0 && index < d.ChunkCount()
+}
+
+func (d *arrayDevice) ChunkSize() int {
+	return d.chunkSz
+}
+
+func (d *arrayDevice) Wipe() error {
+	return d.node.wipe()
+}
+
+// Close leaves the plain disks of the array open, as they belong to whoever created the composite.
+func (d *arrayDevice) Close() error {
+	return nil
+}
+
+// CompositeSimulationFlow writes input to a composite array laid out as raidType, clears the plain
+// disks in clearTargets and reads the input back.
+func CompositeSimulationFlow(input string, raidType RaidType, stripeSz int, clearTargets []int) {
+	controller, err := NewCompositeController(string(raidType), stripeSz)
+	if err != nil {
+		logrus.Errorf("[%s] Failed to create array: %v", raidType, err)
+		return
+	}
+	name := controller.raidType
+	if err := controller.Write([]byte(input), initialOffset); err != nil {
+		logrus.Errorf("[%s] Write failed: %v", name, err)
+		return // Exit if write fails
+	}
+	logrus.Infof("[%s] Write done across %d disks: %s", name, len(controller.disks), input)
+
+	for _, target := range clearTargets {
+		if err := controller.ClearDisk(target); err != nil {
+			logrus.Errorf("[%s] ClearDisk failed for disk %d: %v", name, target, err)
+			return
+		}
+		logrus.Infof("[%s] Disk %d cleared, array is %s", name, target, controller.Status().State)
+	}
+
+	output, err := controller.Read(0, len(input))
+	if err != nil {
+		logrus.Errorf("[%s] Read failed after clear: %v", name, err)
+	} else {
+		logrus.Infof("[%s] Recovered string after clear: %s", name, string(output))
+	}
+}
@@ -0,0 +1,195 @@
+package raid
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComposite_StripeOfMirrors(t *testing.T) {
+	controller, err := NewCompositeController("raid0(2 x raid1(2))", 2)
+	assert.NoError(t, err)
+	status := controller.Status()
+	assert.Equal(t, RaidType("raid0(2 x raid1(2))"), status.Type)
+	assert.Equal(t, 1, status.FaultTolerance)
+	assert.Len(t, status.Disks, 4)
+
+	data := bytes.Repeat([]byte("StripeOfMirrors"), 6)
+	assert.NoError(t, controller.Write(data, 0))
+
+	// One disk in each mirror can fail
+	for _, failed := range []int{0, 3} {
+		assert.NoError(t, controller.ClearDisk(failed))
+		assert.Equal(t, ArrayStateDegraded, controller.Status().State)
+		output, err := controller.Read(0, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, output)
+	}
+	assert.Zero(t, controller.Status().FaultTolerance)
+
+	// Losing a whole mirror loses the stripe
+	assert.NoError(t, controller.ClearDisk(1))
+	assert.Equal(t, ArrayStateFailed, controller.Status().State)
+	_, err = controller.Read(0, len(data))
+	assert.Error(t, err)
+}
+
+func TestComposite_MirrorOfStripesRebuildsLostStripe(t *testing.T) {
+	controller, err := NewCompositeController("raid1(2 x raid0(3))", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, controller.Status().FaultTolerance)
+	data := bytes.Repeat([]byte("MirrorOfStripes"), 6)
+	assert.NoError(t, controller.Write(data, 0))
+
+	// A single disk failure takes its whole stripe out of the mirror
+	assert.NoError(t, controller.ClearDisk(1))
+	assert.Equal(t, DiskStateFailed, controller.root.memberState(0))
+	status := controller.Status()
+	assert.Equal(t, ArrayStateDegraded, status.State)
+	assert.Zero(t, status.FaultTolerance)
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	// The replaced disk brings the stripe back, rebuilt from the other one
+	assert.NoError(t, controller.ReplaceDisk(1))
+	assert.NoError(t, controller.Rebuild(1, nil))
+	assert.Equal(t, ArrayStateOptimal, controller.Status().State)
+	assert.Equal(t, 1, controller.Status().FaultTolerance)
+
+	assert.NoError(t, controller.ClearDisk(4))
+	output, err = controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestComposite_StripeOfRAID6(t *testing.T) {
+	controller, err := NewCompositeController("raid0(3 x raid6(5))", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, controller.Status().FaultTolerance)
+	data := bytes.Repeat([]byte("0123456789"), 20)
+	assert.NoError(t, controller.Write(data, 0))
+
+	for _, failed := range []int{0, 1, 5, 6, 10, 11} {
+		assert.NoError(t, controller.ClearDisk(failed))
+	}
+	assert.Equal(t, ArrayStateDegraded, controller.Status().State)
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	// A nested array that survived rebuilds its disks on its own
+	assert.NoError(t, controller.ReplaceDisk(5))
+	assert.NoError(t, controller.Rebuild(5, nil))
+	assert.Equal(t, DiskStateOnline, controller.Status().Disks[5].State)
+	output, err = controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestComposite_RestartsFailedNestedArray(t *testing.T) {
+	controller, err := NewCompositeController("raid1(2 x raid5(3))", 2)
+	assert.NoError(t, err)
+	data := []byte("MirrorOfParityArrays")
+	assert.NoError(t, controller.Write(data, 0))
+
+	assert.NoError(t, controller.ClearDisk(0))
+	assert.NoError(t, controller.ClearDisk(1))
+	assert.Equal(t, ArrayStateDegraded, controller.Status().State)
+
+	// One replacement is enough for the RAID5 array to serve data, restarted from the other one
+	assert.NoError(t, controller.ReplaceDisk(0))
+	assert.NoError(t, controller.Rebuild(0, nil))
+	assert.Equal(t, DiskStateOnline, controller.root.memberState(0))
+	assert.Equal(t, DiskStateFailed, controller.Status().Disks[1].State)
+
+	// Its remaining disk is then rebuilt inside the RAID5 array
+	assert.NoError(t, controller.ReplaceDisk(1))
+	assert.NoError(t, controller.Rebuild(1, nil))
+	assert.Equal(t, ArrayStateOptimal, controller.Status().State)
+
+	for _, failed := range []int{3, 4} {
+		assert.NoError(t, controller.ClearDisk(failed))
+	}
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestComposite_RestartRequiresReplacedDisks(t *testing.T) {
+	controller, err := NewCompositeController("raid1(2 x raid0(2))", 2)
+	assert.NoError(t, err)
+	data := []byte("MirrorOfStripes")
+	assert.NoError(t, controller.Write(data, 0))
+
+	assert.NoError(t, controller.ClearDisk(0))
+	assert.NoError(t, controller.ClearDisk(1))
+
+	// The replacement waits until the whole stripe can be restarted
+	assert.NoError(t, controller.ReplaceDisk(0))
+	assert.Equal(t, DiskStateRebuilding, controller.Status().Disks[0].State)
+	err = controller.Rebuild(0, nil)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "still has failed disks")
+	}
+
+	assert.NoError(t, controller.ReplaceDisk(1))
+	assert.NoError(t, controller.Rebuild(1, nil))
+	assert.Equal(t, ArrayStateOptimal, controller.Status().State)
+
+	assert.NoError(t, controller.ClearDisk(3))
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestComposite_InvalidConfigurations(t *testing.T) {
+	_, err := NewController("raid0(2 x raid1(2))", 3, 2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "requires exactly 4 disks")
+	}
+	_, err = NewCompositeController("raid0(2 x raid5(2))", 2)
+	assert.Error(t, err, "RAID5 needs 3 disks")
+	_, err = NewCompositeController("raid0(2 x raid1(2))", 0)
+	assert.Error(t, err)
+	_, err = NewControllerWithOptions("raid0(2 x raid1(2))", newDisks(4, 2), 2, ControllerOptions{Groups: 2})
+	assert.Error(t, err)
+
+	controller, err := NewCompositeController("raid0(2 x raid1(2))", 2)
+	assert.NoError(t, err)
+	assert.Error(t, controller.ClearDisk(4))
+	assert.Error(t, controller.Rebuild(0, nil), "nothing to rebuild")
+}
+
+func TestArray_CompositeReopenAndReshape(t *testing.T) {
+	dir := t.TempDir()
+	array, err := CreateArray(dir, "raid1(2 x raid0(2))", 4, 2, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	data := []byte("NestedArraysOnDiskImages")
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.ClearDisk(2))
+	assert.NoError(t, array.Close())
+
+	// The stripe that lost a disk is still out of the mirror after reopening
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, ArrayStateDegraded, array.Status().State)
+	assert.NoError(t, array.ReplaceDisk(2))
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.Rebuild(2, nil))
+	assert.Equal(t, ArrayStateOptimal, array.Status().State)
+
+	assert.NoError(t, array.StartReshape(ReshapeTarget{Type: "raid0(2 x raid5(3))", DiskCount: 6, StripeSz: 2}))
+	done, err := array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, RaidType("raid0(2 x raid5(3))"), array.Status().Type)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
@@ -0,0 +1,96 @@
+package raid
+
+import "sync"
+
+// stripeLocks hands out a reader/writer lock per stripe, so I/O on disjoint stripes runs in
+// parallel while overlapping I/O is serialized. Locks are created on demand and dropped once
+// nobody holds or waits for them. The zero value is ready to use.
+type stripeLocks struct {
+	mu    sync.Mutex
+	locks map[int]*stripeLock
+}
+
+type stripeLock struct {
+	sync.RWMutex
+	refs int // holders and waiters
+}
+
+// lockRange locks stripes first through last and returns the function releasing them.
+// Stripes are locked in ascending order so that concurrent callers cannot deadlock.
+func (s *stripeLocks) lockRange(first, last int, shared bool) func() {
+	held := make([]*stripeLock, 0, max(last-first+1, 0))
+	for stripe := first; stripe <= last; stripe++ {
+		l := s.acquire(stripe)
+		if shared {
+			l.RLock()
+		} else {
+			l.Lock()
+		}
+		held = append(held, l)
+	}
+	return func() {
+		for i, l := range held {
+			if shared {
+				l.RUnlock()
+			} else {
+				l.Unlock()
+			}
+			s.release(first+i, l)
+		}
+	}
+}
+
+// lock locks a single stripe and returns the function releasing it.
+func (s *stripeLocks) lock(stripe int, shared bool) func() {
+	return s.lockRange(stripe, stripe, shared)
+}
+
+func (s *stripeLocks) acquire(stripe int) *stripeLock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.locks == nil {
+		s.locks = map[int]*stripeLock{}
+	}
+	l, ok := s.locks[stripe]
+	if !ok {
+		l = &stripeLock{}
+		s.locks[stripe] = l
+	}
+	l.refs++
+	return l
+}
+
+func (s *stripeLocks) release(stripe int, l *stripeLock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l.refs--
+	if l.refs == 0 {
+		delete(s.locks, stripe)
+	}
+}
+
+// forEachParallel runs fn(0) through fn(n-1) concurrently and returns the error of the lowest
+// failing index, so errors are reported deterministically.
+func forEachParallel(n int, fn func(i int) error) error {
+	if n == 1 {
+		return fn(0)
+	}
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = fn(i)
+		}(i)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
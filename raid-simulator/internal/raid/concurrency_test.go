@@ -0,0 +1,171 @@
+package raid_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+var concurrencyLevels = []struct {
+	raidType  raid.RaidType
+	diskCount int
+}{
+	{raid.RaidTypeRaid0, 3},
+	{raid.RaidTypeRaid1, 3},
+	{raid.RaidTypeRaid10, 4},
+	{raid.RaidTypeRaid5, 4},
+	{raid.RaidTypeRaid6, 5},
+	{raid.RaidTypeRaid50, 6},
+	{raid.RaidTypeRaid60, 8},
+	{"raid1(2 x raid0(2))", 4},
+	{"raid0(2 x raid5(3))", 6},
+}
+
+const (
+	concurrencyWriters    = 16
+	concurrencyRegionSize = 7 // deliberately unaligned, so neighbouring regions share chunks and stripes
+	concurrencyRounds     = 20
+)
+
+func TestConcurrency_DisjointWrites(t *testing.T) {
+	for _, level := range concurrencyLevels {
+		t.Run(string(level.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(level.raidType, level.diskCount, 2)
+			assert.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for w := 0; w < concurrencyWriters; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					region := bytes.Repeat([]byte{byte('a' + w)}, concurrencyRegionSize)
+					for round := 0; round < concurrencyRounds; round++ {
+						assert.NoError(t, controller.Write(region, w*concurrencyRegionSize))
+					}
+				}(w)
+			}
+			wg.Wait()
+
+			output, err := controller.Read(0, concurrencyWriters*concurrencyRegionSize)
+			assert.NoError(t, err)
+			for w := 0; w < concurrencyWriters; w++ {
+				expected := bytes.Repeat([]byte{byte('a' + w)}, concurrencyRegionSize)
+				assert.Equal(t, expected, output[w*concurrencyRegionSize:(w+1)*concurrencyRegionSize], "region of writer %d", w)
+			}
+
+			// Parity written by interleaved read-modify-writes must still match the data
+			if scrubber, ok := controller.(raid.Scrubber); ok {
+				report, err := scrubber.Scrub(nil)
+				assert.NoError(t, err)
+				assert.Empty(t, report.Repaired)
+				assert.Empty(t, report.Unrecoverable)
+			}
+		})
+	}
+}
+
+func TestConcurrency_OverlappingWritesDoNotInterleave(t *testing.T) {
+	const span = 40
+	for _, level := range concurrencyLevels {
+		t.Run(string(level.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(level.raidType, level.diskCount, 3)
+			assert.NoError(t, err)
+
+			var wg sync.WaitGroup
+			for w := 0; w < concurrencyWriters; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for round := 0; round < concurrencyRounds; round++ {
+						assert.NoError(t, controller.Write(bytes.Repeat([]byte{byte('A' + w)}, span), 1))
+					}
+				}(w)
+			}
+
+			// Readers must only ever observe the whole range from a single write
+			for r := 0; r < 4; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for round := 0; round < concurrencyRounds; round++ {
+						output, err := controller.Read(1, span)
+						if err != nil || len(output) == 0 {
+							continue // nothing written yet
+						}
+						assert.Equal(t, bytes.Repeat(output[:1], len(output)), output)
+					}
+				}()
+			}
+			wg.Wait()
+
+			output, err := controller.Read(1, span)
+			assert.NoError(t, err)
+			assert.Equal(t, bytes.Repeat(output[:1], span), output)
+		})
+	}
+}
+
+func TestConcurrency_IODuringRebuildAndScrub(t *testing.T) {
+	cases := []struct {
+		raidType  raid.RaidType
+		diskCount int
+	}{
+		{raid.RaidTypeRaid1, 2},
+		{raid.RaidTypeRaid10, 4},
+		{raid.RaidTypeRaid5, 4},
+		{raid.RaidTypeRaid6, 5},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(tc.raidType, tc.diskCount, 2)
+			assert.NoError(t, err)
+			stable := bytes.Repeat([]byte("stable!"), 20)
+			assert.NoError(t, controller.Write(stable, 0))
+			assert.NoError(t, controller.ClearDisk(1))
+			assert.NoError(t, controller.ReplaceDisk(1))
+
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				assert.NoError(t, controller.(raid.Rebuilder).Rebuild(1, nil))
+			}()
+			if scrubber, ok := controller.(raid.Scrubber); ok {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := scrubber.Scrub(nil)
+					assert.NoError(t, err)
+				}()
+			}
+			for w := 0; w < 4; w++ {
+				wg.Add(2)
+				go func(w int) {
+					defer wg.Done()
+					region := bytes.Repeat([]byte{byte('0' + w)}, concurrencyRegionSize)
+					for round := 0; round < concurrencyRounds; round++ {
+						assert.NoError(t, controller.Write(region, len(stable)+w*concurrencyRegionSize))
+					}
+				}(w)
+				go func() {
+					defer wg.Done()
+					for round := 0; round < concurrencyRounds; round++ {
+						output, err := controller.Read(0, len(stable))
+						assert.NoError(t, err)
+						assert.Equal(t, stable, output)
+					}
+				}()
+			}
+			wg.Wait()
+
+			assert.Equal(t, raid.ArrayStateOptimal, controller.Status().State)
+			output, err := controller.Read(0, len(stable))
+			assert.NoError(t, err)
+			assert.Equal(t, stable, output)
+		})
+	}
+}
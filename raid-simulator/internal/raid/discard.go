@@ -0,0 +1,40 @@
+package raid
+
+import "fmt"
+
+// Discarder is implemented by controllers that can discard (TRIM) a logical byte range, releasing
+// the chunks it covers on their member disks. The range reads back as zeros afterwards.
+type Discarder interface {
+	Discard(offset, length int) error
+}
+
+// discardBounds validates a discard of length bytes at offset and clips it to the data written so
+// far, returning the end of the range to discard. Nothing is stored past the high-water mark.
+func discardBounds(offset, length, highWaterMark int) (int, error) {
+	if offset < 0 || length < 0 {
+		return 0, fmt.Errorf("discard offset and length must be non-negative")
+	}
+	return min(offset+length, highWaterMark), nil
+}
+
+// zeroPartialUnits writes zeros with write over the parts of [offset, end) that cover units of
+// unitSz bytes only partly, so they stay consistent with their redundancy. It returns the first
+// and last unit the range covers whole, to be released; last < first when there are none.
+func zeroPartialUnits(write func(data []byte, offset int) error, offset, end, unitSz int) (int, int, error) {
+	first := (offset + unitSz - 1) / unitSz
+	last := end/unitSz - 1
+	if first > last {
+		return first, last, write(make([]byte, end-offset), offset)
+	}
+	if head := first * unitSz; head > offset {
+		if err := write(make([]byte, head-offset), offset); err != nil {
+			return 0, 0, err
+		}
+	}
+	if tail := (last + 1) * unitSz; tail < end {
+		if err := write(make([]byte, end-tail), tail); err != nil {
+			return 0, 0, err
+		}
+	}
+	return first, last, nil
+}
@@ -0,0 +1,190 @@
+package raid_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+// allocatedChunks sums the chunks taking up space on every disk of the controller.
+func allocatedChunks(controller raid.RAIDController) int {
+	total := 0
+	for _, disk := range controller.Status().Disks {
+		total += disk.Allocated
+	}
+	return total
+}
+
+func TestDiscard_AllRaidTypes(t *testing.T) {
+	cases := []struct {
+		raidType  raid.RaidType
+		diskCount int
+		failDisk  int
+	}{
+		{raid.RaidTypeRaid0, 3, -1},
+		{raid.RaidTypeRaid1, 3, 1},
+		{raid.RaidTypeRaid10, 4, 2},
+		{raid.RaidTypeRaid4, 3, 2},
+		{raid.RaidTypeRaid5, 4, 0},
+		{raid.RaidTypeRaid6, 5, 3},
+		{"ec:3+2", 5, 4},
+		{raid.RaidTypeRaid50, 6, 4},
+		{raid.RaidTypeRaid60, 8, 1},
+		{"raid1(2 x raid5(3))", 6, 3},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(tc.raidType, tc.diskCount, 4)
+			assert.NoError(t, err)
+			data := bytes.Repeat([]byte("0123456789abcdefghijklmnopqrstuv"), 8)
+			assert.NoError(t, controller.Write(data, 0))
+			allocated := allocatedChunks(controller)
+
+			// Discarded bytes read back as zeros, whether they cover whole stripes or not
+			assert.NoError(t, controller.(raid.Discarder).Discard(5, 190))
+			expected := bytes.Clone(data)
+			copy(expected[5:195], make([]byte, 190))
+			output, err := controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, expected, output)
+			assert.Less(t, allocatedChunks(controller), allocated, "whole stripes are released")
+			assert.Equal(t, len(data), controller.HighWaterMark(), "the logical size is unchanged")
+
+			// Redundancy stays consistent: the array still serves its data degraded
+			if tc.failDisk >= 0 {
+				assert.NoError(t, controller.ClearDisk(tc.failDisk))
+				output, err = controller.Read(0, len(data))
+				assert.NoError(t, err)
+				assert.Equal(t, expected, output)
+			}
+		})
+	}
+}
+
+func TestDiscard_ScrubFindsParityConsistent(t *testing.T) {
+	controller, err := raid.NewController(raid.RaidTypeRaid6, 5, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write(bytes.Repeat([]byte("ParityStaysInSync"), 4), 0))
+	assert.NoError(t, controller.(raid.Discarder).Discard(3, 40))
+
+	report, err := controller.(raid.Scrubber).Scrub(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Repaired)
+	assert.Empty(t, report.Unrecoverable)
+}
+
+func TestDiscard_SparseWrites(t *testing.T) {
+	// A write far into the array only takes up its own stripe
+	controller, err := raid.NewController(raid.RaidTypeRaid5, 3, 4)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("farfar"), 4000))
+	status := controller.Status()
+	assert.Equal(t, 501, status.Disks[0].Chunks)
+	assert.Equal(t, 3, allocatedChunks(controller))
+
+	output, err := controller.Read(0, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, make([]byte, 8), output)
+
+	// Discarding past the data written, or nothing at all, is a no-op
+	discarder := controller.(raid.Discarder)
+	assert.NoError(t, discarder.Discard(5000, 100))
+	assert.NoError(t, discarder.Discard(0, 0))
+	assert.Error(t, discarder.Discard(-1, 4))
+	assert.NoError(t, discarder.Discard(4000, 8))
+	assert.Zero(t, allocatedChunks(controller))
+}
+
+func TestArray_DiscardPersists(t *testing.T) {
+	dir := t.TempDir()
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid5, 3, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	data := []byte("AAAABBBBCCCCDDDD")
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Discard(0, 8))
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	report := array.HealthReport(0)
+	assert.Equal(t, 3*4, report.Allocated, "only the second stripe takes up space")
+	assert.Equal(t, 16, report.HighWaterMark)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, append(make([]byte, 8), "CCCCDDDD"...), output)
+}
+
+func TestVolume_Discard(t *testing.T) {
+	volume := newTestVolume(t, raid.RaidTypeRaid1, 2, 32)
+	_, err := volume.WriteAt([]byte("KeepDropDropKeep"), 0)
+	assert.NoError(t, err)
+	assert.NoError(t, volume.Discard(4, 8))
+	assert.NoError(t, volume.Discard(30, 100), "clipped to the end of the volume")
+	assert.Error(t, volume.Discard(-1, 4))
+
+	buf := make([]byte, 16)
+	_, err = volume.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte("Keep"), make([]byte, 8)...), "Keep"...), buf)
+}
+
+func TestRebuild_KeepsHoles(t *testing.T) {
+	for _, tc := range []struct {
+		raidType  raid.RaidType
+		diskCount int
+	}{
+		{raid.RaidTypeRaid1, 2},
+		{raid.RaidTypeRaid10, 4},
+		{raid.RaidTypeRaid5, 3},
+		{raid.RaidTypeRaid6, 5},
+		{"ec:3+2", 5},
+		{raid.RaidTypeRaid50, 6},
+		{"raid1(2 x raid5(3))", 6},
+	} {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(tc.raidType, tc.diskCount, 4)
+			assert.NoError(t, err)
+			assert.NoError(t, controller.Write([]byte{'x'}, 64*1024))
+			allocated := controller.Status().Disks[1].Allocated
+
+			assert.NoError(t, controller.ClearDisk(1))
+			assert.NoError(t, controller.ReplaceDisk(1))
+			assert.NoError(t, controller.(raid.Rebuilder).Rebuild(1, nil))
+			assert.Equal(t, allocated, controller.Status().Disks[1].Allocated, "the holes below the data stay holes")
+
+			assert.NoError(t, controller.ClearDisk(0))
+			output, err := controller.Read(64*1024-2, 3)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte{0, 0, 'x'}, output)
+		})
+	}
+}
+
+func TestReshape_KeepsHoles(t *testing.T) {
+	from, err := raid.NewController(raid.RaidTypeRaid5, 3, 4)
+	assert.NoError(t, err)
+	to, err := raid.NewController(raid.RaidTypeRaid6, 5, 4)
+	assert.NoError(t, err)
+	assert.NoError(t, from.Write([]byte("head"), 0))
+	assert.NoError(t, from.Write([]byte{'x'}, 64*1024))
+
+	// Contents left in the target by an earlier run are discarded where the source holds zeros
+	assert.NoError(t, to.Write([]byte("stale"), 1024))
+
+	reshape, err := raid.NewReshape(from, to, 0)
+	assert.NoError(t, err)
+	assert.NoError(t, reshape.Run(nil))
+	assert.Equal(t, from.HighWaterMark(), to.HighWaterMark())
+	assert.Equal(t, 2*5, allocatedChunks(to), "one stripe for each write")
+
+	output, err := to.Read(0, from.HighWaterMark())
+	assert.NoError(t, err)
+	expected := make([]byte, 64*1024+1)
+	copy(expected, "head")
+	expected[64*1024] = 'x'
+	assert.Equal(t, expected, output)
+}
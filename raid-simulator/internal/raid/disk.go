@@ -0,0 +1,318 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+)
+
+// DiskState describes whether a disk's contents can be trusted. A member disk goes from online
+// (active) to failed (faulty) when it breaks, may then be removed from its slot, and comes back
+// online once a replacement or a hot spare installed in the slot has been rebuilding long enough
+// to hold every chunk again.
+type DiskState string
+
+const (
+	DiskStateOnline     DiskState = "online"
+	DiskStateFailed     DiskState = "failed"
+	DiskStateRemoved    DiskState = "removed"    // failed disk pulled out of its slot, which stays empty until a replacement
+	DiskStateRebuilding DiskState = "rebuilding" // replacement installed, contents not yet regenerated
+	DiskStateSpare      DiskState = "spare"      // hot spare standing by to take the slot of a failed member
+)
+
+// isFailed reports whether a member in the state holds nothing that can be read: it failed, or
+// was removed since.
+func (s DiskState) isFailed() bool {
+	return s == DiskStateFailed || s == DiskStateRemoved
+}
+
+// ErrChecksumMismatch is returned when a chunk no longer matches the checksum recorded when it was written.
+var ErrChecksumMismatch = errors.New("chunk checksum mismatch")
+
+// Simulate single Disk
+// Chunk I/O is safe for concurrent use. State and rebuilt are guarded by the owning controller.
+type Disk struct {
+	ID      int
+	State   DiskState
+	rebuilt int // chunks already regenerated while the disk is rebuilding
+
+	chunkLimit int // declared size in chunks, 0 when the disk grows on demand
+
+	mu    sync.RWMutex    // guards dev and sums
+	dev   blockdev.Device // storage holding the disk's chunks (unit stripe/block)
+	sums  []uint32        // CRC-32 of every chunk on the device, indexed like the chunks
+	fault faultState      // faults injected to simulate misbehaving hardware
+
+	inflight atomic.Int32 // reads in flight through a readBalancer, compared by the least-loaded policy
+	reads    atomic.Int64 // chunk reads that reached the device, for workload reports
+	writes   atomic.Int64 // chunk writes that reached the device
+}
+
+// DiskIOStats counts the chunk I/Os a disk served.
+type DiskIOStats struct {
+	Reads  int64 `json:"reads"`
+	Writes int64 `json:"writes"`
+}
+
+// NewDisk creates a disk on top of the given block device.
+// Checksums of chunks already on the device are computed from their current contents.
+func NewDisk(id int, state DiskState, dev blockdev.Device) *Disk {
+	d := &Disk{ID: id, State: state, dev: dev}
+	for i := 0; i < dev.ChunkCount(); i++ {
+		chunk, err := dev.ReadChunk(i)
+		if err != nil {
+			chunk = make([]byte, dev.ChunkSize())
+		}
+		d.sums = append(d.sums, crc32.ChecksumIEEE(chunk))
+	}
+	return d
+}
+
+// NewSizedDisk creates a disk on top of the given block device that holds at most chunkLimit chunks.
+// Writes past the declared size fail with ErrOutOfSpace.
+func NewSizedDisk(id int, state DiskState, dev blockdev.Device, chunkLimit int) *Disk {
+	d := NewDisk(id, state, dev)
+	d.chunkLimit = max(chunkLimit, 0)
+	return d
+}
+
+// newDiskWithChecksums creates a disk whose chunk checksums were recorded earlier.
+// Checksums missing from sums are computed from the chunks' current contents.
+func newDiskWithChecksums(id int, state DiskState, dev blockdev.Device, chunkLimit int, sums []uint32) *Disk {
+	if len(sums) != dev.ChunkCount() {
+		return NewSizedDisk(id, state, dev, chunkLimit)
+	}
+	return &Disk{ID: id, State: state, chunkLimit: max(chunkLimit, 0), dev: dev, sums: sums}
+}
+
+// newDisks creates count empty, online, in-memory disks with sequential IDs that grow on demand.
+func newDisks(count, chunkSz int) []*Disk {
+	return newSizedDisks(count, chunkSz, 0)
+}
+
+// newSizedDisks creates count empty, online, in-memory disks holding at most chunkLimit chunks each.
+func newSizedDisks(count, chunkSz, chunkLimit int) []*Disk {
+	disks := make([]*Disk, max(count, 0))
+	for i := range disks {
+		disks[i] = NewSizedDisk(i, DiskStateOnline, blockdev.NewMemory(chunkSz), chunkLimit)
+	}
+	return disks
+}
+
+// diskChunks converts a disk size in bytes into whole chunks. A size of 0 declares disks that grow on demand.
+func diskChunks(diskSize, chunkSz int) (int, error) {
+	if diskSize < 0 {
+		return 0, fmt.Errorf("disk size must be non-negative. Provided: %d", diskSize)
+	}
+	if diskSize > 0 && diskSize < chunkSz {
+		return 0, fmt.Errorf("disk size %d is smaller than the stripe size %d", diskSize, chunkSz)
+	}
+	if chunkSz <= 0 {
+		return 0, nil // rejected by the controller
+	}
+	return diskSize / chunkSz, nil
+}
+
+// isOnline reports whether the disk can serve reads.
+func (d *Disk) isOnline() bool {
+	return d.State == DiskStateOnline
+}
+
+// canServe reports whether the chunk at index can be trusted for reads.
+// A rebuilding disk serves the chunks that have already been regenerated.
+func (d *Disk) canServe(index int) bool {
+	return d.State == DiskStateOnline || (d.State == DiskStateRebuilding && index < d.rebuilt)
+}
+
+// RebuildProgress returns how many chunks have been regenerated on a rebuilding disk.
+func (d *Disk) RebuildProgress() int {
+	return d.rebuilt
+}
+
+// IOStats returns how many chunk reads and writes reached the disk since it was created.
+// Reads and writes rejected by injected faults are not counted.
+func (d *Disk) IOStats() DiskIOStats {
+	return DiskIOStats{Reads: d.reads.Load(), Writes: d.writes.Load()}
+}
+
+// Size returns the declared size of the disk in bytes, or 0 when it grows on demand.
+func (d *Disk) Size() int {
+	return d.chunkLimit * d.dev.ChunkSize()
+}
+
+// ChunkCount returns the number of chunks up to the last one written to the disk, holes included.
+func (d *Disk) ChunkCount() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dev.ChunkCount()
+}
+
+// AllocatedChunks returns the number of chunks taking up space on the disk.
+func (d *Disk) AllocatedChunks() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dev.AllocatedChunks()
+}
+
+// allocated reports whether the chunk at index takes up space on the disk, rather than being a
+// hole that reads back as zeros.
+func (d *Disk) allocated(index int) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dev.Allocated(index)
+}
+
+// ReadChunk returns a copy of the chunk at index, failing with ErrChecksumMismatch
+// if its contents changed since it was written.
+func (d *Disk) ReadChunk(index int) ([]byte, error) {
+	if err := d.beforeRead(index); err != nil {
+		return nil, err
+	}
+	d.reads.Add(1)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	chunk, err := d.dev.ReadChunk(index)
+	if err != nil {
+		return nil, err
+	}
+	if !d.matchesChecksum(index, chunk) {
+		return nil, fmt.Errorf("%w: disk %d, chunk %d", ErrChecksumMismatch, d.ID, index)
+	}
+	return chunk, nil
+}
+
+// WriteChunk stores chunk at index, growing the disk up to its declared size if needed, and records its checksum.
+func (d *Disk) WriteChunk(index int, chunk []byte) error {
+	if d.chunkLimit > 0 && index >= d.chunkLimit {
+		return fmt.Errorf("%w: disk %d holds %d chunks, cannot write chunk %d", ErrOutOfSpace, d.ID, d.chunkLimit, index)
+	}
+	if err := d.beforeWrite(index); err != nil {
+		return err
+	}
+	d.writes.Add(1)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.dev.WriteChunk(index, chunk); err != nil {
+		return err
+	}
+	if index >= len(d.sums) {
+		// Chunks skipped over by the write read back as zeros
+		zeroSum := crc32.ChecksumIEEE(make([]byte, d.dev.ChunkSize()))
+		for len(d.sums) <= index {
+			d.sums = append(d.sums, zeroSum)
+		}
+	}
+	d.sums[index] = crc32.ChecksumIEEE(chunk)
+	return nil
+}
+
+// Discard releases the chunk at index, which reads back as zeros afterwards.
+func (d *Disk) Discard(index int) error {
+	if err := d.beforeWrite(index); err != nil {
+		return err
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.dev.Discard(index); err != nil {
+		return err
+	}
+	if index < len(d.sums) {
+		d.sums[index] = crc32.ChecksumIEEE(make([]byte, d.dev.ChunkSize()))
+	}
+	return nil
+}
+
+// readRawChunk returns the chunk at index without verifying its checksum.
+func (d *Disk) readRawChunk(index int) ([]byte, error) {
+	if err := d.beforeRead(index); err != nil {
+		return nil, err
+	}
+	d.reads.Add(1)
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.dev.ReadChunk(index)
+}
+
+// verifyChunk reports whether chunk matches the checksum recorded for index.
+// Chunks without a recorded checksum are trusted.
+func (d *Disk) verifyChunk(index int, chunk []byte) bool {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.matchesChecksum(index, chunk)
+}
+
+// matchesChecksum is verifyChunk for callers already holding the disk lock.
+func (d *Disk) matchesChecksum(index int, chunk []byte) bool {
+	return index >= len(d.sums) || d.sums[index] == crc32.ChecksumIEEE(chunk)
+}
+
+// Checksums returns a copy of the CRC-32 recorded for each chunk.
+func (d *Disk) Checksums() []uint32 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return append([]uint32(nil), d.sums...)
+}
+
+// readChunkOrZeros returns the chunk at index, for reads and Read-Modify-Write alike.
+// Chunks that were never written read back as zeros.
+func (d *Disk) readChunkOrZeros(index int) ([]byte, error) {
+	chunk, err := d.ReadChunk(index)
+	if errors.Is(err, blockdev.ErrChunkNotFound) {
+		return make([]byte, d.dev.ChunkSize()), nil
+	}
+	return chunk, err
+}
+
+// reset wipes the disk's contents and moves it to the given state.
+// Injected faults are dropped along with the contents, as the disk is swapped out.
+func (d *Disk) reset(state DiskState) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.dev.Wipe(); err != nil {
+		return fmt.Errorf("failed to wipe disk %d: %w", d.ID, err)
+	}
+	d.State = state
+	d.rebuilt = 0
+	d.sums = nil
+	d.fault.mu.Lock()
+	d.fault.faults = Faults{}
+	d.fault.mu.Unlock()
+	return nil
+}
+
+// swapDevice installs dev as the disk's block device and returns the previous one, for the caller
+// to close. Checksums and injected faults stay with the previous device, as the disk is swapped out.
+func (d *Disk) swapDevice(dev blockdev.Device) blockdev.Device {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	old := d.dev
+	d.dev = dev
+	d.sums = nil
+	d.fault.mu.Lock()
+	d.fault.faults = Faults{}
+	d.fault.mu.Unlock()
+	return old
+}
+
+// Close releases the disk's block device.
+func (d *Disk) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.dev.Close()
+}
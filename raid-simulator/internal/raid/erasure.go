@@ -0,0 +1,107 @@
+package raid
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// erasureCodePrefix starts the RaidType of generic erasure-coded arrays, e.g. "ec:8+3".
+const erasureCodePrefix = "ec:"
+
+// Codes with more than gf8MaxShards shards are computed by reedsolomon in GF(2^16), which only
+// accepts shards whose size is a multiple of gf16ShardAlignment bytes.
+const (
+	gf8MaxShards       = 256
+	gf16ShardAlignment = 64
+)
+
+// ErasureCodedType returns the RaidType of an erasure-coded array with dataShards data and
+// parityShards parity shards per stripe, e.g. "ec:8+3".
+func ErasureCodedType(dataShards, parityShards int) RaidType {
+	return RaidType(fmt.Sprintf("%s%d+%d", erasureCodePrefix, dataShards, parityShards))
+}
+
+// IsErasureCoded reports whether raidType names a generic erasure-coded array ("ec:k+m").
+func IsErasureCoded(raidType RaidType) bool {
+	return strings.HasPrefix(string(raidType), erasureCodePrefix)
+}
+
+// ParseErasureCode splits an "ec:k+m" RaidType into its data and parity shard counts.
+func ParseErasureCode(raidType RaidType) (dataShards, parityShards int, err error) {
+	spec, ok := strings.CutPrefix(string(raidType), erasureCodePrefix)
+	if !ok {
+		return 0, 0, fmt.Errorf("%s is not an erasure-coded RAID type (expected %sk+m)", raidType, erasureCodePrefix)
+	}
+	k, m, ok := strings.Cut(spec, "+")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid erasure code %s: expected %sk+m, e.g. %s", raidType, erasureCodePrefix, ErasureCodedType(8, 3))
+	}
+	if dataShards, err = strconv.Atoi(k); err != nil || dataShards < 1 {
+		return 0, 0, fmt.Errorf("invalid erasure code %s: data shard count must be a positive integer", raidType)
+	}
+	if parityShards, err = strconv.Atoi(m); err != nil || parityShards < 1 {
+		return 0, 0, fmt.Errorf("invalid erasure code %s: parity shard count must be a positive integer", raidType)
+	}
+	return dataShards, parityShards, nil
+}
+
+// ErasureCodedController implements the RAIDController interface for a generic k+m Reed-Solomon
+// code: every stripe holds k data and m parity shards on k+m disks, and the array survives the
+// loss of any m of them. RAID5 and RAID6 are the special cases k+1 and k+2.
+type ErasureCodedController struct {
+	*parityArray
+}
+
+// NewErasureCodedController creates an erasure-coded controller over dataShards+parityShards disks.
+func NewErasureCodedController(dataShards, parityShards, stripeSz int) (*ErasureCodedController, error) {
+	return newErasureCodedController(newDisks(dataShards+parityShards, stripeSz), stripeSz, dataShards, parityShards)
+}
+
+func newErasureCodedController(disks []*Disk, stripeSz, dataShards, parityShards int) (*ErasureCodedController, error) {
+	raidType := ErasureCodedType(dataShards, parityShards)
+	if dataShards < 1 || parityShards < 1 {
+		return nil, fmt.Errorf("%s requires at least 1 data and 1 parity shard", raidType)
+	}
+	if len(disks) != dataShards+parityShards {
+		return nil, fmt.Errorf("%s requires exactly %d disks (%d data + %d parity). Provided: %d", raidType, dataShards+parityShards, dataShards, parityShards, len(disks))
+	}
+	if len(disks) > gf8MaxShards && stripeSz%gf16ShardAlignment != 0 {
+		return nil, fmt.Errorf("%s has more than %d shards, so its stripe size must be a multiple of %d. Provided: %d", raidType, gf8MaxShards, gf16ShardAlignment, stripeSz)
+	}
+	name := fmt.Sprintf("EC%d+%d", dataShards, parityShards)
+	array, err := newParityArrayWithMinData(raidType, name, disks, stripeSz, 1, parityShards, rotatingPlacement)
+	if err != nil {
+		return nil, err
+	}
+	return &ErasureCodedController{parityArray: array}, nil
+}
+
+// newErasureCodedFactory returns the factory building controllers of the "ec:k+m" raidType.
+func newErasureCodedFactory(raidType RaidType) (ControllerFactory, error) {
+	dataShards, parityShards, err := ParseErasureCode(raidType)
+	if err != nil {
+		return nil, err
+	}
+	return func(disks []*Disk, stripeSz int, opts ControllerOptions) (RAIDController, error) {
+		if err := rejectOptions(opts); err != nil {
+			return nil, err
+		}
+		controller, err := newErasureCodedController(disks, stripeSz, dataShards, parityShards)
+		if err != nil {
+			return nil, err
+		}
+		return controller, nil
+	}, nil
+}
+
+// rotatingPlacement shifts every shard one disk further per stripe, so the parity shards (and the
+// extra I/O they attract) visit every disk in turn. Stripe 0 keeps the data on the first disks and
+// the parity on the last ones.
+func rotatingPlacement(stripeIdx, numDisks, numParityShards int) []int {
+	placement := make([]int, numDisks)
+	for shardIdx := range placement {
+		placement[shardIdx] = (shardIdx + stripeIdx) % numDisks
+	}
+	return placement
+}
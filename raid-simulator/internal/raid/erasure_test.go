@@ -0,0 +1,162 @@
+package raid
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseErasureCode(t *testing.T) {
+	dataShards, parityShards, err := ParseErasureCode("ec:8+3")
+	assert.NoError(t, err)
+	assert.Equal(t, 8, dataShards)
+	assert.Equal(t, 3, parityShards)
+	assert.Equal(t, RaidType("ec:8+3"), ErasureCodedType(8, 3))
+
+	for _, invalid := range []RaidType{"raid5", "ec:", "ec:8", "ec:8+", "ec:+3", "ec:0+2", "ec:4+0", "ec:a+b", "ec:4+-1"} {
+		_, _, err := ParseErasureCode(invalid)
+		assert.Error(t, err, "%s", invalid)
+	}
+}
+
+func TestErasureCoded_ToleratesParityShardLosses(t *testing.T) {
+	controller, err := NewController("ec:8+3", 11, 2)
+	assert.NoError(t, err)
+	status := controller.Status()
+	assert.Equal(t, RaidType("ec:8+3"), status.Type)
+	assert.Equal(t, 3, status.FaultTolerance)
+
+	data := bytes.Repeat([]byte("WideStripesSurviveThreeLosses"), 10)
+	assert.NoError(t, controller.Write(data, 0))
+
+	for _, failed := range []int{0, 5, 10} {
+		assert.NoError(t, controller.ClearDisk(failed))
+	}
+	assert.Equal(t, ArrayStateDegraded, controller.Status().State)
+	assert.Zero(t, controller.Status().FaultTolerance)
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	// Writes keep working with m disks down
+	assert.NoError(t, controller.Write([]byte("degraded"), 7))
+	copy(data[7:], "degraded")
+	output, err = controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	assert.NoError(t, controller.ClearDisk(3))
+	assert.Equal(t, ArrayStateFailed, controller.Status().State)
+	_, err = controller.Read(0, len(data))
+	assert.Error(t, err)
+}
+
+func TestErasureCoded_RebuildAndScrub(t *testing.T) {
+	controller, err := NewErasureCodedController(4, 3, 3)
+	assert.NoError(t, err)
+	data := bytes.Repeat([]byte("0123456789"), 13)
+	assert.NoError(t, controller.Write(data, 0))
+
+	for _, failed := range []int{1, 4, 6} {
+		assert.NoError(t, controller.ClearDisk(failed))
+		assert.NoError(t, controller.ReplaceDisk(failed))
+	}
+	for _, failed := range []int{1, 4, 6} {
+		assert.NoError(t, controller.Rebuild(failed, nil))
+	}
+	assert.Equal(t, ArrayStateOptimal, controller.Status().State)
+
+	assert.NoError(t, controller.disks[2].CorruptChunk(1, 0, 2))
+	report, err := controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChunkRepair{{Stripe: 1, Disk: 2}}, report.Repaired)
+	assert.Empty(t, report.Unrecoverable)
+
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestErasureCoded_RotatesShardPlacement(t *testing.T) {
+	controller, err := NewErasureCodedController(3, 2, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, controller.placement(0, 5, 2))
+	assert.Equal(t, []int{1, 2, 3, 4, 0}, controller.placement(1, 5, 2))
+	assert.Equal(t, []int{4, 0, 1, 2, 3}, controller.placement(4, 5, 2))
+
+	// Over a full rotation every disk holds each parity shard exactly once
+	parityCount := make([]int, 5)
+	for stripe := 0; stripe < 5; stripe++ {
+		for _, d := range controller.placement(stripe, 5, 2)[3:] {
+			parityCount[d]++
+		}
+	}
+	assert.Equal(t, []int{2, 2, 2, 2, 2}, parityCount)
+}
+
+func TestErasureCoded_SingleDataShardAndCapacity(t *testing.T) {
+	controller, err := NewSizedController("ec:1+2", 3, 4, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, controller.Capacity())
+	assert.NoError(t, controller.Write([]byte("three copies"), 0))
+	assert.NoError(t, controller.ClearDisk(0))
+	assert.NoError(t, controller.ClearDisk(2))
+	output, err := controller.Read(0, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("three copies"), output)
+
+	controller, err = NewSizedController("ec:6+2", 8, 4, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, 6*16, controller.Capacity())
+}
+
+func TestErasureCoded_BeyondGF256(t *testing.T) {
+	// Past 256 shards the library switches to a 16-bit field, which needs 64-byte aligned shards
+	_, err := NewController("ec:200+100", 300, 2)
+	assert.Error(t, err)
+	controller, err := NewController("ec:200+100", 300, 64)
+	assert.NoError(t, err)
+	data := bytes.Repeat([]byte("w"), 1000)
+	assert.NoError(t, controller.Write(data, 0))
+	for failed := 0; failed < 100; failed++ {
+		assert.NoError(t, controller.ClearDisk(failed*3))
+	}
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestErasureCoded_InvalidConfigurations(t *testing.T) {
+	_, err := NewController("ec:4+2", 5, 2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "requires exactly 6 disks")
+	}
+	_, err = NewController("ec:4", 4, 2)
+	assert.Error(t, err)
+	_, err = NewControllerWithOptions("ec:2+1", newDisks(3, 2), 2, ControllerOptions{Layout: LayoutLeftSymmetric})
+	assert.Error(t, err)
+}
+
+func TestArray_ErasureCodedReopenAndReshape(t *testing.T) {
+	dir := t.TempDir()
+	array, err := CreateArray(dir, "ec:4+2", 6, 2, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	data := []byte("PersistedAcrossSixDisks")
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, RaidType("ec:4+2"), array.Status().Type)
+
+	assert.NoError(t, array.StartReshape(ReshapeTarget{Type: "ec:5+3", DiskCount: 8, StripeSz: 2}))
+	done, err := array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 3, array.Status().FaultTolerance)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
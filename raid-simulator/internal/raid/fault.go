@@ -0,0 +1,128 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrInjectedFault is returned by chunk I/O that failed because of an injected fault.
+var ErrInjectedFault = errors.New("injected disk fault")
+
+// Faults describes misbehaviour injected into a disk to exercise the recovery paths of the array.
+type Faults struct {
+	BadChunks  []int         `json:"bad_chunks,omitempty"`  // latent sector errors: reads of these chunks fail until they are rewritten
+	ReadErrors bool          `json:"read_errors,omitempty"` // every read fails while writes keep succeeding
+	Latency    time.Duration `json:"latency,omitempty"`     // delay added to every chunk read and write
+	ErrorRate  float64       `json:"error_rate,omitempty"`  // probability in [0, 1] that a chunk read or write fails
+	Seed       int64         `json:"seed,omitempty"`        // seed of the intermittent failures, for reproducible runs
+}
+
+// IsZero reports whether no fault is injected.
+func (f Faults) IsZero() bool {
+	return len(f.BadChunks) == 0 && !f.ReadErrors && f.Latency == 0 && f.ErrorRate == 0
+}
+
+// faultState holds the faults injected into a disk. It has its own lock because
+// concurrent readers of an array share the disks; holding it while sleeping makes a
+// slow disk serve one request at a time, like real hardware.
+type faultState struct {
+	mu     sync.Mutex
+	faults Faults
+	rng    *rand.Rand
+}
+
+// InjectFaults replaces the faults injected into the disk.
+func (d *Disk) InjectFaults(faults Faults) error {
+	if faults.ErrorRate < 0 || faults.ErrorRate > 1 {
+		return fmt.Errorf("error rate must be between 0 and 1. Provided: %g", faults.ErrorRate)
+	}
+	if faults.Latency < 0 {
+		return fmt.Errorf("latency must be non-negative. Provided: %s", faults.Latency)
+	}
+	d.fault.mu.Lock()
+	defer d.fault.mu.Unlock()
+
+	faults.BadChunks = slices.Clone(faults.BadChunks)
+	slices.Sort(faults.BadChunks)
+	faults.BadChunks = slices.Compact(faults.BadChunks)
+	d.fault.faults = faults
+	d.fault.rng = rand.New(rand.NewSource(faults.Seed))
+	return nil
+}
+
+// Faults returns the faults currently injected into the disk.
+func (d *Disk) Faults() Faults {
+	d.fault.mu.Lock()
+	defer d.fault.mu.Unlock()
+
+	faults := d.fault.faults
+	faults.BadChunks = slices.Clone(faults.BadChunks)
+	return faults
+}
+
+// CorruptChunk flips length bytes of the chunk at index starting at offset, bypassing the
+// checksum so the damage stays silent until the chunk is read or scrubbed.
+func (d *Disk) CorruptChunk(index, offset, length int) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	chunk, err := d.dev.ReadChunk(index)
+	if err != nil {
+		return err
+	}
+	if offset < 0 || length <= 0 || offset+length > len(chunk) {
+		return fmt.Errorf("corrupt range [%d, %d) is outside the %d-byte chunk", offset, offset+length, len(chunk))
+	}
+	for i := offset; i < offset+length; i++ {
+		chunk[i] ^= 0xFF
+	}
+	return d.dev.WriteChunk(index, chunk)
+}
+
+// beforeRead applies the injected faults to a read of the chunk at index.
+func (d *Disk) beforeRead(index int) error {
+	d.fault.mu.Lock()
+	defer d.fault.mu.Unlock()
+
+	faults := d.fault.faults
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+	switch {
+	case faults.ReadErrors:
+		return fmt.Errorf("%w: disk %d returns read errors", ErrInjectedFault, d.ID)
+	case slices.Contains(faults.BadChunks, index):
+		return fmt.Errorf("%w: latent sector error on disk %d, chunk %d", ErrInjectedFault, d.ID, index)
+	case d.intermittentFailure():
+		return fmt.Errorf("%w: intermittent read failure on disk %d, chunk %d", ErrInjectedFault, d.ID, index)
+	}
+	return nil
+}
+
+// beforeWrite applies the injected faults to a write of the chunk at index.
+// A successful write remaps a latent sector error, so the chunk reads fine afterwards.
+func (d *Disk) beforeWrite(index int) error {
+	d.fault.mu.Lock()
+	defer d.fault.mu.Unlock()
+
+	faults := d.fault.faults
+	if faults.Latency > 0 {
+		time.Sleep(faults.Latency)
+	}
+	if d.intermittentFailure() {
+		return fmt.Errorf("%w: intermittent write failure on disk %d, chunk %d", ErrInjectedFault, d.ID, index)
+	}
+	if i, found := slices.BinarySearch(faults.BadChunks, index); found {
+		d.fault.faults.BadChunks = slices.Delete(faults.BadChunks, i, i+1)
+	}
+	return nil
+}
+
+// intermittentFailure draws whether the current I/O fails. The fault lock must be held.
+func (d *Disk) intermittentFailure() bool {
+	return d.fault.faults.ErrorRate > 0 && d.fault.rng.Float64() < d.fault.faults.ErrorRate
+}
@@ -0,0 +1,155 @@
+package raid
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/stretchr/testify/assert"
+)
+
+func newFaultTestDisk(t *testing.T, chunks int) *Disk {
+	disk := NewDisk(0, DiskStateOnline, blockdev.NewMemory(2))
+	for i := 0; i < chunks; i++ {
+		assert.NoError(t, disk.WriteChunk(i, []byte{byte(i), byte(i)}))
+	}
+	return disk
+}
+
+func TestDisk_BadChunksFailUntilRewritten(t *testing.T) {
+	disk := newFaultTestDisk(t, 3)
+	assert.NoError(t, disk.InjectFaults(Faults{BadChunks: []int{2, 1, 2}}))
+	assert.Equal(t, []int{1, 2}, disk.Faults().BadChunks)
+
+	_, err := disk.ReadChunk(1)
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	_, err = disk.ReadChunk(0)
+	assert.NoError(t, err)
+
+	assert.NoError(t, disk.WriteChunk(1, []byte{9, 9}))
+	chunk, err := disk.ReadChunk(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{9, 9}, chunk)
+	assert.Equal(t, []int{2}, disk.Faults().BadChunks)
+}
+
+func TestDisk_ReadErrorsOnly(t *testing.T) {
+	disk := newFaultTestDisk(t, 1)
+	assert.NoError(t, disk.InjectFaults(Faults{ReadErrors: true}))
+
+	_, err := disk.ReadChunk(0)
+	assert.ErrorIs(t, err, ErrInjectedFault)
+	assert.NoError(t, disk.WriteChunk(1, []byte{1, 1}))
+	assert.Equal(t, 2, disk.ChunkCount())
+}
+
+func TestDisk_SlowDisk(t *testing.T) {
+	disk := newFaultTestDisk(t, 1)
+	assert.NoError(t, disk.InjectFaults(Faults{Latency: 20 * time.Millisecond}))
+
+	start := time.Now()
+	_, err := disk.ReadChunk(0)
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+}
+
+func TestDisk_IntermittentFailuresAreSeeded(t *testing.T) {
+	failures := func(seed int64) []bool {
+		disk := newFaultTestDisk(t, 1)
+		assert.NoError(t, disk.InjectFaults(Faults{ErrorRate: 0.3, Seed: seed}))
+		pattern := make([]bool, 200)
+		for i := range pattern {
+			_, err := disk.ReadChunk(0)
+			pattern[i] = err != nil
+		}
+		return pattern
+	}
+
+	first := failures(42)
+	assert.Equal(t, first, failures(42))
+	assert.NotEqual(t, first, failures(7))
+
+	count := 0
+	for _, failed := range first {
+		if failed {
+			count++
+		}
+	}
+	assert.InDelta(t, 60, count, 30)
+}
+
+func TestDisk_InjectFaultsValidation(t *testing.T) {
+	disk := newFaultTestDisk(t, 1)
+	assert.Error(t, disk.InjectFaults(Faults{ErrorRate: 1.5}))
+	assert.Error(t, disk.InjectFaults(Faults{Latency: -time.Second}))
+	assert.Error(t, disk.CorruptChunk(0, 1, 2))
+	assert.Error(t, disk.CorruptChunk(5, 0, 1))
+}
+
+func TestDisk_CorruptChunkIsDetected(t *testing.T) {
+	disk := newFaultTestDisk(t, 2)
+	assert.NoError(t, disk.CorruptChunk(1, 1, 1))
+
+	_, err := disk.ReadChunk(1)
+	assert.ErrorIs(t, err, ErrChecksumMismatch)
+	raw, err := disk.readRawChunk(1)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 0xFE}, raw)
+}
+
+func TestParityArray_ReadsAroundInjectedFaults(t *testing.T) {
+	data := []byte("ReconstructAroundMisbehavingDisks")
+
+	t.Run("raid5", func(t *testing.T) {
+		controller, err := NewRAID5Controller(4, 2)
+		assert.NoError(t, err)
+		assert.NoError(t, controller.Write(data, 0))
+		assert.NoError(t, controller.disks[1].InjectFaults(Faults{ReadErrors: true}))
+
+		output, err := controller.Read(0, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, output)
+
+		// A latent sector error on a second disk leaves its stripe with two lost shards
+		assert.NoError(t, controller.disks[2].InjectFaults(Faults{BadChunks: []int{1}}))
+		_, err = controller.Read(0, len(data))
+		assert.Error(t, err)
+	})
+
+	t.Run("raid6", func(t *testing.T) {
+		controller, err := NewRAID6Controller(5, 2)
+		assert.NoError(t, err)
+		assert.NoError(t, controller.Write(data, 0))
+		assert.NoError(t, controller.disks[0].InjectFaults(Faults{ReadErrors: true}))
+		assert.NoError(t, controller.disks[3].InjectFaults(Faults{BadChunks: []int{0, 2}}))
+		assert.NoError(t, controller.disks[4].CorruptChunk(1, 0, 2))
+
+		output, err := controller.Read(0, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, output)
+	})
+}
+
+func TestArray_FaultsPersistAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	array, err := CreateArray(dir, RaidTypeRaid5, 3, 4, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	disk, err := array.Disk(2)
+	assert.NoError(t, err)
+	assert.NoError(t, disk.InjectFaults(Faults{BadChunks: []int{3}, Latency: time.Millisecond}))
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	status := array.Status()
+	assert.Equal(t, &Faults{BadChunks: []int{3}, Latency: time.Millisecond}, status.Disks[2].Faults)
+	assert.Nil(t, status.Disks[0].Faults)
+
+	// Replacing the disk swaps out the faulty hardware
+	assert.NoError(t, array.ReplaceDisk(2))
+	assert.Nil(t, array.Status().Disks[2].Faults)
+
+	_, err = array.Disk(3)
+	assert.Error(t, err)
+}
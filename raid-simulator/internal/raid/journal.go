@@ -0,0 +1,182 @@
+package raid
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrSimulatedCrash is returned by a write interrupted at an armed crash point.
+var ErrSimulatedCrash = errors.New("simulated crash")
+
+// JournalEntry is a stripe write recorded before any of its shards reach the disks.
+type JournalEntry struct {
+	Stripe int      `json:"stripe"`
+	Shards [][]byte `json:"shards,omitempty"` // new shards in logical order: data shards, then parity shards
+}
+
+// Journal is a write-ahead log of stripe writes. A stripe is begun with its full new contents
+// before any disk is touched and committed once every shard is stored, so a write interrupted
+// in between can be replayed instead of leaving parity inconsistent with the data (the write hole).
+type Journal interface {
+	// Begin durably records that stripe is about to be overwritten with shards.
+	Begin(stripe int, shards [][]byte) error
+	// Commit records that every shard of stripe has been stored.
+	Commit(stripe int) error
+	// Pending returns the begun but uncommitted writes, ordered by stripe.
+	Pending() ([]JournalEntry, error)
+	Close() error
+}
+
+// MemoryJournal keeps the journal in process memory, for arrays whose disks live there too.
+type MemoryJournal struct {
+	mu      sync.Mutex
+	pending map[int][][]byte
+}
+
+func NewMemoryJournal() *MemoryJournal {
+	return &MemoryJournal{pending: map[int][][]byte{}}
+}
+
+func (j *MemoryJournal) Begin(stripe int, shards [][]byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.pending[stripe] = cloneShards(shards)
+	return nil
+}
+
+func (j *MemoryJournal) Commit(stripe int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.pending, stripe)
+	return nil
+}
+
+func (j *MemoryJournal) Pending() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]JournalEntry, 0, len(j.pending))
+	for stripe, shards := range j.pending {
+		entries = append(entries, JournalEntry{Stripe: stripe, Shards: cloneShards(shards)})
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Stripe < entries[b].Stripe })
+	return entries, nil
+}
+
+func (j *MemoryJournal) Close() error {
+	return nil
+}
+
+// journalRecord is a single line of a FileJournal.
+type journalRecord struct {
+	Op string `json:"op"` // "begin" or "commit"
+	JournalEntry
+}
+
+// FileJournal appends one JSON record per line to a file and syncs it before returning,
+// so begun writes survive a crash. The file is truncated whenever no write is pending.
+type FileJournal struct {
+	mu      sync.Mutex
+	path    string
+	file    *os.File
+	pending map[int][][]byte
+}
+
+// OpenFileJournal opens the journal at path, creating an empty one if it does not exist.
+// A torn record at the end of the file, left by a crash while it was appended, is ignored.
+func OpenFileJournal(path string) (*FileJournal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal %s: %w", path, err)
+	}
+	j := &FileJournal{path: path, file: f, pending: map[int][][]byte{}}
+
+	valid := int64(0) // length of the prefix made of complete records
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 1<<30)
+	for scanner.Scan() {
+		var record journalRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			break
+		}
+		valid += int64(len(scanner.Bytes())) + 1
+		switch record.Op {
+		case "begin":
+			j.pending[record.Stripe] = record.Shards
+		case "commit":
+			delete(j.pending, record.Stripe)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+	// Drop the torn record so new records are not appended after it
+	if err := f.Truncate(valid); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to truncate journal %s: %w", path, err)
+	}
+	return j, nil
+}
+
+func (j *FileJournal) Begin(stripe int, shards [][]byte) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if err := j.append(journalRecord{Op: "begin", JournalEntry: JournalEntry{Stripe: stripe, Shards: shards}}); err != nil {
+		return err
+	}
+	j.pending[stripe] = cloneShards(shards)
+	return nil
+}
+
+func (j *FileJournal) Commit(stripe int) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	delete(j.pending, stripe)
+	if len(j.pending) == 0 {
+		if err := j.file.Truncate(0); err != nil {
+			return fmt.Errorf("failed to truncate journal %s: %w", j.path, err)
+		}
+		return nil
+	}
+	return j.append(journalRecord{Op: "commit", JournalEntry: JournalEntry{Stripe: stripe}})
+}
+
+func (j *FileJournal) Pending() ([]JournalEntry, error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	entries := make([]JournalEntry, 0, len(j.pending))
+	for stripe, shards := range j.pending {
+		entries = append(entries, JournalEntry{Stripe: stripe, Shards: cloneShards(shards)})
+	}
+	sort.Slice(entries, func(a, b int) bool { return entries[a].Stripe < entries[b].Stripe })
+	return entries, nil
+}
+
+func (j *FileJournal) Close() error {
+	return j.file.Close()
+}
+
+func (j *FileJournal) append(record journalRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to encode journal record: %w", err)
+	}
+	if _, err := j.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to append to journal %s: %w", j.path, err)
+	}
+	if err := j.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync journal %s: %w", j.path, err)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package raid
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParityArray_CrashWithoutJournalLeavesWriteHole(t *testing.T) {
+	controller, err := NewRAID5Controller(3, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("AAAA"), 0))
+
+	controller.CrashAfter(1)
+	err = controller.Write([]byte("BBBB"), 0)
+	assert.ErrorIs(t, err, ErrSimulatedCrash)
+
+	report, err := controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0}, report.Unrecoverable)
+}
+
+func TestParityArray_JournalReplaysInterruptedWrite(t *testing.T) {
+	cases := []struct {
+		name       string
+		raidType   RaidType
+		diskCount  int
+		crashAfter int
+	}{
+		{"raid5 before any shard", RaidTypeRaid5, 4, 0},
+		{"raid5 mid stripe", RaidTypeRaid5, 4, 1},
+		{"raid5 before commit", RaidTypeRaid5, 4, 4},
+		{"raid6 mid stripe", RaidTypeRaid6, 5, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			journal := NewMemoryJournal()
+			disks := newDisks(tc.diskCount, 2)
+			controller, err := NewControllerWithDisks(tc.raidType, disks, 2)
+			assert.NoError(t, err)
+			_, err = controller.(Journaled).AttachJournal(journal)
+			assert.NoError(t, err)
+
+			oldData := []byte("OldStripeContents!")
+			newData := []byte("NEWSTRIPECONTENTS!")
+			assert.NoError(t, controller.Write(oldData, 0))
+
+			controller.(Journaled).CrashAfter(tc.crashAfter)
+			err = controller.Write(newData, 0)
+			assert.ErrorIs(t, err, ErrSimulatedCrash)
+
+			pending, err := journal.Pending()
+			assert.NoError(t, err)
+			assert.Len(t, pending, 1)
+
+			// Reopen the same disks after the crash
+			controller, err = NewControllerWithDisks(tc.raidType, disks, 2)
+			assert.NoError(t, err)
+			replayed, err := controller.(Journaled).AttachJournal(journal)
+			assert.NoError(t, err)
+			assert.Equal(t, 1, replayed)
+
+			pending, err = journal.Pending()
+			assert.NoError(t, err)
+			assert.Empty(t, pending)
+
+			report, err := controller.(Scrubber).Scrub(nil)
+			assert.NoError(t, err)
+			assert.Empty(t, report.Unrecoverable)
+			assert.Empty(t, report.Repaired)
+
+			// The stripe the crash interrupted holds the new data, later stripes still hold the old data
+			output, err := controller.Read(0, len(oldData))
+			assert.NoError(t, err)
+			stripeBytes := 2 * (len(disks) - controllerParity(controller).encoderExtension.ParityShards())
+			assert.Equal(t, newData[:stripeBytes], output[:stripeBytes])
+			assert.Equal(t, oldData[stripeBytes:], output[stripeBytes:])
+		})
+	}
+}
+
+func TestFileJournal_SurvivesReopenAndIgnoresTornRecord(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.log")
+	journal, err := OpenFileJournal(path)
+	assert.NoError(t, err)
+
+	shards := [][]byte{{1, 2}, {3, 4}, {2, 6}}
+	assert.NoError(t, journal.Begin(3, shards))
+	assert.NoError(t, journal.Begin(1, shards))
+	assert.NoError(t, journal.Commit(3))
+	assert.NoError(t, journal.Close())
+
+	// A crash while appending leaves half a record behind
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	assert.NoError(t, err)
+	_, err = f.WriteString(`{"op":"begin","stri`)
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	journal, err = OpenFileJournal(path)
+	assert.NoError(t, err)
+	pending, err := journal.Pending()
+	assert.NoError(t, err)
+	assert.Equal(t, []JournalEntry{{Stripe: 1, Shards: shards}}, pending)
+
+	assert.NoError(t, journal.Commit(1))
+	assert.NoError(t, journal.Close())
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Zero(t, info.Size())
+}
+
+func TestArray_RecoversInterruptedWriteOnReopen(t *testing.T) {
+	dir := t.TempDir()
+	array, err := CreateArray(dir, RaidTypeRaid5, 4, 2, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write([]byte("before"), 0))
+
+	assert.NoError(t, array.CrashAfter(2))
+	assert.ErrorIs(t, array.Write([]byte("AFTER!"), 0), ErrSimulatedCrash)
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+
+	output, err := array.Read(0, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("AFTER!"), output)
+
+	report, err := array.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Unrecoverable)
+}
+
+func TestArray_CrashRequiresJournaledLevel(t *testing.T) {
+	array, err := CreateArray(t.TempDir(), RaidTypeRaid10, 4, 2, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+
+	assert.Error(t, array.CrashAfter(1))
+}
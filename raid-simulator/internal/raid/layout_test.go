@@ -0,0 +1,106 @@
+package raid_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+// parityLayoutControllers returns a 4-disk RAID4 controller and one RAID5 controller per layout.
+func parityLayoutControllers(t *testing.T) map[string]raid.RAIDController {
+	t.Helper()
+	controllers := map[string]raid.RAIDController{}
+	raid4, err := raid.NewRAID4Controller(4, 2)
+	assert.NoError(t, err)
+	controllers[string(raid.RaidTypeRaid4)] = raid4
+	for _, layout := range raid.ParityLayouts() {
+		controller, err := raid.NewRAID5ControllerWithLayout(4, 2, layout)
+		assert.NoError(t, err)
+		controllers[string(layout)] = controller
+	}
+	return controllers
+}
+
+func TestParityLayouts_DegradedReadAndRebuild(t *testing.T) {
+	data := bytes.Repeat([]byte("EveryLayoutKeepsTheData"), 4)
+	for name, controller := range parityLayoutControllers(t) {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, controller.Write(data, 0))
+
+			for failed := 0; failed < 4; failed++ {
+				assert.NoError(t, controller.ClearDisk(failed))
+				output, err := controller.Read(0, len(data))
+				assert.NoError(t, err)
+				assert.Equal(t, data, output, "degraded read without disk %d", failed)
+
+				assert.NoError(t, controller.ReplaceDisk(failed))
+				assert.NoError(t, controller.(raid.Rebuilder).Rebuild(failed, nil))
+				assert.Equal(t, raid.ArrayStateOptimal, controller.Status().State)
+			}
+
+			report, err := controller.(raid.Scrubber).Scrub(nil)
+			assert.NoError(t, err)
+			assert.Empty(t, report.Repaired)
+			assert.Empty(t, report.Unrecoverable)
+		})
+	}
+}
+
+func TestParityLayouts_Status(t *testing.T) {
+	for name, controller := range parityLayoutControllers(t) {
+		status := controller.Status()
+		if name == string(raid.RaidTypeRaid4) {
+			assert.Equal(t, raid.RaidTypeRaid4, status.Type)
+			assert.Empty(t, status.Layout)
+		} else {
+			assert.Equal(t, raid.ParityLayout(name), status.Layout)
+		}
+		assert.Equal(t, 1, status.FaultTolerance)
+	}
+
+	controller, err := raid.NewController(raid.RaidTypeRaid5, 3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.DefaultParityLayout, controller.Status().Layout)
+}
+
+func TestNewControllerWithOptions_LayoutOnlyForRAID5(t *testing.T) {
+	opts := raid.ControllerOptions{Layout: raid.LayoutLeftSymmetric}
+	for _, raidType := range []raid.RaidType{raid.RaidTypeRaid0, raid.RaidTypeRaid1, raid.RaidTypeRaid4, raid.RaidTypeRaid6} {
+		disks := make([]*raid.Disk, 4)
+		for i := range disks {
+			disks[i] = raid.NewDisk(i, raid.DiskStateOnline, blockdev.NewMemory(2))
+		}
+		_, err := raid.NewControllerWithOptions(raidType, disks, 2, opts)
+		assert.Error(t, err, "layout on %s", raidType)
+	}
+}
+
+func TestArray_PersistsLayoutAndReshapesBetweenLayouts(t *testing.T) {
+	dir := t.TempDir()
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid5, 4, 2, 0, raid.ControllerOptions{Layout: raid.LayoutLeftSymmetric})
+	assert.NoError(t, err)
+	data := []byte("ParityMovesButDataStays")
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.LayoutLeftSymmetric, array.Status().Layout)
+
+	assert.NoError(t, array.StartReshape(raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 4, StripeSz: 2, Layout: raid.LayoutRightSymmetric}))
+	done, err := array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, raid.LayoutRightSymmetric, array.Status().Layout)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
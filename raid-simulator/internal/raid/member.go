@@ -0,0 +1,194 @@
+package raid
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/sirupsen/logrus"
+)
+
+// memberMagic opens the header of every member disk image, ahead of the length and CRC-32 of the
+// member superblock that follows.
+var memberMagic = []byte("RAIDSIM\x01")
+
+// MemberSuperblock is the metadata every member of a persisted array keeps in the header of its
+// disk image, like the superblock of an md member: which array the disk belongs to, the array's
+// level and geometry, the disk's slot in it and an event counter bumped by every update of the
+// array, so a member that missed updates can be told apart from the current ones.
+type MemberSuperblock struct {
+	ArrayUUID     string       `json:"array_uuid"`
+	Type          RaidType     `json:"type"`
+	StripeSz      int          `json:"stripe_size"`
+	Layout        ParityLayout `json:"layout,omitempty"`
+	Groups        int          `json:"groups,omitempty"`
+	Copies        int          `json:"copies,omitempty"`
+	MirrorLayout  MirrorLayout `json:"mirror_layout,omitempty"`
+	ReadPolicy    ReadPolicy   `json:"read_policy,omitempty"`
+	DiskSize      int          `json:"disk_size,omitempty"`
+	HighWaterMark int          `json:"high_water_mark,omitempty"`
+	Generation    int          `json:"generation,omitempty"`
+	Slot          int          `json:"slot"`
+	Disks         []DiskState  `json:"disks"` // state of every slot when the superblock was written
+	Events        uint64       `json:"events"`
+	Reshaping     bool         `json:"reshaping,omitempty"` // written while a reshape was in progress
+}
+
+// encodeMemberSuperblock lays out a member superblock for the header of a disk image.
+func encodeMemberSuperblock(msb MemberSuperblock) ([]byte, error) {
+	raw, err := json.Marshal(msb)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode member superblock: %w", err)
+	}
+	header := bytes.Clone(memberMagic)
+	header = binary.LittleEndian.AppendUint32(header, uint32(len(raw)))
+	header = binary.LittleEndian.AppendUint32(header, crc32.ChecksumIEEE(raw))
+	return append(header, raw...), nil
+}
+
+// decodeMemberSuperblock parses the header of a disk image. It reports false for a header
+// holding no superblock, such as the blank header of a wiped disk.
+func decodeMemberSuperblock(header []byte) (MemberSuperblock, bool, error) {
+	var msb MemberSuperblock
+	if !bytes.HasPrefix(header, memberMagic) {
+		return msb, false, nil
+	}
+	rest := header[len(memberMagic):]
+	if len(rest) < 8 {
+		return msb, false, fmt.Errorf("member superblock is truncated")
+	}
+	length, sum := binary.LittleEndian.Uint32(rest), binary.LittleEndian.Uint32(rest[4:])
+	if uint64(length) > uint64(len(rest)-8) {
+		return msb, false, fmt.Errorf("member superblock is truncated")
+	}
+	raw := rest[8 : 8+length]
+	if crc32.ChecksumIEEE(raw) != sum {
+		return msb, false, fmt.Errorf("member superblock is corrupt: %w", ErrChecksumMismatch)
+	}
+	if err := json.Unmarshal(raw, &msb); err != nil {
+		return msb, false, fmt.Errorf("failed to parse member superblock: %w", err)
+	}
+	return msb, true, nil
+}
+
+// newArrayUUID returns a random (version 4) UUID naming a new array.
+func newArrayUUID() (string, error) {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		return "", fmt.Errorf("failed to generate array UUID: %w", err)
+	}
+	u[6] = u[6]&0x0f | 0x40
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16]), nil
+}
+
+// memberSuperblock describes the current disk set of the array as seen by the member in slot.
+func (a *Array) memberSuperblock(slot int) MemberSuperblock {
+	states := make([]DiskState, len(a.sb.Disks))
+	for i, disk := range a.sb.Disks {
+		states[i] = disk.State
+	}
+	return MemberSuperblock{
+		ArrayUUID:     a.sb.UUID,
+		Type:          a.sb.Type,
+		StripeSz:      a.sb.StripeSz,
+		Layout:        a.sb.Layout,
+		Groups:        a.sb.Groups,
+		Copies:        a.sb.Copies,
+		MirrorLayout:  a.sb.MirrorLayout,
+		ReadPolicy:    a.sb.ReadPolicy,
+		DiskSize:      a.sb.DiskSize,
+		HighWaterMark: a.sb.HighWaterMark,
+		Generation:    a.sb.Generation,
+		Slot:          slot,
+		Disks:         states,
+		Events:        a.sb.Events,
+		Reshaping:     a.sb.Reshape != nil,
+	}
+}
+
+// writeMemberSuperblocks bumps the event counter and writes the member superblock of every disk
+// of the current set that has not failed, by the states last recorded in the array's superblock.
+// Failed disks keep whatever they held, so they lag behind.
+func (a *Array) writeMemberSuperblocks() error {
+	a.sb.Events++
+	for slot, disk := range a.members.disks {
+		if a.sb.Disks[slot].State.isFailed() {
+			continue
+		}
+		header, err := encodeMemberSuperblock(a.memberSuperblock(slot))
+		if err != nil {
+			return err
+		}
+		if err := disk.writeHeader(header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMembers verifies that every disk of the current set that has not failed carries the member
+// superblock of its slot. Members of another array or slot mean the images were swapped, which
+// only reassembling can sort out; members without a superblock or whose event counter lags behind
+// the array missed updates and are failed, to be replaced and rebuilt.
+func (a *Array) checkMembers() error {
+	for slot, disk := range a.members.disks {
+		if disk.State.isFailed() {
+			continue
+		}
+		image := a.sb.Disks[slot].Image
+		header, err := disk.readHeader()
+		if err != nil {
+			return err
+		}
+		msb, ok, err := decodeMemberSuperblock(header)
+		if err != nil {
+			return fmt.Errorf("disk %d (%s): %w", slot, image, err)
+		}
+		if !ok {
+			// A blank image stands in for a member that went missing, it holds none of the array's data
+			logrus.Warnf("[%s] Disk %d (%s) carries no member superblock and was failed; replace and rebuild it, or run raid assemble if it moved.", a.sb.Type, slot, image)
+			disk.State = DiskStateFailed
+			continue
+		}
+		if msb.ArrayUUID != a.sb.UUID || msb.Generation != a.sb.Generation {
+			return fmt.Errorf("disk %d (%s) belongs to another array (%s); run raid assemble to find the members", slot, image, msb.ArrayUUID)
+		}
+		if msb.Slot != slot {
+			return fmt.Errorf("disk %d (%s) holds slot %d of the array: the members are out of order, run raid assemble", slot, image, msb.Slot)
+		}
+		if msb.Events < a.sb.Events {
+			logrus.Warnf("[%s] Disk %d (%s) is stale (events %d, array %d) and was failed; replace and rebuild it.", a.sb.Type, slot, image, msb.Events, a.sb.Events)
+			disk.State = DiskStateFailed
+		}
+	}
+	return nil
+}
+
+// readHeader returns the header of the disk's image.
+func (d *Disk) readHeader() ([]byte, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	dev, ok := d.dev.(blockdev.HeaderDevice)
+	if !ok {
+		return nil, fmt.Errorf("disk %d has no header", d.ID)
+	}
+	return dev.ReadHeader()
+}
+
+// writeHeader replaces the header of the disk's image.
+func (d *Disk) writeHeader(header []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dev, ok := d.dev.(blockdev.HeaderDevice)
+	if !ok {
+		return fmt.Errorf("disk %d has no header", d.ID)
+	}
+	return dev.WriteHeader(header)
+}
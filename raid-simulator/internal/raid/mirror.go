@@ -0,0 +1,92 @@
+package raid
+
+import (
+	"fmt"
+	"slices"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReadPolicy selects which copy of a mirrored chunk serves a read (RAID1, RAID10).
+type ReadPolicy string
+
+const (
+	// ReadPolicyPrimaryFirst reads the first copy that can serve the chunk, in disk order.
+	ReadPolicyPrimaryFirst ReadPolicy = "primary-first"
+	// ReadPolicyRoundRobin rotates the first copy tried on every read, spreading reads over every mirror.
+	ReadPolicyRoundRobin ReadPolicy = "round-robin"
+	// ReadPolicyLeastLoaded reads the copy whose disk has the fewest reads in flight, steering reads away from slow disks.
+	ReadPolicyLeastLoaded ReadPolicy = "least-loaded"
+)
+
+// DefaultReadPolicy is the read policy of mirrored arrays that do not select one.
+const DefaultReadPolicy = ReadPolicyPrimaryFirst
+
+// ReadPolicies lists every supported read policy.
+func ReadPolicies() []ReadPolicy {
+	return []ReadPolicy{ReadPolicyPrimaryFirst, ReadPolicyRoundRobin, ReadPolicyLeastLoaded}
+}
+
+// chunkAddr locates one copy of a chunk: the disk holding it and the chunk index on that disk.
+type chunkAddr struct {
+	disk  *Disk
+	index int
+}
+
+// allocated reports whether the chunk takes up space on its disk.
+func (c chunkAddr) allocated() bool {
+	return c.disk.allocated(c.index)
+}
+
+// readBalancer picks the copy of a mirrored chunk to read according to a ReadPolicy.
+// It is safe for concurrent use.
+type readBalancer struct {
+	policy ReadPolicy
+	next   atomic.Uint64 // rotation of the round-robin policy
+}
+
+// newReadBalancer returns a balancer applying policy, DefaultReadPolicy when empty.
+func newReadBalancer(policy ReadPolicy) (*readBalancer, error) {
+	if policy == "" {
+		policy = DefaultReadPolicy
+	}
+	if !slices.Contains(ReadPolicies(), policy) {
+		return nil, fmt.Errorf("unsupported read policy: %s (supported: %v)", policy, ReadPolicies())
+	}
+	return &readBalancer{policy: policy}, nil
+}
+
+// order returns the copies in the order they should be tried. copies lists the primary copy first.
+func (b *readBalancer) order(copies []chunkAddr) []chunkAddr {
+	ordered := slices.Clone(copies)
+	switch b.policy {
+	case ReadPolicyRoundRobin:
+		first := int(b.next.Add(1)-1) % len(ordered)
+		ordered = append(ordered[first:], ordered[:first]...)
+	case ReadPolicyLeastLoaded:
+		slices.SortStableFunc(ordered, func(a, b chunkAddr) int {
+			return int(a.disk.inflight.Load() - b.disk.inflight.Load())
+		})
+	}
+	return ordered
+}
+
+// read returns the chunk from the first copy, in policy order, that can serve it.
+// Copies that fail are skipped in favour of the next one.
+func (b *readBalancer) read(log logrus.FieldLogger, name string, copies []chunkAddr) ([]byte, bool) {
+	for _, c := range b.order(copies) {
+		if !c.disk.canServe(c.index) {
+			continue
+		}
+		c.disk.inflight.Add(1)
+		chunk, err := c.disk.readChunkOrZeros(c.index)
+		c.disk.inflight.Add(-1)
+		if err != nil {
+			log.Debugf("[%s] Disk %d could not serve chunk %d: %v", name, c.disk.ID, c.index, err)
+			continue
+		}
+		return chunk, true
+	}
+	return nil, false
+}
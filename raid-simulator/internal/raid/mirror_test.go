@@ -0,0 +1,168 @@
+package raid
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBalancer_Policies(t *testing.T) {
+	disks := newDisks(3, 1)
+	copies := []chunkAddr{{disk: disks[0]}, {disk: disks[1]}, {disk: disks[2]}}
+	firstDisks := func(b *readBalancer, reads int) []int {
+		var ids []int
+		for i := 0; i < reads; i++ {
+			ids = append(ids, b.order(copies)[0].disk.ID)
+		}
+		return ids
+	}
+
+	balancer, err := newReadBalancer("")
+	assert.NoError(t, err)
+	assert.Equal(t, ReadPolicyPrimaryFirst, balancer.policy)
+	assert.Equal(t, []int{0, 0, 0}, firstDisks(balancer, 3))
+
+	balancer, err = newReadBalancer(ReadPolicyRoundRobin)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 1, 2, 0}, firstDisks(balancer, 4))
+
+	// Every copy is still tried, starting from the rotated one
+	ordered := balancer.order(copies)
+	assert.Equal(t, []*Disk{disks[1], disks[2], disks[0]}, []*Disk{ordered[0].disk, ordered[1].disk, ordered[2].disk})
+
+	balancer, err = newReadBalancer(ReadPolicyLeastLoaded)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{0, 0}, firstDisks(balancer, 2))
+	disks[0].inflight.Store(2)
+	disks[1].inflight.Store(1)
+	ordered = balancer.order(copies)
+	assert.Equal(t, []*Disk{disks[2], disks[1], disks[0]}, []*Disk{ordered[0].disk, ordered[1].disk, ordered[2].disk})
+
+	_, err = newReadBalancer("fastest")
+	assert.Error(t, err)
+}
+
+func TestRAID10_LayoutPlacement(t *testing.T) {
+	addrs := func(copies []chunkAddr) [][2]int {
+		var out [][2]int
+		for _, c := range copies {
+			out = append(out, [2]int{c.disk.ID, c.index})
+		}
+		return out
+	}
+
+	// 4 disks of 4 chunks with 2 copies: the far layout mirrors the first 2 chunks of every disk into the last 2
+	far, err := newRAID10Controller(newSizedDisks(4, 1, 4), 1, 2, MirrorLayoutFar, "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 0}, {1, 2}}, addrs(far.placement(0)))
+	assert.Equal(t, [][2]int{{1, 1}, {2, 3}}, addrs(far.placement(5)))
+	assert.Equal(t, [][2]int{{3, 1}, {0, 3}}, addrs(far.placement(7)))
+
+	offset, err := newRAID10Controller(newSizedDisks(4, 1, 4), 1, 2, MirrorLayoutOffset, "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{0, 0}, {1, 1}}, addrs(offset.placement(0)))
+	assert.Equal(t, [][2]int{{1, 2}, {2, 3}}, addrs(offset.placement(5)))
+
+	near, err := newRAID10Controller(newSizedDisks(3, 1, 4), 1, 2, MirrorLayoutNear, "")
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]int{{2, 0}, {0, 1}}, addrs(near.placement(1)))
+
+	// stripeAt inverts placement for every copy of every chunk that fits
+	for _, r := range []*RAID10Controller{far, offset, near} {
+		for stripe := 0; stripe < r.Capacity(); stripe++ {
+			for _, c := range r.placement(stripe) {
+				found, ok := r.stripeAt(c.disk.ID, c.index)
+				assert.True(t, ok)
+				assert.Equal(t, stripe, found, "%s copy of stripe %d on disk %d", r.layout, stripe, c.disk.ID)
+			}
+		}
+	}
+}
+
+func TestRAID10_FarAndOffsetLayouts(t *testing.T) {
+	for _, layout := range []MirrorLayout{MirrorLayoutFar, MirrorLayoutOffset} {
+		t.Run(string(layout), func(t *testing.T) {
+			controller, err := NewControllerWithOptions(RaidTypeRaid10, newSizedDisks(4, 2, 8), 2, ControllerOptions{MirrorLayout: layout})
+			assert.NoError(t, err)
+			assert.Equal(t, 4*8*2/2, controller.Capacity())
+			status := controller.Status()
+			assert.Equal(t, layout, status.MirrorLayout)
+			assert.Equal(t, 1, status.FaultTolerance)
+
+			data := bytes.Repeat([]byte("SpreadCopies"), 2)
+			assert.NoError(t, controller.Write(data, 0))
+
+			assert.NoError(t, controller.ClearDisk(1))
+			assert.NoError(t, controller.ReplaceDisk(1))
+			assert.NoError(t, controller.(Rebuilder).Rebuild(1, nil))
+			assert.Equal(t, ArrayStateOptimal, controller.Status().State)
+
+			// Copies sit on neighbouring disks, so losing two disks apart is survivable and adjacent ones are not
+			assert.NoError(t, controller.ClearDisk(0))
+			assert.NoError(t, controller.ClearDisk(2))
+			assert.Equal(t, ArrayStateDegraded, controller.Status().State)
+			output, err := controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, output)
+
+			assert.NoError(t, controller.ClearDisk(1))
+			assert.Equal(t, ArrayStateFailed, controller.Status().State)
+			_, err = controller.Read(0, len(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRAID10_InvalidOptions(t *testing.T) {
+	_, err := NewControllerWithOptions(RaidTypeRaid10, newDisks(4, 2), 2, ControllerOptions{MirrorLayout: MirrorLayoutFar})
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "declared size")
+	}
+	_, err = NewControllerWithOptions(RaidTypeRaid10, newDisks(4, 2), 2, ControllerOptions{MirrorLayout: "diagonal"})
+	assert.Error(t, err)
+	_, err = NewControllerWithOptions(RaidTypeRaid10, newDisks(4, 2), 2, ControllerOptions{Copies: 1})
+	assert.Error(t, err)
+	_, err = NewControllerWithOptions(RaidTypeRaid1, newDisks(3, 2), 2, ControllerOptions{Copies: 3})
+	assert.Error(t, err)
+	_, err = NewControllerWithOptions(RaidTypeRaid5, newDisks(3, 2), 2, ControllerOptions{ReadPolicy: ReadPolicyRoundRobin})
+	assert.Error(t, err)
+
+	controller, err := NewControllerWithOptions(RaidTypeRaid1, newDisks(3, 2), 2, ControllerOptions{ReadPolicy: ReadPolicyLeastLoaded})
+	assert.NoError(t, err)
+	assert.Equal(t, ReadPolicyLeastLoaded, controller.Status().ReadPolicy)
+}
+
+func TestArray_MirrorSettingsPersistAndReshape(t *testing.T) {
+	dir := t.TempDir()
+	opts := ControllerOptions{Copies: 3, MirrorLayout: MirrorLayoutOffset, ReadPolicy: ReadPolicyRoundRobin}
+	array, err := CreateArray(dir, RaidTypeRaid10, 6, 2, 12, opts)
+	assert.NoError(t, err)
+	data := []byte("TripleOffsetMirrors")
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	status := array.Status()
+	assert.Equal(t, 3, status.Copies)
+	assert.Equal(t, MirrorLayoutOffset, status.MirrorLayout)
+	assert.Equal(t, ReadPolicyRoundRobin, status.ReadPolicy)
+	assert.Equal(t, 2, status.FaultTolerance)
+
+	target := status.ReshapeTarget()
+	target.Copies, target.MirrorLayout = 2, MirrorLayoutFar
+	assert.NoError(t, array.StartReshape(target))
+	done, err := array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+
+	status = array.Status()
+	assert.Equal(t, 2, status.Copies)
+	assert.Equal(t, MirrorLayoutFar, status.MirrorLayout)
+	assert.Equal(t, ReadPolicyRoundRobin, status.ReadPolicy)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
@@ -0,0 +1,185 @@
+package raid_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+// modelLevels are the levels the model-checking harness drives, each over the disk count it is
+// created with.
+var modelLevels = []struct {
+	raidType  raid.RaidType
+	diskCount int
+}{
+	{raid.RaidTypeRaid0, 3},
+	{raid.RaidTypeRaid1, 3},
+	{raid.RaidTypeRaid10, 4},
+	{raid.RaidTypeRaid5, 4},
+	{raid.RaidTypeRaid6, 5},
+}
+
+const (
+	modelSpace    = 512 // logical bytes the operations address
+	modelMaxWrite = 64  // longest single write
+)
+
+// Operations of a model program, picked by its next byte.
+const (
+	opWrite = iota
+	opRead
+	opFail
+	opRebuild
+	opCount
+)
+
+// program hands out the bytes of a model program as bounded integers; an exhausted program
+// yields zeros.
+type program []byte
+
+func (p *program) next(n int) int {
+	if len(*p) == 0 || n <= 0 {
+		return 0
+	}
+	v := int((*p)[0]) % n
+	*p = (*p)[1:]
+	return v
+}
+
+// checkModel runs a program against a controller of the level and against a flat byte slice,
+// the reference model of what the array holds: random writes at random offsets, disk failures
+// within the level's fault tolerance, replacements and rebuilds of the failed disks, and reads
+// anywhere. It asserts after every step that the array reads back exactly what the model holds,
+// and that it never fails.
+func checkModel(t *testing.T, raidType raid.RaidType, diskCount, stripeSz int, ops program) {
+	t.Helper()
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.ErrorLevel)
+	defer logrus.SetLevel(level)
+
+	controller, err := raid.NewController(raidType, diskCount, stripeSz)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var model []byte
+	failed := map[int]bool{}
+
+	for step := 0; len(ops) > 0; step++ {
+		switch ops.next(opCount) {
+		case opWrite:
+			offset, length := ops.next(modelSpace), 1+ops.next(modelMaxWrite)
+			data := make([]byte, length)
+			for i := range data {
+				data[i] = byte(step*31 + i)
+			}
+			if !assert.NoError(t, controller.Write(data, offset), "step %d: write %d bytes at %d", step, length, offset) {
+				return
+			}
+			if end := offset + length; end > len(model) {
+				model = append(model, make([]byte, end-len(model))...)
+			}
+			copy(model[offset:], data)
+
+		case opRead:
+			if len(model) == 0 {
+				continue
+			}
+			start := ops.next(len(model))
+			length := 1 + ops.next(modelMaxWrite)
+			output, err := controller.Read(start, length)
+			if !assert.NoError(t, err, "step %d: read %d bytes at %d", step, length, start) ||
+				!assert.Equal(t, model[start:min(start+length, len(model))], output, "step %d: read %d bytes at %d", step, length, start) {
+				return
+			}
+
+		case opFail:
+			if controller.Status().FaultTolerance == 0 {
+				continue
+			}
+			index := ops.next(diskCount)
+			if failed[index] {
+				continue
+			}
+			if !assert.NoError(t, controller.ClearDisk(index), "step %d: fail disk %d", step, index) {
+				return
+			}
+			failed[index] = true
+
+		case opRebuild:
+			rebuilder, ok := controller.(raid.Rebuilder)
+			index := ops.next(diskCount)
+			if !ok || !failed[index] {
+				continue
+			}
+			if !assert.NoError(t, controller.ReplaceDisk(index), "step %d: replace disk %d", step, index) ||
+				!assert.NoError(t, rebuilder.Rebuild(index, nil), "step %d: rebuild disk %d", step, index) {
+				return
+			}
+			delete(failed, index)
+		}
+
+		status := controller.Status()
+		if !assert.NotEqual(t, raid.ArrayStateFailed, status.State, "step %d", step) ||
+			!assert.Equal(t, len(model), controller.HighWaterMark(), "step %d", step) {
+			return
+		}
+	}
+
+	// Whatever failed comes back, after which the redundancy matches the data again
+	if rebuilder, ok := controller.(raid.Rebuilder); ok {
+		for index := range failed {
+			assert.NoError(t, controller.ReplaceDisk(index))
+			assert.NoError(t, rebuilder.Rebuild(index, nil))
+		}
+		assert.Equal(t, raid.ArrayStateOptimal, controller.Status().State)
+	}
+	if len(model) > 0 {
+		output, err := controller.Read(0, len(model))
+		assert.NoError(t, err)
+		assert.Equal(t, model, output)
+	}
+	if scrubber, ok := controller.(raid.Scrubber); ok {
+		report, err := scrubber.Scrub(nil)
+		assert.NoError(t, err)
+		assert.Empty(t, report.Repaired)
+		assert.Empty(t, report.Unrecoverable)
+	}
+}
+
+func TestModel_RandomOperations(t *testing.T) {
+	seeds, steps := 25, 200
+	if testing.Short() {
+		seeds, steps = 5, 50
+	}
+	for _, level := range modelLevels {
+		t.Run(string(level.raidType), func(t *testing.T) {
+			for seed := range seeds {
+				rng := rand.New(rand.NewSource(int64(seed)))
+				ops := make(program, 4*steps)
+				rng.Read(ops)
+				stripeSz := 1 + seed%8
+				t.Run(fmt.Sprintf("seed%d_stripe%d", seed, stripeSz), func(t *testing.T) {
+					checkModel(t, level.raidType, level.diskCount, stripeSz, ops)
+				})
+			}
+		})
+	}
+}
+
+// FuzzModel runs fuzzed programs against every level, e.g.
+//
+//	go test ./internal/raid -run '^$' -fuzz FuzzModel -fuzztime 30s
+func FuzzModel(f *testing.F) {
+	f.Add(uint8(0), uint8(4), []byte{opWrite, 0, 20, opRead, 0, 20})
+	f.Add(uint8(3), uint8(1), []byte{opWrite, 7, 63, opFail, 2, opWrite, 3, 9, opRead, 5, 40, opRebuild, 2, opRead, 0, 63})
+	f.Add(uint8(4), uint8(3), []byte{opWrite, 0, 63, opFail, 0, opFail, 4, opWrite, 100, 30, opRebuild, 4, opRebuild, 0})
+	f.Add(uint8(2), uint8(2), []byte{opFail, 1, opWrite, 10, 40, opFail, 2, opRead, 12, 8, opRebuild, 1})
+	f.Fuzz(func(t *testing.T, level, stripeSz uint8, ops []byte) {
+		l := modelLevels[int(level)%len(modelLevels)]
+		checkModel(t, l.raidType, l.diskCount, 1+int(stripeSz)%8, ops)
+	})
+}
@@ -0,0 +1,344 @@
+package raid
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultParityGroups is the number of sub-arrays of RAID50 and RAID60 arrays that do not select one.
+const DefaultParityGroups = 2
+
+// parityGroups stripes the logical address space across several parity sub-arrays (RAID50, RAID60).
+// Consecutive full stripes of the sub-arrays go to consecutive groups, so logical stripe s lives in
+// group s % len(groups) as that group's stripe s / len(groups). Every group tolerates as many
+// failures as it has parity shards, independently of the others: the array survives one failure
+// per RAID5 group, but not two in the same group.
+type parityGroups struct {
+	stripes  stripeLocks // per-stripe locks, indexed by logical stripe, serializing overlapping I/O
+	raidType RaidType
+	name     string
+	disks    []*Disk        // every member disk; group g holds disks[g*groupSize : (g+1)*groupSize]
+	groups   []*parityArray // the sub-arrays, each locking its own stripes
+	stripeSz int
+	highWaterMark
+	controllerLog
+}
+
+// newParityGroups splits disks into groupCount equal groups (DefaultParityGroups when 0), each a
+// parity array with numParityShards parity shards placed by placement and named by layout.
+func newParityGroups(raidType RaidType, name string, disks []*Disk, stripeSz, groupCount, numParityShards int, placement shardPlacement, layout ParityLayout) (*parityGroups, error) {
+	if groupCount == 0 {
+		groupCount = DefaultParityGroups
+	}
+	if groupCount < 2 {
+		return nil, fmt.Errorf("%s requires at least 2 parity groups. Provided: %d", name, groupCount)
+	}
+	if len(disks)%groupCount != 0 {
+		return nil, fmt.Errorf("%s requires a disk count divisible by its %d parity groups. Provided: %d", name, groupCount, len(disks))
+	}
+
+	groupSize := len(disks) / groupCount
+	n := &parityGroups{raidType: raidType, name: name, disks: disks, stripeSz: stripeSz}
+	for g := 0; g < groupCount; g++ {
+		group, err := newParityArray(raidType, fmt.Sprintf("%s group %d", name, g), disks[g*groupSize:(g+1)*groupSize], stripeSz, numParityShards, placement)
+		if err != nil {
+			return nil, err
+		}
+		group.layout = layout
+		n.groups = append(n.groups, group)
+	}
+	n.restoreHighWaterMark(n.allocated())
+	return n, nil
+}
+
+// groupStripeSz returns the logical bytes of one full stripe of a group, the unit striped across groups.
+func (n *parityGroups) groupStripeSz() int {
+	return n.groups[0].bytesPerFullStripe()
+}
+
+func (n *parityGroups) groupSize() int {
+	return len(n.disks) / len(n.groups)
+}
+
+// locate returns the group holding a segment and the segment's logical offset inside that group.
+func (n *parityGroups) locate(segment chunkSegment) (int, int) {
+	return segment.stripeIdx % len(n.groups), segment.stripeIdx/len(n.groups)*n.groupStripeSz() + segment.offsetInChunk
+}
+
+// locateDisk maps a member disk index to its group and its index inside the group.
+func (n *parityGroups) locateDisk(index int) (int, int, error) {
+	if index < 0 || index >= len(n.disks) {
+		return 0, 0, fmt.Errorf("disk index %d out of bounds for %d disks", index, len(n.disks))
+	}
+	return index / n.groupSize(), index % n.groupSize(), nil
+}
+
+// Write writes data starting at the logical byte offset. The stripes of different groups are
+// written concurrently, each group computing its own parity.
+func (n *parityGroups) Write(data []byte, offset int) error {
+	if offset < 0 {
+		return fmt.Errorf("write offset must be non-negative")
+	}
+	if len(data) == 0 {
+		return nil // No data to write
+	}
+	if err := checkSpace(n.name, n.disks, n.capacity(), offset, len(data)); err != nil {
+		return err
+	}
+
+	segments := splitIntoChunks(offset, len(data), n.groupStripeSz())
+	for _, segment := range segments {
+		g, _ := n.locate(segment)
+		group := n.groups[g]
+		if unavailable := countUnavailable(group.disks); unavailable > group.encoderExtension.ParityShards() {
+			return fmt.Errorf("%s: cannot write stripe %d, %d disks of group %d unavailable", n.name, segment.stripeIdx, unavailable, g)
+		}
+	}
+
+	unlock := n.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, false)
+	defer unlock()
+
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		g, groupOffset := n.locate(segment)
+		return n.groups[g].Write(data[segment.dataOffset:segment.dataOffset+segment.length], groupOffset)
+	})
+	if err != nil {
+		return err
+	}
+	n.advance(offset + len(data))
+	return nil
+}
+
+// Discard discards the logical range [offset, offset+length) in every group it spans, each
+// releasing the stripes it covers whole.
+func (n *parityGroups) Discard(offset, length int) error {
+	end, err := discardBounds(offset, length, n.HighWaterMark())
+	if err != nil || end <= offset {
+		return err
+	}
+
+	segments := splitIntoChunks(offset, end-offset, n.groupStripeSz())
+	unlock := n.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, false)
+	defer unlock()
+
+	return forEachParallel(len(segments), func(i int) error {
+		g, groupOffset := n.locate(segments[i])
+		return n.groups[g].Discard(groupOffset, segments[i].length)
+	})
+}
+
+// Read reads data from the array. Each group reconstructs the shards it lost on its own.
+func (n *parityGroups) Read(start, length int) ([]byte, error) {
+	if start < 0 || length < 0 {
+		return nil, fmt.Errorf("read start and length must be non-negative")
+	}
+
+	maxWrittenLogicalOffset := n.HighWaterMark()
+	if start >= maxWrittenLogicalOffset {
+		if start > maxWrittenLogicalOffset {
+			return nil, fmt.Errorf("read start offset %d is beyond total data stored %d", start, maxWrittenLogicalOffset)
+		}
+		return []byte{}, nil
+	}
+	if start+length > maxWrittenLogicalOffset {
+		n.log().Warnf("[%s] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
+			n.name, length, start, maxWrittenLogicalOffset, maxWrittenLogicalOffset-start)
+		length = maxWrittenLogicalOffset - start
+	}
+	if length <= 0 {
+		return []byte{}, nil
+	}
+
+	segments := splitIntoChunks(start, length, n.groupStripeSz())
+	unlock := n.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, true)
+	defer unlock()
+
+	result := make([]byte, length)
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		g, groupOffset := n.locate(segment)
+		// A group never written this far holds a hole, which reads back as zeros
+		available := min(segment.length, n.groups[g].HighWaterMark()-groupOffset)
+		if available <= 0 {
+			return nil
+		}
+		output, err := n.groups[g].Read(groupOffset, available)
+		if err != nil {
+			return fmt.Errorf("%s: failed to read stripe %d from group %d: %w", n.name, segment.stripeIdx, g, err)
+		}
+		copy(result[segment.dataOffset:], output)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ClearDisk simulates a failure of the disk at index.
+func (n *parityGroups) ClearDisk(index int) error {
+	g, local, err := n.locateDisk(index)
+	if err != nil {
+		return err
+	}
+	return n.groups[g].ClearDisk(local)
+}
+
+func (n *parityGroups) removeDisk(index int) error {
+	g, local, err := n.locateDisk(index)
+	if err != nil {
+		return err
+	}
+	return n.groups[g].removeDisk(local)
+}
+
+// setLogger has every group log through logger too.
+func (n *parityGroups) setLogger(logger logrus.FieldLogger) {
+	n.controllerLog.setLogger(logger)
+	for _, group := range n.groups {
+		group.setLogger(logger)
+	}
+}
+
+// ReplaceDisk installs a blank disk at index, to be rebuilt from the other disks of its group.
+func (n *parityGroups) ReplaceDisk(index int) error {
+	g, local, err := n.locateDisk(index)
+	if err != nil {
+		return err
+	}
+	return n.groups[g].ReplaceDisk(local)
+}
+
+// Rebuild regenerates a replaced disk from the other disks of its group; the other groups are not read.
+func (n *parityGroups) Rebuild(index int, progress ProgressFunc) error {
+	g, local, err := n.locateDisk(index)
+	if err != nil {
+		return err
+	}
+	return n.groups[g].Rebuild(local, progress)
+}
+
+// Scrub scrubs every group in turn. Stripes and disks in the report are those of the whole array.
+func (n *parityGroups) Scrub(progress ProgressFunc) (ScrubReport, error) {
+	report := ScrubReport{}
+	groupCount := len(n.groups)
+	for g, group := range n.groups {
+		groupReport, err := group.Scrub(nil)
+		if err != nil {
+			return report, fmt.Errorf("%s: failed to scrub group %d: %w", n.name, g, err)
+		}
+		report.Stripes += groupReport.Stripes
+		for _, repair := range groupReport.Repaired {
+			report.Repaired = append(report.Repaired, ChunkRepair{Stripe: repair.Stripe*groupCount + g, Disk: g*n.groupSize() + repair.Disk})
+		}
+		for _, stripe := range groupReport.Unrecoverable {
+			report.Unrecoverable = append(report.Unrecoverable, stripe*groupCount+g)
+		}
+		if progress != nil {
+			progress(g+1, groupCount)
+		}
+	}
+	slices.Sort(report.Unrecoverable)
+	return report, nil
+}
+
+// Status reports the array state. The array fails as soon as any group does; its fault tolerance
+// is that of its weakest group, the failures it survives whichever disks they hit.
+func (n *parityGroups) Status() ArrayStatus {
+	state, tolerance := ArrayStateOptimal, -1
+	for _, group := range n.groups {
+		groupStatus := group.Status()
+		switch {
+		case groupStatus.State == ArrayStateFailed:
+			state = ArrayStateFailed
+		case groupStatus.State == ArrayStateDegraded && state == ArrayStateOptimal:
+			state = ArrayStateDegraded
+		}
+		if tolerance < 0 || groupStatus.FaultTolerance < tolerance {
+			tolerance = groupStatus.FaultTolerance
+		}
+	}
+	if state == ArrayStateFailed {
+		tolerance = 0
+	}
+	return ArrayStatus{
+		Type:           n.raidType,
+		State:          state,
+		StripeSz:       n.stripeSz,
+		Layout:         n.groups[0].layout,
+		Groups:         len(n.groups),
+		FaultTolerance: tolerance,
+		Capacity:       n.capacity(),
+		HighWaterMark:  n.HighWaterMark(),
+		Disks:          diskStatuses(n.disks),
+	}
+}
+
+// ParityDisks returns the disks holding the parity shards of the logical stripe, which is a stripe
+// of a single group.
+func (n *parityGroups) ParityDisks(stripe int) []int {
+	g := stripe % len(n.groups)
+	disks := n.groups[g].ParityDisks(stripe / len(n.groups))
+	for i := range disks {
+		disks[i] += g * n.groupSize()
+	}
+	return disks
+}
+
+// Capacity returns the usable logical bytes of all groups together.
+func (n *parityGroups) Capacity() int {
+	return n.capacity()
+}
+
+func (n *parityGroups) capacity() int {
+	if chunkLimit := diskChunkLimit(n.disks); chunkLimit > 0 {
+		return chunkLimit * n.groupStripeSz() * len(n.groups)
+	}
+	return n.allocated()
+}
+
+// allocated returns the logical bytes covered up to the furthest stripe allocated in any group.
+func (n *parityGroups) allocated() int {
+	stripes := 0
+	for g, group := range n.groups {
+		if count := group.stripeCount(); count > 0 {
+			stripes = max(stripes, (count-1)*len(n.groups)+g+1)
+		}
+	}
+	return stripes * n.groupStripeSz()
+}
+
+// parityGroupsSimulationFlow writes input to controller, clears clearTargets and reads the input back.
+// It backs the RAID50 and RAID60 simulation flows.
+func parityGroupsSimulationFlow(name string, controller *parityGroups, input string, clearTargets []int) {
+	if err := controller.Write([]byte(input), initialOffset); err != nil {
+		logrus.Errorf("[%s] Write failed: %v", name, err)
+		return // Exit if write fails
+	}
+	logrus.Infof("[%s] Write done across %d groups: %s", name, len(controller.groups), input)
+
+	output, err := controller.Read(0, len(input))
+	if err != nil {
+		logrus.Errorf("[%s] Read failed: %v", name, err)
+	} else {
+		logrus.Infof("[%s] Recovered string before clear: %s", name, string(output))
+	}
+
+	for _, target := range clearTargets {
+		if err := controller.ClearDisk(target); err != nil {
+			logrus.Errorf("[%s] ClearDisk failed for disk %d: %v", name, target, err)
+			return
+		}
+		logrus.Infof("[%s] Disk %d cleared", name, target)
+	}
+
+	output, err = controller.Read(0, len(input))
+	if err != nil {
+		logrus.Errorf("[%s] Read failed after clear: %v", name, err)
+	} else {
+		logrus.Infof("[%s] Recovered string after clear: %s", name, string(output))
+	}
+}
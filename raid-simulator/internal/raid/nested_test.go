@@ -0,0 +1,144 @@
+package raid
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParityGroups_FaultTolerancePerGroup(t *testing.T) {
+	cases := []struct {
+		raidType  RaidType
+		diskCount int
+		survived  []int // one more failure than the array-wide fault tolerance, spread over the groups
+		fatal     int   // a further failure in the first group
+	}{
+		{RaidTypeRaid50, 6, []int{0, 3}, 1},
+		{RaidTypeRaid60, 8, []int{0, 1, 4, 5}, 2},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := NewController(tc.raidType, tc.diskCount, 2)
+			assert.NoError(t, err)
+			status := controller.Status()
+			assert.Equal(t, DefaultParityGroups, status.Groups)
+			assert.Equal(t, len(tc.survived)/2, status.FaultTolerance, "tolerance is that of a single group")
+
+			data := bytes.Repeat([]byte("NestedParity"), 8)
+			assert.NoError(t, controller.Write(data, 0))
+
+			// Every group loses as many disks as it has parity, and the data survives
+			for _, failed := range tc.survived {
+				assert.NoError(t, controller.ClearDisk(failed))
+			}
+			status = controller.Status()
+			assert.Equal(t, ArrayStateDegraded, status.State)
+			assert.Zero(t, status.FaultTolerance)
+			output, err := controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, output)
+
+			// One more failure in the same group is fatal, even though the other group is as degraded
+			assert.NoError(t, controller.ClearDisk(tc.fatal))
+			assert.Equal(t, ArrayStateFailed, controller.Status().State)
+			_, err = controller.Read(0, len(data))
+			assert.Error(t, err)
+			assert.Error(t, controller.Write([]byte("x"), 0))
+		})
+	}
+}
+
+func TestParityGroups_StripesAcrossGroups(t *testing.T) {
+	controller, err := NewRAID50Controller(9, 3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, controller.Status().Groups)
+
+	// A group stripe holds 2 data chunks of 2 bytes; the first one lands entirely in group 0
+	assert.NoError(t, controller.Write([]byte("ABCD"), 0))
+	for _, disk := range controller.Status().Disks {
+		expected := 0
+		if disk.ID < 3 {
+			expected = 1
+		}
+		assert.Equal(t, expected, disk.Chunks, "disk %d", disk.ID)
+	}
+
+	// The fourth group stripe wraps around to group 0 as its second stripe
+	assert.NoError(t, controller.Write([]byte("MNOP"), 12))
+	output, err := controller.Read(0, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, append(append([]byte("ABCD"), make([]byte, 8)...), "MNOP"...), output)
+	assert.Equal(t, 2, controller.Status().Disks[0].Chunks)
+	assert.Equal(t, 0, controller.Status().Disks[3].Chunks)
+}
+
+func TestParityGroups_RebuildAndScrub(t *testing.T) {
+	controller, err := NewRAID60Controller(8, 2, 2)
+	assert.NoError(t, err)
+	data := bytes.Repeat([]byte("0123456789"), 5)
+	assert.NoError(t, controller.Write(data, 0))
+
+	for _, failed := range []int{1, 6} {
+		assert.NoError(t, controller.ClearDisk(failed))
+		assert.NoError(t, controller.ReplaceDisk(failed))
+		assert.NoError(t, controller.Rebuild(failed, nil))
+	}
+	assert.Equal(t, ArrayStateOptimal, controller.Status().State)
+
+	// Stripe 1 of group 1 (disks 4-7) is logical stripe 3, its second disk is disk 5 of the array
+	assert.NoError(t, controller.groups[1].disks[1].CorruptChunk(1, 0, 2))
+	report, err := controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChunkRepair{{Stripe: 3, Disk: 5}}, report.Repaired)
+	assert.Empty(t, report.Unrecoverable)
+
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestParityGroups_InvalidConfigurations(t *testing.T) {
+	_, err := NewRAID50Controller(7, 2, 2)
+	assert.Error(t, err, "disks not divisible into groups")
+	_, err = NewRAID50Controller(4, 2, 2)
+	assert.Error(t, err, "RAID5 groups of 2 disks")
+	_, err = NewRAID60Controller(6, 2, 2)
+	assert.Error(t, err, "RAID6 groups of 3 disks")
+	_, err = NewRAID50Controller(6, 1, 2)
+	assert.Error(t, err, "a single group is plain RAID5")
+
+	_, err = NewControllerWithOptions(RaidTypeRaid5, newDisks(8, 2), 2, ControllerOptions{Groups: 2})
+	assert.Error(t, err)
+	_, err = NewControllerWithOptions(RaidTypeRaid60, newDisks(8, 2), 2, ControllerOptions{Layout: LayoutLeftSymmetric})
+	assert.Error(t, err)
+
+	controller, err := NewControllerWithOptions(RaidTypeRaid50, newDisks(8, 2), 2, ControllerOptions{Groups: 2, Layout: LayoutLeftSymmetric})
+	assert.NoError(t, err)
+	assert.Equal(t, LayoutLeftSymmetric, controller.Status().Layout)
+}
+
+func TestArray_PersistsParityGroups(t *testing.T) {
+	dir := t.TempDir()
+	array, err := CreateArray(dir, RaidTypeRaid50, 9, 2, 0, ControllerOptions{Groups: 3})
+	assert.NoError(t, err)
+	data := []byte("ThreeGroupsOfThreeDisks")
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, 3, array.Status().Groups)
+
+	assert.NoError(t, array.StartReshape(ReshapeTarget{Type: RaidTypeRaid60, DiskCount: 8, StripeSz: 2}))
+	done, err := array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.Equal(t, RaidTypeRaid60, array.Status().Type)
+	assert.Equal(t, DefaultParityGroups, array.Status().Groups)
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
@@ -0,0 +1,614 @@
+package raid
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Anthya1104/raid-simulator/internal/rsutil"
+	"github.com/klauspost/reedsolomon"
+)
+
+// shardPlacement maps a stripe to the physical disk holding each Reed-Solomon shard.
+// The returned slice is in the order the reedsolomon library expects: [Data0, ..., DataN-1, Parity0, ...].
+type shardPlacement func(stripeIdx, numDisks, numParityShards int) []int
+
+// parityArray holds the stripe machinery shared by the Reed-Solomon backed levels (RAID4, RAID5,
+// RAID6 and the generic erasure codes). Levels differ only in the number of parity shards and in
+// where each shard is placed.
+type parityArray struct {
+	mu       sync.RWMutex // held shared by I/O and exclusively by disk state changes, rebuild and scrub steps
+	stripes  stripeLocks  // per-stripe locks serializing overlapping I/O
+	raidType RaidType
+	name     string // level name used in logs and errors, e.g. "RAID5"
+	disks    []*Disk
+	stripeSz int
+
+	minDataShards    int                    // fewest data shards the level accepts
+	encoder          reedsolomon.Encoder    // Reed-Solomon encoder for Encode/Reconstruct
+	encoderExtension reedsolomon.Extensions // Reed-Solomon extension for DataShards/ParityShards
+	placement        shardPlacement
+	layout           ParityLayout // named placement, reported in the status; empty for levels with a single placement
+
+	journal    Journal      // write-ahead log of stripe writes, nil when writes are not journaled
+	crashAfter atomic.Int64 // shards the next stripe write stores before a simulated crash, -1 when disarmed
+	highWaterMark
+	controllerLog
+}
+
+func newParityArray(raidType RaidType, name string, disks []*Disk, stripeSz, numParityShards int, placement shardPlacement) (*parityArray, error) {
+	return newParityArrayWithMinData(raidType, name, disks, stripeSz, 2, numParityShards, placement)
+}
+
+// newParityArrayWithMinData is newParityArray for levels accepting fewer (or more) than 2 data shards.
+func newParityArrayWithMinData(raidType RaidType, name string, disks []*Disk, stripeSz, minDataShards, numParityShards int, placement shardPlacement) (*parityArray, error) {
+	diskCount := len(disks)
+	minDisks := numParityShards + minDataShards
+	if diskCount < minDisks {
+		return nil, fmt.Errorf("%s requires at least %d disks (%d data + %d parity). Provided: %d", name, minDisks, minDataShards, numParityShards, diskCount)
+	}
+	if stripeSz <= 0 {
+		return nil, fmt.Errorf("stripe size (chunk unit size) must be greater than 0. Provided: %d", stripeSz)
+	}
+
+	// init reedsolomon encoder
+	enc, err := reedsolomon.New(diskCount-numParityShards, numParityShards)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create reedsolomon encoder for %s: %w", name, err)
+	}
+
+	// init reedsolomon extension
+	encEx, ok := enc.(reedsolomon.Extensions)
+	if !ok {
+		return nil, fmt.Errorf("reedsolomon encoder does not implement Extensions interface")
+	}
+
+	p := &parityArray{
+		raidType:         raidType,
+		name:             name,
+		disks:            disks,
+		stripeSz:         stripeSz,
+		minDataShards:    minDataShards,
+		encoder:          enc,
+		encoderExtension: encEx,
+		placement:        placement,
+	}
+	p.crashAfter.Store(-1)
+	p.restoreHighWaterMark(p.stripeCount() * p.bytesPerFullStripe())
+	return p, nil
+}
+
+func (p *parityArray) validate() error {
+	minDisks := p.encoderExtension.ParityShards() + p.minDataShards
+	if len(p.disks) < minDisks {
+		return fmt.Errorf("%s requires at least %d disks, got %d", p.name, minDisks, len(p.disks))
+	}
+	if p.stripeSz <= 0 {
+		return fmt.Errorf("stripe size (chunk unit size) must be greater than 0")
+	}
+	return nil
+}
+
+func (p *parityArray) bytesPerFullStripe() int {
+	return p.stripeSz * p.encoderExtension.DataShards()
+}
+
+// Write writes data to the array starting at the logical byte offset.
+// Stripes fully covered by data are encoded directly; stripes touched only partially go through Read-Modify-Write.
+// Only the stripes being written are locked, so writes to other stripes proceed in parallel.
+func (p *parityArray) Write(data []byte, offset int) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if err := p.validate(); err != nil {
+		return err
+	}
+	if offset < 0 {
+		return fmt.Errorf("write offset must be non-negative")
+	}
+	if len(data) == 0 {
+		return nil // No data to write
+	}
+	if unavailable := countUnavailable(p.disks); unavailable > p.encoderExtension.ParityShards() {
+		return fmt.Errorf("%s: cannot write, %d disks unavailable but only %d parity shards", p.name, unavailable, p.encoderExtension.ParityShards())
+	}
+	if err := checkSpace(p.name, p.disks, p.capacity(), offset, len(data)); err != nil {
+		return err
+	}
+
+	bytesPerFullStripe := p.bytesPerFullStripe()
+	unlock := p.stripes.lockRange(offset/bytesPerFullStripe, (offset+len(data)-1)/bytesPerFullStripe, false)
+	defer unlock()
+
+	currentDataOffsetInInput := 0
+
+	for currentDataOffsetInInput < len(data) {
+		logicalOffset := offset + currentDataOffsetInInput
+		currentAbsoluteStripeIdx := logicalOffset / bytesPerFullStripe
+		offsetInStripe := logicalOffset % bytesPerFullStripe
+
+		segmentLen := min(bytesPerFullStripe-offsetInStripe, len(data)-currentDataOffsetInInput)
+		segment := data[currentDataOffsetInInput : currentDataOffsetInInput+segmentLen]
+
+		var err error
+		if segmentLen == bytesPerFullStripe {
+			err = p.writeFullStripe(currentAbsoluteStripeIdx, segment)
+		} else {
+			err = p.handlePartialWrite(currentAbsoluteStripeIdx, offsetInStripe, segment)
+		}
+		if err != nil {
+			return err
+		}
+
+		currentDataOffsetInInput += segmentLen
+	}
+	p.advance(offset + len(data))
+	return nil
+}
+
+// writeFullStripe encodes a full stripe of logical data and writes every shard to its disk.
+func (p *parityArray) writeFullStripe(stripeIdx int, stripeData []byte) error {
+	numDataShards := p.encoderExtension.DataShards()
+	numParityShards := p.encoderExtension.ParityShards()
+
+	encodedShards, err := rsutil.EncodeStripeShards(stripeData, p.stripeSz, p.encoder, numDataShards, numParityShards)
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode shards for stripe %d: %w", p.name, stripeIdx, err)
+	}
+	if err := p.storeShards(stripeIdx, encodedShards); err != nil {
+		return err
+	}
+
+	p.log().Debugf("[%s] stripe %d (absolute) - parity: %v", p.name, stripeIdx, encodedShards[numDataShards:])
+	return nil
+}
+
+// handlePartialWrite performs a Read-Modify-Write operation for data that does not cover a full stripe.
+func (p *parityArray) handlePartialWrite(stripeIdx, offsetInStripe int, segment []byte) error {
+	p.log().Debugf("[%s] Handling partial write of %d bytes using Read-Modify-Write for absolute stripe index %d.", p.name, len(segment), stripeIdx)
+
+	numDataShards := p.encoderExtension.DataShards()
+
+	rsShards, err := p.loadStripe(stripeIdx)
+	if err != nil {
+		return fmt.Errorf("%s: failed to reconstruct shards in stripe %d for RMW: %w", p.name, stripeIdx, err)
+	}
+
+	fullLogicalStripeBuffer := make([]byte, p.bytesPerFullStripe())
+	for i := 0; i < numDataShards; i++ {
+		copy(fullLogicalStripeBuffer[i*p.stripeSz:(i+1)*p.stripeSz], rsShards[i])
+	}
+	copy(fullLogicalStripeBuffer[offsetInStripe:], segment)
+
+	return p.writeFullStripe(stripeIdx, fullLogicalStripeBuffer)
+}
+
+// loadStripe collects the shards of a stripe in logical order and reconstructs any missing ones.
+// A stripe that no disk has reached yet was never written and reads back as zeros.
+func (p *parityArray) loadStripe(stripeIdx int) ([][]byte, error) {
+	numDataShards := p.encoderExtension.DataShards()
+	numParityShards := p.encoderExtension.ParityShards()
+
+	rsShards := make([][]byte, numDataShards+numParityShards)
+	if stripeIdx >= p.stripeCount() {
+		for i := range rsShards {
+			rsShards[i] = make([]byte, p.stripeSz)
+		}
+		return rsShards, nil
+	}
+
+	// Every disk is read concurrently; a shard that cannot be read is left nil
+	placement := p.placement(stripeIdx, len(p.disks), numParityShards)
+	_ = forEachParallel(len(placement), func(shardIdx int) error {
+		d := placement[shardIdx]
+		disk := p.disks[d]
+		if !disk.canServe(stripeIdx) {
+			p.log().Debugf("Disk %d considered failed for stripe %d.", d, stripeIdx)
+			return nil // mark as lost (reed solomon defined as nil)
+		}
+		chunk, err := disk.ReadChunk(stripeIdx)
+		if err != nil {
+			p.log().Debugf("Disk %d could not serve stripe %d: %v", d, stripeIdx, err)
+			return nil
+		}
+		rsShards[shardIdx] = chunk
+		return nil
+	})
+
+	if err := rsutil.ReconstructStripeShards(rsShards, p.encoder, numParityShards); err != nil {
+		return nil, err
+	}
+	return rsShards, nil
+}
+
+// storeShards writes logically ordered shards to their physical disks, skipping failed disks.
+// With a journal attached, the stripe is journaled before the first shard is written and
+// committed after the last one.
+func (p *parityArray) storeShards(stripeIdx int, shards [][]byte) error {
+	if p.journal != nil {
+		if err := p.journal.Begin(stripeIdx, shards); err != nil {
+			return fmt.Errorf("%s: failed to journal stripe %d: %w", p.name, stripeIdx, err)
+		}
+	}
+	if err := p.writeShards(stripeIdx, shards); err != nil {
+		return err
+	}
+	if p.journal != nil {
+		if err := p.journal.Commit(stripeIdx); err != nil {
+			return fmt.Errorf("%s: failed to commit stripe %d to the journal: %w", p.name, stripeIdx, err)
+		}
+	}
+	return nil
+}
+
+// writeShards writes the shards to their disks concurrently. With a crash point armed, only the
+// first shards up to the crash point are written, one disk after another, before the simulated crash.
+func (p *parityArray) writeShards(stripeIdx int, shards [][]byte) error {
+	var shardIdxs, targets []int
+	for shardIdx, d := range p.placement(stripeIdx, len(p.disks), p.encoderExtension.ParityShards()) {
+		if p.disks[d].State.isFailed() {
+			continue
+		}
+		shardIdxs = append(shardIdxs, shardIdx)
+		targets = append(targets, d)
+	}
+	writeShard := func(i int) error {
+		if err := p.disks[targets[i]].WriteChunk(stripeIdx, shards[shardIdxs[i]]); err != nil {
+			return fmt.Errorf("%s: failed to write shard %d of stripe %d to disk %d: %w", p.name, shardIdxs[i], stripeIdx, targets[i], err)
+		}
+		return nil
+	}
+
+	crashAfter := p.crashAfter.Load()
+	if crashAfter < 0 || crashAfter > int64(len(targets)) || !p.crashAfter.CompareAndSwap(crashAfter, -1) {
+		return forEachParallel(len(targets), writeShard)
+	}
+	written := int(crashAfter)
+	for i := 0; i < written; i++ {
+		if err := writeShard(i); err != nil {
+			return err
+		}
+	}
+	if written == len(targets) {
+		return fmt.Errorf("%s: %w after writing all %d shards of stripe %d", p.name, ErrSimulatedCrash, written, stripeIdx)
+	}
+	return fmt.Errorf("%s: %w after writing %d shards of stripe %d", p.name, ErrSimulatedCrash, written, stripeIdx)
+}
+
+// AttachJournal journals every later stripe write in journal. Writes the journal holds that
+// never completed are replayed first, restoring parity consistency after a crash.
+func (p *parityArray) AttachJournal(journal Journal) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pending, err := journal.Pending()
+	if err != nil {
+		return 0, fmt.Errorf("%s: failed to read the journal: %w", p.name, err)
+	}
+	numShards := len(p.disks)
+	for _, entry := range pending {
+		if len(entry.Shards) != numShards {
+			return 0, fmt.Errorf("%s: journaled stripe %d has %d shards, expected %d", p.name, entry.Stripe, len(entry.Shards), numShards)
+		}
+		if err := p.writeShards(entry.Stripe, entry.Shards); err != nil {
+			return 0, fmt.Errorf("%s: failed to replay stripe %d: %w", p.name, entry.Stripe, err)
+		}
+		if err := journal.Commit(entry.Stripe); err != nil {
+			return 0, fmt.Errorf("%s: failed to commit replayed stripe %d: %w", p.name, entry.Stripe, err)
+		}
+		p.log().Infof("[%s] Replayed interrupted write of stripe %d from the journal.", p.name, entry.Stripe)
+	}
+	p.journal = journal
+	return len(pending), nil
+}
+
+// CrashAfter arms a simulated crash: the next stripe write stops once n shards have reached
+// their disks and returns ErrSimulatedCrash, leaving the stripe half written.
+func (p *parityArray) CrashAfter(n int) {
+	p.crashAfter.Store(int64(n))
+}
+
+// Discard releases every shard, parity included, of the stripes covered whole by the logical range
+// [offset, offset+length): zero data has zero parity, so the released stripes stay consistent.
+// Stripes covered partly are zeroed by a write that updates their parity.
+func (p *parityArray) Discard(offset, length int) error {
+	end, err := discardBounds(offset, length, p.HighWaterMark())
+	if err != nil || end <= offset {
+		return err
+	}
+	bytesPerFullStripe := p.bytesPerFullStripe()
+	first, last, err := zeroPartialUnits(p.Write, offset, end, bytesPerFullStripe)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	head, tail := offset/bytesPerFullStripe, (end-1)/bytesPerFullStripe
+	unlock := p.stripes.lockRange(head, tail, false)
+	defer unlock()
+
+	// Partly discarded stripes are released too once the zeros leave no data in them, so discarding
+	// a stripe piece by piece (as a parent array does, chunk by chunk) frees it in the end
+	if first > head && p.stripeIsZero(head) {
+		first = head
+	}
+	if last < tail && p.stripeIsZero(tail) {
+		last = tail
+	}
+	for stripeIdx := first; stripeIdx <= last; stripeIdx++ {
+		if err := p.discardStripe(stripeIdx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stripeIsZero reports whether every data shard of a stripe reads as zeros.
+func (p *parityArray) stripeIsZero(stripeIdx int) bool {
+	shards, err := p.loadStripe(stripeIdx)
+	if err != nil {
+		return false
+	}
+	for _, shard := range shards[:p.encoderExtension.DataShards()] {
+		if slices.ContainsFunc(shard, func(b byte) bool { return b != 0 }) {
+			return false
+		}
+	}
+	return true
+}
+
+// discardStripe releases every shard of a stripe on the disks that have not failed. With a journal
+// attached, the stripe is journaled as zeros first, so a crash halfway cannot leave stale parity behind.
+func (p *parityArray) discardStripe(stripeIdx int) error {
+	numShards := p.encoderExtension.DataShards() + p.encoderExtension.ParityShards()
+	if p.journal != nil {
+		zeros := make([][]byte, numShards)
+		for i := range zeros {
+			zeros[i] = make([]byte, p.stripeSz)
+		}
+		if err := p.journal.Begin(stripeIdx, zeros); err != nil {
+			return fmt.Errorf("%s: failed to journal stripe %d: %w", p.name, stripeIdx, err)
+		}
+	}
+	for _, d := range p.placement(stripeIdx, len(p.disks), p.encoderExtension.ParityShards()) {
+		if p.disks[d].State.isFailed() {
+			continue
+		}
+		if err := p.disks[d].Discard(stripeIdx); err != nil {
+			return fmt.Errorf("%s: failed to discard stripe %d on disk %d: %w", p.name, stripeIdx, d, err)
+		}
+	}
+	if p.journal != nil {
+		if err := p.journal.Commit(stripeIdx); err != nil {
+			return fmt.Errorf("%s: failed to commit stripe %d to the journal: %w", p.name, stripeIdx, err)
+		}
+	}
+	return nil
+}
+
+// Read reads data from the array, reconstructing shards lost to failed disks from parity.
+func (p *parityArray) Read(start, length int) ([]byte, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if start < 0 || length < 0 {
+		return nil, fmt.Errorf("read start and length must be non-negative")
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+
+	numDataShards := p.encoderExtension.DataShards()
+	bytesPerFullStripe := p.bytesPerFullStripe()
+
+	totalDataStored := p.HighWaterMark()
+	if totalDataStored == 0 {
+		return []byte{}, fmt.Errorf("no data has been written to the RAID array yet to read from")
+	}
+
+	// Adjust read range to not exceed available data
+	if start >= totalDataStored {
+		return nil, fmt.Errorf("read start offset %d is beyond total data stored %d", start, totalDataStored)
+	}
+	if start+length > totalDataStored {
+		p.log().Warnf("Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
+			length, start, totalDataStored, totalDataStored-start)
+		length = totalDataStored - start
+	}
+	if length <= 0 { // After truncation, length might become 0 or negative
+		return []byte{}, nil
+	}
+
+	// Determine the first and last logical stripe indices involved in the read
+	startStripeIdx := start / bytesPerFullStripe
+	endStripeIdx := (start + length - 1) / bytesPerFullStripe
+	unlock := p.stripes.lockRange(startStripeIdx, endStripeIdx, true)
+	defer unlock()
+
+	result := make([]byte, 0, length) // Pre-allocate capacity for the result
+
+	for currentStripeIdx := startStripeIdx; currentStripeIdx <= endStripeIdx; currentStripeIdx++ {
+		rsShards, err := p.loadStripe(currentStripeIdx)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to reconstruct data for stripe %d: %w", p.name, currentStripeIdx, err)
+		}
+
+		currentStripeLogicalData := make([]byte, 0, bytesPerFullStripe)
+		for i := 0; i < numDataShards; i++ {
+			if rsShards[i] == nil || len(rsShards[i]) != p.stripeSz {
+				return nil, fmt.Errorf("%s internal error: logical data shard %d for stripe %d is nil or malformed after reconstruction", p.name, i, currentStripeIdx)
+			}
+			currentStripeLogicalData = append(currentStripeLogicalData, rsShards[i]...)
+		}
+
+		stripeStart := currentStripeIdx * bytesPerFullStripe
+		startCopyOffset := max(start-stripeStart, 0)
+		endCopyOffset := min(start+length-stripeStart, bytesPerFullStripe)
+		result = append(result, currentStripeLogicalData[startCopyOffset:endCopyOffset]...)
+	}
+
+	return result, nil
+}
+
+// ClearDisk simulates a disk failure by clearing the data on the specified disk.
+func (p *parityArray) ClearDisk(index int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if index < 0 || index >= len(p.disks) {
+		return fmt.Errorf("disk index %d out of bounds for %d disks", index, len(p.disks))
+	}
+
+	if err := p.disks[index].reset(DiskStateFailed); err != nil { // Clear the data to simulate failure
+		return err
+	}
+	p.log().Infof("[%s] Disk %d has been cleared (simulating failure).", p.name, p.disks[index].ID)
+	return nil
+}
+
+func (p *parityArray) removeDisk(index int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if index < 0 || index >= len(p.disks) {
+		return fmt.Errorf("disk index %d out of bounds for %d disks", index, len(p.disks))
+	}
+	return markRemoved(p.disks[index])
+}
+
+// ReplaceDisk installs a blank disk in the given slot. The replacement receives new writes
+// but its shards are treated as missing until they have been reconstructed from parity.
+func (p *parityArray) ReplaceDisk(index int) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if index < 0 || index >= len(p.disks) {
+		return fmt.Errorf("disk index %d out of bounds for %d disks", index, len(p.disks))
+	}
+
+	if err := p.disks[index].reset(DiskStateRebuilding); err != nil {
+		return err
+	}
+	p.log().Infof("[%s] Disk %d has been replaced.", p.name, index)
+	return nil
+}
+
+// Status reports the array state. The array survives as many unavailable disks as it has parity shards.
+func (p *parityArray) Status() ArrayStatus {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	state, tolerance := toleranceState(countUnavailable(p.disks), p.encoderExtension.ParityShards())
+	return ArrayStatus{
+		Type:           p.raidType,
+		State:          state,
+		StripeSz:       p.stripeSz,
+		Layout:         p.layout,
+		FaultTolerance: tolerance,
+		Capacity:       p.capacity(),
+		HighWaterMark:  p.HighWaterMark(),
+		Disks:          diskStatuses(p.disks),
+	}
+}
+
+// ParityDisks returns the disks holding the parity shards of stripe, P first.
+func (p *parityArray) ParityDisks(stripe int) []int {
+	numParityShards := p.encoderExtension.ParityShards()
+	placement := p.placement(stripe, len(p.disks), numParityShards)
+	return placement[len(placement)-numParityShards:]
+}
+
+// Rebuild regenerates a replaced disk stripe by stripe, reconstructing its shard of
+// each stripe from the shards held by the other disks. Stripes that are holes on every other
+// disk hold no data and stay holes on the replacement.
+func (p *parityArray) Rebuild(index int, progress ProgressFunc) error {
+	p.mu.Lock()
+	if index < 0 || index >= len(p.disks) {
+		p.mu.Unlock()
+		return fmt.Errorf("disk index %d out of bounds for %d disks", index, len(p.disks))
+	}
+	target := p.disks[index]
+	if err := checkRebuildable(target); err != nil {
+		p.mu.Unlock()
+		return err
+	}
+	p.mu.Unlock()
+
+	numParityShards := p.encoderExtension.ParityShards()
+	for stripeIdx := 0; ; stripeIdx++ {
+		// Take the lock per stripe so reads and writes interleave with the rebuild
+		p.mu.Lock()
+		if target.State != DiskStateRebuilding {
+			p.mu.Unlock()
+			return fmt.Errorf("%s: rebuild of disk %d interrupted, disk is now %s", p.name, index, target.State)
+		}
+		total := p.stripeCount()
+		if stripeIdx >= total {
+			target.State = DiskStateOnline
+			target.rebuilt = 0
+			p.mu.Unlock()
+			p.log().Infof("[%s] Disk %d rebuilt (%d stripes).", p.name, index, total)
+			return nil
+		}
+
+		if p.stripeAllocated(stripeIdx, index) {
+			rsShards, err := p.loadStripe(stripeIdx)
+			if err != nil {
+				p.mu.Unlock()
+				return fmt.Errorf("%s: failed to rebuild stripe %d of disk %d: %w", p.name, stripeIdx, index, err)
+			}
+			for shardIdx, d := range p.placement(stripeIdx, len(p.disks), numParityShards) {
+				if d != index {
+					continue
+				}
+				if err := target.WriteChunk(stripeIdx, rsShards[shardIdx]); err != nil {
+					p.mu.Unlock()
+					return fmt.Errorf("%s: failed to write rebuilt stripe %d to disk %d: %w", p.name, stripeIdx, index, err)
+				}
+			}
+		}
+		target.rebuilt = stripeIdx + 1
+		p.mu.Unlock()
+
+		p.log().Debugf("[%s] Rebuilt stripe %d/%d of disk %d.", p.name, stripeIdx+1, total, index)
+		if progress != nil {
+			progress(stripeIdx+1, total)
+		}
+	}
+}
+
+// Capacity returns the size of the data shards: every disk but those worth of parity.
+func (p *parityArray) Capacity() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.capacity()
+}
+
+func (p *parityArray) capacity() int {
+	if chunkLimit := diskChunkLimit(p.disks); chunkLimit > 0 {
+		return chunkLimit * p.bytesPerFullStripe()
+	}
+	return p.stripeCount() * p.bytesPerFullStripe()
+}
+
+// stripeAllocated reports whether any disk but the one at except takes up space for stripe.
+func (p *parityArray) stripeAllocated(stripe, except int) bool {
+	for d, disk := range p.disks {
+		if d != except && disk.allocated(stripe) {
+			return true
+		}
+	}
+	return false
+}
+
+// stripeCount returns the number of stripes allocated on the longest disk.
+func (p *parityArray) stripeCount() int {
+	maxStripes := 0
+	for _, disk := range p.disks {
+		maxStripes = max(maxStripes, disk.ChunkCount())
+	}
+	return maxStripes
+}
@@ -2,30 +2,63 @@ package raid
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
 type RAID0Controller struct {
+	mu       sync.RWMutex // held shared by I/O and exclusively by disk state changes
+	stripes  stripeLocks  // per-stripe locks, indexed by absolute stripe (chunk) index
 	disks    []*Disk
 	stripeSz int // The size of each data stripe (chunk)
+	highWaterMark
+	controllerLog
 }
 
 func NewRAID0Controller(diskCount int, stripeSize int) *RAID0Controller {
-	disks := make([]*Disk, diskCount)
-	for i := range disks {
-		disks[i] = &Disk{
-			ID:   i,
-			Data: [][]byte{},
-		}
-	}
-	return &RAID0Controller{
+	return newRAID0Controller(newDisks(diskCount, stripeSize), stripeSize)
+}
+
+func newRAID0Controller(disks []*Disk, stripeSize int) *RAID0Controller {
+	r := &RAID0Controller{
 		disks:    disks,
 		stripeSz: stripeSize,
 	}
+	r.restoreHighWaterMark(r.allocated())
+	return r
+}
+
+// chunkSegment is the part of a logical byte range that falls into a single chunk.
+type chunkSegment struct {
+	stripeIdx     int // absolute stripe (chunk) index
+	offsetInChunk int
+	dataOffset    int // position of the segment within the caller's buffer
+	length        int
+}
+
+// splitIntoChunks cuts the logical byte range [offset, offset+length) at chunk boundaries.
+func splitIntoChunks(offset, length, chunkSz int) []chunkSegment {
+	var segments []chunkSegment
+	for done := 0; done < length; {
+		logicalOffset := offset + done
+		offsetInChunk := logicalOffset % chunkSz
+		segmentLen := min(chunkSz-offsetInChunk, length-done)
+		segments = append(segments, chunkSegment{
+			stripeIdx:     logicalOffset / chunkSz,
+			offsetInChunk: offsetInChunk,
+			dataOffset:    done,
+			length:        segmentLen,
+		})
+		done += segmentLen
+	}
+	return segments
 }
 
 func (r *RAID0Controller) Write(data []byte, offset int) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if len(data) == 0 {
 		return nil // No data to write
 	}
@@ -38,47 +71,81 @@ func (r *RAID0Controller) Write(data []byte, offset int) error {
 	if offset < 0 {
 		return fmt.Errorf("write offset must be non-negative")
 	}
+	if err := checkSpace("RAID0", r.disks, r.capacity(), offset, len(data)); err != nil {
+		return err
+	}
 
-	currentLogicalByteOffset := offset
-	dataToWriteIndex := 0
-
-	for dataToWriteIndex < len(data) {
-		currentAbsoluteStripeIdx := currentLogicalByteOffset / r.stripeSz
-		diskIndex := currentAbsoluteStripeIdx % len(r.disks)
-		chunkIndexInDisk := currentAbsoluteStripeIdx / len(r.disks)
-
-		// Ensure disk has enough pre-allocated chunks to write into, or extend it.
-		// If writing into a new stripe, or extending existing ones.
-		for chunkIndexInDisk >= len(r.disks[diskIndex].Data) {
-			r.disks[diskIndex].Data = append(r.disks[diskIndex].Data, make([]byte, r.stripeSz))
+	segments := splitIntoChunks(offset, len(data), r.stripeSz)
+	for _, segment := range segments {
+		diskIndex := segment.stripeIdx % len(r.disks)
+		if r.disks[diskIndex].State.isFailed() {
+			return fmt.Errorf("RAID0: cannot write stripe %d, disk %d has failed", segment.stripeIdx, diskIndex)
 		}
+	}
 
-		// Calculate the start and end offsets within the current stripe chunk
-		offsetInStripeChunk := currentLogicalByteOffset % r.stripeSz
-		bytesToCopy := r.stripeSz - offsetInStripeChunk
+	unlock := r.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, false)
+	defer unlock()
 
-		if bytesToCopy > (len(data) - dataToWriteIndex) {
-			bytesToCopy = len(data) - dataToWriteIndex
-		}
+	// Chunks live on different disks, so they are written concurrently
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		diskIndex := segment.stripeIdx % len(r.disks)
+		chunkIndexInDisk := segment.stripeIdx / len(r.disks)
 
 		// Perform Read-Modify-Write if it's a partial update of an existing chunk
 		// or if data doesn't perfectly align to stripe boundaries.
-		targetChunk := r.disks[diskIndex].Data[chunkIndexInDisk]
+		// Chunks beyond the end of the disk read back as zeros, extending the disk on write.
+		targetChunk, err := r.disks[diskIndex].readChunkOrZeros(chunkIndexInDisk)
+		if err != nil {
+			return fmt.Errorf("RAID0: failed to read chunk for disk %d, stripe %d: %w", diskIndex, chunkIndexInDisk, err)
+		}
 
-		// Ensure targetChunk is not nil and has correct size (it should be, due to append loop above)
-		if targetChunk == nil || len(targetChunk) != r.stripeSz {
-			return fmt.Errorf("RAID0 internal error: chunk for disk %d, stripe %d is nil or malformed", diskIndex, chunkIndexInDisk)
+		copy(targetChunk[segment.offsetInChunk:segment.offsetInChunk+segment.length], data[segment.dataOffset:segment.dataOffset+segment.length])
+		if err := r.disks[diskIndex].WriteChunk(chunkIndexInDisk, targetChunk); err != nil {
+			return fmt.Errorf("RAID0: failed to write chunk for disk %d, stripe %d: %w", diskIndex, chunkIndexInDisk, err)
 		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	r.advance(offset + len(data))
+	return nil
+}
+
+// Discard releases the chunks covered whole by the logical range [offset, offset+length) and
+// zeroes the chunks it covers partly.
+func (r *RAID0Controller) Discard(offset, length int) error {
+	end, err := discardBounds(offset, length, r.HighWaterMark())
+	if err != nil || end <= offset {
+		return err
+	}
+	first, last, err := zeroPartialUnits(r.Write, offset, end, r.stripeSz)
+	if err != nil || first > last {
+		return err
+	}
 
-		copy(targetChunk[offsetInStripeChunk:offsetInStripeChunk+bytesToCopy], data[dataToWriteIndex:dataToWriteIndex+bytesToCopy])
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	unlock := r.stripes.lockRange(first, last, false)
+	defer unlock()
 
-		currentLogicalByteOffset += bytesToCopy
-		dataToWriteIndex += bytesToCopy
+	for stripeIdx := first; stripeIdx <= last; stripeIdx++ {
+		diskIndex := stripeIdx % len(r.disks)
+		if r.disks[diskIndex].State.isFailed() {
+			return fmt.Errorf("RAID0: cannot discard stripe %d, disk %d has failed", stripeIdx, diskIndex)
+		}
+		if err := r.disks[diskIndex].Discard(stripeIdx / len(r.disks)); err != nil {
+			return fmt.Errorf("RAID0: failed to discard stripe %d on disk %d: %w", stripeIdx, diskIndex, err)
+		}
 	}
 	return nil
 }
 
 func (r *RAID0Controller) Read(start, length int) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if start < 0 || length < 0 {
 		return nil, fmt.Errorf("read start and length must be non-negative")
 	}
@@ -89,24 +156,12 @@ func (r *RAID0Controller) Read(start, length int) ([]byte, error) {
 		return nil, fmt.Errorf("stripe size must be greater than 0")
 	}
 
-	result := make([]byte, 0, length)
 	endLogicalOffset := start + length
 
-	// Determine the maximum logical byte offset ever written to the array.
-	// This helps in correctly handling reads that go beyond written data.
-	// Let's refine `maxWrittenLogicalOffset` to reflect the maximum data that *could* be read
-	// assuming no failures, then apply failure logic during the read loop.
-	maxDiskStripeCount := 0
-	for _, disk := range r.disks {
-		if len(disk.Data) > maxDiskStripeCount {
-			maxDiskStripeCount = len(disk.Data)
-		}
-	}
-	// This `maxWrittenLogicalOffset` represents the maximum possible logical size if all disks were full
-	// up to `maxDiskStripeCount`.
-	maxWrittenLogicalOffset := maxDiskStripeCount * len(r.disks) * r.stripeSz
+	// Reads are bounded by the furthest byte ever written to the array, not by the chunks allocated on the disks
+	maxWrittenLogicalOffset := r.HighWaterMark()
 
-	if maxWrittenLogicalOffset == -1 || start >= maxWrittenLogicalOffset {
+	if start >= maxWrittenLogicalOffset {
 		if start > maxWrittenLogicalOffset {
 			return nil, fmt.Errorf("read start offset %d is beyond total data stored %d", start, maxWrittenLogicalOffset)
 		}
@@ -114,7 +169,7 @@ func (r *RAID0Controller) Read(start, length int) ([]byte, error) {
 	}
 
 	if endLogicalOffset > maxWrittenLogicalOffset {
-		logrus.Warnf("[RAID0] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
+		r.log().Warnf("[RAID0] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
 			length, start, maxWrittenLogicalOffset, maxWrittenLogicalOffset-start)
 		endLogicalOffset = maxWrittenLogicalOffset
 		length = endLogicalOffset - start
@@ -123,54 +178,119 @@ func (r *RAID0Controller) Read(start, length int) ([]byte, error) {
 		return []byte{}, nil
 	}
 
-	currentLogicalReadOffset := start
+	segments := splitIntoChunks(start, length, r.stripeSz)
+	unlock := r.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, true)
+	defer unlock()
 
-	for currentLogicalReadOffset < endLogicalOffset {
-		currentAbsoluteStripeIdx := currentLogicalReadOffset / r.stripeSz
-		diskIndex := currentAbsoluteStripeIdx % len(r.disks)
-		chunkIndexInDisk := currentAbsoluteStripeIdx / len(r.disks)
+	result := make([]byte, length)
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		diskIndex := segment.stripeIdx % len(r.disks)
+		chunkIndexInDisk := segment.stripeIdx / len(r.disks)
+		currentLogicalReadOffset := start + segment.dataOffset
 
 		// In RAID0, if any part of a logical stripe (chunk) is on a failed disk, the entire stripe is considered unrecoverable.
 		// This `Read` method demonstrates this fundamental RAID0 characteristic by returning an error immediately
 		// if a required data chunk is missing due to disk failure.
 		// While the underlying logic can read partial data from a *healthy* chunk (as shown in the selected code snippet),
 		// in the context of RAID0's lack of fault tolerance, any missing component means the logical data cannot be reliably presented.
-		if diskIndex >= len(r.disks) || r.disks[diskIndex] == nil || chunkIndexInDisk >= len(r.disks[diskIndex].Data) || r.disks[diskIndex].Data[chunkIndexInDisk] == nil || len(r.disks[diskIndex].Data[chunkIndexInDisk]) == 0 {
-			return nil, fmt.Errorf("RAID0: Data unrecoverable due to missing chunk at disk %d, chunk %d (logical stripe %d, offset %d). All disks must be healthy", diskIndex, chunkIndexInDisk, currentAbsoluteStripeIdx, currentLogicalReadOffset)
+		if !r.disks[diskIndex].isOnline() {
+			return fmt.Errorf("RAID0: Data unrecoverable due to missing chunk at disk %d, chunk %d (logical stripe %d, offset %d). All disks must be healthy", diskIndex, chunkIndexInDisk, segment.stripeIdx, currentLogicalReadOffset)
+		}
+		chunk, err := r.disks[diskIndex].readChunkOrZeros(chunkIndexInDisk)
+		if err != nil {
+			return fmt.Errorf("RAID0: Data unrecoverable due to missing chunk at disk %d, chunk %d (logical stripe %d, offset %d): %w", diskIndex, chunkIndexInDisk, segment.stripeIdx, currentLogicalReadOffset, err)
 		}
+		copy(result[segment.dataOffset:segment.dataOffset+segment.length], chunk[segment.offsetInChunk:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-		chunk := r.disks[diskIndex].Data[chunkIndexInDisk]
-		offsetInChunk := currentLogicalReadOffset % r.stripeSz
+func (r *RAID0Controller) ClearDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		bytesToRead := r.stripeSz - offsetInChunk
-		if bytesToRead > (endLogicalOffset - currentLogicalReadOffset) {
-			bytesToRead = endLogicalOffset - currentLogicalReadOffset
-		}
+	if index < 0 || index >= len(r.disks) {
+		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
+	}
+	if err := r.disks[index].reset(DiskStateFailed); err != nil {
+		return err
+	}
+	r.log().Infof("[RAID0] Disk %d has been cleared (simulating failure).", index)
+	return nil
+}
 
-		if offsetInChunk+bytesToRead > len(chunk) {
-			bytesToRead = len(chunk) - offsetInChunk
-			if bytesToRead < 0 {
-				bytesToRead = 0
-			}
-		}
+func (r *RAID0Controller) removeDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		if bytesToRead > 0 {
-			result = append(result, chunk[offsetInChunk:offsetInChunk+bytesToRead]...)
-		}
-		currentLogicalReadOffset += bytesToRead
+	if index < 0 || index >= len(r.disks) {
+		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
 	}
-	return result, nil
+	return markRemoved(r.disks[index])
 }
 
-func (r *RAID0Controller) ClearDisk(index int) error {
+// ReplaceDisk installs a blank disk in the given slot. RAID0 has no redundancy,
+// so any data previously striped onto the slot stays lost.
+func (r *RAID0Controller) ReplaceDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if index < 0 || index >= len(r.disks) {
 		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
 	}
-	r.disks[index].Data = [][]byte{}
-	logrus.Infof("[RAID0] Disk %d has been cleared (simulating failure).", index)
+	if err := r.disks[index].reset(DiskStateOnline); err != nil {
+		return err
+	}
+	r.log().Infof("[RAID0] Disk %d has been replaced.", index)
 	return nil
 }
 
+// Status reports the array state. Any unavailable disk fails a RAID0 array.
+func (r *RAID0Controller) Status() ArrayStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state, tolerance := toleranceState(countUnavailable(r.disks), 0)
+	return ArrayStatus{
+		Type:           RaidTypeRaid0,
+		State:          state,
+		StripeSz:       r.stripeSz,
+		FaultTolerance: tolerance,
+		Capacity:       r.capacity(),
+		HighWaterMark:  r.HighWaterMark(),
+		Disks:          diskStatuses(r.disks),
+	}
+}
+
+// Capacity returns the combined size of every disk, as RAID0 stores no redundancy.
+func (r *RAID0Controller) Capacity() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.capacity()
+}
+
+func (r *RAID0Controller) capacity() int {
+	if chunkLimit := diskChunkLimit(r.disks); chunkLimit > 0 {
+		return chunkLimit * len(r.disks) * r.stripeSz
+	}
+	return r.allocated()
+}
+
+// allocated returns the logical bytes covered by the stripes allocated on the disks so far.
+func (r *RAID0Controller) allocated() int {
+	maxDiskStripeCount := 0
+	for _, disk := range r.disks {
+		maxDiskStripeCount = max(maxDiskStripeCount, disk.ChunkCount())
+	}
+	return maxDiskStripeCount * len(r.disks) * r.stripeSz
+}
+
 // Raid0SimulationFlow is a helper function to simulate a write, clear, and read cycle for RAID0.
 func Raid0SimulationFlow(input string, diskCount int, stripeSz int, clearTarget int) {
 	raid := NewRAID0Controller(diskCount, stripeSz)
@@ -2,33 +2,51 @@ package raid
 
 import (
 	"fmt"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
 type RAID1Controller struct {
-	disks    []*Disk
-	stripeSz int // Added stripe size for block-level operations
+	mu       sync.RWMutex // held shared by I/O and exclusively by disk state changes
+	stripes  stripeLocks  // per-chunk locks
+	disks    []*Disk      // every disk holds a full copy, so n disks make an n-way mirror
+	stripeSz int          // Added stripe size for block-level operations
+	balancer *readBalancer
+	highWaterMark
+	controllerLog
 }
 
+// NewRAID1Controller creates an n-way mirror over diskCount disks, reading with the default read policy.
 func NewRAID1Controller(diskCount int, stripeSz int) (*RAID1Controller, error) {
-	if diskCount < 2 {
-		return nil, fmt.Errorf("RAID1 requires at least 2 disks. Provided: %d", diskCount)
+	return newRAID1Controller(newDisks(diskCount, stripeSz), stripeSz, DefaultReadPolicy)
+}
+
+// NewRAID1ControllerWithPolicy creates an n-way mirror over diskCount disks, choosing the copy each read is served from by policy.
+func NewRAID1ControllerWithPolicy(diskCount int, stripeSz int, policy ReadPolicy) (*RAID1Controller, error) {
+	return newRAID1Controller(newDisks(diskCount, stripeSz), stripeSz, policy)
+}
+
+func newRAID1Controller(disks []*Disk, stripeSz int, policy ReadPolicy) (*RAID1Controller, error) {
+	if len(disks) < 2 {
+		return nil, fmt.Errorf("RAID1 requires at least 2 disks. Provided: %d", len(disks))
 	}
 	if stripeSz <= 0 {
 		return nil, fmt.Errorf("stripe size must be greater than 0. Provided: %d", stripeSz)
 	}
-	disks := make([]*Disk, diskCount)
-	for i := range disks {
-		disks[i] = &Disk{
-			ID:   i,
-			Data: [][]byte{},
-		}
+	balancer, err := newReadBalancer(policy)
+	if err != nil {
+		return nil, err
 	}
-	return &RAID1Controller{disks: disks, stripeSz: stripeSz}, nil
+	r := &RAID1Controller{disks: disks, stripeSz: stripeSz, balancer: balancer}
+	r.restoreHighWaterMark(r.allocated())
+	return r, nil
 }
 
 func (r *RAID1Controller) Write(data []byte, offset int) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if len(r.disks) < 2 {
 		return fmt.Errorf("RAID1 requires at least 2 disks, got %d", len(r.disks))
 	}
@@ -41,39 +59,76 @@ func (r *RAID1Controller) Write(data []byte, offset int) error {
 	if offset < 0 {
 		return fmt.Errorf("write offset must be non-negative")
 	}
+	if countUnavailable(r.disks) == len(r.disks) {
+		return fmt.Errorf("RAID1: no healthy disk left to write to")
+	}
+	if err := checkSpace("RAID1", r.disks, r.capacity(), offset, len(data)); err != nil {
+		return err
+	}
 
-	currentLogicalByteOffset := offset
-	dataToWriteIndex := 0
-
-	for dataToWriteIndex < len(data) {
-		currentAbsoluteChunkIdx := currentLogicalByteOffset / r.stripeSz
-		offsetInChunk := currentLogicalByteOffset % r.stripeSz
+	segments := splitIntoChunks(offset, len(data), r.stripeSz)
+	unlock := r.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, false)
+	defer unlock()
 
-		bytesToCopy := 0
-		// For each disk (mirror)
-		for _, disk := range r.disks {
-			for currentAbsoluteChunkIdx >= len(disk.Data) {
-				disk.Data = append(disk.Data, make([]byte, r.stripeSz))
+	for _, segment := range segments {
+		// Every mirror is written concurrently; failed disks are skipped until they are replaced
+		err := forEachParallel(len(r.disks), func(i int) error {
+			disk := r.disks[i]
+			if disk.State.isFailed() {
+				return nil
 			}
-
-			bytesToCopy = r.stripeSz - offsetInChunk
-			if bytesToCopy > (len(data) - dataToWriteIndex) {
-				bytesToCopy = len(data) - dataToWriteIndex
+			targetChunk, err := disk.readChunkOrZeros(segment.stripeIdx)
+			if err != nil {
+				return fmt.Errorf("RAID1: failed to read chunk for disk %d, index %d: %w", disk.ID, segment.stripeIdx, err)
+			}
+			copy(targetChunk[segment.offsetInChunk:segment.offsetInChunk+segment.length], data[segment.dataOffset:segment.dataOffset+segment.length])
+			if err := disk.WriteChunk(segment.stripeIdx, targetChunk); err != nil {
+				return fmt.Errorf("RAID1: failed to write chunk for disk %d, index %d: %w", disk.ID, segment.stripeIdx, err)
 			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	r.advance(offset + len(data))
+	return nil
+}
+
+// Discard releases the chunks covered whole by the logical range [offset, offset+length) on every
+// mirror and zeroes the chunks it covers partly. Failed disks are skipped until they are replaced.
+func (r *RAID1Controller) Discard(offset, length int) error {
+	end, err := discardBounds(offset, length, r.HighWaterMark())
+	if err != nil || end <= offset {
+		return err
+	}
+	first, last, err := zeroPartialUnits(r.Write, offset, end, r.stripeSz)
+	if err != nil || first > last {
+		return err
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	unlock := r.stripes.lockRange(first, last, false)
+	defer unlock()
 
-			targetChunk := disk.Data[currentAbsoluteChunkIdx]
-			if targetChunk == nil || len(targetChunk) != r.stripeSz {
-				return fmt.Errorf("RAID1 internal error: chunk for disk %d, index %d is nil or malformed", disk.ID, currentAbsoluteChunkIdx)
+	for stripeIdx := first; stripeIdx <= last; stripeIdx++ {
+		for _, disk := range r.disks {
+			if disk.State.isFailed() {
+				continue
+			}
+			if err := disk.Discard(stripeIdx); err != nil {
+				return fmt.Errorf("RAID1: failed to discard chunk %d on disk %d: %w", stripeIdx, disk.ID, err)
 			}
-			copy(targetChunk[offsetInChunk:offsetInChunk+bytesToCopy], data[dataToWriteIndex:dataToWriteIndex+bytesToCopy])
 		}
-		currentLogicalByteOffset += bytesToCopy
-		dataToWriteIndex += bytesToCopy
 	}
 	return nil
 }
 
 func (r *RAID1Controller) Read(start, length int) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if start < 0 || length < 0 {
 		return nil, fmt.Errorf("read start and length must be non-negative")
 	}
@@ -84,19 +139,12 @@ func (r *RAID1Controller) Read(start, length int) ([]byte, error) {
 		return nil, fmt.Errorf("stripe size must be greater than 0")
 	}
 
-	result := make([]byte, 0, length)
 	endLogicalOffset := start + length
 
-	maxWrittenLogicalOffset := -1
-	for _, disk := range r.disks {
-		if len(disk.Data) > 0 && disk.Data[0] != nil {
-			// Total data on this disk is (number of chunks) * stripeSz
-			currentDiskMaxOffset := len(disk.Data) * r.stripeSz
-			maxWrittenLogicalOffset = max(maxWrittenLogicalOffset, currentDiskMaxOffset)
-		}
-	}
+	// Reads are bounded by the furthest byte ever written to the array
+	maxWrittenLogicalOffset := r.HighWaterMark()
 
-	if maxWrittenLogicalOffset == -1 || start >= maxWrittenLogicalOffset {
+	if start >= maxWrittenLogicalOffset {
 		if start > maxWrittenLogicalOffset {
 			return nil, fmt.Errorf("read start offset %d is beyond total data stored %d", start, maxWrittenLogicalOffset)
 		}
@@ -104,7 +152,7 @@ func (r *RAID1Controller) Read(start, length int) ([]byte, error) {
 	}
 
 	if endLogicalOffset > maxWrittenLogicalOffset {
-		logrus.Warnf("[RAID1] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
+		r.log().Warnf("[RAID1] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
 			length, start, maxWrittenLogicalOffset, maxWrittenLogicalOffset-start)
 		endLogicalOffset = maxWrittenLogicalOffset
 		length = endLogicalOffset - start
@@ -113,59 +161,133 @@ func (r *RAID1Controller) Read(start, length int) ([]byte, error) {
 		return []byte{}, nil
 	}
 
-	currentLogicalReadOffset := start
+	segments := splitIntoChunks(start, length, r.stripeSz)
+	unlock := r.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, true)
+	defer unlock()
 
-	for currentLogicalReadOffset < endLogicalOffset {
-		currentAbsoluteChunkIdx := currentLogicalReadOffset / r.stripeSz
-		offsetInChunk := currentLogicalReadOffset % r.stripeSz
+	result := make([]byte, length)
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		currentAbsoluteChunkIdx := segment.stripeIdx
 
-		var sourceChunk []byte
-		foundHealthyDisk := false
-		// Try to read from any healthy mirrored disk
-		for _, disk := range r.disks {
-			if currentAbsoluteChunkIdx < len(disk.Data) && disk.Data[currentAbsoluteChunkIdx] != nil && len(disk.Data[currentAbsoluteChunkIdx]) > 0 {
-				sourceChunk = disk.Data[currentAbsoluteChunkIdx]
-				foundHealthyDisk = true
-				break
-			}
+		// Every mirror holds the chunk at the same index; the read policy picks which one serves it
+		copies := make([]chunkAddr, len(r.disks))
+		for d, disk := range r.disks {
+			copies[d] = chunkAddr{disk: disk, index: currentAbsoluteChunkIdx}
 		}
+		sourceChunk, foundHealthyDisk := r.balancer.read(r.log(), "RAID1", copies)
 
 		if !foundHealthyDisk {
-			return nil, fmt.Errorf("no healthy disk found for chunk %d (logical offset %d). RAID1 cannot recover from all mirrors failing for this chunk", currentAbsoluteChunkIdx, currentLogicalReadOffset)
+			return fmt.Errorf("no healthy disk found for chunk %d (logical offset %d). RAID1 cannot recover from all mirrors failing for this chunk", currentAbsoluteChunkIdx, start+segment.dataOffset)
 		}
-
-		bytesToRead := r.stripeSz - offsetInChunk
-		if bytesToRead > (endLogicalOffset - currentLogicalReadOffset) {
-			bytesToRead = endLogicalOffset - currentLogicalReadOffset
-		}
-
-		if offsetInChunk+bytesToRead > len(sourceChunk) {
-			bytesToRead = len(sourceChunk) - offsetInChunk
-			if bytesToRead < 0 {
-				bytesToRead = 0
-			}
-		}
-
-		if bytesToRead > 0 {
-			result = append(result, sourceChunk[offsetInChunk:offsetInChunk+bytesToRead]...)
-		}
-		currentLogicalReadOffset += bytesToRead
+		copy(result[segment.dataOffset:segment.dataOffset+segment.length], sourceChunk[segment.offsetInChunk:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 	return result, nil
 }
 
 // ClearDisk simulates a disk failure by clearing the data on the specified disk.
 func (r *RAID1Controller) ClearDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	if index < 0 || index >= len(r.disks) {
 		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
 	}
-	r.disks[index].Data = [][]byte{} // Clear the data to simulate failure
-	logrus.Infof("[RAID1] Disk %d has been cleared (simulating failure).", index)
+	if err := r.disks[index].reset(DiskStateFailed); err != nil { // Clear the data to simulate failure
+		return err
+	}
+	r.log().Infof("[RAID1] Disk %d has been cleared (simulating failure).", index)
 	return nil
 }
 
+func (r *RAID1Controller) removeDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if index < 0 || index >= len(r.disks) {
+		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
+	}
+	return markRemoved(r.disks[index])
+}
+
+// ReplaceDisk installs a blank disk in the given slot. The replacement receives new writes
+// but is not read from until its contents have been regenerated from the other mirrors.
+func (r *RAID1Controller) ReplaceDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if index < 0 || index >= len(r.disks) {
+		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
+	}
+	if err := r.disks[index].reset(DiskStateRebuilding); err != nil {
+		return err
+	}
+	r.log().Infof("[RAID1] Disk %d has been replaced.", index)
+	return nil
+}
+
+// Status reports the array state. RAID1 survives as long as one mirror is online.
+func (r *RAID1Controller) Status() ArrayStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state, tolerance := toleranceState(countUnavailable(r.disks), len(r.disks)-1)
+	return ArrayStatus{
+		Type:           RaidTypeRaid1,
+		State:          state,
+		StripeSz:       r.stripeSz,
+		ReadPolicy:     r.balancer.policy,
+		FaultTolerance: tolerance,
+		Capacity:       r.capacity(),
+		HighWaterMark:  r.HighWaterMark(),
+		Disks:          diskStatuses(r.disks),
+	}
+}
+
+// Rebuild regenerates a replaced disk chunk by chunk from the remaining mirrors.
+func (r *RAID1Controller) Rebuild(index int, progress ProgressFunc) error {
+	r.mu.Lock()
+	if index < 0 || index >= len(r.disks) {
+		r.mu.Unlock()
+		return fmt.Errorf("invalid disk index: %d, out of bounds for %d disks", index, len(r.disks))
+	}
+	target := r.disks[index]
+	r.mu.Unlock()
+
+	return rebuildFromMirrors(&r.mu, r.log(), "RAID1", r.disks, target, progress)
+}
+
+// Capacity returns the size of a single disk, as every disk holds a full copy.
+func (r *RAID1Controller) Capacity() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.capacity()
+}
+
+func (r *RAID1Controller) capacity() int {
+	if chunkLimit := diskChunkLimit(r.disks); chunkLimit > 0 {
+		return chunkLimit * r.stripeSz
+	}
+	return r.allocated()
+}
+
+// allocated returns the logical bytes covered by the chunks allocated on the disks so far.
+func (r *RAID1Controller) allocated() int {
+	maxChunks := 0
+	for _, disk := range r.disks {
+		maxChunks = max(maxChunks, disk.ChunkCount())
+	}
+	return maxChunks * r.stripeSz
+}
+
 // Raid1SimulationFlow is a helper function to simulate a write, clear, and read cycle for RAID1.
-func Raid1SimulationFlow(input string, diskCount int, stripeSz int, clearTarget int) {
+// Clearing every target but one mirror still recovers the input.
+func Raid1SimulationFlow(input string, diskCount int, stripeSz int, clearTargets []int) {
 	raid, err := NewRAID1Controller(diskCount, stripeSz) // Pass stripeSz
 	if err != nil {
 		logrus.Errorf("[RAID1] Init Raid1 controller failed: %v", err)
@@ -185,12 +307,13 @@ func Raid1SimulationFlow(input string, diskCount int, stripeSz int, clearTarget
 		logrus.Infof("[RAID1] Recovered string before clear: %s", string(output))
 	}
 
-	err = raid.ClearDisk(clearTarget)
-	if err != nil {
-		logrus.Errorf("[RAID1] ClearDisk failed: %v", err)
-		return
+	for _, target := range clearTargets {
+		if err := raid.ClearDisk(target); err != nil {
+			logrus.Errorf("[RAID1] ClearDisk failed for disk %d: %v", target, err)
+			return
+		}
+		logrus.Infof("[RAID1] Disk %d cleared", target)
 	}
-	logrus.Infof("[RAID1] Disk %d cleared", clearTarget)
 
 	output, err = raid.Read(0, len(input))
 	if err != nil {
@@ -2,143 +2,286 @@ package raid
 
 import (
 	"fmt"
+	"slices"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
 
+// MirrorLayout selects where RAID10 places the copies of each chunk, after the layouts of Linux md.
+type MirrorLayout string
+
+const (
+	// MirrorLayoutNear writes the copies of a chunk to consecutive disks in the same row. When the copy
+	// count divides the disk count the disks form fixed mirror sets and chunks stripe across the sets.
+	MirrorLayoutNear MirrorLayout = "near"
+	// MirrorLayoutFar splits every disk into one section per copy. The first section holds the chunks
+	// striped as in RAID0, and every further section repeats that stripe shifted by one more disk, so
+	// sequential reads stream from every disk at once. It needs disks of a declared size.
+	MirrorLayoutFar MirrorLayout = "far"
+	// MirrorLayoutOffset repeats every row of chunks right below itself, shifted by one more disk per
+	// copy, keeping the copies close together as near does while spreading them like far.
+	MirrorLayoutOffset MirrorLayout = "offset"
+)
+
+// DefaultMirrorLayout is the layout of RAID10 arrays that do not select one.
+const DefaultMirrorLayout = MirrorLayoutNear
+
+// DefaultMirrorCopies is the number of copies of every chunk of RAID10 arrays that do not select one.
+const DefaultMirrorCopies = 2
+
+// MirrorLayouts lists every supported RAID10 layout.
+func MirrorLayouts() []MirrorLayout {
+	return []MirrorLayout{MirrorLayoutNear, MirrorLayoutFar, MirrorLayoutOffset}
+}
+
 type RAID10Controller struct {
-	mirrors  [][]*Disk // Array of RAID1 mirror pairs
-	stripeSz int       // The size of each data stripe (chunk)
+	mu       sync.RWMutex // held shared by I/O and exclusively by disk state changes
+	stripes  stripeLocks  // per-stripe locks, indexed by absolute stripe (chunk) index
+	disks    []*Disk
+	copies   int          // copies of every chunk, each on a different disk
+	layout   MirrorLayout // placement of the copies
+	stripeSz int          // The size of each data stripe (chunk)
+	balancer *readBalancer
+	highWaterMark
+	controllerLog
 }
 
-// NewRAID10Controller creates and initializes a new RAID10Controller.
-// Requires an even number of totalDisks (min 4).
+// NewRAID10Controller creates and initializes a new RAID10Controller keeping 2 copies of every
+// chunk in the near layout, so consecutive disk pairs mirror each other.
+// Requires at least 3 disks; with an even number the pairs are fixed.
 // stripeSz must be greater than 0.
 func NewRAID10Controller(totalDisks int, stripeSz int) (*RAID10Controller, error) {
-	if totalDisks < 4 || totalDisks%2 != 0 {
-		return nil, fmt.Errorf("RAID10 requires an even number of disks, minimum 4. Provided: %d", totalDisks)
+	return newRAID10Controller(newDisks(totalDisks, stripeSz), stripeSz, DefaultMirrorCopies, DefaultMirrorLayout, DefaultReadPolicy)
+}
+
+// NewRAID10ControllerWithCopies creates a RAID10Controller keeping copies copies of every chunk in
+// the near layout, e.g. 3 copies over 6 disks stripe across two triple mirrors.
+func NewRAID10ControllerWithCopies(totalDisks, stripeSz, copies int) (*RAID10Controller, error) {
+	return newRAID10Controller(newDisks(totalDisks, stripeSz), stripeSz, copies, DefaultMirrorLayout, DefaultReadPolicy)
+}
+
+func newRAID10Controller(disks []*Disk, stripeSz, copies int, layout MirrorLayout, policy ReadPolicy) (*RAID10Controller, error) {
+	if copies == 0 {
+		copies = DefaultMirrorCopies
+	}
+	if layout == "" {
+		layout = DefaultMirrorLayout
+	}
+	totalDisks := len(disks)
+	if copies < 2 {
+		return nil, fmt.Errorf("RAID10 requires at least 2 copies of every chunk. Provided: %d", copies)
+	}
+	if totalDisks <= copies {
+		return nil, fmt.Errorf("RAID10 with %d copies requires at least %d disks. Provided: %d", copies, copies+1, totalDisks)
 	}
 	if stripeSz <= 0 {
 		return nil, fmt.Errorf("stripe size must be greater than 0. Provided: %d", stripeSz)
 	}
-
-	var mirrors [][]*Disk
-	for i := 0; i < totalDisks; i += 2 {
-		mirrors = append(mirrors, []*Disk{
-			{ID: i, Data: [][]byte{}},
-			{ID: i + 1, Data: [][]byte{}},
-		})
+	if !slices.Contains(MirrorLayouts(), layout) {
+		return nil, fmt.Errorf("unsupported RAID10 layout: %s (supported: %v)", layout, MirrorLayouts())
+	}
+	if layout == MirrorLayoutFar && diskChunkLimit(disks) < copies {
+		return nil, fmt.Errorf("RAID10 %s layout needs disks of a declared size holding at least %d chunks, one section per copy", layout, copies)
+	}
+	balancer, err := newReadBalancer(policy)
+	if err != nil {
+		return nil, err
 	}
 
-	return &RAID10Controller{
-		mirrors:  mirrors,
+	r := &RAID10Controller{
+		disks:    disks,
+		copies:   copies,
+		layout:   layout,
 		stripeSz: stripeSz,
-	}, nil
+		balancer: balancer,
+	}
+	r.restoreHighWaterMark(r.allocated())
+	return r, nil
+}
+
+// sectionChunks returns the chunks of each disk section of the far layout.
+func (r *RAID10Controller) sectionChunks() int {
+	return diskChunkLimit(r.disks) / r.copies
+}
+
+// placement returns where the copies of the logical chunk at stripeIdx live, primary copy first.
+func (r *RAID10Controller) placement(stripeIdx int) []chunkAddr {
+	n := len(r.disks)
+	copies := make([]chunkAddr, r.copies)
+	for c := range copies {
+		var disk, index int
+		switch r.layout {
+		case MirrorLayoutFar:
+			disk, index = (stripeIdx%n+c)%n, c*r.sectionChunks()+stripeIdx/n
+		case MirrorLayoutOffset:
+			disk, index = (stripeIdx%n+c)%n, stripeIdx/n*r.copies+c
+		default:
+			position := stripeIdx*r.copies + c
+			disk, index = position%n, position/n
+		}
+		copies[c] = chunkAddr{disk: r.disks[disk], index: index}
+	}
+	return copies
+}
+
+// stripeAt returns the logical chunk whose copy the disk at position d holds at index,
+// or false when that chunk of the disk holds no data, past the last section of the far layout.
+func (r *RAID10Controller) stripeAt(d, index int) (int, bool) {
+	n := len(r.disks)
+	switch r.layout {
+	case MirrorLayoutFar:
+		c := index / r.sectionChunks()
+		if c >= r.copies {
+			return 0, false
+		}
+		return index%r.sectionChunks()*n + (d-c+n)%n, true
+	case MirrorLayoutOffset:
+		c := index % r.copies
+		return index/r.copies*n + (d-c+n)%n, true
+	default:
+		return (index*n + d) / r.copies, true
+	}
+}
+
+// copySets returns the sets of disks holding all copies of some chunk. Every layout keeps the copies
+// of a chunk on consecutive disks, wrapping around; the near layout only starts them on multiples of
+// the greatest common divisor of the disk and copy counts, so with an even split the sets are disjoint.
+func (r *RAID10Controller) copySets() [][]*Disk {
+	n := len(r.disks)
+	step := 1
+	if r.layout == MirrorLayoutNear {
+		step = gcd(n, r.copies)
+	}
+	var sets [][]*Disk
+	for first := 0; first < n; first += step {
+		set := make([]*Disk, r.copies)
+		for c := range set {
+			set[c] = r.disks[(first+c)%n]
+		}
+		sets = append(sets, set)
+	}
+	return sets
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
 }
 
-// Write writes data to the RAID10 array, striping data across mirror pairs.
+// Write writes data to the RAID10 array, writing every copy of each chunk.
 // Supports block-level writes and Read-Modify-Write for partial updates.
 func (r *RAID10Controller) Write(data []byte, offset int) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if len(data) == 0 {
 		return nil // No data to write
 	}
 	if r.stripeSz <= 0 {
 		return fmt.Errorf("stripe size must be greater than 0")
 	}
-	if len(r.mirrors) == 0 {
-		return fmt.Errorf("no mirror pairs in RAID10 array")
-	}
 	if offset < 0 {
 		return fmt.Errorf("write offset must be non-negative")
 	}
+	if err := checkSpace("RAID10", r.disks, r.capacity(), offset, len(data)); err != nil {
+		return err
+	}
 
-	currentLogicalByteOffset := offset
-	dataToWriteIndex := 0
+	segments := splitIntoChunks(offset, len(data), r.stripeSz)
+	for _, segment := range segments {
+		healthy := false
+		for _, c := range r.placement(segment.stripeIdx) {
+			healthy = healthy || c.disk.isOnline()
+		}
+		if !healthy {
+			return fmt.Errorf("RAID10: no healthy disk left holding a copy of stripe %d", segment.stripeIdx)
+		}
+	}
 
-	for dataToWriteIndex < len(data) {
-		currentAbsoluteStripeIdx := currentLogicalByteOffset / r.stripeSz
-		mirrorIndex := currentAbsoluteStripeIdx % len(r.mirrors)
-		chunkIndexInMirrorPair := currentAbsoluteStripeIdx / len(r.mirrors)
+	unlock := r.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, false)
+	defer unlock()
 
-		primaryDisk := r.mirrors[mirrorIndex][0]
-		backupDisk := r.mirrors[mirrorIndex][1]
+	// Different stripes, and the copies of each stripe, are written concurrently
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		copies := r.placement(segment.stripeIdx)
 
-		// Ensure disks have enough pre-allocated chunks
-		for chunkIndexInMirrorPair >= len(primaryDisk.Data) {
-			primaryDisk.Data = append(primaryDisk.Data, make([]byte, r.stripeSz))
-			backupDisk.Data = append(backupDisk.Data, make([]byte, r.stripeSz)) // Mirror also needs a new chunk
-		}
+		// Copy data to every disk holding a copy that has not failed
+		return forEachParallel(len(copies), func(c int) error {
+			disk, index := copies[c].disk, copies[c].index
+			if disk.State.isFailed() {
+				return nil
+			}
+			// Perform Read-Modify-Write; chunks beyond the end of the disk read back as zeros
+			targetChunk, err := disk.readChunkOrZeros(index)
+			if err != nil {
+				return fmt.Errorf("RAID10: failed to read chunk %d of disk %d, stripe %d: %w", index, disk.ID, segment.stripeIdx, err)
+			}
+			copy(targetChunk[segment.offsetInChunk:segment.offsetInChunk+segment.length], data[segment.dataOffset:segment.dataOffset+segment.length])
+			if err := disk.WriteChunk(index, targetChunk); err != nil {
+				return fmt.Errorf("RAID10: failed to write chunk %d of disk %d, stripe %d: %w", index, disk.ID, segment.stripeIdx, err)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+	r.advance(offset + len(data))
+	return nil
+}
 
-		// Determine how much data to write into the current chunk
-		offsetInStripeChunk := currentLogicalByteOffset % r.stripeSz
-		bytesToCopy := r.stripeSz - offsetInStripeChunk
-		if bytesToCopy > (len(data) - dataToWriteIndex) {
-			bytesToCopy = len(data) - dataToWriteIndex
-		}
+// Discard releases every copy of the chunks covered whole by the logical range [offset, offset+length)
+// and zeroes the chunks it covers partly. Copies on failed disks are skipped until they are replaced.
+func (r *RAID10Controller) Discard(offset, length int) error {
+	end, err := discardBounds(offset, length, r.HighWaterMark())
+	if err != nil || end <= offset {
+		return err
+	}
+	first, last, err := zeroPartialUnits(r.Write, offset, end, r.stripeSz)
+	if err != nil || first > last {
+		return err
+	}
 
-		// Perform Read-Modify-Write (if needed) and copy data to both mirrored disks
-		targetChunkPrimary := primaryDisk.Data[chunkIndexInMirrorPair]
-		targetChunkBackup := backupDisk.Data[chunkIndexInMirrorPair]
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	unlock := r.stripes.lockRange(first, last, false)
+	defer unlock()
 
-		if targetChunkPrimary == nil || len(targetChunkPrimary) != r.stripeSz ||
-			targetChunkBackup == nil || len(targetChunkBackup) != r.stripeSz {
-			return fmt.Errorf("RAID10 internal error: mirrored chunks for mirror pair %d, stripe %d are nil or malformed", mirrorIndex, chunkIndexInMirrorPair)
+	for stripeIdx := first; stripeIdx <= last; stripeIdx++ {
+		for _, c := range r.placement(stripeIdx) {
+			if c.disk.State.isFailed() {
+				continue
+			}
+			if err := c.disk.Discard(c.index); err != nil {
+				return fmt.Errorf("RAID10: failed to discard stripe %d on disk %d: %w", stripeIdx, c.disk.ID, err)
+			}
 		}
-
-		copy(targetChunkPrimary[offsetInStripeChunk:offsetInStripeChunk+bytesToCopy], data[dataToWriteIndex:dataToWriteIndex+bytesToCopy])
-		copy(targetChunkBackup[offsetInStripeChunk:offsetInStripeChunk+bytesToCopy], data[dataToWriteIndex:dataToWriteIndex+bytesToCopy])
-
-		currentLogicalByteOffset += bytesToCopy
-		dataToWriteIndex += bytesToCopy
 	}
 	return nil
 }
 
-// Read reads data from the RAID10 array, reading from healthy disks in each mirror pair.
+// Read reads data from the RAID10 array, serving each chunk from one of its healthy copies as chosen by the read policy.
 func (r *RAID10Controller) Read(start, length int) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
 	if start < 0 || length < 0 {
 		return nil, fmt.Errorf("read start and length must be non-negative")
 	}
-	if len(r.mirrors) == 0 {
-		return nil, fmt.Errorf("no mirror pairs in RAID10 array to read from")
-	}
 	if r.stripeSz <= 0 {
 		return nil, fmt.Errorf("stripe size must be greater than 0")
 	}
 
-	result := make([]byte, 0, length)
 	endLogicalOffset := start + length
 
-	// Determine the maximum logical stripe index that has ever been written across the array.
-	// This needs to check both disks in a mirror pair to find the true max written data.
-	maxWrittenLogicalStripeIdx := -1
-	if len(r.mirrors) > 0 {
-		for mirrorIdx, mirror := range r.mirrors {
-			// Find the maximum number of chunks written to *either* disk in this mirror pair.
-			// This accounts for one disk in the pair failing, but the other still holding the data.
-			chunksInThisPair := 0
-			for _, disk := range mirror {
-				if len(disk.Data) > chunksInThisPair {
-					chunksInThisPair = len(disk.Data)
-				}
-			}
+	// Reads are bounded by the furthest byte ever written to the array
+	maxWrittenLogicalOffset := r.HighWaterMark()
 
-			if chunksInThisPair > 0 {
-				// The absolute stripe index of the *last* stripe written to this mirror pair
-				// is (chunksInThisPair - 1).
-				// Its logical position in the overall array is then calculated based on its mirrorIdx.
-				logicalStripeIndexOfLastChunkInPair := (chunksInThisPair-1)*len(r.mirrors) + mirrorIdx
-				maxWrittenLogicalStripeIdx = max(maxWrittenLogicalStripeIdx, logicalStripeIndexOfLastChunkInPair)
-			}
-		}
-	}
-
-	maxWrittenLogicalOffset := -1
-	if maxWrittenLogicalStripeIdx != -1 {
-		maxWrittenLogicalOffset = (maxWrittenLogicalStripeIdx + 1) * r.stripeSz
-	}
-
-	if maxWrittenLogicalOffset == -1 || start >= maxWrittenLogicalOffset {
+	if start >= maxWrittenLogicalOffset {
 		if start > maxWrittenLogicalOffset {
 			return nil, fmt.Errorf("read start offset %d is beyond total data stored %d", start, maxWrittenLogicalOffset)
 		}
@@ -146,7 +289,7 @@ func (r *RAID10Controller) Read(start, length int) ([]byte, error) {
 	}
 
 	if endLogicalOffset > maxWrittenLogicalOffset {
-		logrus.Warnf("[RAID10] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
+		r.log().Warnf("[RAID10] Read request for %d bytes starting at %d exceeds total data stored %d. Truncating read length to %d.",
 			length, start, maxWrittenLogicalOffset, maxWrittenLogicalOffset-start)
 		endLogicalOffset = maxWrittenLogicalOffset
 		length = endLogicalOffset - start
@@ -155,72 +298,188 @@ func (r *RAID10Controller) Read(start, length int) ([]byte, error) {
 		return []byte{}, nil
 	}
 
-	currentLogicalReadOffset := start
-
-	for currentLogicalReadOffset < endLogicalOffset {
-		currentAbsoluteStripeIdx := currentLogicalReadOffset / r.stripeSz
-		mirrorIndex := currentAbsoluteStripeIdx % len(r.mirrors)
-		chunkIndexInMirrorPair := currentAbsoluteStripeIdx / len(r.mirrors)
-
-		currentMirror := r.mirrors[mirrorIndex]
-		var sourceChunk []byte // The chunk to read from
-		foundHealthyDisk := false
+	segments := splitIntoChunks(start, length, r.stripeSz)
+	unlock := r.stripes.lockRange(segments[0].stripeIdx, segments[len(segments)-1].stripeIdx, true)
+	defer unlock()
 
-		// Try to read from any healthy disk in the mirror pair
-		for _, disk := range currentMirror {
-			if chunkIndexInMirrorPair < len(disk.Data) && disk.Data[chunkIndexInMirrorPair] != nil && len(disk.Data[chunkIndexInMirrorPair]) > 0 {
-				sourceChunk = disk.Data[chunkIndexInMirrorPair]
-				foundHealthyDisk = true
-				break
-			}
+	result := make([]byte, length)
+	err := forEachParallel(len(segments), func(i int) error {
+		segment := segments[i]
+		sourceChunk, foundHealthyDisk := r.balancer.read(r.log(), "RAID10", r.placement(segment.stripeIdx))
+		if !foundHealthyDisk {
+			return fmt.Errorf("missing stripe data at stripe %d (logical offset %d). Every disk holding one of its %d copies might have failed", segment.stripeIdx, start+segment.dataOffset, r.copies)
 		}
+		copy(result[segment.dataOffset:segment.dataOffset+segment.length], sourceChunk[segment.offsetInChunk:])
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
-		if !foundHealthyDisk {
-			return nil, fmt.Errorf("missing stripe data at mirror pair %d, chunk %d. Both disks in mirror pair might have failed for stripe %d (logical offset %d)", mirrorIndex, chunkIndexInMirrorPair, currentAbsoluteStripeIdx, currentLogicalReadOffset)
+// find returns the position of the disk with the given ID.
+func (r *RAID10Controller) find(index int) (int, error) {
+	for d, disk := range r.disks {
+		if disk.ID == index {
+			return d, nil
 		}
+	}
+	return 0, fmt.Errorf("disk %d not found in RAID10 array", index)
+}
 
-		offsetInChunk := currentLogicalReadOffset % r.stripeSz
+// ClearDisk simulates a disk failure for a specific disk in the RAID10 array.
+func (r *RAID10Controller) ClearDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		bytesToRead := r.stripeSz - offsetInChunk
-		if bytesToRead > (endLogicalOffset - currentLogicalReadOffset) {
-			bytesToRead = endLogicalOffset - currentLogicalReadOffset
-		}
+	d, err := r.find(index)
+	if err != nil {
+		return err
+	}
+	if err := r.disks[d].reset(DiskStateFailed); err != nil { // Clear the data to simulate failure
+		return err
+	}
+	r.log().Infof("[RAID10] Disk %d has been cleared (simulating failure).", index)
+	return nil
+}
+
+func (r *RAID10Controller) removeDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	d, err := r.find(index)
+	if err != nil {
+		return err
+	}
+	return markRemoved(r.disks[d])
+}
+
+// ReplaceDisk installs a blank disk in place of the disk with the given ID. The replacement
+// receives new writes but is not read from until it has been regenerated from the other copies.
+func (r *RAID10Controller) ReplaceDisk(index int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
-		if offsetInChunk+bytesToRead > len(sourceChunk) {
-			bytesToRead = len(sourceChunk) - offsetInChunk
-			if bytesToRead < 0 {
-				bytesToRead = 0
+	d, err := r.find(index)
+	if err != nil {
+		return err
+	}
+	if err := r.disks[d].reset(DiskStateRebuilding); err != nil {
+		return err
+	}
+	r.log().Infof("[RAID10] Disk %d has been replaced.", index)
+	return nil
+}
+
+// Rebuild regenerates a replaced disk chunk by chunk, copying each from another copy of the
+// same logical chunk, wherever the layout placed it.
+func (r *RAID10Controller) Rebuild(index int, progress ProgressFunc) error {
+	r.mu.Lock()
+	d, err := r.find(index)
+	r.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	target := r.disks[d]
+
+	rows := func() int {
+		total := 0
+		for _, disk := range r.disks {
+			if disk != target {
+				total = max(total, disk.ChunkCount())
 			}
 		}
-
-		if bytesToRead > 0 {
-			result = append(result, sourceChunk[offsetInChunk:offsetInChunk+bytesToRead]...)
+		return total
+	}
+	copiesOf := func(chunkIdx int) []chunkAddr {
+		stripeIdx, ok := r.stripeAt(d, chunkIdx)
+		if !ok {
+			return nil
 		}
-		currentLogicalReadOffset += bytesToRead
+		var others []chunkAddr
+		for _, c := range r.placement(stripeIdx) {
+			if c.disk != target {
+				others = append(others, c)
+			}
+		}
+		return others
 	}
-	return result, nil
+	return rebuildFromCopies(&r.mu, r.log(), "RAID10", target, rows, copiesOf, progress)
 }
 
-// ClearDisk simulates a disk failure for a specific disk in the RAID10 array.
-func (r *RAID10Controller) ClearDisk(index int) error {
-	found := false
-	for _, mirror := range r.mirrors {
-		for _, disk := range mirror {
-			if disk.ID == index {
-				disk.Data = [][]byte{} // Clear the data to simulate failure
-				found = true
-				logrus.Infof("[RAID10] Disk %d has been cleared (simulating failure).", index)
-				break
-			}
+// Status reports the array state. RAID10 fails as soon as every disk holding the copies of some
+// chunk is lost, and its remaining fault tolerance is bounded by the weakest such set of disks.
+func (r *RAID10Controller) Status() ArrayStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	state := ArrayStateOptimal
+	tolerance := -1
+	for _, set := range r.copySets() {
+		setState, setTolerance := toleranceState(countUnavailable(set), len(set)-1)
+		if setState == ArrayStateFailed {
+			state = ArrayStateFailed
+		} else if setState == ArrayStateDegraded && state == ArrayStateOptimal {
+			state = ArrayStateDegraded
 		}
-		if found {
-			break
+		if tolerance == -1 || setTolerance < tolerance {
+			tolerance = setTolerance
 		}
 	}
-	if !found {
-		return fmt.Errorf("disk %d not found in RAID10 array", index)
+	return ArrayStatus{
+		Type:           RaidTypeRaid10,
+		State:          state,
+		StripeSz:       r.stripeSz,
+		Copies:         r.copies,
+		MirrorLayout:   r.layout,
+		ReadPolicy:     r.balancer.policy,
+		FaultTolerance: max(tolerance, 0),
+		Capacity:       r.capacity(),
+		HighWaterMark:  r.HighWaterMark(),
+		Disks:          diskStatuses(r.disks),
+	}
+}
+
+// Capacity returns the size of all disks divided by the number of copies of every chunk.
+func (r *RAID10Controller) Capacity() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.capacity()
+}
+
+func (r *RAID10Controller) capacity() int {
+	chunkLimit := diskChunkLimit(r.disks)
+	if chunkLimit == 0 {
+		return r.allocated()
+	}
+	if r.layout == MirrorLayoutNear {
+		return chunkLimit * len(r.disks) / r.copies * r.stripeSz
+	}
+	// Far sections and offset row groups only use whole multiples of the copy count
+	return chunkLimit / r.copies * len(r.disks) * r.stripeSz
+}
+
+// allocated returns the logical bytes covered by the stripes allocated on the disks so far.
+func (r *RAID10Controller) allocated() int {
+	maxChunks := 0
+	for _, disk := range r.disks {
+		maxChunks = max(maxChunks, disk.ChunkCount())
+	}
+	switch r.layout {
+	case MirrorLayoutFar:
+		// The copies in later sections sit a section further than the first copy of the same row
+		rows := min(maxChunks, r.sectionChunks())
+		for c := 1; c < r.copies; c++ {
+			rows = max(rows, min(maxChunks-c*r.sectionChunks(), r.sectionChunks()))
+		}
+		return rows * len(r.disks) * r.stripeSz
+	case MirrorLayoutOffset:
+		return (maxChunks + r.copies - 1) / r.copies * len(r.disks) * r.stripeSz
+	default:
+		return (maxChunks*len(r.disks) + r.copies - 1) / r.copies * r.stripeSz
 	}
-	return nil
 }
 
 // Raid10SimulationFlow is a helper function to simulate a write, clear, and read cycle for RAID10.
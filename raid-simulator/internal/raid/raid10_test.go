@@ -42,3 +42,71 @@ func TestRAID10_ReadAfterDiskClear(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, data, read)
 }
+
+func TestRAID10_TripleMirrors(t *testing.T) {
+	r, err := raid.NewRAID10ControllerWithCopies(6, 2, 3) // 2 mirrors, each with 3 disks
+	assert.NoError(t, err)
+	status := r.Status()
+	assert.Equal(t, 3, status.Copies)
+	assert.Equal(t, raid.MirrorLayoutNear, status.MirrorLayout)
+	assert.Equal(t, 2, status.FaultTolerance)
+
+	data := []byte("ThreeCopiesOfEveryChunk")
+	assert.NoError(t, r.Write(data, 0))
+
+	// Two disks of the first mirror and one of the second
+	for _, failed := range []int{0, 1, 4} {
+		assert.NoError(t, r.ClearDisk(failed))
+	}
+	status = r.Status()
+	assert.Equal(t, raid.ArrayStateDegraded, status.State)
+	assert.Zero(t, status.FaultTolerance)
+	read, err := r.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	for _, failed := range []int{0, 1} {
+		assert.NoError(t, r.ReplaceDisk(failed))
+		assert.NoError(t, r.Rebuild(failed, nil))
+	}
+	assert.Equal(t, 1, r.Status().FaultTolerance)
+
+	assert.NoError(t, r.ClearDisk(2))
+	assert.NoError(t, r.ClearDisk(1))
+	read, err = r.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	assert.NoError(t, r.ClearDisk(0))
+	assert.Equal(t, raid.ArrayStateFailed, r.Status().State)
+	_, err = r.Read(0, len(data))
+	assert.Error(t, err)
+}
+
+func TestRAID10_OddDiskCount(t *testing.T) {
+	// As in Linux md, the near layout places copies on consecutive disks even when they do not pair up
+	r, err := raid.NewRAID10Controller(3, 2)
+	assert.NoError(t, err)
+	data := []byte("ThreeDisksTwoCopiesEach")
+	assert.NoError(t, r.Write(data, 0))
+
+	for failed := 0; failed < 3; failed++ {
+		assert.NoError(t, r.ClearDisk(failed))
+		read, err := r.Read(0, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, read)
+
+		assert.NoError(t, r.ReplaceDisk(failed))
+		assert.NoError(t, r.Rebuild(failed, nil))
+		assert.Equal(t, raid.ArrayStateOptimal, r.Status().State)
+	}
+
+	controller, err := raid.NewSizedController(raid.RaidTypeRaid10, 3, 2, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, 3*16/2, controller.Capacity())
+
+	_, err = raid.NewRAID10Controller(2, 2)
+	assert.Error(t, err)
+	_, err = raid.NewRAID10ControllerWithCopies(3, 2, 3)
+	assert.Error(t, err)
+}
@@ -59,3 +59,58 @@ func TestRAID1_PartialRead(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("RAID1"), read)
 }
+
+func TestRAID1_ThreeWayMirrorSurvivesTwoFailures(t *testing.T) {
+	r, err := raid.NewRAID1Controller(3, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, r.Status().FaultTolerance)
+
+	data := []byte("TripleMirrorDurability")
+	assert.NoError(t, r.Write(data, 0))
+	assert.NoError(t, r.ClearDisk(0))
+	assert.NoError(t, r.ClearDisk(2))
+	status := r.Status()
+	assert.Equal(t, raid.ArrayStateDegraded, status.State)
+	assert.Zero(t, status.FaultTolerance)
+
+	read, err := r.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+
+	assert.NoError(t, r.ReplaceDisk(0))
+	assert.NoError(t, r.Rebuild(0, nil))
+	assert.Equal(t, 1, r.Status().FaultTolerance)
+	assert.NoError(t, r.ClearDisk(1))
+	read, err = r.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+}
+
+func TestRAID1_ReadPolicies(t *testing.T) {
+	for _, policy := range raid.ReadPolicies() {
+		t.Run(string(policy), func(t *testing.T) {
+			r, err := raid.NewRAID1ControllerWithPolicy(3, 2, policy)
+			assert.NoError(t, err)
+			assert.Equal(t, policy, r.Status().ReadPolicy)
+
+			data := []byte("EveryMirrorServesTheSameBytes")
+			assert.NoError(t, r.Write(data, 0))
+			for i := 0; i < 3; i++ {
+				read, err := r.Read(0, len(data))
+				assert.NoError(t, err)
+				assert.Equal(t, data, read)
+			}
+
+			// Whichever mirror the policy prefers, a failed one is skipped
+			assert.NoError(t, r.ClearDisk(1))
+			for i := 0; i < 3; i++ {
+				read, err := r.Read(0, len(data))
+				assert.NoError(t, err)
+				assert.Equal(t, data, read)
+			}
+		})
+	}
+
+	_, err := raid.NewRAID1ControllerWithPolicy(2, 2, "fastest")
+	assert.Error(t, err)
+}
@@ -0,0 +1,30 @@
+package raid
+
+// RAID4Controller implements the RAIDController interface for RAID 4: striping with a
+// single parity shard kept on a dedicated disk.
+type RAID4Controller struct {
+	*parityArray
+}
+
+// NewRAID4Controller creates and initializes a new RAID4Controller.
+// It requires at least 3 disks (2 data + 1 parity); the last disk holds the parity.
+func NewRAID4Controller(diskCount, stripeSz int) (*RAID4Controller, error) {
+	return newRAID4Controller(newDisks(diskCount, stripeSz), stripeSz)
+}
+
+func newRAID4Controller(disks []*Disk, stripeSz int) (*RAID4Controller, error) {
+	array, err := newParityArray(RaidTypeRaid4, "RAID4", disks, stripeSz, 1, raid4Placement)
+	if err != nil {
+		return nil, err
+	}
+	return &RAID4Controller{parityArray: array}, nil
+}
+
+// raid4Placement keeps the data shards on the first disks and the parity on the last disk of every stripe.
+func raid4Placement(stripeIdx, numDisks, numParityShards int) []int {
+	placement := make([]int, numDisks)
+	for d := range placement {
+		placement[d] = d
+	}
+	return placement
+}
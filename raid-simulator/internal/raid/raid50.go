@@ -0,0 +1,42 @@
+package raid
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// RAID50Controller implements the RAIDController interface for RAID 50: data striped across
+// several RAID5 groups, each surviving one failed disk of its own.
+type RAID50Controller struct {
+	*parityGroups
+}
+
+// NewRAID50Controller creates a RAID50Controller splitting diskCount disks into groupCount RAID5
+// groups (DefaultParityGroups when 0) with the default parity layout. Every group needs at least 3 disks.
+func NewRAID50Controller(diskCount, groupCount, stripeSz int) (*RAID50Controller, error) {
+	return newRAID50Controller(newDisks(diskCount, stripeSz), stripeSz, groupCount, DefaultParityLayout)
+}
+
+func newRAID50Controller(disks []*Disk, stripeSz, groupCount int, layout ParityLayout) (*RAID50Controller, error) {
+	if layout == "" {
+		layout = DefaultParityLayout
+	}
+	placement, err := raid5Placement(layout)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := newParityGroups(RaidTypeRaid50, "RAID50", disks, stripeSz, groupCount, 1, placement, layout)
+	if err != nil {
+		return nil, err
+	}
+	return &RAID50Controller{parityGroups: groups}, nil
+}
+
+// Raid50SimulationFlow simulates a write, clear, and read cycle for RAID50 with the default number of groups.
+func Raid50SimulationFlow(input string, diskCount int, stripeSz int, clearTargets []int) {
+	controller, err := NewRAID50Controller(diskCount, 0, stripeSz)
+	if err != nil {
+		logrus.Errorf("[RAID50] Init Raid50 controller failed: %v", err)
+		return // Exit if controller initialization fails
+	}
+	parityGroupsSimulationFlow("RAID50", controller.parityGroups, input, clearTargets)
+}
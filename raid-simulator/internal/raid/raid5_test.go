@@ -25,7 +25,7 @@ func TestNewRAID5Controller(t *testing.T) {
 		assert.Equal(t, 4, controller.stripeSz)
 		for i, disk := range controller.disks {
 			assert.Equal(t, i, disk.ID)
-			assert.Empty(t, disk.Data)
+			assert.Zero(t, disk.ChunkCount())
 		}
 	})
 
@@ -66,9 +66,9 @@ func TestRAID5_Write_FullStripes(t *testing.T) {
 		assert.Equal(t, data, readData, "Read data should be consistent with original data")
 
 		// Verify the length of each disk, no longer checking specific content
-		assert.Equal(t, 4, len(controller.disks[0].Data), "Disk 0 should have 4 stripes")
-		assert.Equal(t, 4, len(controller.disks[1].Data), "Disk 1 should have 4 stripes")
-		assert.Equal(t, 4, len(controller.disks[2].Data), "Disk 2 should have 4 stripes")
+		assert.Equal(t, 4, controller.disks[0].ChunkCount(), "Disk 0 should have 4 stripes")
+		assert.Equal(t, 4, controller.disks[1].ChunkCount(), "Disk 1 should have 4 stripes")
+		assert.Equal(t, 4, controller.disks[2].ChunkCount(), "Disk 2 should have 4 stripes")
 	})
 
 	t.Run("4Disks_StripeSz2_12Bytes", func(t *testing.T) {
@@ -85,10 +85,10 @@ func TestRAID5_Write_FullStripes(t *testing.T) {
 		assert.Equal(t, data, readData, "Read data should be consistent with original data")
 
 		// Verify the length of each disk, no longer checking specific content
-		assert.Equal(t, 2, len(controller.disks[0].Data), "Disk 0 should have 2 stripes")
-		assert.Equal(t, 2, len(controller.disks[1].Data), "Disk 1 should have 2 stripes")
-		assert.Equal(t, 2, len(controller.disks[2].Data), "Disk 2 should have 2 stripes")
-		assert.Equal(t, 2, len(controller.disks[3].Data), "Disk 3 should have 2 stripes")
+		assert.Equal(t, 2, controller.disks[0].ChunkCount(), "Disk 0 should have 2 stripes")
+		assert.Equal(t, 2, controller.disks[1].ChunkCount(), "Disk 1 should have 2 stripes")
+		assert.Equal(t, 2, controller.disks[2].ChunkCount(), "Disk 2 should have 2 stripes")
+		assert.Equal(t, 2, controller.disks[3].ChunkCount(), "Disk 3 should have 2 stripes")
 	})
 }
 
@@ -106,9 +106,9 @@ func TestRAID5_Write_PartialStripe_RMW(t *testing.T) {
 		assert.Nil(t, err, "Should not have an error when reading data")
 		assert.Equal(t, data, readData, "Read data should be consistent with original data")
 
-		assert.Equal(t, 1, len(controller.disks[0].Data))
-		assert.Equal(t, 1, len(controller.disks[1].Data))
-		assert.Equal(t, 1, len(controller.disks[2].Data))
+		assert.Equal(t, 1, controller.disks[0].ChunkCount())
+		assert.Equal(t, 1, controller.disks[1].ChunkCount())
+		assert.Equal(t, 1, controller.disks[2].ChunkCount())
 	})
 
 	t.Run("AppendPartialWrite_1Byte", func(t *testing.T) {
@@ -118,7 +118,7 @@ func TestRAID5_Write_PartialStripe_RMW(t *testing.T) {
 		dataInitial := []byte("ABCDEF") // 6 bytes
 		err = controller.Write(dataInitial, 0)
 		assert.Nil(t, err)
-		assert.Equal(t, 3, len(controller.disks[0].Data))
+		assert.Equal(t, 3, controller.disks[0].ChunkCount())
 
 		dataAppend := []byte("G") // 1 bytes, partial stripe
 		err = controller.Write(dataAppend, 6)
@@ -130,9 +130,9 @@ func TestRAID5_Write_PartialStripe_RMW(t *testing.T) {
 		assert.Nil(t, err, "Should not have an error when reading data")
 		assert.Equal(t, expectedData, readData, "Read data should be consistent with original data")
 
-		assert.Equal(t, 4, len(controller.disks[0].Data))
-		assert.Equal(t, 4, len(controller.disks[1].Data))
-		assert.Equal(t, 4, len(controller.disks[2].Data))
+		assert.Equal(t, 4, controller.disks[0].ChunkCount())
+		assert.Equal(t, 4, controller.disks[1].ChunkCount())
+		assert.Equal(t, 4, controller.disks[2].ChunkCount())
 	})
 }
 
@@ -212,9 +212,9 @@ func TestRAID5_ClearDisk_Success(t *testing.T) {
 	t.Run("ClearDisk0", func(t *testing.T) {
 		err := controller.ClearDisk(0)
 		assert.Nil(t, err)
-		assert.Empty(t, controller.disks[0].Data)
-		assert.Equal(t, 4, len(controller.disks[1].Data))
-		assert.Equal(t, 4, len(controller.disks[2].Data))
+		assert.Zero(t, controller.disks[0].ChunkCount())
+		assert.Equal(t, 4, controller.disks[1].ChunkCount())
+		assert.Equal(t, 4, controller.disks[2].ChunkCount())
 	})
 
 	t.Run("ClearNonExistentDisk", func(t *testing.T) {
@@ -298,3 +298,49 @@ func TestRAID5_Read_MultipleDiskFailures(t *testing.T) {
 		assert.Empty(t, readData)
 	})
 }
+
+func TestRAID5_LayoutPlacement(t *testing.T) {
+	// Shard placements of the first four stripes on 4 disks: data shards first, then the parity
+	cases := map[ParityLayout][][]int{
+		LayoutLeftAsymmetric:  {{0, 1, 2, 3}, {0, 1, 3, 2}, {0, 2, 3, 1}, {1, 2, 3, 0}},
+		LayoutLeftSymmetric:   {{0, 1, 2, 3}, {3, 0, 1, 2}, {2, 3, 0, 1}, {1, 2, 3, 0}},
+		LayoutRightAsymmetric: {{1, 2, 3, 0}, {0, 2, 3, 1}, {0, 1, 3, 2}, {0, 1, 2, 3}},
+		LayoutRightSymmetric:  {{1, 2, 3, 0}, {2, 3, 0, 1}, {3, 0, 1, 2}, {0, 1, 2, 3}},
+	}
+
+	for layout, expected := range cases {
+		t.Run(string(layout), func(t *testing.T) {
+			controller, err := NewRAID5ControllerWithLayout(4, 2, layout)
+			assert.NoError(t, err)
+			for stripe, placement := range expected {
+				assert.Equal(t, placement, controller.placement(stripe, 4, 1), "stripe %d", stripe)
+			}
+			assert.Equal(t, expected[0], controller.placement(4, 4, 1), "placement repeats every numDisks stripes")
+		})
+	}
+
+	_, err := NewRAID5ControllerWithLayout(4, 2, "diagonal")
+	assert.Error(t, err)
+}
+
+func TestRAID4_ParityOnLastDisk(t *testing.T) {
+	controller, err := NewRAID4Controller(4, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("ABCDEFGHIJKL"), 0))
+
+	// Stripe 0 holds AB CD EF, stripe 1 holds GH IJ KL; the parity of both is on disk 3
+	for stripe, data := range []string{"ABCDEF", "GHIJKL"} {
+		for d := 0; d < 3; d++ {
+			chunk, err := controller.disks[d].ReadChunk(stripe)
+			assert.NoError(t, err)
+			assert.Equal(t, []byte(data[2*d:2*d+2]), chunk)
+		}
+		parity, err := controller.disks[3].ReadChunk(stripe)
+		assert.NoError(t, err)
+		expected := make([]byte, 2)
+		for i := range expected {
+			expected[i] = data[i] ^ data[2+i] ^ data[4+i]
+		}
+		assert.Equal(t, expected, parity)
+	}
+}
@@ -0,0 +1,35 @@
+package raid
+
+import (
+	"github.com/sirupsen/logrus"
+)
+
+// RAID60Controller implements the RAIDController interface for RAID 60: data striped across
+// several RAID6 groups, each surviving two failed disks of its own.
+type RAID60Controller struct {
+	*parityGroups
+}
+
+// NewRAID60Controller creates a RAID60Controller splitting diskCount disks into groupCount RAID6
+// groups (DefaultParityGroups when 0). Every group needs at least 4 disks.
+func NewRAID60Controller(diskCount, groupCount, stripeSz int) (*RAID60Controller, error) {
+	return newRAID60Controller(newDisks(diskCount, stripeSz), stripeSz, groupCount)
+}
+
+func newRAID60Controller(disks []*Disk, stripeSz, groupCount int) (*RAID60Controller, error) {
+	groups, err := newParityGroups(RaidTypeRaid60, "RAID60", disks, stripeSz, groupCount, 2, raid6Placement, "")
+	if err != nil {
+		return nil, err
+	}
+	return &RAID60Controller{parityGroups: groups}, nil
+}
+
+// Raid60SimulationFlow simulates a write, clear, and read cycle for RAID60 with the default number of groups.
+func Raid60SimulationFlow(input string, diskCount int, stripeSz int, clearTargets []int) {
+	controller, err := NewRAID60Controller(diskCount, 0, stripeSz)
+	if err != nil {
+		logrus.Errorf("[RAID60] Init Raid60 controller failed: %v", err)
+		return // Exit if controller initialization fails
+	}
+	parityGroupsSimulationFlow("RAID60", controller.parityGroups, input, clearTargets)
+}
@@ -18,7 +18,7 @@ func TestNewRAID6Controller(t *testing.T) {
 		assert.Equal(t, 4, controller.stripeSz, "Stripe size should be 4")       // Accessing unexported field 'stripeSz'
 		for i, disk := range controller.disks {                                  // Accessing unexported field 'disks'
 			assert.Equal(t, i, disk.ID, fmt.Sprintf("Disk %d ID should be %d", i, i))
-			assert.Empty(t, disk.Data, fmt.Sprintf("Disk %d data should be empty initially", i))
+			assert.Zero(t, disk.ChunkCount(), fmt.Sprintf("Disk %d data should be empty initially", i))
 		}
 	})
 
@@ -113,10 +113,10 @@ func TestRAID6_ClearDisk_Success(t *testing.T) {
 	t.Run("ClearDisk0", func(t *testing.T) {
 		err := controller.ClearDisk(0)
 		assert.Nil(t, err, "Clearing disk 0 should not have an error")
-		assert.Empty(t, controller.disks[0].Data, "Disk 0's data should be empty after clearing")         // Accessing unexported field 'disks'
-		assert.Equal(t, 4, len(controller.disks[1].Data), "Disk 1's block count should remain unchanged") // Accessing unexported field 'disks'
-		assert.Equal(t, 4, len(controller.disks[2].Data), "Disk 2's block count should remain unchanged") // Accessing unexported field 'disks'
-		assert.Equal(t, 4, len(controller.disks[3].Data), "Disk 3's block count should remain unchanged") // Accessing unexported field 'disks'
+		assert.Zero(t, controller.disks[0].ChunkCount(), "Disk 0's data should be empty after clearing")     // Accessing unexported field 'disks'
+		assert.Equal(t, 4, controller.disks[1].ChunkCount(), "Disk 1's block count should remain unchanged") // Accessing unexported field 'disks'
+		assert.Equal(t, 4, controller.disks[2].ChunkCount(), "Disk 2's block count should remain unchanged") // Accessing unexported field 'disks'
+		assert.Equal(t, 4, controller.disks[3].ChunkCount(), "Disk 3's block count should remain unchanged") // Accessing unexported field 'disks'
 	})
 
 	t.Run("ClearNonExistentDisk", func(t *testing.T) {
@@ -0,0 +1,105 @@
+package raid
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// checkRebuildable verifies that disk is a replacement waiting to be rebuilt.
+func checkRebuildable(disk *Disk) error {
+	switch disk.State {
+	case DiskStateRebuilding:
+		return nil
+	case DiskStateFailed, DiskStateRemoved:
+		return fmt.Errorf("disk %d has failed, replace it before rebuilding", disk.ID)
+	default:
+		return fmt.Errorf("disk %d is %s, nothing to rebuild", disk.ID, disk.State)
+	}
+}
+
+// rebuildFromMirrors copies every chunk onto target from another disk in its mirror set, every
+// disk of which holds chunk i at index i.
+func rebuildFromMirrors(mu *sync.RWMutex, log logrus.FieldLogger, name string, mirror []*Disk, target *Disk, progress ProgressFunc) error {
+	rows := func() int {
+		total := 0
+		for _, disk := range mirror {
+			if disk != target {
+				total = max(total, disk.ChunkCount())
+			}
+		}
+		return total
+	}
+	copiesOf := func(index int) []chunkAddr {
+		var copies []chunkAddr
+		for _, disk := range mirror {
+			if disk != target {
+				copies = append(copies, chunkAddr{disk: disk, index: index})
+			}
+		}
+		return copies
+	}
+	return rebuildFromCopies(mu, log, name, target, rows, copiesOf, progress)
+}
+
+// rebuildFromCopies regenerates the first rows() chunks of target, copying chunk i from one of
+// the other copies returned by copiesOf(i). Chunks with no other copy hold no data and are skipped,
+// as are chunks that are holes on every other copy: they stay holes on target too.
+// The controller lock is taken per chunk so reads and writes interleave with the rebuild.
+func rebuildFromCopies(mu *sync.RWMutex, log logrus.FieldLogger, name string, target *Disk, rows func() int, copiesOf func(index int) []chunkAddr, progress ProgressFunc) error {
+	mu.Lock()
+	if err := checkRebuildable(target); err != nil {
+		mu.Unlock()
+		return err
+	}
+	mu.Unlock()
+
+	for chunkIdx := 0; ; chunkIdx++ {
+		mu.Lock()
+		if target.State != DiskStateRebuilding {
+			mu.Unlock()
+			return fmt.Errorf("%s: rebuild of disk %d interrupted, disk is now %s", name, target.ID, target.State)
+		}
+		total := rows()
+		if chunkIdx >= total {
+			target.State = DiskStateOnline
+			target.rebuilt = 0
+			mu.Unlock()
+			log.Infof("[%s] Disk %d rebuilt (%d chunks).", name, target.ID, total)
+			return nil
+		}
+
+		if copies := copiesOf(chunkIdx); slices.ContainsFunc(copies, chunkAddr.allocated) {
+			var sourceChunk []byte
+			for _, c := range copies {
+				if !c.disk.canServe(c.index) {
+					continue
+				}
+				chunk, err := c.disk.readChunkOrZeros(c.index)
+				if err != nil {
+					log.Debugf("[%s] Disk %d could not serve chunk %d: %v", name, c.disk.ID, c.index, err)
+					continue
+				}
+				sourceChunk = chunk
+				break
+			}
+			if sourceChunk == nil {
+				mu.Unlock()
+				return fmt.Errorf("%s: no healthy mirror holds chunk %d to rebuild disk %d from", name, chunkIdx, target.ID)
+			}
+			if err := target.WriteChunk(chunkIdx, sourceChunk); err != nil {
+				mu.Unlock()
+				return fmt.Errorf("%s: failed to write rebuilt chunk %d to disk %d: %w", name, chunkIdx, target.ID, err)
+			}
+		}
+		target.rebuilt = chunkIdx + 1
+		mu.Unlock()
+
+		log.Debugf("[%s] Rebuilt chunk %d/%d of disk %d.", name, chunkIdx+1, total, target.ID)
+		if progress != nil {
+			progress(chunkIdx+1, total)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package raid_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRebuild_RestoresRedundancy(t *testing.T) {
+	cases := []struct {
+		raidType  raid.RaidType
+		diskCount int
+		target    int
+		// disk that fails after the rebuild, which the array only survives if the rebuilt disk is intact
+		nextFailures []int
+	}{
+		{raid.RaidTypeRaid1, 2, 0, []int{1}},
+		{raid.RaidTypeRaid10, 4, 2, []int{3}},
+		{raid.RaidTypeRaid5, 3, 1, []int{0}},
+		{raid.RaidTypeRaid6, 5, 4, []int{0, 2}},
+	}
+
+	for _, tc := range cases {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			controller, err := raid.NewController(tc.raidType, tc.diskCount, 2)
+			assert.NoError(t, err)
+
+			data := []byte("RebuildMeFromTheSurvivors")
+			assert.NoError(t, controller.Write(data, 0))
+			assert.NoError(t, controller.ClearDisk(tc.target))
+			assert.NoError(t, controller.ReplaceDisk(tc.target))
+
+			var progress [][2]int
+			err = controller.(raid.Rebuilder).Rebuild(tc.target, func(done, total int) {
+				progress = append(progress, [2]int{done, total})
+			})
+			assert.NoError(t, err)
+			assert.NotEmpty(t, progress)
+			last := progress[len(progress)-1]
+			assert.Equal(t, last[0], last[1])
+
+			status := controller.Status()
+			assert.Equal(t, raid.ArrayStateOptimal, status.State)
+			assert.Equal(t, raid.DiskStateOnline, status.Disks[tc.target].State)
+
+			for _, d := range tc.nextFailures {
+				assert.NoError(t, controller.ClearDisk(d))
+			}
+			read, err := controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, read)
+		})
+	}
+}
+
+func TestRebuild_ServesIOWhileRebuilding(t *testing.T) {
+	controller, err := raid.NewRAID5Controller(4, 2)
+	assert.NoError(t, err)
+
+	data := []byte("0123456789ABCDEFGHIJKLMNOPQRSTUV")
+	assert.NoError(t, controller.Write(data, 0))
+	assert.NoError(t, controller.ClearDisk(2))
+	assert.NoError(t, controller.ReplaceDisk(2))
+
+	// Each progress callback runs between rebuild steps, so I/O must be served there
+	err = controller.Rebuild(2, func(done, total int) {
+		read, err := controller.Read(0, len(data))
+		assert.NoError(t, err)
+		assert.Equal(t, data, read)
+
+		if done == 2 {
+			assert.NoError(t, controller.Write([]byte("xyz"), 20))
+			copy(data[20:], "xyz")
+		}
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, controller.ClearDisk(0))
+	read, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+}
+
+func TestRebuild_ConcurrentReaders(t *testing.T) {
+	controller, err := raid.NewRAID1Controller(3, 1)
+	assert.NoError(t, err)
+
+	data := []byte("ConcurrentReadersDuringRebuild")
+	assert.NoError(t, controller.Write(data, 0))
+	assert.NoError(t, controller.ClearDisk(1))
+	assert.NoError(t, controller.ReplaceDisk(1))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				read, err := controller.Read(0, len(data))
+				assert.NoError(t, err)
+				assert.Equal(t, data, read)
+			}
+		}()
+	}
+	assert.NoError(t, controller.Rebuild(1, nil))
+	wg.Wait()
+}
+
+func TestRebuild_InvalidTargets(t *testing.T) {
+	controller, err := raid.NewRAID6Controller(4, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("ABCDEFGH"), 0))
+
+	err = controller.Rebuild(0, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "nothing to rebuild")
+
+	assert.NoError(t, controller.ClearDisk(0))
+	err = controller.Rebuild(0, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "replace it before rebuilding")
+
+	err = controller.Rebuild(9, nil)
+	assert.Error(t, err)
+}
+
+func TestRebuild_TooManyFailures(t *testing.T) {
+	controller, err := raid.NewRAID5Controller(3, 1)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("ABCDEFGH"), 0))
+
+	assert.NoError(t, controller.ClearDisk(0))
+	assert.NoError(t, controller.ClearDisk(1))
+	assert.NoError(t, controller.ReplaceDisk(0))
+
+	err = controller.Rebuild(0, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "too many missing shards")
+	assert.Equal(t, raid.DiskStateRebuilding, controller.Status().Disks[0].State)
+}
+
+func TestArray_RebuildPersists(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("RebuiltOnDiskImages")
+
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid6, 4, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.ClearDisk(3))
+	assert.NoError(t, array.ReplaceDisk(3))
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.DiskStateRebuilding, array.Status().Disks[3].State)
+	assert.NoError(t, array.Rebuild(3, nil))
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, raid.ArrayStateOptimal, array.Status().State)
+
+	assert.NoError(t, array.ClearDisk(0))
+	assert.NoError(t, array.ClearDisk(1))
+	read, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, read)
+}
+
+func TestArray_RebuildRAID0Unsupported(t *testing.T) {
+	array, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid0, 2, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+
+	err = array.Rebuild(0, nil)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "no redundancy")
+}
@@ -0,0 +1,456 @@
+package raid
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	hoursPerYear = 24 * 365
+
+	// survivalSamples caps the disk sets tried per failure count by the survival analysis: counts
+	// with fewer combinations are enumerated exhaustively, the others sampled at random.
+	survivalSamples = 4096
+)
+
+// ReliabilityModel describes how the member disks of an array fail and are rebuilt, for estimating
+// how likely the array is to lose data.
+type ReliabilityModel struct {
+	AFR         float64 `json:"afr,omitempty"`        // annualized failure rate of every disk, from 0 to 1
+	MTBF        float64 `json:"mtbf_hours,omitempty"` // mean time between failures of every disk in hours, used when AFR is 0
+	DiskSize    float64 `json:"disk_size"`            // bytes rebuilt onto the replacement of a failed disk
+	RebuildRate float64 `json:"rebuild_rate"`         // bytes per second a replacement is rebuilt at
+	Mission     float64 `json:"mission_hours"`        // hours the array is meant to keep its data
+	Trials      int     `json:"trials"`               // Monte Carlo trials, 0 for the analytic estimate alone
+	Seed        int64   `json:"seed"`                 // seed of the simulated failures and sampled disk sets
+}
+
+// validate checks the model's parameters.
+func (m ReliabilityModel) validate() error {
+	switch {
+	case m.AFR < 0 || m.AFR >= 1:
+		return fmt.Errorf("annualized failure rate must be at least 0 and below 1. Provided: %g", m.AFR)
+	case m.AFR == 0 && m.MTBF <= 0:
+		return fmt.Errorf("either the annualized failure rate or the MTBF must be greater than 0")
+	case m.DiskSize <= 0:
+		return fmt.Errorf("disk size must be greater than 0. Provided: %g", m.DiskSize)
+	case m.RebuildRate <= 0:
+		return fmt.Errorf("rebuild rate must be greater than 0. Provided: %g", m.RebuildRate)
+	case m.Mission <= 0:
+		return fmt.Errorf("mission time must be greater than 0. Provided: %g", m.Mission)
+	case m.Trials < 0:
+		return fmt.Errorf("number of trials must be non-negative. Provided: %d", m.Trials)
+	}
+	return nil
+}
+
+// diskMTBF returns the mean time between failures of a disk in hours. An AFR is the probability
+// of failing within a year of exponentially distributed lifetimes.
+func (m ReliabilityModel) diskMTBF() float64 {
+	if m.AFR > 0 {
+		return hoursPerYear / -math.Log1p(-m.AFR)
+	}
+	return m.MTBF
+}
+
+// rebuildHours returns how long the replacement of a failed disk takes to rebuild.
+func (m ReliabilityModel) rebuildHours() float64 {
+	return m.DiskSize / m.RebuildRate / 3600
+}
+
+// ReliabilityEstimate is the mean time to data loss of an array and its probability of losing
+// data within the mission time.
+type ReliabilityEstimate struct {
+	MTTDL           float64 `json:"mttdl_hours"`      // mean time to data loss, 0 when no trial lost data
+	LossProbability float64 `json:"loss_probability"` // probability of losing data within the mission time
+	StdErr          float64 `json:"std_err,omitempty"`
+	Trials          int     `json:"trials,omitempty"`
+	Losses          int     `json:"losses,omitempty"` // trials that lost data within the mission time
+}
+
+// ReliabilityReport is the outcome of Reliability.
+type ReliabilityReport struct {
+	Type           RaidType             `json:"type"`
+	Disks          int                  `json:"disks"`
+	FaultTolerance int                  `json:"fault_tolerance"` // disk failures survived whichever disks fail
+	Survival       []float64            `json:"survival"`        // fraction of the sets of k failed disks survived, by k
+	Model          ReliabilityModel     `json:"model"`
+	DiskMTBF       float64              `json:"disk_mtbf_hours"`
+	RebuildHours   float64              `json:"rebuild_hours"`
+	Analytic       ReliabilityEstimate  `json:"analytic"`
+	MonteCarlo     *ReliabilityEstimate `json:"monte_carlo,omitempty"`
+}
+
+// Reliability estimates how likely an array of raidType over diskCount disks is to lose data when
+// its disks fail at random, each failed disk being replaced at once and rebuilt at the model's
+// rebuild rate. It asks the level itself which disk failures it survives: every failure count is
+// tried on a fresh controller over every set of disks that fails, or a random sample of them.
+//
+// The analytic estimate solves the Markov chain of the number of failed disks, whose failures
+// bring the array down in the proportion of disk sets it does not survive, assuming exponentially
+// distributed rebuild times as the classic MTTDL formulas do. The Monte Carlo estimate replays
+// random failures and rebuilds of fixed duration on the level's controller until it fails or the
+// mission ends, and counts the hours the trials ran per data loss.
+//
+// The controllers log the simulated failures and rebuilds through opts.Logger; without one they
+// are not logged at all.
+func Reliability(raidType RaidType, diskCount int, opts ControllerOptions, model ReliabilityModel) (ReliabilityReport, error) {
+	report := ReliabilityReport{Type: raidType, Disks: diskCount, Model: model}
+	if err := model.validate(); err != nil {
+		return report, err
+	}
+	if opts.Logger == nil {
+		quiet := logrus.New()
+		quiet.SetOutput(io.Discard)
+		quiet.SetLevel(logrus.PanicLevel)
+		opts.Logger = quiet
+	}
+	newController := func() (RAIDController, error) {
+		return NewControllerWithOptions(raidType, newDisks(diskCount, 1), 1, opts)
+	}
+	controller, err := newController()
+	if err != nil {
+		return report, err
+	}
+	report.FaultTolerance = controller.Status().FaultTolerance
+	rng := rand.New(rand.NewSource(model.Seed))
+	if report.Survival, err = survival(newController, diskCount, rng); err != nil {
+		return report, err
+	}
+	report.DiskMTBF, report.RebuildHours = model.diskMTBF(), model.rebuildHours()
+	report.Analytic = analyticReliability(report.Survival, 1/report.DiskMTBF, 1/report.RebuildHours, model.Mission)
+	if model.Trials > 0 {
+		estimate, err := simulateReliability(newController, diskCount, report.DiskMTBF, report.RebuildHours, model, rng)
+		if err != nil {
+			return report, err
+		}
+		report.MonteCarlo = &estimate
+	}
+	return report, nil
+}
+
+// survival returns, for every count k of failed disks, the fraction of the sets of k disks whose
+// failure the controllers built by newController survive. Counts with at most survivalSamples sets
+// are enumerated, the others sampled with rng. A count no set survives ends the search, as more
+// failures cannot help.
+func survival(newController func() (RAIDController, error), diskCount int, rng *rand.Rand) ([]float64, error) {
+	fractions := make([]float64, diskCount+1)
+	fractions[0] = 1
+	for k := 1; k <= diskCount; k++ {
+		var sets [][]int
+		if binomial(diskCount, k) <= survivalSamples {
+			sets = combinations(diskCount, k)
+		} else {
+			for range survivalSamples {
+				sets = append(sets, rng.Perm(diskCount)[:k])
+			}
+		}
+		survived := 0
+		for _, set := range sets {
+			controller, err := newController()
+			if err != nil {
+				return nil, err
+			}
+			for _, d := range set {
+				if err := controller.ClearDisk(d); err != nil {
+					return nil, err
+				}
+			}
+			if controller.Status().State != ArrayStateFailed {
+				survived++
+			}
+		}
+		if fractions[k] = float64(survived) / float64(len(sets)); survived == 0 {
+			break
+		}
+	}
+	return fractions, nil
+}
+
+// binomial returns the number of sets of k out of n, saturating well above survivalSamples.
+func binomial(n, k int) int {
+	result := 1
+	for i := 1; i <= k; i++ {
+		result = result * (n - k + i) / i
+		if result > math.MaxInt32 {
+			return math.MaxInt32
+		}
+	}
+	return result
+}
+
+// combinations lists every set of k out of n indexes, in lexicographic order.
+func combinations(n, k int) [][]int {
+	var sets [][]int
+	set := make([]int, k)
+	var walk func(next, at int)
+	walk = func(next, at int) {
+		if at == k {
+			sets = append(sets, append([]int(nil), set...))
+			return
+		}
+		for i := next; i <= n-(k-at); i++ {
+			set[at] = i
+			walk(i+1, at+1)
+		}
+	}
+	walk(0, 0)
+	return sets
+}
+
+// analyticReliability solves the Markov chain whose state k counts the failed disks of an array
+// that survives the fractions of failed disk sets given by survival. In state k the n-k working
+// disks fail at rate lambda each, leading to state k+1 in the proportion of the surviving sets of
+// k failed disks that survive one more failure, and to data loss otherwise; the k failed disks are
+// rebuilt at rate mu each.
+func analyticReliability(survival []float64, lambda, mu, mission float64) ReliabilityEstimate {
+	n := len(survival) - 1
+	states := 0 // states the array survives, 0 to states-1; state "states" is data loss
+	for states <= n && survival[states] > 0 {
+		states++
+	}
+	generator := make([][]float64, states+1)
+	for i := range generator {
+		generator[i] = make([]float64, states+1)
+	}
+	for k := range states {
+		fail := float64(n-k) * lambda
+		next := 0.0
+		if k+1 < states {
+			next = survival[k+1] / survival[k]
+			generator[k][k+1] = fail * next
+		}
+		generator[k][states] = fail * (1 - next)
+		if k > 0 {
+			generator[k][k-1] = float64(k) * mu
+		}
+		generator[k][k] = -(fail + float64(k)*mu)
+	}
+
+	// The expected times to loss t solve -Q t = 1 over the surviving states
+	system := make([][]float64, states)
+	for k := range system {
+		system[k] = make([]float64, states+1)
+		for j := range states {
+			system[k][j] = -generator[k][j]
+		}
+		system[k][states] = 1
+	}
+	times := solveLinear(system)
+	return ReliabilityEstimate{
+		MTTDL:           times[0],
+		LossProbability: transientProbability(generator, mission)[states],
+	}
+}
+
+// solveLinear solves the linear system whose augmented matrix is given, by Gaussian elimination
+// with partial pivoting. The matrix is overwritten.
+func solveLinear(a [][]float64) []float64 {
+	n := len(a)
+	for col := range n {
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		for row := col + 1; row < n; row++ {
+			factor := a[row][col] / a[col][col]
+			for j := col; j <= n; j++ {
+				a[row][j] -= factor * a[col][j]
+			}
+		}
+	}
+	x := make([]float64, n)
+	for row := n - 1; row >= 0; row-- {
+		sum := a[row][n]
+		for j := row + 1; j < n; j++ {
+			sum -= a[row][j] * x[j]
+		}
+		x[row] = sum / a[row][row]
+	}
+	return x
+}
+
+// transientProbability returns the probability of every state of the continuous-time Markov
+// chain with generator q at time t, starting from state 0. It computes exp(q·t) by uniformization
+// over a step short enough for a few terms of its series to converge, then squares the step up to
+// t: every matrix involved is non-negative, so even tiny probabilities come out accurate.
+func transientProbability(q [][]float64, t float64) []float64 {
+	n := len(q)
+	rate := 0.0
+	for i := range n {
+		rate = max(rate, -q[i][i])
+	}
+	if rate == 0 {
+		p := make([]float64, n)
+		p[0] = 1
+		return p
+	}
+	squarings := max(0, int(math.Ceil(math.Log2(rate*t))))
+	step := t / math.Exp2(float64(squarings))
+
+	// exp(q·step) = e^(-rate·step) Σ (rate·step)^k/k! P^k, with P = I + q/rate stochastic
+	jump := make([][]float64, n)
+	for i := range jump {
+		jump[i] = make([]float64, n)
+		for j := range n {
+			jump[i][j] = q[i][j] / rate
+		}
+		jump[i][i]++
+	}
+	term := identity(n)
+	exp := identity(n)
+	weight := 1.0
+	for k := 1; k <= 30; k++ {
+		term = multiply(term, jump)
+		weight *= rate * step / float64(k)
+		for i := range n {
+			for j := range n {
+				exp[i][j] += weight * term[i][j]
+			}
+		}
+	}
+	scale := math.Exp(-rate * step)
+	for i := range n {
+		for j := range n {
+			exp[i][j] *= scale
+		}
+	}
+	for range squarings {
+		exp = multiply(exp, exp)
+	}
+	return exp[0]
+}
+
+func identity(n int) [][]float64 {
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		m[i][i] = 1
+	}
+	return m
+}
+
+func multiply(a, b [][]float64) [][]float64 {
+	n := len(a)
+	m := make([][]float64, n)
+	for i := range m {
+		m[i] = make([]float64, n)
+		for k := range n {
+			if a[i][k] == 0 {
+				continue
+			}
+			for j := range n {
+				m[i][j] += a[i][k] * b[k][j]
+			}
+		}
+	}
+	return m
+}
+
+// simulateReliability runs the model's Monte Carlo trials on controllers built by newController.
+// Every trial fails working disks after exponentially distributed lifetimes and replaces and
+// rebuilds each failed disk rebuildHours later, until the controller reports the array failed or
+// the mission ends. The MTTDL is estimated as the hours run by all trials per data loss.
+func simulateReliability(newController func() (RAIDController, error), diskCount int, mtbf, rebuildHours float64, model ReliabilityModel, rng *rand.Rand) (ReliabilityEstimate, error) {
+	estimate := ReliabilityEstimate{Trials: model.Trials}
+	exposure := 0.0
+	var controller RAIDController
+	for range model.Trials {
+		if controller == nil {
+			var err error
+			if controller, err = newController(); err != nil {
+				return estimate, err
+			}
+		}
+		lost, hours, err := simulateTrial(controller, diskCount, mtbf, rebuildHours, model.Mission, rng)
+		if err != nil {
+			return estimate, err
+		}
+		exposure += hours
+		if lost {
+			estimate.Losses++
+			controller = nil // a failed array cannot be rebuilt, the next trial starts afresh
+		}
+	}
+	p := float64(estimate.Losses) / float64(estimate.Trials)
+	estimate.LossProbability = p
+	estimate.StdErr = math.Sqrt(p * (1 - p) / float64(estimate.Trials))
+	if estimate.Losses > 0 {
+		estimate.MTTDL = exposure / float64(estimate.Losses)
+	}
+	return estimate, nil
+}
+
+// simulateTrial runs one trial of simulateReliability on controller, whose disks all work. It
+// returns whether the array lost data and the hours the trial ran. A trial that survives leaves
+// every disk of the controller rebuilt.
+func simulateTrial(controller RAIDController, diskCount int, mtbf, rebuildHours, mission float64, rng *rand.Rand) (bool, float64, error) {
+	rebuilder, _ := controller.(Rebuilder)
+	repairs := map[int]float64{} // failed disk -> hour its rebuild completes
+	now := 0.0
+	for {
+		// Lifetimes are memoryless: the next failure strikes a random working disk
+		nextFailure := math.Inf(1)
+		if working := diskCount - len(repairs); working > 0 {
+			nextFailure = now + rng.ExpFloat64()*mtbf/float64(working)
+		}
+		repaired, nextRepair := -1, math.Inf(1)
+		for d, at := range repairs {
+			if at < nextRepair || at == nextRepair && d < repaired {
+				repaired, nextRepair = d, at
+			}
+		}
+
+		switch {
+		case min(nextFailure, nextRepair) > mission:
+			for d := range repairs {
+				if err := replaceAndRebuild(controller, rebuilder, d); err != nil {
+					return false, 0, err
+				}
+			}
+			return false, mission, nil
+
+		case nextRepair <= nextFailure:
+			now = nextRepair
+			if err := replaceAndRebuild(controller, rebuilder, repaired); err != nil {
+				return false, 0, err
+			}
+			delete(repairs, repaired)
+
+		default:
+			now = nextFailure
+			var working []int
+			for i := range diskCount {
+				if _, failed := repairs[i]; !failed {
+					working = append(working, i)
+				}
+			}
+			d := working[rng.Intn(len(working))]
+			if err := controller.ClearDisk(d); err != nil {
+				return false, 0, err
+			}
+			if controller.Status().State == ArrayStateFailed {
+				return true, now, nil
+			}
+			repairs[d] = now + rebuildHours
+		}
+	}
+}
+
+// replaceAndRebuild brings a failed disk of a surviving array back, as a rebuilt replacement.
+func replaceAndRebuild(controller RAIDController, rebuilder Rebuilder, index int) error {
+	if err := controller.ReplaceDisk(index); err != nil {
+		return err
+	}
+	if rebuilder == nil {
+		return fmt.Errorf("disk %d cannot be rebuilt without redundancy", index)
+	}
+	return rebuilder.Rebuild(index, nil)
+}
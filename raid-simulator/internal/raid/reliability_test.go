@@ -0,0 +1,131 @@
+package raid_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+)
+
+// reliabilityModel has disks failing often and rebuilding slowly, so trials lose data often
+// enough for the Monte Carlo estimate to be checked against the analytic one.
+var reliabilityModel = raid.ReliabilityModel{
+	MTBF:        1000,
+	DiskSize:    360e9,
+	RebuildRate: 1e6, // 100 hours per rebuild
+	Mission:     2000,
+	Trials:      4000,
+	Seed:        1,
+}
+
+func TestReliability_Survival(t *testing.T) {
+	for _, tc := range []struct {
+		raidType       raid.RaidType
+		diskCount      int
+		faultTolerance int
+		survival       []float64
+	}{
+		{raid.RaidTypeRaid0, 3, 0, []float64{1, 0, 0, 0}},
+		{raid.RaidTypeRaid1, 3, 2, []float64{1, 1, 1, 0}},
+		{raid.RaidTypeRaid10, 4, 1, []float64{1, 1, 4.0 / 6, 0, 0}},
+		{raid.RaidTypeRaid5, 4, 1, []float64{1, 1, 0, 0, 0}},
+		{raid.RaidTypeRaid6, 5, 2, []float64{1, 1, 1, 0, 0, 0}},
+		{raid.RaidTypeRaid50, 6, 1, []float64{1, 1, 9.0 / 15, 0, 0, 0, 0}},
+	} {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			model := reliabilityModel
+			model.Trials = 0
+			report, err := raid.Reliability(tc.raidType, tc.diskCount, raid.ControllerOptions{}, model)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.faultTolerance, report.FaultTolerance)
+			assert.InDeltaSlice(t, tc.survival, report.Survival, 1e-9)
+			assert.Nil(t, report.MonteCarlo)
+		})
+	}
+}
+
+func TestReliability_AnalyticMatchesClosedForms(t *testing.T) {
+	model := raid.ReliabilityModel{AFR: 0.02, DiskSize: 8e12, RebuildRate: 100e6, Mission: 5 * 24 * 365}
+	lambda := -math.Log1p(-model.AFR) / (24 * 365)
+	mu := 1 / (model.DiskSize / model.RebuildRate / 3600)
+
+	report, err := raid.Reliability(raid.RaidTypeRaid0, 4, raid.ControllerOptions{}, model)
+	assert.NoError(t, err)
+	assert.InEpsilon(t, 1/(4*lambda), report.Analytic.MTTDL, 1e-9)
+	assert.InEpsilon(t, 1-math.Exp(-4*lambda*model.Mission), report.Analytic.LossProbability, 1e-9)
+
+	// The classic RAID5 formula, ((2n-1)λ+µ) / (n(n-1)λ²)
+	report, err = raid.Reliability(raid.RaidTypeRaid5, 6, raid.ControllerOptions{}, model)
+	assert.NoError(t, err)
+	assert.InEpsilon(t, (11*lambda+mu)/(30*lambda*lambda), report.Analytic.MTTDL, 1e-9)
+	assert.InEpsilon(t, 1-math.Exp(-model.Mission/report.Analytic.MTTDL), report.Analytic.LossProbability, 1e-3)
+
+	// RAID6 outlives RAID5 by orders of magnitude
+	raid6, err := raid.Reliability(raid.RaidTypeRaid6, 6, raid.ControllerOptions{}, model)
+	assert.NoError(t, err)
+	assert.Greater(t, raid6.Analytic.MTTDL, 1000*report.Analytic.MTTDL)
+	assert.Greater(t, raid6.Analytic.LossProbability, 0.0)
+}
+
+func TestReliability_MonteCarloMatchesAnalytic(t *testing.T) {
+	for _, tc := range []struct {
+		raidType  raid.RaidType
+		diskCount int
+	}{
+		{raid.RaidTypeRaid0, 3},
+		{raid.RaidTypeRaid1, 2},
+		{raid.RaidTypeRaid10, 4},
+		{raid.RaidTypeRaid5, 4},
+		{raid.RaidTypeRaid6, 5},
+	} {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			report, err := raid.Reliability(tc.raidType, tc.diskCount, raid.ControllerOptions{}, reliabilityModel)
+			assert.NoError(t, err)
+			if assert.NotNil(t, report.MonteCarlo) {
+				simulated := report.MonteCarlo
+				assert.Equal(t, reliabilityModel.Trials, simulated.Trials)
+				assert.Greater(t, simulated.Losses, 0)
+				// The simulated rebuilds take a fixed time rather than the analytic model's exponential one
+				assert.InEpsilon(t, report.Analytic.MTTDL, simulated.MTTDL, 0.15)
+				assert.InDelta(t, report.Analytic.LossProbability, simulated.LossProbability, 0.05)
+			}
+		})
+	}
+}
+
+func TestReliability_Logging(t *testing.T) {
+	level := logrus.GetLevel()
+	logrus.SetLevel(logrus.DebugLevel)
+	defer logrus.SetLevel(level)
+	global := test.NewGlobal()
+	defer global.Reset()
+
+	model := reliabilityModel
+	model.Trials = 20
+	_, err := raid.Reliability(raid.RaidTypeRaid50, 6, raid.ControllerOptions{}, model)
+	assert.NoError(t, err)
+	assert.Empty(t, global.AllEntries(), "the simulated failures stay off the standard logger")
+
+	logger, hook := test.NewNullLogger()
+	_, err = raid.Reliability(raid.RaidTypeRaid50, 6, raid.ControllerOptions{Logger: logger}, model)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, hook.AllEntries(), "a given logger receives them")
+	assert.Empty(t, global.AllEntries())
+}
+
+func TestReliability_InvalidModel(t *testing.T) {
+	for name, model := range map[string]raid.ReliabilityModel{
+		"NoFailureRate": {DiskSize: 1, RebuildRate: 1, Mission: 1},
+		"AFR":           {AFR: 1, DiskSize: 1, RebuildRate: 1, Mission: 1},
+		"RebuildRate":   {AFR: 0.01, DiskSize: 1, Mission: 1},
+		"Mission":       {AFR: 0.01, DiskSize: 1, RebuildRate: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := raid.Reliability(raid.RaidTypeRaid5, 4, raid.ControllerOptions{}, model)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package raid
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReshapeTarget describes the level and geometry an array is reshaped into.
+type ReshapeTarget struct {
+	Type         RaidType     `json:"type"`
+	DiskCount    int          `json:"disk_count"`
+	StripeSz     int          `json:"stripe_size"`
+	Layout       ParityLayout `json:"layout,omitempty"`        // parity layout of a RAID5 or RAID50 target, default when empty
+	Groups       int          `json:"groups,omitempty"`        // parity groups of a RAID50 or RAID60 target, default when 0
+	Copies       int          `json:"copies,omitempty"`        // copies of every chunk of a RAID10 target, default when 0
+	MirrorLayout MirrorLayout `json:"mirror_layout,omitempty"` // copy placement of a RAID10 target, default when empty
+	ReadPolicy   ReadPolicy   `json:"read_policy,omitempty"`   // read policy of a RAID1 or RAID10 target, default when empty
+}
+
+// ReshapeTarget returns the target reshaping into an array of the same level, geometry and settings as status.
+func (status ArrayStatus) ReshapeTarget() ReshapeTarget {
+	return ReshapeTarget{
+		Type:         status.Type,
+		DiskCount:    len(status.Disks),
+		StripeSz:     status.StripeSz,
+		Layout:       status.Layout,
+		Groups:       status.Groups,
+		Copies:       status.Copies,
+		MirrorLayout: status.MirrorLayout,
+		ReadPolicy:   status.ReadPolicy,
+	}
+}
+
+// ReshapeStatus reports the progress of a reshape.
+type ReshapeStatus struct {
+	Target     ReshapeTarget `json:"target"`
+	Checkpoint int           `json:"checkpoint"` // logical bytes already copied into the target layout
+	Total      int           `json:"total"`      // logical bytes to copy
+}
+
+// Reshape migrates the logical contents of an array into a new array of a different level or
+// geometry while serving reads and writes. Bytes below the checkpoint have been copied to the
+// target and are read from it; the rest is read from the source. Writes always go to the source
+// and also to the target below the checkpoint, so the source stays complete and a reshape can
+// resume from any checkpoint at or below the real one.
+type Reshape struct {
+	mu         sync.RWMutex
+	from       RAIDController
+	to         RAIDController
+	target     ReshapeTarget
+	checkpoint int
+}
+
+var _ RAIDController = (*Reshape)(nil)
+
+// NewReshape starts or resumes copying from into to, with the first checkpoint bytes already copied.
+func NewReshape(from, to RAIDController, checkpoint int) (*Reshape, error) {
+	if checkpoint < 0 {
+		return nil, fmt.Errorf("reshape checkpoint must be non-negative. Provided: %d", checkpoint)
+	}
+	status := to.Status()
+	return &Reshape{
+		from:       from,
+		to:         to,
+		target:     status.ReshapeTarget(),
+		checkpoint: checkpoint,
+	}, nil
+}
+
+// Checkpoint returns the number of logical bytes already copied into the target.
+func (r *Reshape) Checkpoint() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.checkpoint
+}
+
+// Target returns the controller the contents are copied into.
+func (r *Reshape) Target() RAIDController {
+	return r.to
+}
+
+// stepSize is the number of logical bytes copied per step: one stripe across every target disk.
+func (r *Reshape) stepSize() int {
+	return r.target.StripeSz * r.target.DiskCount
+}
+
+// Step copies the next block of logical bytes into the target and reports whether the copy is complete.
+// Chunks that read back as zeros, such as the holes of sparse disks, are not written to the
+// target, so they take up no space there either.
+func (r *Reshape) Step() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	total := r.from.HighWaterMark()
+	if r.checkpoint >= total {
+		return true, nil
+	}
+	length := min(r.stepSize(), total-r.checkpoint)
+	data, err := r.from.Read(r.checkpoint, length)
+	if err != nil {
+		return false, fmt.Errorf("reshape: failed to read %d bytes at %d from the source: %w", length, r.checkpoint, err)
+	}
+	if err := r.copyBlock(data, r.checkpoint); err != nil {
+		return false, err
+	}
+	r.checkpoint += len(data)
+	logrus.Debugf("[reshape] Copied %d/%d bytes into %s.", r.checkpoint, total, r.target.Type)
+	return r.checkpoint >= total, nil
+}
+
+// copyBlock stores a block read from the source at offset of the target, one run of chunks at a
+// time. Runs of all-zero chunks are not written: they are discarded where the target may hold
+// older contents copied by an earlier run of a resumed reshape, and left alone past them. The
+// target's high-water mark is then moved past the block, so reads below the checkpoint keep
+// being served by the target.
+func (r *Reshape) copyBlock(data []byte, offset int) error {
+	discarder, canDiscard := r.to.(Discarder)
+	chunkSz := r.target.StripeSz
+	isZero := func(i int) bool {
+		return canDiscard && !slices.ContainsFunc(data[i:min(i+chunkSz, len(data))], func(b byte) bool { return b != 0 })
+	}
+	for start := 0; start < len(data); {
+		zero := isZero(start)
+		end := start + chunkSz
+		for end < len(data) && isZero(end) == zero {
+			end += chunkSz
+		}
+		end = min(end, len(data))
+
+		switch {
+		case !zero:
+			if err := r.to.Write(data[start:end], offset+start); err != nil {
+				return fmt.Errorf("reshape: failed to write %d bytes at %d to the target: %w", end-start, offset+start, err)
+			}
+		case offset+start < r.to.HighWaterMark():
+			if err := discarder.Discard(offset+start, end-start); err != nil {
+				return fmt.Errorf("reshape: failed to discard %d bytes at %d in the target: %w", end-start, offset+start, err)
+			}
+		}
+		start = end
+	}
+	if restorer, ok := r.to.(highWaterMarkRestorer); ok && r.to.HighWaterMark() < offset+len(data) {
+		restorer.restoreHighWaterMark(offset + len(data))
+	}
+	return nil
+}
+
+// Run copies the remaining contents, reporting progress in bytes after each step.
+func (r *Reshape) Run(progress ProgressFunc) error {
+	for {
+		done, err := r.Step()
+		if err != nil {
+			return err
+		}
+		if progress != nil {
+			status := r.ReshapeStatus()
+			progress(status.Checkpoint, status.Total)
+		}
+		if done {
+			return nil
+		}
+	}
+}
+
+// ReshapeStatus reports the target and how far the copy has progressed.
+func (r *Reshape) ReshapeStatus() ReshapeStatus {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return ReshapeStatus{Target: r.target, Checkpoint: r.checkpoint, Total: r.from.HighWaterMark()}
+}
+
+func (r *Reshape) Write(data []byte, offset int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.from.Write(data, offset); err != nil {
+		return err
+	}
+	if offset < r.checkpoint && len(data) > 0 {
+		copied := data[:min(len(data), r.checkpoint-offset)]
+		if err := r.to.Write(copied, offset); err != nil {
+			return fmt.Errorf("reshape: failed to update the target: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *Reshape) Read(start, length int) ([]byte, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if start < 0 || length < 0 {
+		return nil, fmt.Errorf("read start and length must be non-negative")
+	}
+	if start >= r.checkpoint {
+		return r.from.Read(start, length)
+	}
+	length = min(length, r.from.HighWaterMark()-start)
+	copied := min(length, r.checkpoint-start)
+	result, err := r.to.Read(start, copied)
+	if err != nil {
+		return nil, err
+	}
+	if copied < length {
+		rest, err := r.from.Read(r.checkpoint, length-copied)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, rest...)
+	}
+	return result, nil
+}
+
+// ClearDisk is refused while reshaping, as disk indexes are ambiguous between the two layouts.
+func (r *Reshape) ClearDisk(index int) error {
+	return fmt.Errorf("cannot fail disk %d while the array is being reshaped", index)
+}
+
+// ReplaceDisk is refused while reshaping, as disk indexes are ambiguous between the two layouts.
+func (r *Reshape) ReplaceDisk(index int) error {
+	return fmt.Errorf("cannot replace disk %d while the array is being reshaped", index)
+}
+
+// Status reports the source array, along with the progress of the reshape.
+func (r *Reshape) Status() ArrayStatus {
+	status := r.from.Status()
+	reshape := r.ReshapeStatus()
+	status.Reshape = &reshape
+	return status
+}
+
+func (r *Reshape) Capacity() int {
+	return r.from.Capacity()
+}
+
+func (r *Reshape) HighWaterMark() int {
+	return r.from.HighWaterMark()
+}
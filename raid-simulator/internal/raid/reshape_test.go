@@ -0,0 +1,145 @@
+package raid_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReshape_PreservesContents(t *testing.T) {
+	cases := []struct {
+		name string
+		from raid.ReshapeTarget
+		to   raid.ReshapeTarget
+	}{
+		{"raid1 to raid5", raid.ReshapeTarget{Type: raid.RaidTypeRaid1, DiskCount: 2, StripeSz: 2}, raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 3, StripeSz: 2, Layout: raid.DefaultParityLayout}},
+		{"grow raid5", raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 3, StripeSz: 2}, raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 5, StripeSz: 2, Layout: raid.DefaultParityLayout}},
+		{"grow raid6", raid.ReshapeTarget{Type: raid.RaidTypeRaid6, DiskCount: 4, StripeSz: 2}, raid.ReshapeTarget{Type: raid.RaidTypeRaid6, DiskCount: 6, StripeSz: 2}},
+		{"raid5 stripe size", raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 3, StripeSz: 2}, raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 3, StripeSz: 5, Layout: raid.DefaultParityLayout}},
+		{"raid5 to raid4", raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 4, StripeSz: 3}, raid.ReshapeTarget{Type: raid.RaidTypeRaid4, DiskCount: 4, StripeSz: 3}},
+		{"raid5 to raid6", raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 4, StripeSz: 3}, raid.ReshapeTarget{Type: raid.RaidTypeRaid6, DiskCount: 5, StripeSz: 3}},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			data := []byte("LogicalContentsSurviveTheReshape")
+			from, err := raid.NewController(tc.from.Type, tc.from.DiskCount, tc.from.StripeSz)
+			assert.NoError(t, err)
+			to, err := raid.NewController(tc.to.Type, tc.to.DiskCount, tc.to.StripeSz)
+			assert.NoError(t, err)
+			assert.NoError(t, from.Write(data, 0))
+
+			reshape, err := raid.NewReshape(from, to, 0)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.to, reshape.ReshapeStatus().Target)
+
+			var lastCopied, lastTotal int
+			assert.NoError(t, reshape.Run(func(copied, total int) { lastCopied, lastTotal = copied, total }))
+			assert.Equal(t, lastTotal, lastCopied)
+			assert.Equal(t, from.HighWaterMark(), reshape.Checkpoint())
+
+			output, err := to.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, output)
+		})
+	}
+}
+
+func TestReshape_ServesIOWhileCopying(t *testing.T) {
+	from, err := raid.NewController(raid.RaidTypeRaid5, 3, 2)
+	assert.NoError(t, err)
+	to, err := raid.NewController(raid.RaidTypeRaid6, 5, 2)
+	assert.NoError(t, err)
+	data := []byte("0123456789abcdefghijklmnopqrstuv")
+	assert.NoError(t, from.Write(data, 0))
+
+	reshape, err := raid.NewReshape(from, to, 0)
+	assert.NoError(t, err)
+	done, err := reshape.Step()
+	assert.NoError(t, err)
+	assert.False(t, done)
+	checkpoint := reshape.Checkpoint()
+	assert.Equal(t, 10, checkpoint)
+
+	// A write straddling the checkpoint lands in both layouts
+	assert.NoError(t, reshape.Write([]byte("WXYZ"), checkpoint-2))
+	copy(data[checkpoint-2:], "WXYZ")
+
+	output, err := reshape.Read(4, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, data[4:24], output)
+
+	assert.Error(t, reshape.ClearDisk(0))
+	assert.Error(t, reshape.ReplaceDisk(0))
+	assert.NotNil(t, reshape.Status().Reshape)
+
+	assert.NoError(t, reshape.Run(nil))
+	output, err = to.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestArray_ReshapeResumesAfterInterruption(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("InterruptedReshapesPickUpAgain")
+
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid5, 3, 2, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.StartReshape(raid.ReshapeTarget{Type: raid.RaidTypeRaid6, DiskCount: 5, StripeSz: 4}))
+	assert.Error(t, array.StartReshape(raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 4, StripeSz: 4}))
+	done, err := array.ContinueReshape(1, nil)
+	assert.NoError(t, err)
+	assert.False(t, done)
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	status := array.Status()
+	assert.Equal(t, raid.RaidTypeRaid5, status.Type)
+	assert.Equal(t, 20, status.Reshape.Checkpoint)
+	_, err = array.Scrub(nil)
+	assert.Error(t, err)
+
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	done, err = array.ContinueReshape(0, nil)
+	assert.NoError(t, err)
+	assert.True(t, done)
+	assert.NoError(t, array.Close())
+
+	_, err = os.Stat(filepath.Join(dir, "disk-0.img"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	status = array.Status()
+	assert.Equal(t, raid.RaidTypeRaid6, status.Type)
+	assert.Equal(t, 4, status.StripeSz)
+	assert.Len(t, status.Disks, 5)
+	assert.Nil(t, status.Reshape)
+
+	output, err = array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	_, err = array.ContinueReshape(0, nil)
+	assert.Error(t, err)
+}
+
+func TestArray_ReshapeRequiresHealthyArray(t *testing.T) {
+	array, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid5, 3, 2, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.Write([]byte("degraded"), 0))
+	assert.NoError(t, array.ClearDisk(1))
+
+	assert.Error(t, array.StartReshape(raid.ReshapeTarget{Type: raid.RaidTypeRaid5, DiskCount: 4, StripeSz: 2}))
+	assert.Error(t, array.StartReshape(raid.ReshapeTarget{Type: "raid7", DiskCount: 4, StripeSz: 2}))
+}
@@ -0,0 +1,140 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ChunkRepair identifies a chunk that a scrub rewrote with reconstructed contents.
+type ChunkRepair struct {
+	Stripe int `json:"stripe"`
+	Disk   int `json:"disk"`
+}
+
+// ScrubReport summarizes a scrub pass over an array.
+type ScrubReport struct {
+	Stripes       int           `json:"stripes"`       // stripes examined
+	Repaired      []ChunkRepair `json:"repaired"`      // corrupt chunks that were rewritten
+	Unrecoverable []int         `json:"unrecoverable"` // stripes whose corruption could not be located or corrected
+}
+
+// Scrub verifies every stripe against its parity and repairs corrupt shards.
+// A shard is known to be corrupt when it fails its checksum. When every checksum matches but the
+// parity does not, each shard in turn is assumed corrupt and the one whose reconstruction makes the
+// stripe consistent again is repaired; this needs a spare parity shard, so RAID6 can locate such
+// corruption while RAID5 can only report it.
+func (p *parityArray) Scrub(progress ProgressFunc) (ScrubReport, error) {
+	report := ScrubReport{}
+	for stripeIdx := 0; ; stripeIdx++ {
+		// Take the lock per stripe so reads and writes interleave with the scrub
+		p.mu.Lock()
+		total := p.stripeCount()
+		if stripeIdx >= total {
+			p.mu.Unlock()
+			break
+		}
+		repairs, err := p.scrubStripe(stripeIdx)
+		p.mu.Unlock()
+
+		report.Stripes++
+		if err != nil {
+			p.log().Warnf("[%s] Stripe %d is unrecoverable: %v", p.name, stripeIdx, err)
+			report.Unrecoverable = append(report.Unrecoverable, stripeIdx)
+		}
+		report.Repaired = append(report.Repaired, repairs...)
+
+		if progress != nil {
+			progress(stripeIdx+1, total)
+		}
+	}
+
+	p.log().Infof("[%s] Scrub done: %d stripes, %d chunks repaired, %d stripes unrecoverable.",
+		p.name, report.Stripes, len(report.Repaired), len(report.Unrecoverable))
+	return report, nil
+}
+
+var errCorruptionNotLocated = errors.New("parity mismatch but the corrupt shard cannot be located")
+
+// scrubStripe checks a single stripe and rewrites the shards found to be corrupt.
+func (p *parityArray) scrubStripe(stripeIdx int) ([]ChunkRepair, error) {
+	numParityShards := p.encoderExtension.ParityShards()
+	placement := p.placement(stripeIdx, len(p.disks), numParityShards)
+
+	shards := make([][]byte, len(placement))
+	missing := 0
+	var corrupt []int // shard indices whose chunk failed its checksum or could not be read
+	for shardIdx, d := range placement {
+		disk := p.disks[d]
+		if !disk.canServe(stripeIdx) {
+			missing++
+			continue
+		}
+		chunk, err := disk.readRawChunk(stripeIdx)
+		if err != nil || !disk.verifyChunk(stripeIdx, chunk) {
+			corrupt = append(corrupt, shardIdx)
+			continue
+		}
+		shards[shardIdx] = chunk
+	}
+
+	erased := missing + len(corrupt)
+	if erased > numParityShards {
+		return nil, fmt.Errorf("%d shards missing or corrupt but only %d parity shards", erased, numParityShards)
+	}
+
+	reconstructed := cloneShards(shards)
+	if err := p.encoder.Reconstruct(reconstructed); err != nil {
+		return nil, err
+	}
+	if ok, err := p.encoder.Verify(reconstructed); err != nil || !ok {
+		// Checksums did not reveal the culprit; with parity to spare, find the single shard
+		// whose reconstruction from the others makes the stripe consistent.
+		if erased+1 >= numParityShards {
+			return nil, errCorruptionNotLocated
+		}
+		culprit := -1
+		for candidate := range shards {
+			if shards[candidate] == nil {
+				continue
+			}
+			attempt := cloneShards(shards)
+			attempt[candidate] = nil
+			if err := p.encoder.Reconstruct(attempt); err != nil {
+				continue
+			}
+			if ok, err := p.encoder.Verify(attempt); err == nil && ok {
+				if culprit != -1 {
+					return nil, errCorruptionNotLocated
+				}
+				culprit = candidate
+				reconstructed = attempt
+			}
+		}
+		if culprit == -1 {
+			return nil, errCorruptionNotLocated
+		}
+		corrupt = append(corrupt, culprit)
+	}
+
+	repairs := make([]ChunkRepair, 0, len(corrupt))
+	for _, shardIdx := range corrupt {
+		d := placement[shardIdx]
+		if err := p.disks[d].WriteChunk(stripeIdx, reconstructed[shardIdx]); err != nil {
+			return repairs, fmt.Errorf("failed to repair shard %d on disk %d: %w", shardIdx, d, err)
+		}
+		p.log().Infof("[%s] Repaired shard %d of stripe %d on disk %d.", p.name, shardIdx, stripeIdx, d)
+		repairs = append(repairs, ChunkRepair{Stripe: stripeIdx, Disk: d})
+	}
+	return repairs, nil
+}
+
+// cloneShards returns a copy of shards that can be reconstructed without touching the original.
+func cloneShards(shards [][]byte) [][]byte {
+	clone := make([][]byte, len(shards))
+	for i, shard := range shards {
+		if shard != nil {
+			clone[i] = append([]byte(nil), shard...)
+		}
+	}
+	return clone
+}
@@ -0,0 +1,176 @@
+package raid
+
+import (
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/stretchr/testify/assert"
+)
+
+// corruptChunk flips the bits of a chunk behind the disk's back, leaving its recorded checksum stale.
+func corruptChunk(t *testing.T, disk *Disk, index int) {
+	chunk, err := disk.dev.ReadChunk(index)
+	assert.NoError(t, err)
+	for i := range chunk {
+		chunk[i] ^= 0xFF
+	}
+	assert.NoError(t, disk.dev.WriteChunk(index, chunk))
+}
+
+func TestParityArray_ReadSkipsCorruptChunk(t *testing.T) {
+	data := []byte("SilentCorruptionIsNotReturned!")
+	for _, raidType := range []RaidType{RaidTypeRaid5, RaidTypeRaid6} {
+		t.Run(string(raidType), func(t *testing.T) {
+			controller, err := NewController(raidType, 5, 2)
+			assert.NoError(t, err)
+			assert.NoError(t, controller.Write(data, 0))
+
+			parity := controllerParity(controller)
+			corruptChunk(t, parity.disks[2], 1)
+
+			output, err := controller.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, output)
+
+			_, err = parity.disks[2].ReadChunk(1)
+			assert.ErrorIs(t, err, ErrChecksumMismatch)
+		})
+	}
+}
+
+func TestParityArray_ScrubRepairsChecksumMismatch(t *testing.T) {
+	data := []byte("ScrubFindsFlippedBits")
+	controller, err := NewRAID5Controller(4, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write(data, 0))
+
+	corruptChunk(t, controller.disks[0], 0)
+	corruptChunk(t, controller.disks[3], 2)
+
+	var lastDone, lastTotal int
+	report, err := controller.Scrub(func(done, total int) { lastDone, lastTotal = done, total })
+	assert.NoError(t, err)
+	assert.Equal(t, controller.stripeCount(), report.Stripes)
+	assert.Equal(t, []ChunkRepair{{Stripe: 0, Disk: 0}, {Stripe: 2, Disk: 3}}, report.Repaired)
+	assert.Empty(t, report.Unrecoverable)
+	assert.Equal(t, lastTotal, lastDone)
+
+	for _, disk := range controller.disks {
+		for i := 0; i < disk.ChunkCount(); i++ {
+			_, err := disk.ReadChunk(i)
+			assert.NoError(t, err, "disk %d chunk %d", disk.ID, i)
+		}
+	}
+
+	report, err = controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Repaired)
+}
+
+func TestParityArray_ScrubLocatesCorruptionWithSecondParity(t *testing.T) {
+	data := []byte("RAID6CanPinpointTheBadShard")
+	controller, err := NewRAID6Controller(5, 3)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write(data, 0))
+
+	// Corrupt a chunk and update its checksum too, so only the parity can reveal it
+	disk := controller.disks[1]
+	corruptChunk(t, disk, 1)
+	chunk, err := disk.dev.ReadChunk(1)
+	assert.NoError(t, err)
+	disk.sums[1] = crc32.ChecksumIEEE(chunk)
+
+	report, err := controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChunkRepair{{Stripe: 1, Disk: 1}}, report.Repaired)
+	assert.Empty(t, report.Unrecoverable)
+
+	output, err := controller.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestParityArray_ScrubReportsUnlocatableCorruption(t *testing.T) {
+	data := []byte("RAID5CannotTellWhichShard")
+	controller, err := NewRAID5Controller(3, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write(data, 0))
+
+	disk := controller.disks[2]
+	corruptChunk(t, disk, 0)
+	chunk, err := disk.dev.ReadChunk(0)
+	assert.NoError(t, err)
+	disk.sums[0] = crc32.ChecksumIEEE(chunk)
+
+	report, err := controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Repaired)
+	assert.Equal(t, []int{0}, report.Unrecoverable)
+}
+
+func TestParityArray_ScrubDegradedArray(t *testing.T) {
+	data := []byte("TooManyLostShards")
+	controller, err := NewRAID5Controller(3, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write(data, 0))
+
+	assert.NoError(t, controller.ClearDisk(0))
+	corruptChunk(t, controller.disks[1], 1)
+
+	report, err := controller.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, report.Repaired)
+	assert.Equal(t, []int{1}, report.Unrecoverable)
+}
+
+func TestArray_ChecksumsPersistAcrossReopen(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("ChecksumsSurviveReopen")
+
+	array, err := CreateArray(dir, RaidTypeRaid5, 3, 4, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.Close())
+
+	// Flip a byte of the first chunk straight in the image file while the array is offline
+	image := filepath.Join(dir, "disk-1.img")
+	raw, err := os.ReadFile(image)
+	assert.NoError(t, err)
+	raw[blockdev.HeaderSize] ^= 0x01
+	assert.NoError(t, os.WriteFile(image, raw, 0644))
+
+	array, err = OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+
+	report, err := array.Scrub(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []ChunkRepair{{Stripe: 0, Disk: 1}}, report.Repaired)
+}
+
+func TestArray_ScrubRequiresParity(t *testing.T) {
+	array, err := CreateArray(t.TempDir(), RaidTypeRaid1, 2, 4, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+
+	_, err = array.Scrub(nil)
+	assert.Error(t, err)
+}
+
+// controllerParity returns the parity core of a RAID5 or RAID6 controller.
+func controllerParity(controller RAIDController) *parityArray {
+	switch c := controller.(type) {
+	case *RAID5Controller:
+		return c.parityArray
+	case *RAID6Controller:
+		return c.parityArray
+	}
+	return nil
+}
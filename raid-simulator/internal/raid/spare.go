@@ -0,0 +1,364 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+	"github.com/sirupsen/logrus"
+)
+
+// EventType names a step in the lifecycle of the disks of an array.
+type EventType string
+
+const (
+	EventDiskFaulty      EventType = "disk-faulty"      // a member failed, its contents are lost
+	EventDiskRemoved     EventType = "disk-removed"     // a failed member was pulled out of its slot
+	EventDiskReplaced    EventType = "disk-replaced"    // a blank disk was installed in a slot, to be rebuilt
+	EventSpareAdded      EventType = "spare-added"      // a hot spare joined the array
+	EventSpareActivated  EventType = "spare-activated"  // a hot spare took the slot of a failed member
+	EventRebuildStarted  EventType = "rebuild-started"  // a disk is being regenerated from the other members
+	EventRebuildFinished EventType = "rebuild-finished" // a disk is back online
+	EventRebuildFailed   EventType = "rebuild-failed"   // a rebuild stopped short, see Event.Err
+)
+
+// Event reports a change in the lifecycle of the disks of an array to its subscribers.
+type Event struct {
+	Type  EventType `json:"type"`
+	Disk  int       `json:"disk"`            // slot of the member concerned, -1 for events of a spare alone
+	Image string    `json:"image,omitempty"` // image of the disk concerned, e.g. the spare taking over a slot
+	Err   error     `json:"-"`               // why a rebuild failed
+}
+
+func (e Event) String() string {
+	s := string(e.Type)
+	if e.Disk >= 0 {
+		s += fmt.Sprintf(" disk %d", e.Disk)
+	}
+	if e.Image != "" {
+		s += fmt.Sprintf(" (%s)", e.Image)
+	}
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+// EventFunc receives the events of an array it subscribed to.
+type EventFunc func(Event)
+
+// lifecycle holds the subscribers to the events of an array and the rebuilds it runs in the background.
+type lifecycle struct {
+	mu          sync.Mutex
+	subscribers map[int]EventFunc
+	nextID      int
+	rebuilds    map[int]chan struct{} // slot being rebuilt onto a hot spare, closed once the rebuild ends
+}
+
+// Subscribe calls fn with every later event of the array until the returned function cancels the
+// subscription. Events of background rebuilds are delivered from the goroutine running them, so fn
+// must be safe for concurrent use and must not call back into the array.
+func (a *Array) Subscribe(fn EventFunc) (cancel func()) {
+	a.lifecycle.mu.Lock()
+	defer a.lifecycle.mu.Unlock()
+
+	if a.lifecycle.subscribers == nil {
+		a.lifecycle.subscribers = make(map[int]EventFunc)
+	}
+	id := a.lifecycle.nextID
+	a.lifecycle.nextID++
+	a.lifecycle.subscribers[id] = fn
+	return func() {
+		a.lifecycle.mu.Lock()
+		defer a.lifecycle.mu.Unlock()
+		delete(a.lifecycle.subscribers, id)
+	}
+}
+
+// emit logs event and hands it to every subscriber, in subscription order.
+func (a *Array) emit(event Event) {
+	logrus.Infof("[%s] %s", a.sb.Type, event)
+	a.lifecycle.mu.Lock()
+	ids := make([]int, 0, len(a.lifecycle.subscribers))
+	for id := range a.lifecycle.subscribers {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	subscribers := make([]EventFunc, len(ids))
+	for i, id := range ids {
+		subscribers[i] = a.lifecycle.subscribers[id]
+	}
+	a.lifecycle.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(event)
+	}
+}
+
+// Spares returns the images of the hot spares standing by.
+func (a *Array) Spares() []string {
+	images := make([]string, len(a.sb.Spares))
+	for i, spare := range a.sb.Spares {
+		images[i] = spare.Image
+	}
+	return images
+}
+
+// AddSpare adds a blank hot spare to the array. Should a member fail, the spare takes its slot and
+// is rebuilt in the background; a member that already failed gets it straight away.
+func (a *Array) AddSpare() error {
+	image := a.spareImage()
+	dev, err := a.openImage(image)
+	if err != nil {
+		return err
+	}
+	// A leftover file of the same name must not pass for the spare's contents
+	wipeErr := dev.Wipe()
+	if err := dev.Close(); err != nil && wipeErr == nil {
+		wipeErr = err
+	}
+	if wipeErr != nil {
+		return fmt.Errorf("failed to prepare hot spare %s: %w", image, wipeErr)
+	}
+	a.sb.Spares = append(a.sb.Spares, superblockDisk{ID: len(a.sb.Spares), State: DiskStateSpare, Image: image})
+	a.emit(Event{Type: EventSpareAdded, Disk: -1, Image: image})
+
+	if a.reshape == nil {
+		for slot, disk := range a.members.disks {
+			if disk.State.isFailed() && len(a.sb.Spares) > 0 {
+				if err := a.activateSpare(slot); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return a.Save()
+}
+
+// ClearDisk simulates a failure of the disk at index. If the array has a hot spare and its level
+// the redundancy to rebuild from, the spare takes the slot and is rebuilt in the background.
+func (a *Array) ClearDisk(index int) error {
+	if err := a.RAIDController.ClearDisk(index); err != nil {
+		return err
+	}
+	a.emit(Event{Type: EventDiskFaulty, Disk: index, Image: a.sb.Disks[index].Image})
+	// A rebuild of the slot still running gives up at its next step; it must be gone before another starts
+	a.waitRebuild(index)
+	return a.activateSpare(index)
+}
+
+// diskRemover is implemented by the controllers whose failed disks can be pulled out of their slots.
+type diskRemover interface {
+	// removeDisk marks the failed disk at index removed, under the controller lock like ClearDisk.
+	removeDisk(index int) error
+}
+
+// markRemoved moves a failed disk to the removed state. The caller holds the controller lock.
+func markRemoved(disk *Disk) error {
+	if disk.State != DiskStateFailed {
+		return fmt.Errorf("disk %d is %s, only a failed disk can be removed", disk.ID, disk.State)
+	}
+	disk.State = DiskStateRemoved
+	return nil
+}
+
+// RemoveDisk pulls the failed disk at index out of its slot and deletes its image, leaving the slot
+// empty until ReplaceDisk installs a new disk or AddSpare a hot spare.
+func (a *Array) RemoveDisk(index int) error {
+	if a.reshape != nil {
+		return fmt.Errorf("cannot remove disk %d while the array is being reshaped", index)
+	}
+	remover, ok := a.RAIDController.(diskRemover)
+	if !ok {
+		return fmt.Errorf("%s arrays cannot remove disks", a.sb.Type)
+	}
+	disk, err := a.Disk(index)
+	if err != nil {
+		return err
+	}
+	if err := remover.removeDisk(index); err != nil {
+		return err
+	}
+	image := a.sb.Disks[index].Image
+	if err := a.detachImage(disk, image, blockdev.NewMemory(a.sb.StripeSz)); err != nil {
+		return err
+	}
+	a.emit(Event{Type: EventDiskRemoved, Disk: index, Image: image})
+	return a.Save()
+}
+
+// ReplaceDisk swaps the disk at index for a blank replacement. A slot whose disk was removed gets
+// a new image.
+func (a *Array) ReplaceDisk(index int) error {
+	if a.rebuildRunning(index) {
+		return fmt.Errorf("disk %d is being rebuilt onto a hot spare", index)
+	}
+	if disk, err := a.Disk(index); err == nil && disk.State == DiskStateRemoved && a.reshape == nil {
+		image := a.sb.Disks[index].Image
+		dev, err := a.openImage(image)
+		if err != nil {
+			return err
+		}
+		if err := a.detachImage(disk, "", dev); err != nil {
+			return err
+		}
+	}
+	if err := a.RAIDController.ReplaceDisk(index); err != nil {
+		return err
+	}
+	a.emit(Event{Type: EventDiskReplaced, Disk: index, Image: a.sb.Disks[index].Image})
+	return nil
+}
+
+// Rebuild regenerates a replaced disk if the array's level has redundancy to rebuild from.
+func (a *Array) Rebuild(index int, progress ProgressFunc) error {
+	if a.reshape != nil {
+		return fmt.Errorf("cannot rebuild disk %d while the array is being reshaped", index)
+	}
+	rebuilder, ok := a.RAIDController.(Rebuilder)
+	if !ok {
+		return fmt.Errorf("%s arrays have no redundancy to rebuild from", a.sb.Type)
+	}
+	if _, err := a.Disk(index); err != nil {
+		return err
+	}
+	if a.rebuildRunning(index) {
+		return fmt.Errorf("disk %d is already being rebuilt onto a hot spare", index)
+	}
+	return a.rebuild(rebuilder, index, a.sb.Disks[index].Image, progress)
+}
+
+// Wait blocks until every rebuild running onto a hot spare in the background has ended.
+func (a *Array) Wait() {
+	for {
+		a.lifecycle.mu.Lock()
+		var running chan struct{}
+		for _, done := range a.lifecycle.rebuilds {
+			running = done
+			break
+		}
+		a.lifecycle.mu.Unlock()
+		if running == nil {
+			return
+		}
+		<-running
+	}
+}
+
+// rebuild regenerates the disk at index, whose image is given, reporting the start and outcome as events.
+func (a *Array) rebuild(rebuilder Rebuilder, index int, image string, progress ProgressFunc) error {
+	a.emit(Event{Type: EventRebuildStarted, Disk: index, Image: image})
+	if err := rebuilder.Rebuild(index, progress); err != nil {
+		a.emit(Event{Type: EventRebuildFailed, Disk: index, Image: image, Err: err})
+		return err
+	}
+	a.emit(Event{Type: EventRebuildFinished, Disk: index, Image: image})
+	return nil
+}
+
+// activateSpare installs the first hot spare in the slot of the failed member at index, deleting
+// the failed member's image, and starts rebuilding it in the background. Without a spare, or for a
+// level without redundancy, the slot stays failed.
+func (a *Array) activateSpare(index int) error {
+	rebuilder, ok := a.RAIDController.(Rebuilder)
+	if len(a.sb.Spares) == 0 || !ok || a.reshape != nil {
+		return nil
+	}
+	spare := a.sb.Spares[0]
+	dev, err := a.openImage(spare.Image)
+	if err != nil {
+		return err
+	}
+	if err := a.detachImage(a.members.disks[index], a.sb.Disks[index].Image, dev); err != nil {
+		return err
+	}
+	a.sb.Spares = a.sb.Spares[1:]
+	a.sb.Disks[index].Image = spare.Image
+	if err := a.RAIDController.ReplaceDisk(index); err != nil {
+		return err
+	}
+	a.emit(Event{Type: EventSpareActivated, Disk: index, Image: spare.Image})
+	// Record the new image of the slot before the old one is gone for good
+	if err := a.Save(); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	a.lifecycle.mu.Lock()
+	if a.lifecycle.rebuilds == nil {
+		a.lifecycle.rebuilds = make(map[int]chan struct{})
+	}
+	a.lifecycle.rebuilds[index] = done
+	a.lifecycle.mu.Unlock()
+	go func() {
+		defer func() {
+			a.lifecycle.mu.Lock()
+			delete(a.lifecycle.rebuilds, index)
+			a.lifecycle.mu.Unlock()
+			close(done)
+		}()
+		_ = a.rebuild(rebuilder, index, spare.Image, nil)
+	}()
+	return nil
+}
+
+// waitRebuild blocks until the background rebuild of the slot at index, if any, has ended.
+func (a *Array) waitRebuild(index int) {
+	a.lifecycle.mu.Lock()
+	done := a.lifecycle.rebuilds[index]
+	a.lifecycle.mu.Unlock()
+	if done != nil {
+		<-done
+	}
+}
+
+func (a *Array) rebuildRunning(index int) bool {
+	a.lifecycle.mu.Lock()
+	defer a.lifecycle.mu.Unlock()
+	return a.lifecycle.rebuilds[index] != nil
+}
+
+// detachImage installs dev as the block device of disk, closing the previous one and deleting the
+// files of its image, if any.
+func (a *Array) detachImage(disk *Disk, image string, dev blockdev.Device) error {
+	if err := disk.swapDevice(dev).Close(); err != nil {
+		return fmt.Errorf("failed to close disk %d: %w", disk.ID, err)
+	}
+	if image == "" {
+		return nil
+	}
+	for _, file := range []string{image, image + checksumFileSuffix, image + blockdev.AllocationMapSuffix} {
+		if err := os.Remove(imagePath(a.dir, file)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s of disk %d: %w", file, disk.ID, err)
+		}
+	}
+	return nil
+}
+
+// openImage opens a disk image of the array's current disk set, with a header for its member
+// superblock unless the array predates them.
+func (a *Array) openImage(image string) (*blockdev.File, error) {
+	if a.sb.UUID == "" {
+		return blockdev.OpenFile(imagePath(a.dir, image), a.sb.StripeSz)
+	}
+	return blockdev.OpenFileWithHeader(imagePath(a.dir, image), a.sb.StripeSz)
+}
+
+// spareImage names the image of a new hot spare after the first spare-N.img the array does not use.
+func (a *Array) spareImage() string {
+	used := make(map[string]bool)
+	for _, disk := range a.sb.Disks {
+		used[disk.Image] = true
+	}
+	for _, spare := range a.sb.Spares {
+		used[spare.Image] = true
+	}
+	for n := 0; ; n++ {
+		if image := fmt.Sprintf("spare-%d.img", n); !used[image] {
+			return image
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package raid_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+// eventRecorder collects the types of the events an array emits.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []raid.EventType
+}
+
+func (r *eventRecorder) record(event raid.Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event.Type)
+}
+
+func (r *eventRecorder) types() []raid.EventType {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]raid.EventType(nil), r.events...)
+}
+
+func TestArray_HotSpareRebuildsFailedDisk(t *testing.T) {
+	for _, tc := range []struct {
+		raidType  raid.RaidType
+		diskCount int
+	}{
+		{raid.RaidTypeRaid1, 2},
+		{raid.RaidTypeRaid10, 4},
+		{raid.RaidTypeRaid5, 4},
+		{raid.RaidTypeRaid6, 5},
+		{"ec:3+2", 5},
+		{raid.RaidTypeRaid50, 6},
+		{"raid1(2 x raid5(3))", 6},
+	} {
+		t.Run(string(tc.raidType), func(t *testing.T) {
+			dir := t.TempDir()
+			data := bytes.Repeat([]byte("HotSpare"), 16)
+			array, err := raid.CreateArray(dir, tc.raidType, tc.diskCount, 4, 0, raid.ControllerOptions{})
+			assert.NoError(t, err)
+			assert.NoError(t, array.Write(data, 0))
+			assert.NoError(t, array.AddSpare())
+			assert.Equal(t, []string{"spare-0.img"}, array.Spares())
+
+			var recorder eventRecorder
+			defer array.Subscribe(recorder.record)()
+			assert.NoError(t, array.ClearDisk(1))
+			array.Wait()
+			assert.Equal(t, []raid.EventType{raid.EventDiskFaulty, raid.EventSpareActivated, raid.EventRebuildStarted, raid.EventRebuildFinished}, recorder.types())
+			assert.Equal(t, raid.ArrayStateOptimal, array.Status().State)
+			assert.Empty(t, array.Spares())
+			assert.NoFileExists(t, filepath.Join(dir, "disk-1.img"), "the failed disk was swapped out")
+
+			// The spare holds the failed disk's contents now
+			assert.NoError(t, array.ClearDisk(0))
+			output, err := array.Read(0, len(data))
+			assert.NoError(t, err)
+			assert.Equal(t, data, output)
+			assert.NoError(t, array.Close())
+
+			array, err = raid.OpenArray(dir)
+			assert.NoError(t, err, "the spare carries the member superblock of its slot")
+			assert.Equal(t, raid.DiskStateOnline, array.Status().Disks[1].State)
+			assert.NoError(t, array.Close())
+		})
+	}
+}
+
+func TestArray_SpareTakesSlotFailedEarlier(t *testing.T) {
+	array, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid1, 2, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.Write([]byte("mirrored"), 0))
+
+	var recorder eventRecorder
+	defer array.Subscribe(recorder.record)()
+	assert.NoError(t, array.ClearDisk(0))
+	assert.Equal(t, raid.ArrayStateDegraded, array.Status().State, "no spare to take over")
+
+	assert.NoError(t, array.AddSpare())
+	array.Wait()
+	assert.Equal(t, []raid.EventType{raid.EventDiskFaulty, raid.EventSpareAdded, raid.EventSpareActivated, raid.EventRebuildStarted, raid.EventRebuildFinished}, recorder.types())
+	assert.Equal(t, raid.ArrayStateOptimal, array.Status().State)
+}
+
+func TestArray_SpareNeedsRedundancy(t *testing.T) {
+	array, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid0, 2, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.AddSpare())
+	assert.NoError(t, array.ClearDisk(0))
+	array.Wait()
+	assert.Equal(t, raid.DiskStateFailed, array.Status().Disks[0].State)
+	assert.Equal(t, []string{"spare-0.img"}, array.Spares(), "nothing to rebuild a raid0 disk from")
+}
+
+func TestArray_RemoveAndReplaceDisk(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte("RemovedDisksLeaveAnEmptySlot")
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid6, 5, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	assert.NoError(t, array.Write(data, 0))
+
+	var recorder eventRecorder
+	cancel := array.Subscribe(recorder.record)
+	if assert.Error(t, array.RemoveDisk(0)) {
+		assert.Equal(t, raid.DiskStateOnline, array.Status().Disks[0].State, "only failed disks can be removed")
+	}
+	assert.NoError(t, array.ClearDisk(0))
+	assert.NoError(t, array.RemoveDisk(0))
+	assert.Equal(t, raid.DiskStateRemoved, array.Status().Disks[0].State)
+	assert.NoFileExists(t, filepath.Join(dir, "disk-0.img"))
+	assert.Equal(t, []raid.EventType{raid.EventDiskFaulty, raid.EventDiskRemoved}, recorder.types())
+	cancel()
+	assert.NoError(t, array.Close())
+
+	array, err = raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.Equal(t, raid.DiskStateRemoved, array.Status().Disks[0].State)
+	assert.Equal(t, raid.ArrayStateDegraded, array.Status().State)
+	assert.NoError(t, array.Write([]byte("Written"), 0), "writes skip the empty slot")
+	copy(data, "Written")
+
+	assert.NoError(t, array.ReplaceDisk(0))
+	assert.FileExists(t, filepath.Join(dir, "disk-0.img"))
+	assert.NoError(t, array.Rebuild(0, nil))
+	assert.Equal(t, raid.ArrayStateOptimal, array.Status().State)
+	assert.Equal(t, []raid.EventType{raid.EventDiskFaulty, raid.EventDiskRemoved}, recorder.types(), "cancelled")
+
+	assert.NoError(t, array.ClearDisk(1))
+	assert.NoError(t, array.ClearDisk(2))
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+// TestArray_RemoveDiskDuringSpareRebuild removes a failed disk once a spare has started rebuilding
+// another slot in the background; run it with -race.
+func TestArray_RemoveDiskDuringSpareRebuild(t *testing.T) {
+	dir := t.TempDir()
+	data := bytes.Repeat([]byte("RemoveWhileRebuilding"), 512)
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid6, 5, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.Write(data, 0))
+	assert.NoError(t, array.AddSpare())
+
+	started := make(chan struct{}, 1)
+	defer array.Subscribe(func(event raid.Event) {
+		if event.Type == raid.EventRebuildStarted {
+			started <- struct{}{}
+		}
+	})()
+	assert.NoError(t, array.ClearDisk(1))
+	<-started
+	assert.NoError(t, array.ClearDisk(2))
+	assert.NoError(t, array.RemoveDisk(2))
+	array.Wait()
+
+	disks := array.Status().Disks
+	assert.Equal(t, raid.DiskStateOnline, disks[1].State, "the spare took the first failed slot")
+	assert.Equal(t, raid.DiskStateRemoved, disks[2].State)
+	assert.NoFileExists(t, filepath.Join(dir, "disk-2.img"))
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+}
+
+func TestArray_WritesDuringSpareRebuild(t *testing.T) {
+	array, err := raid.CreateArray(t.TempDir(), raid.RaidTypeRaid5, 3, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	assert.NoError(t, array.Write(bytes.Repeat([]byte("old!"), 64), 0))
+	assert.NoError(t, array.AddSpare())
+	assert.NoError(t, array.AddSpare())
+
+	// The rebuild runs in the background while writes keep coming
+	assert.NoError(t, array.ClearDisk(2))
+	data := bytes.Repeat([]byte("new!"), 64)
+	for offset := 0; offset < len(data); offset += 16 {
+		assert.NoError(t, array.Write(data[offset:offset+16], offset))
+	}
+	array.Wait()
+	assert.Equal(t, raid.ArrayStateOptimal, array.Status().State)
+	assert.Equal(t, []string{"spare-1.img"}, array.Spares())
+
+	assert.NoError(t, array.ClearDisk(0))
+	array.Wait()
+	assert.Empty(t, array.Spares())
+	assert.NoError(t, array.ClearDisk(1))
+	output, err := array.Read(0, len(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, output)
+	_, err = os.Stat(filepath.Join(array.Dir(), "disk-2.img"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,112 @@
+package raid
+
+// ArrayState summarizes whether an array can still serve all of its data.
+type ArrayState string
+
+const (
+	ArrayStateOptimal  ArrayState = "optimal"
+	ArrayStateDegraded ArrayState = "degraded"
+	ArrayStateFailed   ArrayState = "failed"
+)
+
+// DiskStatus reports the state of a single member disk.
+type DiskStatus struct {
+	ID        int       `json:"id"`
+	State     DiskState `json:"state"`
+	Chunks    int       `json:"chunks"`           // chunks up to the last one written, holes included
+	Allocated int       `json:"allocated_chunks"` // chunks taking up space, i.e. written and not discarded since
+	Size      int       `json:"size,omitempty"`   // declared size in bytes, omitted for disks that grow on demand
+	Faults    *Faults   `json:"faults,omitempty"` // injected faults, if any
+}
+
+// ArrayStatus reports the state of a whole array.
+type ArrayStatus struct {
+	Type           RaidType       `json:"type"`
+	State          ArrayState     `json:"state"`
+	StripeSz       int            `json:"stripe_size"`
+	Layout         ParityLayout   `json:"layout,omitempty"`        // parity layout, for levels that offer a choice
+	Groups         int            `json:"groups,omitempty"`        // parity sub-arrays of nested levels (RAID50, RAID60)
+	Copies         int            `json:"copies,omitempty"`        // copies of every chunk of RAID10 arrays
+	MirrorLayout   MirrorLayout   `json:"mirror_layout,omitempty"` // placement of the copies of RAID10 arrays
+	ReadPolicy     ReadPolicy     `json:"read_policy,omitempty"`   // mirror chosen for reads, for mirrored levels
+	FaultTolerance int            `json:"fault_tolerance"`         // further disk failures the array can absorb without data loss
+	Capacity       int            `json:"capacity"`                // usable logical bytes, see RAIDController.Capacity
+	HighWaterMark  int            `json:"high_water_mark"`         // logical end of the data written so far
+	Disks          []DiskStatus   `json:"disks"`
+	Reshape        *ReshapeStatus `json:"reshape,omitempty"` // set while the array is being reshaped
+}
+
+// StripeParity reports which disks hold the parity shards of one stripe.
+type StripeParity struct {
+	Stripe int   `json:"stripe"`
+	Disks  []int `json:"disks"` // P first, then Q and any further parity shard
+}
+
+// HealthReport extends the status of an array with how much of it is used and where its parity lives.
+type HealthReport struct {
+	ArrayStatus
+	UUID      string         `json:"uuid,omitempty"`   // identity of a persisted array, shared by its member superblocks
+	Events    uint64         `json:"events,omitempty"` // event counter of a persisted array
+	Spares    []string       `json:"spares,omitempty"` // images of the hot spares of a persisted array
+	Usage     float64        `json:"usage"`            // fraction of the usable capacity below the high-water mark
+	Allocated int            `json:"allocated"`        // bytes taking up space on the member disks, redundancy included
+	Parity    []StripeParity `json:"parity,omitempty"` // parity placement of the first stripes, for levels with parity
+}
+
+// NewHealthReport reports the health of controller, listing the parity placement of its first
+// stripes. With stripes <= 0 it covers one stripe per disk, a full rotation of every parity layout.
+func NewHealthReport(controller RAIDController, stripes int) HealthReport {
+	report := HealthReport{ArrayStatus: controller.Status()}
+	if report.Capacity > 0 {
+		report.Usage = float64(report.HighWaterMark) / float64(report.Capacity)
+	}
+	for _, disk := range report.Disks {
+		report.Allocated += disk.Allocated * report.StripeSz
+	}
+	mapper, ok := controller.(ParityMapper)
+	if !ok {
+		return report
+	}
+	if stripes <= 0 {
+		stripes = len(report.Disks)
+	}
+	for stripe := 0; stripe < stripes; stripe++ {
+		report.Parity = append(report.Parity, StripeParity{Stripe: stripe, Disks: mapper.ParityDisks(stripe)})
+	}
+	return report
+}
+
+func diskStatuses(disks []*Disk) []DiskStatus {
+	statuses := make([]DiskStatus, len(disks))
+	for i, disk := range disks {
+		statuses[i] = DiskStatus{ID: disk.ID, State: disk.State, Chunks: disk.ChunkCount(), Allocated: disk.AllocatedChunks(), Size: disk.Size()}
+		if faults := disk.Faults(); !faults.IsZero() {
+			statuses[i].Faults = &faults
+		}
+	}
+	return statuses
+}
+
+// countUnavailable returns how many disks cannot currently serve reads.
+func countUnavailable(disks []*Disk) int {
+	count := 0
+	for _, disk := range disks {
+		if !disk.isOnline() {
+			count++
+		}
+	}
+	return count
+}
+
+// toleranceState derives the array state from the number of unavailable disks and the
+// number of failures the level tolerates, returning the remaining fault tolerance.
+func toleranceState(unavailable, tolerance int) (ArrayState, int) {
+	switch {
+	case unavailable == 0:
+		return ArrayStateOptimal, tolerance
+	case unavailable <= tolerance:
+		return ArrayStateDegraded, tolerance - unavailable
+	default:
+		return ArrayStateFailed, 0
+	}
+}
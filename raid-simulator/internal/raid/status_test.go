@@ -0,0 +1,63 @@
+package raid
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthReport_ParityPlacement(t *testing.T) {
+	controller, err := NewRAID5ControllerWithLayout(4, 2, LayoutLeftSymmetric)
+	assert.NoError(t, err)
+	report := NewHealthReport(controller, 0)
+	assert.Equal(t, []StripeParity{
+		{Stripe: 0, Disks: []int{3}},
+		{Stripe: 1, Disks: []int{2}},
+		{Stripe: 2, Disks: []int{1}},
+		{Stripe: 3, Disks: []int{0}},
+	}, report.Parity, "one stripe per disk covers a full rotation")
+
+	raid6, err := NewRAID6Controller(5, 2)
+	assert.NoError(t, err)
+	report = NewHealthReport(raid6, 2)
+	assert.Equal(t, []StripeParity{{Stripe: 0, Disks: []int{3, 4}}, {Stripe: 1, Disks: []int{3, 4}}}, report.Parity)
+
+	// RAID50 stripes alternate between the groups, each placing parity on its own disks
+	raid50, err := NewRAID50Controller(6, 2, 2)
+	assert.NoError(t, err)
+	report = NewHealthReport(raid50, 4)
+	assert.Equal(t, []StripeParity{
+		{Stripe: 0, Disks: []int{0}},
+		{Stripe: 1, Disks: []int{3}},
+		{Stripe: 2, Disks: []int{1}},
+		{Stripe: 3, Disks: []int{4}},
+	}, report.Parity)
+
+	mirror, err := NewRAID1Controller(2, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, NewHealthReport(mirror, 0).Parity)
+}
+
+func TestHealthReport_UsageAndJSON(t *testing.T) {
+	controller, err := NewSizedController(RaidTypeRaid5, 3, 2, 16)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("eightbyt"), 0))
+	assert.NoError(t, controller.ClearDisk(2))
+
+	report := NewHealthReport(controller, 0)
+	assert.Equal(t, ArrayStateDegraded, report.State)
+	assert.Zero(t, report.FaultTolerance)
+	assert.Equal(t, 32, report.Capacity)
+	assert.InDelta(t, 0.25, report.Usage, 1e-9)
+	assert.Equal(t, DiskStateFailed, report.Disks[2].State)
+
+	raw, err := json.Marshal(report)
+	assert.NoError(t, err)
+	var decoded map[string]any
+	assert.NoError(t, json.Unmarshal(raw, &decoded))
+	assert.Equal(t, "degraded", decoded["state"])
+	assert.Equal(t, 0.25, decoded["usage"])
+	assert.Len(t, decoded["disks"], 3)
+	assert.Len(t, decoded["parity"], 3)
+}
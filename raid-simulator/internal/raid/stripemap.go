@@ -0,0 +1,117 @@
+package raid
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Anthya1104/raid-simulator/internal/blockdev"
+)
+
+// RoleData is the role of a chunk holding data in a stripe map; parity chunks are named by ParityRole.
+const RoleData = "data"
+
+// MapChunk describes one chunk of a stripe map: which disk holds it, what it holds and its stored bytes.
+type MapChunk struct {
+	Disk  int       `json:"disk"`
+	Role  string    `json:"role"`            // RoleData, or the parity shard held, e.g. "P" or "Q"
+	Block int       `json:"block"`           // logical block (chunk) number of a data chunk, -1 for parity
+	State DiskState `json:"state"`           // state of the disk holding the chunk
+	Data  []byte    `json:"data,omitempty"`  // stored bytes, unverified; nil when never written or unreadable
+	Error string    `json:"error,omitempty"` // why the chunk could not be read, if it could not
+}
+
+// MapStripe is one row of a stripe map: the chunks of a stripe in shard order, data first.
+// Levels striping across groups list only the disks of the stripe's group.
+type MapStripe struct {
+	Stripe int        `json:"stripe"`
+	Chunks []MapChunk `json:"chunks"`
+}
+
+// StripeMapper is implemented by levels with parity, which can show where they placed the data
+// and parity chunks of each stripe.
+type StripeMapper interface {
+	// StripeMap returns count stripes starting at first, with the bytes their disks hold.
+	StripeMap(first, count int) ([]MapStripe, error)
+}
+
+// ParityRole names the i-th of count parity shards of a stripe: P and Q for RAID5 and RAID6,
+// numbered P1, P2, ... for wider codes.
+func ParityRole(i, count int) string {
+	if count <= 2 {
+		return []string{"P", "Q"}[i]
+	}
+	return fmt.Sprintf("P%d", i+1)
+}
+
+// StripeMap returns count stripes starting at first, as placed by the level's parity layout.
+func (p *parityArray) StripeMap(first, count int) ([]MapStripe, error) {
+	if first < 0 || count < 0 {
+		return nil, fmt.Errorf("stripe map start and count must be non-negative")
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	unlock := p.stripes.lockRange(first, first+count-1, true)
+	defer unlock()
+
+	numDataShards := p.encoderExtension.DataShards()
+	numParityShards := p.encoderExtension.ParityShards()
+	stripes := make([]MapStripe, count)
+	for i := range stripes {
+		stripeIdx := first + i
+		stripes[i] = MapStripe{Stripe: stripeIdx}
+		for shardIdx, d := range p.placement(stripeIdx, len(p.disks), numParityShards) {
+			chunk := MapChunk{Disk: d, Role: RoleData, Block: stripeIdx*numDataShards + shardIdx, State: p.disks[d].State}
+			if shardIdx >= numDataShards {
+				chunk.Role, chunk.Block = ParityRole(shardIdx-numDataShards, numParityShards), -1
+			}
+			chunk.Data, chunk.Error = mapChunkData(p.disks[d], stripeIdx)
+			stripes[i].Chunks = append(stripes[i].Chunks, chunk)
+		}
+	}
+	return stripes, nil
+}
+
+// mapChunkData reads a chunk for a stripe map without verifying it, so corrupted bytes show as stored.
+func mapChunkData(disk *Disk, index int) ([]byte, string) {
+	if disk.State.isFailed() {
+		return nil, ""
+	}
+	data, err := disk.readRawChunk(index)
+	if errors.Is(err, blockdev.ErrChunkNotFound) {
+		return nil, ""
+	}
+	if err != nil {
+		return nil, err.Error()
+	}
+	return data, ""
+}
+
+// StripeMap returns count logical stripes starting at first. Each is a stripe of one group, whose
+// disks and blocks are numbered as in the whole array.
+func (n *parityGroups) StripeMap(first, count int) ([]MapStripe, error) {
+	if first < 0 || count < 0 {
+		return nil, fmt.Errorf("stripe map start and count must be non-negative")
+	}
+	stripes := make([]MapStripe, count)
+	numDataShards := n.groups[0].encoderExtension.DataShards()
+	for i := range stripes {
+		stripeIdx := first + i
+		g, groupStripe := stripeIdx%len(n.groups), stripeIdx/len(n.groups)
+		groupMap, err := n.groups[g].StripeMap(groupStripe, 1)
+		if err != nil {
+			return nil, err
+		}
+		stripes[i] = MapStripe{Stripe: stripeIdx, Chunks: groupMap[0].Chunks}
+		for c := range stripes[i].Chunks {
+			chunk := &stripes[i].Chunks[c]
+			chunk.Disk += g * n.groupSize()
+			if chunk.Role == RoleData {
+				chunk.Block = stripeIdx*numDataShards + c
+			}
+		}
+	}
+	return stripes, nil
+}
@@ -0,0 +1,108 @@
+package raid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mapRoles lists the disk and role of every chunk of a stripe, data chunks as their block number.
+func mapRoles(stripe MapStripe) [][2]any {
+	var roles [][2]any
+	for _, chunk := range stripe.Chunks {
+		if chunk.Role == RoleData {
+			roles = append(roles, [2]any{chunk.Disk, chunk.Block})
+		} else {
+			roles = append(roles, [2]any{chunk.Disk, chunk.Role})
+		}
+	}
+	return roles
+}
+
+func TestStripeMap_RAID5LeftSymmetric(t *testing.T) {
+	controller, err := NewRAID5ControllerWithLayout(4, 2, LayoutLeftSymmetric)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("AABBCCDDEEFF"), 0))
+
+	stripes, err := controller.StripeMap(0, 4)
+	assert.NoError(t, err)
+	assert.Len(t, stripes, 4)
+	assert.Equal(t, [][2]any{{0, 0}, {1, 1}, {2, 2}, {3, "P"}}, mapRoles(stripes[0]))
+	assert.Equal(t, [][2]any{{3, 3}, {0, 4}, {1, 5}, {2, "P"}}, mapRoles(stripes[1]))
+	assert.Equal(t, [][2]any{{1, 9}, {2, 10}, {3, 11}, {0, "P"}}, mapRoles(stripes[3]))
+
+	assert.Equal(t, []byte("AA"), stripes[0].Chunks[0].Data)
+	assert.Equal(t, []byte("FF"), stripes[1].Chunks[2].Data)
+	assert.Equal(t, []byte{'A' ^ 'B' ^ 'C', 'A' ^ 'B' ^ 'C'}, stripes[0].Chunks[3].Data)
+	assert.Nil(t, stripes[2].Chunks[0].Data, "never written")
+
+	stripes, err = controller.StripeMap(5, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, stripes[0].Stripe, "stripe 5 repeats the rotation of stripe 1")
+	assert.Equal(t, [][2]any{{3, 15}, {0, 16}, {1, 17}, {2, "P"}}, mapRoles(stripes[0]))
+
+	_, err = controller.StripeMap(-1, 2)
+	assert.Error(t, err)
+}
+
+func TestStripeMap_ParityRoles(t *testing.T) {
+	raid6, err := NewRAID6Controller(5, 2)
+	assert.NoError(t, err)
+	stripes, err := raid6.StripeMap(0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, [][2]any{{0, 0}, {1, 1}, {2, 2}, {3, "P"}, {4, "Q"}}, mapRoles(stripes[0]))
+
+	ec, err := NewErasureCodedController(2, 3, 2)
+	assert.NoError(t, err)
+	stripes, err = ec.StripeMap(0, 1)
+	assert.NoError(t, err)
+	var roles []string
+	for _, chunk := range stripes[0].Chunks {
+		roles = append(roles, chunk.Role)
+	}
+	assert.Equal(t, []string{RoleData, RoleData, "P1", "P2", "P3"}, roles)
+}
+
+func TestStripeMap_RAID50OffsetsGroups(t *testing.T) {
+	controller, err := NewRAID50Controller(6, 2, 2)
+	assert.NoError(t, err)
+	stripes, err := controller.StripeMap(0, 4)
+	assert.NoError(t, err)
+
+	// Stripes alternate between the groups, which place parity like the health report shows and their
+	// data in disk order around it
+	assert.Equal(t, [][2]any{{1, 0}, {2, 1}, {0, "P"}}, mapRoles(stripes[0]))
+	assert.Equal(t, [][2]any{{4, 2}, {5, 3}, {3, "P"}}, mapRoles(stripes[1]))
+	assert.Equal(t, [][2]any{{0, 4}, {2, 5}, {1, "P"}}, mapRoles(stripes[2]))
+	assert.Equal(t, [][2]any{{3, 6}, {5, 7}, {4, "P"}}, mapRoles(stripes[3]))
+}
+
+func TestStripeMap_ShowsFailedAndCorruptChunks(t *testing.T) {
+	controller, err := NewRAID5ControllerWithLayout(3, 4, LayoutLeftSymmetric)
+	assert.NoError(t, err)
+	assert.NoError(t, controller.Write([]byte("ABCDEFGH"), 0))
+	// Stripe 0 holds D0 on disk 0, D1 on disk 1 and parity on disk 2
+	assert.NoError(t, controller.disks[0].CorruptChunk(0, 0, 1))
+	assert.NoError(t, controller.ClearDisk(1))
+	assert.NoError(t, controller.disks[2].InjectFaults(Faults{BadChunks: []int{0}}))
+
+	stripes, err := controller.StripeMap(0, 1)
+	assert.NoError(t, err)
+	chunks := stripes[0].Chunks
+	assert.Equal(t, []byte{'A' ^ 0xFF, 'B', 'C', 'D'}, chunks[0].Data, "stored bytes are shown unverified")
+	assert.Equal(t, DiskStateFailed, chunks[1].State)
+	assert.Nil(t, chunks[1].Data)
+	assert.Equal(t, "P", chunks[2].Role)
+	assert.Nil(t, chunks[2].Data)
+	assert.NotEmpty(t, chunks[2].Error)
+}
+
+func TestArray_StripeMapRequiresParity(t *testing.T) {
+	array, err := CreateArray(t.TempDir(), RaidTypeRaid1, 2, 2, 0, ControllerOptions{})
+	assert.NoError(t, err)
+	defer array.Close()
+	_, err = array.StripeMap(0, 2)
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "no parity layout")
+	}
+}
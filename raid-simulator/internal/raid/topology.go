@@ -0,0 +1,390 @@
+package raid
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// topologyDisk is the member type of a topology standing for a single plain disk.
+const topologyDisk RaidType = "disk"
+
+// Topology describes a composite array: a RAID level whose members are plain disks or arrays of
+// their own, nested to any depth. It is written either as a spec string, where a number stands for
+// that many plain disks and "N x" repeats a member:
+//
+//	raid0(2 x raid1(2))              a stripe of two mirrors
+//	raid1(2 x raid0(3))              a mirror of two stripes
+//	raid0(3 x raid6(5))              a stripe of three RAID6 arrays
+//	raid5[layout=left-symmetric](2, raid1(2))
+//	raid0(2 x raid10[copies=3,mirror_layout=far](4))
+//
+// or as a YAML document with the same structure:
+//
+//	type: raid0
+//	members:
+//	  - type: raid1
+//	    disks: 2
+//	    count: 2
+type Topology struct {
+	Type         RaidType     `yaml:"type"`
+	Layout       ParityLayout `yaml:"layout,omitempty"`        // parity layout of a raid5 or raid50 level
+	Groups       int          `yaml:"groups,omitempty"`        // parity groups of a raid50 or raid60 level
+	Copies       int          `yaml:"copies,omitempty"`        // copies of every chunk of a raid10 level
+	MirrorLayout MirrorLayout `yaml:"mirror_layout,omitempty"` // copy placement of a raid10 level
+	ReadPolicy   ReadPolicy   `yaml:"read_policy,omitempty"`   // read policy of a raid1 or raid10 level
+	Disks        int          `yaml:"disks,omitempty"`         // plain member disks, placed before Members
+	Members      []Topology   `yaml:"members,omitempty"`       // member arrays, or plain disks of type "disk"
+	Count        int          `yaml:"count,omitempty"`         // repeats this member Count times in its parent
+}
+
+// options returns the level settings of the topology's root.
+func (t Topology) options() ControllerOptions {
+	return ControllerOptions{Layout: t.Layout, Groups: t.Groups, Copies: t.Copies, MirrorLayout: t.MirrorLayout, ReadPolicy: t.ReadPolicy}
+}
+
+// withOptions returns a topology of the given type, disks and members carrying the level settings of t.
+func (t Topology) withOptions(raidType RaidType, disks int, members []Topology) Topology {
+	return Topology{
+		Type:         raidType,
+		Layout:       t.Layout,
+		Groups:       t.Groups,
+		Copies:       t.Copies,
+		MirrorLayout: t.MirrorLayout,
+		ReadPolicy:   t.ReadPolicy,
+		Disks:        disks,
+		Members:      members,
+	}
+}
+
+// IsComposite reports whether raidType is a topology spec, e.g. "raid0(2 x raid1(2))", rather than a single level.
+func IsComposite(raidType RaidType) bool {
+	return strings.ContainsAny(string(raidType), "([")
+}
+
+// ParseTopology parses a topology spec string. The result lists every member explicitly,
+// with Disks and Count expanded.
+func ParseTopology(spec string) (Topology, error) {
+	p := &specParser{spec: spec}
+	topology, err := p.node()
+	if err == nil {
+		p.skipSpace()
+		if p.pos < len(p.spec) {
+			err = fmt.Errorf("unexpected %q at offset %d", p.spec[p.pos:], p.pos)
+		}
+	}
+	if err == nil {
+		topology, err = topology.normalize(true)
+	}
+	if err != nil {
+		return Topology{}, fmt.Errorf("invalid topology %q: %w", spec, err)
+	}
+	return topology, nil
+}
+
+// ParseTopologyYAML parses a topology written as YAML. Like ParseTopology, the result lists every
+// member explicitly.
+func ParseTopologyYAML(data []byte) (Topology, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var topology Topology
+	if err := decoder.Decode(&topology); err != nil {
+		return Topology{}, fmt.Errorf("invalid topology: %w", err)
+	}
+	topology, err := topology.normalize(true)
+	if err != nil {
+		return Topology{}, fmt.Errorf("invalid topology: %w", err)
+	}
+	return topology, nil
+}
+
+// normalize validates the topology and expands Disks and Count into explicit members.
+// An "ec:k+m" level without members gets its k+m plain disks.
+func (t Topology) normalize(root bool) (Topology, error) {
+	if t.Type == topologyDisk {
+		if root {
+			return Topology{}, fmt.Errorf("the root of a topology must be a RAID level, not a plain disk")
+		}
+		if t.Disks != 0 || len(t.Members) > 0 || t.options() != (ControllerOptions{}) {
+			return Topology{}, fmt.Errorf("a plain disk has no members or settings")
+		}
+		return Topology{Type: topologyDisk}, nil
+	}
+	if t.Type == "" {
+		return Topology{}, fmt.Errorf("every array needs a RAID type")
+	}
+	if IsComposite(t.Type) {
+		return Topology{}, fmt.Errorf("nested array %s must be written as a member, not as a type", t.Type)
+	}
+	if _, err := lookupFactory(t.Type); err != nil {
+		return Topology{}, err
+	}
+	if t.Disks < 0 || t.Groups < 0 || t.Copies < 0 {
+		return Topology{}, fmt.Errorf("%s: disk, group and copy counts must be non-negative", t.Type)
+	}
+
+	normalized := t.withOptions(t.Type, 0, nil)
+	for i := 0; i < t.Disks; i++ {
+		normalized.Members = append(normalized.Members, Topology{Type: topologyDisk})
+	}
+	for _, member := range t.Members {
+		if member.Count < 0 {
+			return Topology{}, fmt.Errorf("%s: member count must be non-negative. Provided: %d", member.Type, member.Count)
+		}
+		expanded, err := member.normalize(false)
+		if err != nil {
+			return Topology{}, err
+		}
+		for i := 0; i < max(member.Count, 1); i++ {
+			normalized.Members = append(normalized.Members, expanded)
+		}
+	}
+	if len(normalized.Members) == 0 {
+		if !IsErasureCoded(t.Type) {
+			return Topology{}, fmt.Errorf("%s needs at least one member", t.Type)
+		}
+		diskCount, err := FixedDiskCount(t.Type)
+		if err != nil {
+			return Topology{}, err
+		}
+		return t.withOptions(t.Type, diskCount, nil).normalize(root)
+	}
+	return normalized, nil
+}
+
+// DiskCount returns the number of plain disks in the topology.
+func (t Topology) DiskCount() int {
+	if t.Type == topologyDisk {
+		return 1
+	}
+	count := t.Disks
+	for _, member := range t.Members {
+		count += max(member.Count, 1) * member.DiskCount()
+	}
+	if count == 0 && IsErasureCoded(t.Type) {
+		count, _ = FixedDiskCount(t.Type)
+	}
+	return count
+}
+
+// RaidType returns the canonical spec string of the topology, under which composite arrays are built.
+func (t Topology) RaidType() RaidType {
+	return RaidType(t.String())
+}
+
+// String renders the topology as a spec string, grouping runs of identical members.
+func (t Topology) String() string {
+	if t.Type == topologyDisk {
+		return string(topologyDisk)
+	}
+	var b strings.Builder
+	b.WriteString(string(t.Type))
+
+	var options []string
+	if t.Layout != "" {
+		options = append(options, "layout="+string(t.Layout))
+	}
+	if t.Groups != 0 {
+		options = append(options, "groups="+strconv.Itoa(t.Groups))
+	}
+	if t.Copies != 0 {
+		options = append(options, "copies="+strconv.Itoa(t.Copies))
+	}
+	if t.MirrorLayout != "" {
+		options = append(options, "mirror_layout="+string(t.MirrorLayout))
+	}
+	if t.ReadPolicy != "" {
+		options = append(options, "read_policy="+string(t.ReadPolicy))
+	}
+	if len(options) > 0 {
+		b.WriteString("[" + strings.Join(options, ",") + "]")
+	}
+
+	var members []string
+	for i := 0; i < t.Disks; i++ {
+		members = append(members, string(topologyDisk))
+	}
+	for _, member := range t.Members {
+		for i := 0; i < max(member.Count, 1); i++ {
+			member.Count = 0
+			members = append(members, member.String())
+		}
+	}
+	var groups []string
+	for i := 0; i < len(members); {
+		run := 1
+		for i+run < len(members) && members[i+run] == members[i] {
+			run++
+		}
+		switch {
+		case members[i] == string(topologyDisk):
+			groups = append(groups, strconv.Itoa(run))
+		case run > 1:
+			groups = append(groups, fmt.Sprintf("%d x %s", run, members[i]))
+		default:
+			groups = append(groups, members[i])
+		}
+		i += run
+	}
+	b.WriteString("(" + strings.Join(groups, ", ") + ")")
+	return b.String()
+}
+
+// specParser is a recursive-descent parser of topology spec strings:
+//
+//	node    = type [ "[" option { "," option } "]" ] [ "(" member { "," member } ")" ]
+//	member  = count | count ( "x" | "*" ) node | node
+//	option  = ( "layout" | "groups" | "copies" | "mirror_layout" | "read_policy" ) "=" value
+type specParser struct {
+	spec string
+	pos  int
+}
+
+func (p *specParser) skipSpace() {
+	for p.pos < len(p.spec) && p.spec[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// consume skips c, and the spaces before it, if it comes next.
+func (p *specParser) consume(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.spec) && p.spec[p.pos] == c {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *specParser) expect(c byte) error {
+	if !p.consume(c) {
+		return fmt.Errorf("expected %q at offset %d", c, p.pos)
+	}
+	return nil
+}
+
+// word reads the longest run of characters accepted by valid, which must not be empty.
+func (p *specParser) word(what string, valid func(c byte) bool) (string, error) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.spec) && valid(p.spec[p.pos]) {
+		p.pos++
+	}
+	if p.pos == start {
+		return "", fmt.Errorf("expected %s at offset %d", what, start)
+	}
+	return p.spec[start:p.pos], nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isNameChar(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || strings.IndexByte(":+-_", c) >= 0
+}
+
+func (p *specParser) node() (Topology, error) {
+	name, err := p.word("a RAID type", isNameChar)
+	if err != nil {
+		return Topology{}, err
+	}
+	t := Topology{Type: RaidType(strings.ToLower(name))}
+
+	if p.consume('[') {
+		for {
+			if err := p.option(&t); err != nil {
+				return Topology{}, err
+			}
+			if !p.consume(',') {
+				break
+			}
+		}
+		if err := p.expect(']'); err != nil {
+			return Topology{}, err
+		}
+	}
+
+	if p.consume('(') {
+		for {
+			if err := p.member(&t); err != nil {
+				return Topology{}, err
+			}
+			if !p.consume(',') {
+				break
+			}
+		}
+		if err := p.expect(')'); err != nil {
+			return Topology{}, err
+		}
+	}
+	return t, nil
+}
+
+func (p *specParser) option(t *Topology) error {
+	key, err := p.word("an option", isNameChar)
+	if err != nil {
+		return err
+	}
+	if err := p.expect('='); err != nil {
+		return err
+	}
+	value, err := p.word("an option value", isNameChar)
+	if err != nil {
+		return err
+	}
+	switch key {
+	case "layout":
+		t.Layout = ParityLayout(value)
+	case "groups":
+		if t.Groups, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid group count %q", value)
+		}
+	case "copies":
+		if t.Copies, err = strconv.Atoi(value); err != nil {
+			return fmt.Errorf("invalid copy count %q", value)
+		}
+	case "mirror_layout":
+		t.MirrorLayout = MirrorLayout(value)
+	case "read_policy":
+		t.ReadPolicy = ReadPolicy(value)
+	default:
+		return fmt.Errorf("unknown option %q, expected layout, groups, copies, mirror_layout or read_policy", key)
+	}
+	return nil
+}
+
+func (p *specParser) member(t *Topology) error {
+	p.skipSpace()
+	if p.pos >= len(p.spec) || !isDigit(p.spec[p.pos]) {
+		member, err := p.node()
+		if err != nil {
+			return err
+		}
+		t.Members = append(t.Members, member)
+		return nil
+	}
+
+	digits, err := p.word("a count", isDigit)
+	if err != nil {
+		return err
+	}
+	count, err := strconv.Atoi(digits)
+	if err != nil || count < 1 {
+		return fmt.Errorf("invalid count %q", digits)
+	}
+	if !p.consume('x') && !p.consume('*') {
+		t.Members = append(t.Members, Topology{Type: topologyDisk, Count: count})
+		return nil
+	}
+	member, err := p.node()
+	if err != nil {
+		return err
+	}
+	member.Count = count
+	t.Members = append(t.Members, member)
+	return nil
+}
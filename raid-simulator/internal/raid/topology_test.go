@@ -0,0 +1,93 @@
+package raid
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTopology(t *testing.T) {
+	cases := []struct {
+		spec      string
+		canonical string
+		diskCount int
+	}{
+		{"raid0(2 x raid1(2))", "raid0(2 x raid1(2))", 4},
+		{"RAID0( raid1(disk, disk), raid1(2) )", "raid0(2 x raid1(2))", 4},
+		{"raid1(2*raid0(3))", "raid1(2 x raid0(3))", 6},
+		{"raid0(3x raid6(5))", "raid0(3 x raid6(5))", 15},
+		{"raid0(2 x ec:4+2)", "raid0(2 x ec:4+2(6))", 12},
+		{"raid5[layout=left-symmetric](2, raid1(2))", "raid5[layout=left-symmetric](2, raid1(2))", 4},
+		{"raid1(raid50[groups=3](9), raid0(1, 2 x disk))", "raid1(raid50[groups=3](9), raid0(3))", 12},
+		{"raid0(2 x raid10[copies=3, mirror_layout=offset, read_policy=round-robin](4))", "raid0(2 x raid10[copies=3,mirror_layout=offset,read_policy=round-robin](4))", 8},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.spec, func(t *testing.T) {
+			topology, err := ParseTopology(tc.spec)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.canonical, topology.String())
+			assert.Equal(t, RaidType(tc.canonical), topology.RaidType())
+			assert.Equal(t, tc.diskCount, topology.DiskCount())
+
+			diskCount, err := FixedDiskCount(RaidType(tc.spec))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.diskCount, diskCount)
+
+			reparsed, err := ParseTopology(topology.String())
+			assert.NoError(t, err)
+			assert.Equal(t, topology, reparsed)
+		})
+	}
+}
+
+func TestParseTopology_Invalid(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"raid0",
+		"disk",
+		"raid0(",
+		"raid0(2",
+		"raid0(2))",
+		"raid0(2 x)",
+		"raid0(0)",
+		"raid0(disk(2))",
+		"raid7(2)",
+		"raid0(raid1(2)(2))",
+		"raid5[color=red](3)",
+		"raid50[groups=many](6)",
+		"raid10[copies=two](4)",
+	} {
+		_, err := ParseTopology(spec)
+		assert.Error(t, err, "%q", spec)
+	}
+}
+
+func TestParseTopologyYAML(t *testing.T) {
+	topology, err := ParseTopologyYAML([]byte(`
+type: raid0
+members:
+  - type: raid1
+    disks: 2
+    count: 2
+  - type: raid5
+    layout: left-symmetric
+    members:
+      - type: disk
+        count: 2
+      - type: raid1
+        disks: 2
+`))
+	assert.NoError(t, err)
+	expected, err := ParseTopology("raid0(2 x raid1(2), raid5[layout=left-symmetric](2, raid1(2)))")
+	assert.NoError(t, err)
+	assert.Equal(t, expected, topology)
+	assert.Equal(t, 8, topology.DiskCount())
+
+	_, err = ParseTopologyYAML([]byte("type: raid1\ndisk: 2\n"))
+	assert.Error(t, err, "unknown fields are refused")
+	_, err = ParseTopologyYAML([]byte("type: disk\n"))
+	assert.Error(t, err)
+	_, err = ParseTopologyYAML([]byte("type: raid1\nmembers:\n  - type: raid0\n    count: -1\n    disks: 2\n"))
+	assert.Error(t, err)
+}
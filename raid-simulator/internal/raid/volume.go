@@ -0,0 +1,210 @@
+package raid
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// Volume exposes a RAID controller as a block device of fixed logical size implementing
+// io.ReaderAt, io.WriterAt, io.ReadWriteSeeker and io.Closer. Bytes that were never written
+// read back as zeros, reads stop with io.EOF at the end of the volume and writes past it fail
+// with ErrOutOfSpace.
+type Volume struct {
+	controller RAIDController
+	size       int64
+
+	mu     sync.Mutex // guards pos
+	pos    int64
+	closed atomic.Bool
+}
+
+var (
+	_ io.ReaderAt        = (*Volume)(nil)
+	_ io.WriterAt        = (*Volume)(nil)
+	_ io.ReadWriteSeeker = (*Volume)(nil)
+	_ io.Closer          = (*Volume)(nil)
+)
+
+// NewVolume wraps controller in a volume of size bytes.
+func NewVolume(controller RAIDController, size int64) (*Volume, error) {
+	if controller == nil {
+		return nil, fmt.Errorf("volume requires a controller")
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("volume size must be greater than 0. Provided: %d", size)
+	}
+	return &Volume{controller: controller, size: size}, nil
+}
+
+// Size returns the logical size of the volume in bytes.
+func (v *Volume) Size() int64 {
+	return v.size
+}
+
+// Controller returns the controller backing the volume.
+func (v *Volume) Controller() RAIDController {
+	return v.controller
+}
+
+// ReadAt reads len(p) bytes starting at off. It returns io.EOF when the read reaches the end of the volume.
+func (v *Volume) ReadAt(p []byte, off int64) (int, error) {
+	if err := v.checkOpen(); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("volume: negative offset %d", off)
+	}
+	if off >= v.size {
+		return 0, io.EOF
+	}
+	n := int(min(int64(len(p)), v.size-off))
+
+	// Only the part of the range below the high-water mark is read; the rest was never written
+	stored := min(int64(v.controller.HighWaterMark())-off, int64(n))
+	if stored > 0 {
+		data, err := v.controller.Read(int(off), int(stored))
+		if err != nil {
+			return 0, fmt.Errorf("volume: failed to read %d bytes at offset %d: %w", stored, off, err)
+		}
+		copy(p, data)
+		stored = int64(len(data))
+	}
+	clear(p[max(stored, 0):n])
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// WriteAt writes p starting at off. Bytes that do not fit in the volume are not written and
+// ErrOutOfSpace is returned along with the number of bytes that were.
+func (v *Volume) WriteAt(p []byte, off int64) (int, error) {
+	if err := v.checkOpen(); err != nil {
+		return 0, err
+	}
+	if off < 0 {
+		return 0, fmt.Errorf("volume: negative offset %d", off)
+	}
+	if off >= v.size {
+		if len(p) == 0 {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("volume: write at offset %d: %w (volume size %d)", off, ErrOutOfSpace, v.size)
+	}
+	n := int(min(int64(len(p)), v.size-off))
+	if err := v.controller.Write(p[:n], int(off)); err != nil {
+		return 0, fmt.Errorf("volume: failed to write %d bytes at offset %d: %w", n, off, err)
+	}
+	if n < len(p) {
+		return n, fmt.Errorf("volume: write of %d bytes at offset %d: %w (volume size %d)", len(p), off, ErrOutOfSpace, v.size)
+	}
+	return n, nil
+}
+
+// Discard discards length bytes starting at off, up to the end of the volume, so they read back as
+// zeros. Controllers that cannot discard get the range overwritten with zeros instead.
+func (v *Volume) Discard(off, length int64) error {
+	if err := v.checkOpen(); err != nil {
+		return err
+	}
+	if off < 0 || length < 0 {
+		return fmt.Errorf("volume: negative discard offset %d or length %d", off, length)
+	}
+	n := min(length, v.size-off)
+	if n <= 0 {
+		return nil
+	}
+	discarder, ok := v.controller.(Discarder)
+	if !ok {
+		_, err := v.WriteAt(make([]byte, n), off)
+		return err
+	}
+	if err := discarder.Discard(int(off), int(n)); err != nil {
+		return fmt.Errorf("volume: failed to discard %d bytes at offset %d: %w", n, off, err)
+	}
+	return nil
+}
+
+// Flush persists what was written so far if the controller keeps state of its own, as an Array
+// does in its superblock and checksum files. In-memory controllers have nothing to flush.
+func (v *Volume) Flush() error {
+	if err := v.checkOpen(); err != nil {
+		return err
+	}
+	if saver, ok := v.controller.(interface{ Save() error }); ok {
+		if err := saver.Save(); err != nil {
+			return fmt.Errorf("volume: failed to flush: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read reads from the current position and advances it.
+func (v *Volume) Read(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	n, err := v.ReadAt(p, v.pos)
+	v.pos += int64(n)
+	return n, err
+}
+
+// Write writes at the current position and advances it.
+func (v *Volume) Write(p []byte) (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	n, err := v.WriteAt(p, v.pos)
+	v.pos += int64(n)
+	return n, err
+}
+
+// Seek sets the position for the next Read or Write. Seeking past the end is allowed;
+// reads there return io.EOF and writes ErrOutOfSpace.
+func (v *Volume) Seek(offset int64, whence int) (int64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.closed.Load() {
+		return 0, os.ErrClosed
+	}
+	var pos int64
+	switch whence {
+	case io.SeekStart:
+		pos = offset
+	case io.SeekCurrent:
+		pos = v.pos + offset
+	case io.SeekEnd:
+		pos = v.size + offset
+	default:
+		return 0, fmt.Errorf("volume: invalid whence %d", whence)
+	}
+	if pos < 0 {
+		return 0, fmt.Errorf("volume: negative position %d", pos)
+	}
+	v.pos = pos
+	return pos, nil
+}
+
+// Close closes the volume, and the controller too when it holds resources of its own (such as an Array).
+func (v *Volume) Close() error {
+	if !v.closed.CompareAndSwap(false, true) {
+		return os.ErrClosed
+	}
+
+	if closer, ok := v.controller.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+func (v *Volume) checkOpen() error {
+	if v.closed.Load() {
+		return os.ErrClosed
+	}
+	return nil
+}
@@ -0,0 +1,175 @@
+package raid_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestVolume(t *testing.T, raidType raid.RaidType, diskCount int, size int64) *raid.Volume {
+	t.Helper()
+	controller, err := raid.NewController(raidType, diskCount, 4)
+	assert.NoError(t, err)
+	volume, err := raid.NewVolume(controller, size)
+	assert.NoError(t, err)
+	return volume
+}
+
+func TestVolume_ReadAtUnwrittenAndPastEnd(t *testing.T) {
+	volume := newTestVolume(t, raid.RaidTypeRaid5, 3, 64)
+
+	buf := bytes.Repeat([]byte{0xAA}, 16)
+	n, err := volume.ReadAt(buf, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, n)
+	assert.Equal(t, make([]byte, 16), buf, "unwritten bytes read back as zeros")
+
+	n, err = volume.WriteAt([]byte("hello"), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, n)
+
+	n, err = volume.ReadAt(buf, 8)
+	assert.NoError(t, err)
+	assert.Equal(t, 16, n)
+	assert.Equal(t, append(append([]byte{0, 0}, "hello"...), make([]byte, 9)...), buf)
+
+	n, err = volume.ReadAt(buf, 56)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 8, n)
+
+	n, err = volume.ReadAt(buf, 64)
+	assert.ErrorIs(t, err, io.EOF)
+	assert.Equal(t, 0, n)
+
+	_, err = volume.ReadAt(buf, -1)
+	assert.Error(t, err)
+}
+
+func TestVolume_WriteAtPastEnd(t *testing.T) {
+	volume := newTestVolume(t, raid.RaidTypeRaid0, 2, 10)
+
+	n, err := volume.WriteAt([]byte("0123456789AB"), 4)
+	assert.ErrorIs(t, err, raid.ErrOutOfSpace)
+	assert.Equal(t, 6, n)
+
+	n, err = volume.WriteAt([]byte("x"), 10)
+	assert.ErrorIs(t, err, raid.ErrOutOfSpace)
+	assert.Equal(t, 0, n)
+
+	buf := make([]byte, 10)
+	n, err = volume.ReadAt(buf, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, 10, n)
+	assert.Equal(t, append(make([]byte, 4), "012345"...), buf)
+}
+
+func TestVolume_Seek(t *testing.T) {
+	volume := newTestVolume(t, raid.RaidTypeRaid1, 2, 32)
+
+	_, err := volume.Write([]byte("abcdef"))
+	assert.NoError(t, err)
+
+	pos, err := volume.Seek(-2, io.SeekCurrent)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), pos)
+	buf := make([]byte, 2)
+	_, err = io.ReadFull(volume, buf)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("ef"), buf)
+
+	pos, err = volume.Seek(-4, io.SeekEnd)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(28), pos)
+	rest, err := io.ReadAll(volume)
+	assert.NoError(t, err)
+	assert.Len(t, rest, 4)
+
+	_, err = volume.Seek(-1, io.SeekStart)
+	assert.Error(t, err)
+	_, err = volume.Seek(0, 42)
+	assert.Error(t, err)
+}
+
+func TestVolume_TarRoundTrip(t *testing.T) {
+	for _, level := range concurrencyLevels {
+		t.Run(string(level.raidType), func(t *testing.T) {
+			volume := newTestVolume(t, level.raidType, level.diskCount, 16*1024)
+			files := map[string][]byte{
+				"readme.txt": []byte("a tar archive stored on a simulated RAID array"),
+				"data.bin":   bytes.Repeat([]byte{1, 2, 3, 4, 5}, 300),
+			}
+
+			tw := tar.NewWriter(volume)
+			for _, name := range []string{"readme.txt", "data.bin"} {
+				assert.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(files[name]))}))
+				_, err := tw.Write(files[name])
+				assert.NoError(t, err)
+			}
+			assert.NoError(t, tw.Close())
+
+			_, err := volume.Seek(0, io.SeekStart)
+			assert.NoError(t, err)
+			tr := tar.NewReader(volume)
+			read := map[string][]byte{}
+			for {
+				header, err := tr.Next()
+				if err == io.EOF {
+					break
+				}
+				assert.NoError(t, err)
+				content, err := io.ReadAll(tr)
+				assert.NoError(t, err)
+				read[header.Name] = content
+			}
+			assert.Equal(t, files, read)
+		})
+	}
+}
+
+func TestVolume_CopyWholeVolume(t *testing.T) {
+	volume := newTestVolume(t, raid.RaidTypeRaid6, 4, 100)
+	_, err := volume.WriteAt([]byte("tail"), 96)
+	assert.NoError(t, err)
+
+	var out bytes.Buffer
+	n, err := io.Copy(&out, io.NewSectionReader(volume, 0, volume.Size()))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(100), n)
+	assert.Equal(t, []byte("tail"), out.Bytes()[96:])
+}
+
+func TestVolume_CloseClosesArray(t *testing.T) {
+	dir := t.TempDir()
+	array, err := raid.CreateArray(dir, raid.RaidTypeRaid5, 3, 4, 0, raid.ControllerOptions{})
+	assert.NoError(t, err)
+	volume, err := raid.NewVolume(array, 64)
+	assert.NoError(t, err)
+
+	_, err = volume.WriteAt([]byte("persisted"), 3)
+	assert.NoError(t, err)
+	assert.NoError(t, volume.Close())
+	assert.ErrorIs(t, volume.Close(), os.ErrClosed)
+	_, err = volume.ReadAt(make([]byte, 1), 0)
+	assert.ErrorIs(t, err, os.ErrClosed)
+
+	reopened, err := raid.OpenArray(dir)
+	assert.NoError(t, err)
+	defer reopened.Close()
+	output, err := reopened.Read(3, 9)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("persisted"), output)
+}
+
+func TestNewVolume_Invalid(t *testing.T) {
+	controller, err := raid.NewController(raid.RaidTypeRaid0, 2, 4)
+	assert.NoError(t, err)
+	_, err = raid.NewVolume(controller, 0)
+	assert.Error(t, err)
+	_, err = raid.NewVolume(nil, 10)
+	assert.Error(t, err)
+}
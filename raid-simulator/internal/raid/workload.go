@@ -0,0 +1,312 @@
+package raid
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"time"
+)
+
+// WorkloadPattern selects where the I/Os of a workload land.
+type WorkloadPattern string
+
+const (
+	// WorkloadSequential issues every I/O right after the previous one, wrapping around at the end of the span.
+	WorkloadSequential WorkloadPattern = "sequential"
+	// WorkloadRandom issues every I/O at a random offset of the span, aligned to the I/O size.
+	WorkloadRandom WorkloadPattern = "random"
+)
+
+// WorkloadPatterns lists every supported workload pattern.
+func WorkloadPatterns() []WorkloadPattern {
+	return []WorkloadPattern{WorkloadSequential, WorkloadRandom}
+}
+
+// Workload describes the logical I/Os replayed against an array by RunWorkload.
+type Workload struct {
+	Pattern    WorkloadPattern `json:"pattern"`
+	ReadRatio  float64         `json:"read_ratio"`  // fraction of the I/Os that are reads, from 0 to 1
+	IOSize     int             `json:"io_size"`     // bytes of every I/O
+	QueueDepth int             `json:"queue_depth"` // I/Os kept in flight by the performance model
+	Ops        int             `json:"ops"`         // number of I/Os
+	Span       int             `json:"span"`        // bytes at the start of the array the I/Os fall in
+	Seed       int64           `json:"seed"`        // seed of the random offsets, operations and data
+}
+
+// DiskModel describes the performance of every member disk, for estimating how fast an array
+// runs a workload. A zero model disables the estimate.
+type DiskModel struct {
+	Latency    time.Duration `json:"latency"`    // positioning time paid by every chunk I/O
+	Throughput float64       `json:"throughput"` // transfer rate in bytes per second, 0 for instant transfers
+}
+
+// enabled reports whether the model estimates anything.
+func (m DiskModel) enabled() bool {
+	return m.Latency > 0 || m.Throughput > 0
+}
+
+// serviceTime returns how long a disk takes to serve one chunk I/O of chunkSz bytes.
+func (m DiskModel) serviceTime(chunkSz int) time.Duration {
+	service := m.Latency
+	if m.Throughput > 0 {
+		service += time.Duration(float64(chunkSz) / m.Throughput * float64(time.Second))
+	}
+	return service
+}
+
+// OpStats counts the logical I/Os of one kind and the chunk I/Os they caused on the disks.
+type OpStats struct {
+	Op          string `json:"op"` // "read" or "write"
+	Count       int    `json:"count"`
+	Bytes       int64  `json:"bytes"`
+	ChunkReads  int64  `json:"chunk_reads"`
+	ChunkWrites int64  `json:"chunk_writes"`
+}
+
+// ReadsPerOp returns the chunk reads caused by an average I/O, e.g. 2 for a small RAID5
+// write reading the old data and parity back.
+func (o OpStats) ReadsPerOp() float64 {
+	return perOp(o.ChunkReads, o.Count)
+}
+
+// WritesPerOp returns the chunk writes caused by an average I/O.
+func (o OpStats) WritesPerOp() float64 {
+	return perOp(o.ChunkWrites, o.Count)
+}
+
+func perOp(total int64, count int) float64 {
+	if count == 0 {
+		return 0
+	}
+	return float64(total) / float64(count)
+}
+
+// DiskLoad is the share of a workload served by one disk.
+type DiskLoad struct {
+	Disk        int           `json:"disk"`
+	Reads       int64         `json:"reads"`
+	Writes      int64         `json:"writes"`
+	Busy        time.Duration `json:"busy,omitempty"`        // modelled time spent serving I/O
+	Utilization float64       `json:"utilization,omitempty"` // busy time over the modelled run time
+}
+
+// PerfEstimate is the performance of a workload predicted by a DiskModel.
+type PerfEstimate struct {
+	Elapsed     time.Duration `json:"elapsed"`
+	IOPS        float64       `json:"iops"`
+	Bandwidth   float64       `json:"bandwidth"`    // logical bytes per second
+	MeanLatency time.Duration `json:"mean_latency"` // from issuing an I/O to its completion
+}
+
+// WorkloadReport is the outcome of RunWorkload.
+type WorkloadReport struct {
+	Workload Workload      `json:"workload"`
+	Model    DiskModel     `json:"model"`
+	Ops      []OpStats     `json:"ops"` // reads first, then writes
+	Disks    []DiskLoad    `json:"disks"`
+	Estimate *PerfEstimate `json:"estimate,omitempty"`
+}
+
+// Total sums the stats of every kind of I/O.
+func (r WorkloadReport) Total() OpStats {
+	total := OpStats{Op: "total"}
+	for _, op := range r.Ops {
+		total.Count += op.Count
+		total.Bytes += op.Bytes
+		total.ChunkReads += op.ChunkReads
+		total.ChunkWrites += op.ChunkWrites
+	}
+	return total
+}
+
+// opTrace records the chunk I/Os a single logical I/O caused on every disk.
+type opTrace struct {
+	reads, writes []int64
+}
+
+// RunWorkload fills the span of the array built by controller over disks, then replays the
+// workload against it and counts the chunk I/Os every logical I/O causes on the disks. Reads are
+// checked against the data written. With an enabled model it also estimates the IOPS and
+// bandwidth of the array.
+//
+// I/Os are issued one at a time so that each one's chunk I/Os are counted exactly. The queue
+// depth only shapes the estimate: up to that many I/Os are in flight, each first reading what it
+// needs and then writing, while every disk serves its chunk I/Os in arrival order.
+func RunWorkload(controller RAIDController, disks []*Disk, stripeSz int, w Workload, model DiskModel) (WorkloadReport, error) {
+	if err := w.validate(); err != nil {
+		return WorkloadReport{}, err
+	}
+	if capacity := controller.Capacity(); capacity > 0 && w.Span > capacity {
+		return WorkloadReport{}, fmt.Errorf("workload span %d exceeds the usable capacity of %d bytes", w.Span, capacity)
+	}
+
+	rng := rand.New(rand.NewSource(w.Seed))
+	expected := make([]byte, w.Span)
+	rng.Read(expected)
+	if err := controller.Write(expected, 0); err != nil {
+		return WorkloadReport{}, fmt.Errorf("failed to fill the workload span: %w", err)
+	}
+
+	report := WorkloadReport{Workload: w, Model: model, Ops: []OpStats{{Op: "read"}, {Op: "write"}}}
+	traces := make([]opTrace, 0, w.Ops)
+	before := diskIOStats(disks)
+	slots := w.Span / w.IOSize
+	for i := 0; i < w.Ops; i++ {
+		offset := (i % slots) * w.IOSize
+		if w.Pattern == WorkloadRandom {
+			offset = rng.Intn(slots) * w.IOSize
+		}
+		stats := &report.Ops[1]
+		if rng.Float64() < w.ReadRatio {
+			stats = &report.Ops[0]
+			data, err := controller.Read(offset, w.IOSize)
+			if err != nil {
+				return WorkloadReport{}, fmt.Errorf("read %d of %d bytes at offset %d failed: %w", i, w.IOSize, offset, err)
+			}
+			if !bytes.Equal(data, expected[offset:offset+w.IOSize]) {
+				return WorkloadReport{}, fmt.Errorf("read %d at offset %d returned data that was never written", i, offset)
+			}
+		} else {
+			data := make([]byte, w.IOSize)
+			rng.Read(data)
+			if err := controller.Write(data, offset); err != nil {
+				return WorkloadReport{}, fmt.Errorf("write %d of %d bytes at offset %d failed: %w", i, w.IOSize, offset, err)
+			}
+			copy(expected[offset:], data)
+		}
+
+		after := diskIOStats(disks)
+		trace := opTrace{reads: make([]int64, len(disks)), writes: make([]int64, len(disks))}
+		for d := range disks {
+			trace.reads[d] = after[d].Reads - before[d].Reads
+			trace.writes[d] = after[d].Writes - before[d].Writes
+			stats.ChunkReads += trace.reads[d]
+			stats.ChunkWrites += trace.writes[d]
+		}
+		stats.Count++
+		stats.Bytes += int64(w.IOSize)
+		traces = append(traces, trace)
+		before = after
+	}
+
+	report.Disks = make([]DiskLoad, len(disks))
+	for d, disk := range disks {
+		report.Disks[d].Disk = disk.ID
+		for _, trace := range traces {
+			report.Disks[d].Reads += trace.reads[d]
+			report.Disks[d].Writes += trace.writes[d]
+		}
+	}
+	if model.enabled() {
+		report.Estimate = estimatePerformance(traces, report.Disks, w, model.serviceTime(stripeSz))
+	}
+	return report, nil
+}
+
+// validate checks the workload's parameters.
+func (w Workload) validate() error {
+	switch {
+	case !slices.Contains(WorkloadPatterns(), w.Pattern):
+		return fmt.Errorf("unsupported workload pattern: %s (supported: %v)", w.Pattern, WorkloadPatterns())
+	case w.ReadRatio < 0 || w.ReadRatio > 1:
+		return fmt.Errorf("read ratio must be between 0 and 1. Provided: %g", w.ReadRatio)
+	case w.IOSize <= 0:
+		return fmt.Errorf("I/O size must be greater than 0. Provided: %d", w.IOSize)
+	case w.QueueDepth <= 0:
+		return fmt.Errorf("queue depth must be greater than 0. Provided: %d", w.QueueDepth)
+	case w.Ops < 0:
+		return fmt.Errorf("number of I/Os must be non-negative. Provided: %d", w.Ops)
+	case w.Span < w.IOSize:
+		return fmt.Errorf("workload span %d is smaller than the I/O size %d", w.Span, w.IOSize)
+	}
+	return nil
+}
+
+// diskIOStats snapshots the I/O counters of every disk.
+func diskIOStats(disks []*Disk) []DiskIOStats {
+	stats := make([]DiskIOStats, len(disks))
+	for i, disk := range disks {
+		stats[i] = disk.IOStats()
+	}
+	return stats
+}
+
+// estimatePerformance replays the traced I/Os on modelled disks that take service to serve every
+// chunk I/O, keeping up to the workload's queue depth of I/Os in flight. It fills in the busy
+// time and utilization of every disk.
+func estimatePerformance(traces []opTrace, loads []DiskLoad, w Workload, service time.Duration) *PerfEstimate {
+	slots := make([]time.Duration, w.QueueDepth) // when each in-flight slot frees up
+	diskFree := make([]time.Duration, len(loads))
+	var elapsed, totalLatency time.Duration
+
+	// serve queues count chunk I/Os on disk d no earlier than start and returns when they complete.
+	serve := func(d int, count int64, start time.Duration) time.Duration {
+		diskFree[d] = max(diskFree[d], start) + time.Duration(count)*service
+		return diskFree[d]
+	}
+	for _, trace := range traces {
+		slot := slices.Index(slots, slices.Min(slots))
+		start := slots[slot]
+		readsDone := start
+		for d, count := range trace.reads {
+			if count > 0 {
+				readsDone = max(readsDone, serve(d, count, start))
+			}
+		}
+		done := readsDone
+		for d, count := range trace.writes {
+			if count > 0 {
+				done = max(done, serve(d, count, readsDone))
+			}
+		}
+		slots[slot] = done
+		elapsed = max(elapsed, done)
+		totalLatency += done - start
+	}
+
+	estimate := &PerfEstimate{Elapsed: elapsed}
+	for d := range loads {
+		loads[d].Busy = time.Duration(loads[d].Reads+loads[d].Writes) * service
+	}
+	if elapsed > 0 {
+		seconds := elapsed.Seconds()
+		estimate.IOPS = float64(len(traces)) / seconds
+		estimate.Bandwidth = float64(len(traces)*w.IOSize) / seconds
+		for d := range loads {
+			loads[d].Utilization = loads[d].Busy.Seconds() / seconds
+		}
+	}
+	if len(traces) > 0 {
+		estimate.MeanLatency = totalLatency / time.Duration(len(traces))
+	}
+	return estimate
+}
+
+// Benchmark builds an in-memory array of raidType over diskCount disks of diskSize bytes (0 to let
+// them grow on demand), fails the given disks to measure it degraded, and runs the workload on it.
+// A zero span selects the array's usable capacity, or room for every I/O of the workload when
+// the disks grow on demand.
+func Benchmark(raidType RaidType, diskCount, stripeSz, diskSize int, opts ControllerOptions, failed []int, w Workload, model DiskModel) (WorkloadReport, error) {
+	chunkLimit, err := diskChunks(diskSize, stripeSz)
+	if err != nil {
+		return WorkloadReport{}, err
+	}
+	disks := newSizedDisks(diskCount, stripeSz, chunkLimit)
+	controller, err := NewControllerWithOptions(raidType, disks, stripeSz, opts)
+	if err != nil {
+		return WorkloadReport{}, err
+	}
+	if w.Span == 0 {
+		w.Span = controller.Capacity()
+		if w.Span == 0 {
+			w.Span = max(w.Ops, 1) * w.IOSize
+		}
+	}
+	for _, d := range failed {
+		if err := controller.ClearDisk(d); err != nil {
+			return WorkloadReport{}, err
+		}
+	}
+	return RunWorkload(controller, disks, stripeSz, w, model)
+}
@@ -0,0 +1,125 @@
+package raid
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisk_IOStatsCountChunkIO(t *testing.T) {
+	disk := newDisks(1, 2)[0]
+	assert.NoError(t, disk.WriteChunk(0, []byte("AB")))
+	_, err := disk.ReadChunk(0)
+	assert.NoError(t, err)
+	_, err = disk.readChunkOrZeros(3)
+	assert.NoError(t, err)
+
+	assert.NoError(t, disk.InjectFaults(Faults{ReadErrors: true}))
+	_, err = disk.ReadChunk(0)
+	assert.Error(t, err)
+	assert.Equal(t, DiskIOStats{Reads: 2, Writes: 1}, disk.IOStats(), "rejected reads never reach the device")
+}
+
+func TestBenchmark_WriteAmplification(t *testing.T) {
+	w := Workload{Pattern: WorkloadRandom, IOSize: 4, QueueDepth: 1, Ops: 200, Seed: 7}
+
+	// A small RAID5 write reads its whole stripe back, re-encodes it and writes every shard
+	report, err := Benchmark(RaidTypeRaid5, 4, 4, 64, ControllerOptions{}, nil, w, DiskModel{})
+	assert.NoError(t, err)
+	writes := report.Ops[1]
+	assert.Equal(t, 200, writes.Count)
+	assert.Equal(t, int64(800), writes.Bytes)
+	assert.Equal(t, 4.0, writes.ReadsPerOp())
+	assert.Equal(t, 4.0, writes.WritesPerOp())
+	assert.Nil(t, report.Estimate)
+
+	// Mirrors update the chunk on every copy
+	report, err = Benchmark(RaidTypeRaid1, 3, 4, 64, ControllerOptions{}, nil, w, DiskModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, 3.0, report.Ops[1].ReadsPerOp())
+	assert.Equal(t, 3.0, report.Ops[1].WritesPerOp())
+
+	// Full-stripe writes need no reads at all
+	w.Pattern, w.IOSize = WorkloadSequential, 12
+	report, err = Benchmark(RaidTypeRaid5, 4, 4, 64, ControllerOptions{}, nil, w, DiskModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.0, report.Ops[1].ReadsPerOp())
+	assert.Equal(t, 4.0, report.Ops[1].WritesPerOp())
+}
+
+func TestBenchmark_DegradedReads(t *testing.T) {
+	w := Workload{Pattern: WorkloadSequential, ReadRatio: 1, IOSize: 4, QueueDepth: 1, Ops: 30}
+	// Parity arrays load the whole stripe of every chunk read
+	report, err := Benchmark(RaidTypeRaid5, 4, 4, 0, ControllerOptions{}, nil, w, DiskModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, 4.0, report.Ops[0].ReadsPerOp())
+	assert.Zero(t, report.Ops[1].Count)
+
+	// Degraded, the chunks of the failed disk are reconstructed from the three others
+	report, err = Benchmark(RaidTypeRaid5, 4, 4, 0, ControllerOptions{}, []int{0}, w, DiskModel{})
+	assert.NoError(t, err)
+	assert.Zero(t, report.Disks[0].Reads)
+	assert.Equal(t, 3.0, report.Ops[0].ReadsPerOp())
+	assert.Equal(t, report.Total().ChunkReads, report.Disks[1].Reads+report.Disks[2].Reads+report.Disks[3].Reads)
+
+	// RAID0 only reads the disk holding the chunk
+	report, err = Benchmark(RaidTypeRaid0, 4, 4, 0, ControllerOptions{}, nil, w, DiskModel{})
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, report.Ops[0].ReadsPerOp())
+}
+
+func TestBenchmark_PerformanceModel(t *testing.T) {
+	model := DiskModel{Latency: time.Millisecond}
+	w := Workload{Pattern: WorkloadSequential, ReadRatio: 1, IOSize: 4, QueueDepth: 1, Ops: 100}
+
+	// One read at a time keeps a single disk busy
+	report, err := Benchmark(RaidTypeRaid0, 4, 4, 0, ControllerOptions{}, nil, w, model)
+	assert.NoError(t, err)
+	if assert.NotNil(t, report.Estimate) {
+		assert.Equal(t, 100*time.Millisecond, report.Estimate.Elapsed)
+		assert.InDelta(t, 1000, report.Estimate.IOPS, 1e-6)
+		assert.Equal(t, time.Millisecond, report.Estimate.MeanLatency)
+		assert.InDelta(t, 0.25, report.Disks[0].Utilization, 1e-9)
+	}
+
+	// A deeper queue overlaps reads of different disks
+	w.QueueDepth = 4
+	report, err = Benchmark(RaidTypeRaid0, 4, 4, 0, ControllerOptions{}, nil, w, model)
+	assert.NoError(t, err)
+	if assert.NotNil(t, report.Estimate) {
+		assert.Equal(t, 25*time.Millisecond, report.Estimate.Elapsed)
+		assert.InDelta(t, 4000, report.Estimate.IOPS, 1e-6)
+		assert.InDelta(t, 1.0, report.Disks[0].Utilization, 1e-9)
+	}
+
+	// A small RAID5 write waits for its reads before writing
+	w = Workload{Pattern: WorkloadRandom, IOSize: 4, QueueDepth: 1, Ops: 10}
+	report, err = Benchmark(RaidTypeRaid5, 4, 4, 64, ControllerOptions{}, nil, w, DiskModel{Throughput: 4000})
+	assert.NoError(t, err)
+	if assert.NotNil(t, report.Estimate) {
+		assert.Equal(t, 2*time.Millisecond, report.Estimate.MeanLatency)
+	}
+}
+
+func TestBenchmark_InvalidWorkload(t *testing.T) {
+	valid := Workload{Pattern: WorkloadRandom, IOSize: 4, QueueDepth: 1, Ops: 1}
+	for _, change := range []func(w *Workload){
+		func(w *Workload) { w.Pattern = "zigzag" },
+		func(w *Workload) { w.ReadRatio = 1.5 },
+		func(w *Workload) { w.IOSize = 0 },
+		func(w *Workload) { w.QueueDepth = 0 },
+		func(w *Workload) { w.Span = 2 },
+		func(w *Workload) { w.Span = 1024 }, // past the capacity of the array
+	} {
+		w := valid
+		change(&w)
+		_, err := Benchmark(RaidTypeRaid5, 3, 4, 64, ControllerOptions{}, nil, w, DiskModel{})
+		assert.Error(t, err)
+	}
+
+	// RAID0 cannot fill its span once a disk is gone
+	valid.Ops = 8
+	_, err := Benchmark(RaidTypeRaid0, 2, 4, 0, ControllerOptions{}, []int{1}, valid, DiskModel{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,417 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+
+	"github.com/Anthya1104/raid-simulator/internal/nbd"
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/sirupsen/logrus"
+)
+
+// withArray opens the array persisted in dir, runs fn on it and saves the resulting state.
+func withArray(dir string, fn func(array *raid.Array) error) error {
+	array, err := raid.OpenArray(dir)
+	if err != nil {
+		return err
+	}
+	fnErr := fn(array)
+	if err := array.Close(); err != nil && fnErr == nil {
+		return fmt.Errorf("failed to save array state: %w", err)
+	}
+	return fnErr
+}
+
+// fixedDiskCount returns diskCount, or the disks raidType is defined over when diskCount is 0:
+// k+m for an "ec:k+m" code, the plain disks of a composite topology.
+func fixedDiskCount(raidType raid.RaidType, diskCount int) (int, error) {
+	if diskCount > 0 {
+		return diskCount, nil
+	}
+	fixed, err := raid.FixedDiskCount(raidType)
+	if err != nil || fixed == 0 {
+		return diskCount, err
+	}
+	return fixed, nil
+}
+
+// LoadTopology reads a composite topology from a YAML file and returns the RAID type it builds.
+func LoadTopology(path string) (raid.RaidType, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read topology: %w", err)
+	}
+	topology, err := raid.ParseTopologyYAML(data)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return topology.RaidType(), nil
+}
+
+// CreateArray creates a new persisted array in dir over disks of diskSize bytes (0 to let them grow on demand),
+// with the level-specific settings in opts and the given number of hot spares. A zero diskCount selects the
+// disks an "ec:k+m" code or a composite topology is defined over.
+func CreateArray(dir string, raidType raid.RaidType, diskCount, stripeSz, diskSize int, opts raid.ControllerOptions, spares int) error {
+	diskCount, err := fixedDiskCount(raidType, diskCount)
+	if err != nil {
+		return err
+	}
+	array, err := raid.CreateArray(dir, raidType, diskCount, stripeSz, diskSize, opts)
+	if err != nil {
+		return err
+	}
+	for range spares {
+		if err := array.AddSpare(); err != nil {
+			array.Close()
+			return err
+		}
+	}
+	logrus.Infof("[%s] Created array with %d disks, %d hot spares and stripe size %d in %s, usable capacity %d bytes", raidType, diskCount, spares, stripeSz, dir, array.Capacity())
+	return array.Close()
+}
+
+// WriteArray writes data to the array in dir at the given logical offset.
+func WriteArray(dir string, data []byte, offset int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.Write(data, offset); err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+		logrus.Infof("Wrote %d bytes at offset %d", len(data), offset)
+		return nil
+	})
+}
+
+// CrashWriteArray writes data like WriteArray, but simulates a crash once crashAfter shards of
+// a stripe have reached their disks. The interrupted write is recovered when the array is next opened.
+func CrashWriteArray(dir string, data []byte, offset, crashAfter int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.CrashAfter(crashAfter); err != nil {
+			return err
+		}
+		if err := array.Write(data, offset); err != nil {
+			return fmt.Errorf("write failed: %w", err)
+		}
+		logrus.Warnf("Wrote %d bytes at offset %d without reaching the crash point", len(data), offset)
+		return nil
+	})
+}
+
+// ReadArray reads length bytes from the array in dir starting at start.
+func ReadArray(dir string, start, length int) ([]byte, error) {
+	var output []byte
+	err := withArray(dir, func(array *raid.Array) error {
+		data, err := array.Read(start, length)
+		if err != nil {
+			return fmt.Errorf("read failed: %w", err)
+		}
+		output = data
+		return nil
+	})
+	return output, err
+}
+
+// DiscardArray discards length bytes of the array in dir at the given logical offset.
+func DiscardArray(dir string, offset, length int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.Discard(offset, length); err != nil {
+			return fmt.Errorf("discard failed: %w", err)
+		}
+		logrus.Infof("Discarded %d bytes at offset %d", length, offset)
+		return nil
+	})
+}
+
+// FailDisk simulates a failure of a disk in the array in dir.
+func FailDisk(dir string, disk int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.ClearDisk(disk); err != nil {
+			return fmt.Errorf("fail-disk failed: %w", err)
+		}
+		array.Wait() // for a hot spare to take over
+		logrus.Infof("Disk %d failed, array is now %s", disk, array.Status().State)
+		return nil
+	})
+}
+
+// RemoveDisk pulls a failed disk out of the array in dir, deleting its image.
+func RemoveDisk(dir string, disk int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.RemoveDisk(disk); err != nil {
+			return fmt.Errorf("remove-disk failed: %w", err)
+		}
+		logrus.Infof("Disk %d removed, run replace-disk or add-spare to fill its slot", disk)
+		return nil
+	})
+}
+
+// AddSpare adds a hot spare to the array in dir. It replaces a failed disk straight away, if there is one.
+func AddSpare(dir string) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.AddSpare(); err != nil {
+			return fmt.Errorf("add-spare failed: %w", err)
+		}
+		array.Wait()
+		logrus.Infof("Array has %d hot spares standing by and is %s", len(array.Spares()), array.Status().State)
+		return nil
+	})
+}
+
+// ReplaceDisk swaps a disk in the array in dir for a blank replacement.
+func ReplaceDisk(dir string, disk int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		if err := array.ReplaceDisk(disk); err != nil {
+			return fmt.Errorf("replace-disk failed: %w", err)
+		}
+		logrus.Infof("Disk %d replaced, run rebuild to regenerate its contents", disk)
+		return nil
+	})
+}
+
+// RebuildDisk regenerates a replaced disk in the array in dir, logging progress as it goes.
+func RebuildDisk(dir string, disk int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		lastPercent := -1
+		err := array.Rebuild(disk, func(done, total int) {
+			percent := done * 100 / total
+			if percent/10 != lastPercent/10 || done == total {
+				logrus.Infof("Rebuilding disk %d: %d/%d (%d%%)", disk, done, total, percent)
+			}
+			lastPercent = percent
+		})
+		if err != nil {
+			return fmt.Errorf("rebuild failed: %w", err)
+		}
+		logrus.Infof("Disk %d rebuilt, array is now %s", disk, array.Status().State)
+		return nil
+	})
+}
+
+// AssembleArray puts the array back together in dir from its member images (every *.img file in
+// dir when images is empty), placing each in the slot its member superblock names.
+func AssembleArray(dir string, images []string, force bool) (raid.AssembleReport, error) {
+	array, report, err := raid.AssembleArray(dir, images, force)
+	if err != nil {
+		return report, err
+	}
+	state := array.Status().State
+	if err := array.Close(); err != nil {
+		return report, fmt.Errorf("failed to save array state: %w", err)
+	}
+	logrus.Infof("Assembled %s array %s, array is %s", report.Type, report.UUID, state)
+	return report, nil
+}
+
+// ScrubArray verifies every stripe of the array in dir against its parity and repairs corrupt chunks.
+func ScrubArray(dir string) (raid.ScrubReport, error) {
+	var report raid.ScrubReport
+	err := withArray(dir, func(array *raid.Array) error {
+		var err error
+		report, err = array.Scrub(nil)
+		if err != nil {
+			return fmt.Errorf("scrub failed: %w", err)
+		}
+		return nil
+	})
+	return report, err
+}
+
+// CorruptChunk silently flips length bytes of a chunk on a disk of the array in dir.
+func CorruptChunk(dir string, disk, chunk, offset, length int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		target, err := array.Disk(disk)
+		if err != nil {
+			return err
+		}
+		if err := target.CorruptChunk(chunk, offset, length); err != nil {
+			return fmt.Errorf("inject failed: %w", err)
+		}
+		logrus.Infof("Corrupted %d bytes at offset %d of chunk %d on disk %d", length, offset, chunk, disk)
+		return nil
+	})
+}
+
+// UpdateFaults changes the faults injected into a disk of the array in dir.
+// The faults are kept in the superblock, so they apply to every later command.
+func UpdateFaults(dir string, disk int, update func(faults *raid.Faults)) error {
+	return withArray(dir, func(array *raid.Array) error {
+		target, err := array.Disk(disk)
+		if err != nil {
+			return err
+		}
+		faults := target.Faults()
+		update(&faults)
+		if err := target.InjectFaults(faults); err != nil {
+			return fmt.Errorf("inject failed: %w", err)
+		}
+		logrus.Infof("Disk %d faults: %+v", disk, target.Faults())
+		return nil
+	})
+}
+
+// ReshapeArray migrates the array in dir to the level, geometry and settings of changes; every zero
+// field of changes keeps the current value (level settings such as the parity layout, group count,
+// mirror copies and read policy are only kept when the level is). When a reshape is already in
+// progress it resumes that one instead, provided changes is zero. With steps > 0 the copy stops
+// after that many blocks, leaving the reshape to be resumed later.
+// Migrating to an "ec:k+m" code or a composite topology without a disk count uses the disks it is
+// defined over.
+func ReshapeArray(dir string, changes raid.ReshapeTarget, steps int) error {
+	return withArray(dir, func(array *raid.Array) error {
+		status := array.Status()
+		if status.Reshape == nil {
+			target := status.ReshapeTarget()
+			if changes.Type != "" && changes.Type != status.Type {
+				target = raid.ReshapeTarget{Type: changes.Type, DiskCount: target.DiskCount, StripeSz: target.StripeSz}
+				if fixed, _ := raid.FixedDiskCount(changes.Type); fixed > 0 && changes.DiskCount == 0 {
+					target.DiskCount = 0 // erasure codes and topologies fix their own disk count
+				}
+			}
+			if changes.Layout != "" {
+				target.Layout = changes.Layout
+			}
+			if changes.Groups > 0 {
+				target.Groups = changes.Groups
+			}
+			if changes.Copies > 0 {
+				target.Copies = changes.Copies
+			}
+			if changes.MirrorLayout != "" {
+				target.MirrorLayout = changes.MirrorLayout
+			}
+			if changes.ReadPolicy != "" {
+				target.ReadPolicy = changes.ReadPolicy
+			}
+			if changes.DiskCount > 0 {
+				target.DiskCount = changes.DiskCount
+			}
+			var err error
+			if target.DiskCount, err = fixedDiskCount(target.Type, target.DiskCount); err != nil {
+				return fmt.Errorf("reshape failed: %w", err)
+			}
+			if changes.StripeSz > 0 {
+				target.StripeSz = changes.StripeSz
+			}
+			if err := array.StartReshape(target); err != nil {
+				return fmt.Errorf("reshape failed: %w", err)
+			}
+		} else if changes != (raid.ReshapeTarget{}) {
+			return fmt.Errorf("a reshape into %s is already in progress, run reshape without a target to resume it", status.Reshape.Target.Type)
+		}
+
+		lastPercent := -1
+		done, err := array.ContinueReshape(steps, func(copied, total int) {
+			percent := 100
+			if total > 0 {
+				percent = copied * 100 / total
+			}
+			if percent/10 != lastPercent/10 {
+				logrus.Infof("Reshaping: %d/%d bytes (%d%%)", copied, total, percent)
+			}
+			lastPercent = percent
+		})
+		if err != nil {
+			return fmt.Errorf("reshape failed: %w", err)
+		}
+		if !done {
+			reshape := array.Status().Reshape
+			logrus.Infof("Reshape paused at %d/%d bytes, run reshape again to resume", reshape.Checkpoint, reshape.Total)
+		}
+		return nil
+	})
+}
+
+// GetArrayStatus reports the status of the array in dir.
+func GetArrayStatus(dir string) (raid.ArrayStatus, error) {
+	var status raid.ArrayStatus
+	err := withArray(dir, func(array *raid.Array) error {
+		status = array.Status()
+		return nil
+	})
+	return status, err
+}
+
+// GetHealthReport reports the health of the array in dir, with the parity placement of its first
+// stripes (one full rotation when stripes <= 0).
+func GetHealthReport(dir string, stripes int) (raid.HealthReport, error) {
+	var report raid.HealthReport
+	err := withArray(dir, func(array *raid.Array) error {
+		report = array.HealthReport(stripes)
+		return nil
+	})
+	return report, err
+}
+
+// GetStripeMap maps count stripes of the array in dir starting at first, one per disk (a full
+// rotation of the parity layout) when count <= 0.
+func GetStripeMap(dir string, first, count int) ([]raid.MapStripe, error) {
+	var stripes []raid.MapStripe
+	err := withArray(dir, func(array *raid.Array) error {
+		if count <= 0 {
+			count = len(array.Status().Disks)
+		}
+		var err error
+		stripes, err = array.StripeMap(first, count)
+		return err
+	})
+	return stripes, err
+}
+
+// BenchmarkArray runs workload on a fresh in-memory array of raidType, with the given disks failed
+// first. A zero diskCount selects the disks an "ec:k+m" code or a composite topology is defined over.
+func BenchmarkArray(raidType raid.RaidType, diskCount, stripeSz, diskSize int, opts raid.ControllerOptions, failed []int, workload raid.Workload, model raid.DiskModel) (raid.WorkloadReport, error) {
+	diskCount, err := fixedDiskCount(raidType, diskCount)
+	if err != nil {
+		return raid.WorkloadReport{}, err
+	}
+	return raid.Benchmark(raidType, diskCount, stripeSz, diskSize, opts, failed, workload, model)
+}
+
+// EstimateReliability estimates the MTTDL of an array of raidType and its probability of losing
+// data within the model's mission time. A zero diskCount selects the disks an "ec:k+m" code or a
+// composite topology is defined over. The failures and rebuilds it simulates are not logged.
+func EstimateReliability(raidType raid.RaidType, diskCount int, opts raid.ControllerOptions, model raid.ReliabilityModel) (raid.ReliabilityReport, error) {
+	diskCount, err := fixedDiskCount(raidType, diskCount)
+	if err != nil {
+		return raid.ReliabilityReport{}, err
+	}
+	return raid.Reliability(raidType, diskCount, opts, model)
+}
+
+// ServeArray exports the array in dir over NBD on listener until ctx is done, then saves it.
+// The export spans the array's capacity, or size bytes if given; arrays whose disks grow on
+// demand have no fixed capacity and need a size.
+func ServeArray(ctx context.Context, dir string, listener net.Listener, name string, size int64, readOnly bool) error {
+	defer listener.Close()
+	return withArray(dir, func(array *raid.Array) error {
+		capacity := int64(array.Capacity())
+		switch {
+		case size == 0 && array.DiskSize() == 0:
+			return fmt.Errorf("the disks of the array grow on demand, so the export needs an explicit size")
+		case size == 0:
+			size = capacity
+		case array.DiskSize() > 0 && size > capacity:
+			return fmt.Errorf("export size %d exceeds the array capacity of %d bytes", size, capacity)
+		}
+		volume, err := raid.NewVolume(array, size)
+		if err != nil {
+			return err
+		}
+		server, err := nbd.NewServer(name, volume, readOnly)
+		if err != nil {
+			return err
+		}
+		stop := context.AfterFunc(ctx, func() { _ = server.Close() })
+		defer stop()
+
+		logrus.Infof("Serving export %q of %d bytes over NBD on %s %s", name, size, listener.Addr().Network(), listener.Addr())
+		if err := server.Serve(listener); !errors.Is(err, nbd.ErrServerClosed) {
+			_ = server.Close()
+			return fmt.Errorf("serve failed: %w", err)
+		}
+		logrus.Infof("NBD server stopped, saving the array")
+		return nil
+	})
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Anthya1104/raid-simulator/internal/nbd"
+	"github.com/Anthya1104/raid-simulator/internal/raid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestArrayLifecycle(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "array")
+	input := []byte("MySecretDataOnRAID5")
+
+	assert.NoError(t, CreateArray(dir, raid.RaidTypeRaid5, 4, 4, 0, raid.ControllerOptions{}, 0))
+	assert.NoError(t, WriteArray(dir, input, 0))
+
+	assert.NoError(t, FailDisk(dir, 1))
+	status, err := GetArrayStatus(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.ArrayStateDegraded, status.State)
+
+	output, err := ReadArray(dir, 0, len(input))
+	assert.NoError(t, err)
+	assert.Equal(t, input, output)
+
+	assert.NoError(t, ReplaceDisk(dir, 1))
+	assert.NoError(t, RebuildDisk(dir, 1))
+	status, err = GetArrayStatus(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.ArrayStateOptimal, status.State)
+
+	output, err = ReadArray(dir, 6, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, input[6:10], output)
+
+	report, err := GetHealthReport(dir, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.ArrayStateOptimal, report.State)
+	assert.Len(t, report.Parity, len(report.Disks))
+}
+
+func TestOpenMissingArray(t *testing.T) {
+	_, err := ReadArray(t.TempDir(), 0, 1)
+	assert.Error(t, err)
+}
+
+func TestErasureCodedArrayDerivesDiskCount(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "array")
+	assert.NoError(t, CreateArray(dir, "ec:4+2", 0, 4, 0, raid.ControllerOptions{}, 0))
+	status, err := GetArrayStatus(dir)
+	assert.NoError(t, err)
+	assert.Len(t, status.Disks, 6)
+	assert.Equal(t, 2, status.FaultTolerance)
+
+	assert.NoError(t, WriteArray(dir, []byte("wide stripes"), 0))
+	assert.NoError(t, ReshapeArray(dir, raid.ReshapeTarget{Type: "ec:3+3"}, 0))
+	status, err = GetArrayStatus(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.RaidType("ec:3+3"), status.Type)
+	assert.Len(t, status.Disks, 6)
+	assert.Equal(t, 3, status.FaultTolerance)
+
+	output, err := ReadArray(dir, 0, 12)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("wide stripes"), output)
+}
+
+func TestCompositeArrayFromTopologyFile(t *testing.T) {
+	topologyFile := filepath.Join(t.TempDir(), "topology.yaml")
+	assert.NoError(t, os.WriteFile(topologyFile, []byte("type: raid0\nmembers:\n  - type: raid1\n    disks: 2\n    count: 2\n"), 0644))
+	raidType, err := LoadTopology(topologyFile)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.RaidType("raid0(2 x raid1(2))"), raidType)
+
+	dir := filepath.Join(t.TempDir(), "array")
+	assert.NoError(t, CreateArray(dir, raidType, 0, 4, 0, raid.ControllerOptions{}, 0))
+	assert.NoError(t, WriteArray(dir, []byte("stripe of mirrors"), 0))
+	assert.NoError(t, FailDisk(dir, 1))
+
+	// Reshaping into another topology derives its disk count too
+	assert.Error(t, ReshapeArray(dir, raid.ReshapeTarget{Type: "raid1(2 x raid0(3))"}, 0), "the array must be healthy")
+	assert.NoError(t, ReplaceDisk(dir, 1))
+	assert.NoError(t, RebuildDisk(dir, 1))
+	assert.NoError(t, ReshapeArray(dir, raid.ReshapeTarget{Type: "raid1(2 x raid0(3))"}, 0))
+	status, err := GetArrayStatus(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, raid.RaidType("raid1(2 x raid0(3))"), status.Type)
+	assert.Len(t, status.Disks, 6)
+
+	output, err := ReadArray(dir, 0, 17)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("stripe of mirrors"), output)
+
+	_, err = LoadTopology(filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestServeArrayPersistsWrites(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "array")
+	assert.NoError(t, CreateArray(dir, raid.RaidTypeRaid6, 5, 4, 256, raid.ControllerOptions{}, 0))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- ServeArray(ctx, dir, listener, "raid", 0, false) }()
+
+	client, err := nbd.Dial("tcp", listener.Addr().String(), "raid")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3*256), client.Size(), "the export spans the capacity")
+	_, err = client.WriteAt([]byte("written over NBD"), 500)
+	assert.NoError(t, err)
+	assert.NoError(t, client.Flush())
+	assert.NoError(t, client.Close())
+	cancel()
+	assert.NoError(t, <-served)
+
+	output, err := ReadArray(dir, 500, 16)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("written over NBD"), output)
+
+	// Disks growing on demand give no size to export
+	growing := filepath.Join(t.TempDir(), "array")
+	assert.NoError(t, CreateArray(growing, raid.RaidTypeRaid1, 2, 4, 0, raid.ControllerOptions{}, 0))
+	listener, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	assert.Error(t, ServeArray(context.Background(), growing, listener, "raid", 0, false))
+}